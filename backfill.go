@@ -0,0 +1,130 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// BackfillProgress reports how far along a backfill is. Fraction is
+// estimated from the ROWTIME of the rows seen so far, when the stream's
+// rows carry it.
+type BackfillProgress struct {
+	Rows        int64
+	LastRowTime time.Time
+	Fraction    float64
+	Done        bool
+}
+
+// BackfillOptions configures Backfill.
+type BackfillOptions struct {
+	// Props are sent as the query's streamsProperties, on top of
+	// auto.offset.reset=earliest.
+	Props map[string]string
+
+	// IdleTimeout is how long the stream must stay quiet, once the end
+	// of the range is in the past, for the backfill to be considered
+	// complete. It defaults to ten seconds.
+	IdleTimeout time.Duration
+
+	// OnProgress, if set, is called every ProgressInterval (default one
+	// second) while rows are arriving, and once more when done.
+	OnProgress       func(BackfillProgress)
+	ProgressInterval time.Duration
+}
+
+// Backfill reprocesses the rows of a stream whose ROWTIME falls in
+// [from, to). It issues a push query bounded by ROWTIME predicates,
+// reading the stream from the earliest offset, and passes every row to
+// the handler.
+//
+// Push queries never end on their own, so completion is detected: once
+// the end of the range has passed and no row has arrived for the idle
+// timeout, the query is closed and Backfill returns.
+func (cc *Client) Backfill(ctx context.Context, stream string, from, to time.Time, handler func(Row) error, opts BackfillOptions) (BackfillProgress, error) {
+	idle := opts.IdleTimeout
+	if idle <= 0 {
+		idle = 10 * time.Second
+	}
+	interval := opts.ProgressInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	props := map[string]string{"auto.offset.reset": "earliest"}
+	for name, value := range opts.Props {
+		props[name] = value
+	}
+
+	var progress BackfillProgress
+	query := fmt.Sprintf(
+		"SELECT * FROM %s WHERE ROWTIME >= %d AND ROWTIME < %d EMIT CHANGES;",
+		cc.ident(stream), ksql.Millis(from), ksql.Millis(to),
+	)
+	rows, err := cc.Query(ctx, query, props)
+	if err != nil {
+		return progress, fmt.Errorf("backfilling %s: %w", stream, err)
+	}
+	rs := newRowStream(rows)
+	defer rs.Close()
+
+	report := func() {
+		if opts.OnProgress != nil {
+			opts.OnProgress(progress)
+		}
+	}
+	span := to.Sub(from)
+	lastReport := cc.clock.Now()
+	timer := cc.clock.NewTimer(idle)
+	defer timer.Stop()
+	for {
+		select {
+		case row, ok := <-rs.C:
+			if !ok {
+				if err := rs.Err(); err != nil {
+					return progress, fmt.Errorf("backfilling %s: %w", stream, err)
+				}
+				progress.Done = true
+				report()
+				return progress, nil
+			}
+			if err := handler(row); err != nil {
+				return progress, err
+			}
+			progress.Rows++
+			if rowtime, ok := rowTime(row); ok {
+				ts := fromEpochMillis(rowtime)
+				if ts.After(progress.LastRowTime) {
+					progress.LastRowTime = ts
+					if span > 0 {
+						progress.Fraction = float64(ts.Sub(from)) / float64(span)
+					}
+				}
+			}
+			if since(cc.clock, lastReport) >= interval {
+				lastReport = cc.clock.Now()
+				report()
+			}
+			if !timer.Stop() {
+				<-timer.C()
+			}
+			timer.Reset(idle)
+		case <-timer.C():
+			if cc.clock.Now().Before(to) {
+				timer.Reset(idle)
+				continue
+			}
+			progress.Done = true
+			progress.Fraction = 1
+			report()
+			return progress, nil
+		}
+	}
+}
+
+// fromEpochMillis converts the epoch milliseconds used by ROWTIME and
+// other KSQL timestamps into a time.
+func fromEpochMillis(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
@@ -0,0 +1,190 @@
+package ksqldb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// DefaultBatchMaxBytes is the byte budget of batches when
+// BatchOptions.MaxBytes is unset.
+const DefaultBatchMaxBytes = 1 << 20
+
+// FlushReason is why a batch was handed over.
+type FlushReason int
+
+const (
+	// FlushBytes: the next row would have taken the batch over its byte
+	// budget.
+	FlushBytes FlushReason = iota
+	// FlushRows: the batch reached its maximum number of rows.
+	FlushRows
+	// FlushInterval: the batch's time limit passed.
+	FlushInterval
+	// FlushEnd: the rows ended, or the read was canceled.
+	FlushEnd
+)
+
+// String returns the reason's name.
+func (fr FlushReason) String() string {
+	switch fr {
+	case FlushBytes:
+		return "bytes"
+	case FlushRows:
+		return "rows"
+	case FlushInterval:
+		return "interval"
+	case FlushEnd:
+		return "end"
+	}
+	return fmt.Sprintf("FlushReason(%d)", int(fr))
+}
+
+// Batch is a batch of rows handed to a BatchHandler.
+type Batch struct {
+	Rows []Row
+	// Bytes is the batch's size, as measured by BatchOptions.Size.
+	Bytes  int
+	Reason FlushReason
+}
+
+// BatchHandler receives the batches of ReadBatches. The batch's rows are
+// not reused once it returns.
+type BatchHandler func(ctx context.Context, batch Batch) error
+
+// BatchOptions configures ReadBatches.
+type BatchOptions struct {
+	// MaxBytes is the byte budget of a batch: a batch is handed over
+	// before a row would take it over. It defaults to
+	// DefaultBatchMaxBytes.
+	MaxBytes int
+
+	// MaxRows, if set, also caps the number of rows of a batch.
+	MaxRows int
+
+	// Interval, if set, bounds how long rows wait for their batch to
+	// fill: a batch is handed over once its first row is that old.
+	Interval time.Duration
+
+	// Size measures a row. It defaults to the length of the row as a
+	// JSON line (see JSONLinesSink), to suit bulk APIs taking those.
+	Size func(Row) (int, error)
+}
+
+// ReadBatches consumes the rows in batches that fit a byte budget, for
+// sinks with per-request size limits, such as bulk APIs and multipart
+// uploads. Each batch is handed to the handler with the reason it was
+// flushed. The remaining rows are flushed once the rows end or ctx is
+// done; a row larger than the budget on its own fails the read.
+//
+// It returns the rows' error, the handler's, or ctx's, and closes the
+// rows.
+func (rs *Rows) ReadBatches(ctx context.Context, opts BatchOptions, handler BatchHandler) error {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultBatchMaxBytes
+	}
+	if opts.Size == nil {
+		opts.Size = jsonLineSize
+	}
+
+	// Next blocks, so rows are read on their own goroutine for the time
+	// limit to be kept.
+	rowCh := make(chan Row)
+	stop := make(chan struct{})
+	defer func() {
+		close(stop)
+		rs.Close()
+		for range rowCh {
+		}
+	}()
+	go func() {
+		defer close(rowCh)
+		for rs.Next() {
+			select {
+			case rowCh <- rs.Row():
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var (
+		batch Batch
+		timer Timer
+		due   <-chan time.Time
+	)
+	flush := func(ctx context.Context, reason FlushReason) error {
+		if timer != nil {
+			timer.Stop()
+			timer, due = nil, nil
+		}
+		if len(batch.Rows) == 0 {
+			return nil
+		}
+		batch.Reason = reason
+		err := handler(ctx, batch)
+		batch = Batch{}
+		if err != nil {
+			return fmt.Errorf("handling batch: %w", err)
+		}
+		return nil
+	}
+
+	for {
+		select {
+		case row, ok := <-rowCh:
+			if !ok {
+				if err := flush(ctx, FlushEnd); err != nil {
+					return err
+				}
+				return rs.Err()
+			}
+			size, err := opts.Size(row)
+			if err != nil {
+				return fmt.Errorf("measuring row: %w", err)
+			}
+			if size > opts.MaxBytes {
+				return fmt.Errorf("row of %d bytes exceeds the batch budget of %d", size, opts.MaxBytes)
+			}
+			if batch.Bytes+size > opts.MaxBytes {
+				if err := flush(ctx, FlushBytes); err != nil {
+					return err
+				}
+			}
+			batch.Rows = append(batch.Rows, row)
+			batch.Bytes += size
+			if opts.MaxRows > 0 && len(batch.Rows) >= opts.MaxRows {
+				if err := flush(ctx, FlushRows); err != nil {
+					return err
+				}
+			} else if opts.Interval > 0 && timer == nil {
+				timer = rs.resp.clock.NewTimer(opts.Interval)
+				due = timer.C()
+			}
+		case <-due:
+			timer, due = nil, nil
+			if err := flush(ctx, FlushInterval); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			// The context is done, so the last batch is handed over
+			// without it.
+			if err := flush(context.Background(), FlushEnd); err != nil {
+				return err
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// jsonLineSize measures a row as a JSON line.
+func jsonLineSize(row Row) (int, error) {
+	var buf bytes.Buffer
+	if err := encodeRowJSON(&buf, row, ksql.TimeFormatter{}); err != nil {
+		return 0, err
+	}
+	return buf.Len() + 1, nil
+}
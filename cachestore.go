@@ -0,0 +1,217 @@
+package ksqldb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// CacheStore persists the contents of a TableCache, so that a restarted
+// process can warm its cache from disk and only catch up on the changes
+// made since. Implementations backed by embedded databases (bolt,
+// badger, ...) plug in here; FileStore is a dependency-free default.
+type CacheStore interface {
+	// Load calls fn for every persisted entry and returns the latest
+	// checkpoint: the ROWTIME (in epoch milliseconds) up to which the
+	// entries are known to be current, or zero if unknown.
+	Load(fn func(key string, row Row) error) (checkpoint int64, err error)
+
+	// Put persists a row under its key.
+	Put(key string, row Row) error
+
+	// Delete removes a key.
+	Delete(key string) error
+
+	// Checkpoint records that every change up to and including the given
+	// ROWTIME has been persisted.
+	Checkpoint(rowtime int64) error
+}
+
+// fileStoreOp is a single line of a FileStore journal.
+type fileStoreOp struct {
+	Op         string `json:"op"`
+	Key        string `json:"key,omitempty"`
+	Row        *Row   `json:"row,omitempty"`
+	Checkpoint int64  `json:"checkpoint,omitempty"`
+}
+
+// FileStore is a CacheStore journaling operations as JSON lines to a
+// single file. The journal is compacted every time it is loaded.
+type FileStore struct {
+	path string
+
+	// Decode is applied to rows as they are loaded. It should match the
+	// client's, so that rows read back have the same types as when first
+	// decoded.
+	Decode DecodeOptions
+
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewFileStore creates a FileStore at the given path. The file is
+// created on first Load.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load implements CacheStore. It replays the journal, rewrites it with
+// only the live entries, and reopens it for appending.
+func (fs *FileStore) Load(fn func(key string, row Row) error) (int64, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	entries, checkpoint, err := fs.replay()
+	if err != nil {
+		return 0, fmt.Errorf("loading cache store %s: %w", fs.path, err)
+	}
+	if err := fs.compact(entries, checkpoint); err != nil {
+		return 0, fmt.Errorf("loading cache store %s: %w", fs.path, err)
+	}
+	for key, row := range entries {
+		if err := fn(key, row); err != nil {
+			return 0, err
+		}
+	}
+	return checkpoint, nil
+}
+
+// replay reads the journal into its live entries.
+func (fs *FileStore) replay() (map[string]Row, int64, error) {
+	entries := make(map[string]Row)
+	file, err := os.Open(fs.path)
+	if os.IsNotExist(err) {
+		return entries, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	var checkpoint int64
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		// Numbers are decoded as json.Number so that rows can be retyped
+		// exactly as they were first decoded.
+		var op fileStoreOp
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.UseNumber()
+		if err := dec.Decode(&op); err != nil {
+			// A torn final write is expected after a crash: everything
+			// before it is still good.
+			break
+		}
+		switch op.Op {
+		case "put":
+			if op.Row != nil {
+				if err := retypeRow(op.Row, fs.Decode); err != nil {
+					return nil, 0, fmt.Errorf("key %s: %w", op.Key, err)
+				}
+				entries[op.Key] = *op.Row
+			}
+		case "delete":
+			delete(entries, op.Key)
+		case "checkpoint":
+			checkpoint = op.Checkpoint
+		}
+	}
+	return entries, checkpoint, scanner.Err()
+}
+
+// compact atomically replaces the journal with the given entries.
+func (fs *FileStore) compact(entries map[string]Row, checkpoint int64) error {
+	if fs.file != nil {
+		fs.file.Close()
+		fs.file = nil
+	}
+	tmp := fs.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	enc := json.NewEncoder(writer)
+	for key, row := range entries {
+		row := encodableRow(row)
+		if err := enc.Encode(fileStoreOp{Op: "put", Key: key, Row: &row}); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := enc.Encode(fileStoreOp{Op: "checkpoint", Checkpoint: checkpoint}); err != nil {
+		file.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, fs.path); err != nil {
+		return err
+	}
+
+	fs.file, err = os.OpenFile(fs.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	fs.enc = json.NewEncoder(fs.file)
+	return nil
+}
+
+// append writes a single operation to the journal.
+func (fs *FileStore) append(op fileStoreOp) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.file == nil {
+		return fmt.Errorf("cache store %s: not loaded", fs.path)
+	}
+	if err := fs.enc.Encode(op); err != nil {
+		return fmt.Errorf("cache store %s: %w", fs.path, err)
+	}
+	return nil
+}
+
+// Put implements CacheStore.
+func (fs *FileStore) Put(key string, row Row) error {
+	row = encodableRow(row)
+	return fs.append(fileStoreOp{Op: "put", Key: key, Row: &row})
+}
+
+// Delete implements CacheStore.
+func (fs *FileStore) Delete(key string) error {
+	return fs.append(fileStoreOp{Op: "delete", Key: key})
+}
+
+// Checkpoint implements CacheStore, syncing the journal to disk.
+func (fs *FileStore) Checkpoint(rowtime int64) error {
+	if err := fs.append(fileStoreOp{Op: "checkpoint", Checkpoint: rowtime}); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.file.Sync()
+}
+
+// Close closes the journal.
+func (fs *FileStore) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.file == nil {
+		return nil
+	}
+	err := fs.file.Close()
+	fs.file = nil
+	return err
+}
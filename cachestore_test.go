@@ -0,0 +1,154 @@
+package ksqldb
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	opts := DecodeOptions{Decimals: DecimalRat}
+	columns := []Column{
+		{Name: "ID", Type: "STRING", Key: true},
+		{Name: "PRICE", Type: "DECIMAL(10, 2)"},
+		{Name: "LINE", Type: "STRUCT<`QTY` INTEGER, `PRICE` DECIMAL(10, 2)>"},
+	}
+	row := Row{
+		Columns: columns,
+		Values: []interface{}{
+			"k",
+			big.NewRat(123, 100),
+			map[string]interface{}{"QTY": int32(2), "PRICE": big.NewRat(-5, 2)},
+		},
+	}
+
+	path := filepath.Join(tempDir(t), "cache.jsonl")
+	store := NewFileStore(path)
+	store.Decode = opts
+	if _, err := store.Load(func(string, Row) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put("k", row); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Checkpoint(42); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	got := loadFileStore(t, path, opts)
+	if got.checkpoint != 42 {
+		t.Errorf("checkpoint = %d, want 42", got.checkpoint)
+	}
+	loaded, ok := got.rows["k"]
+	if !ok {
+		t.Fatalf("key k not loaded, got %v", got.rows)
+	}
+	assertRat(t, "PRICE", loaded.Values[1], big.NewRat(123, 100))
+	line, ok := loaded.Values[2].(map[string]interface{})
+	if !ok {
+		t.Fatalf("LINE = %#v, want a map", loaded.Values[2])
+	}
+	if line["QTY"] != int32(2) {
+		t.Errorf("LINE.QTY = %#v, want int32(2)", line["QTY"])
+	}
+	assertRat(t, "LINE.PRICE", line["PRICE"], big.NewRat(-5, 2))
+
+	// Loading compacts the journal, which must load the same again.
+	again := loadFileStore(t, path, opts)
+	assertRat(t, "PRICE after compaction", again.rows["k"].Values[1], big.NewRat(123, 100))
+}
+
+func TestFileStoreLoadsFractions(t *testing.T) {
+	// Journals written before decimals were stored as decimal text.
+	path := filepath.Join(tempDir(t), "cache.jsonl")
+	journal := `{"op":"put","key":"k","row":{"Columns":[{"Name":"PRICE","Type":"DECIMAL(10, 2)"}],"Values":["123/100"]}}` + "\n"
+	if err := ioutil.WriteFile(path, []byte(journal), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got := loadFileStore(t, path, DecodeOptions{Decimals: DecimalRat})
+	assertRat(t, "PRICE", got.rows["k"].Values[0], big.NewRat(123, 100))
+}
+
+func TestFileStoreRoundTripTemporal(t *testing.T) {
+	opts := DecodeOptions{Temporal: true}
+	at := time.Date(2024, 3, 1, 12, 30, 0, int(250*time.Millisecond), time.UTC)
+	row := Row{
+		Columns: []Column{
+			{Name: "AT", Type: "TIMESTAMP"},
+			{Name: "OPENS", Type: "TIME"},
+			{Name: "BREAKS", Type: "ARRAY<TIME>"},
+		},
+		Values: []interface{}{
+			at,
+			5 * time.Second,
+			[]interface{}{12*time.Hour + 1500*time.Millisecond},
+		},
+	}
+
+	path := filepath.Join(tempDir(t), "cache.jsonl")
+	store := NewFileStore(path)
+	store.Decode = opts
+	if _, err := store.Load(func(string, Row) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put("k", row); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	loaded := loadFileStore(t, path, opts).rows["k"]
+	if got, ok := loaded.Values[0].(time.Time); !ok || !got.Equal(at) {
+		t.Errorf("AT = %#v, want %s", loaded.Values[0], at)
+	}
+	if got := loaded.Values[1]; got != 5*time.Second {
+		t.Errorf("OPENS = %#v, want 5s", got)
+	}
+	want := []interface{}{12*time.Hour + 1500*time.Millisecond}
+	if got := loaded.Values[2]; !reflect.DeepEqual(got, want) {
+		t.Errorf("BREAKS = %#v, want %#v", got, want)
+	}
+}
+
+type loadedStore struct {
+	rows       map[string]Row
+	checkpoint int64
+}
+
+func loadFileStore(t *testing.T, path string, opts DecodeOptions) loadedStore {
+	t.Helper()
+	store := NewFileStore(path)
+	store.Decode = opts
+	defer store.Close()
+	got := loadedStore{rows: make(map[string]Row)}
+	checkpoint, err := store.Load(func(key string, row Row) error {
+		got.rows[key] = row
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("loading %s: %v", path, err)
+	}
+	got.checkpoint = checkpoint
+	return got
+}
+
+func assertRat(t *testing.T, name string, got interface{}, want *big.Rat) {
+	t.Helper()
+	if rat, ok := got.(*big.Rat); !ok || rat.Cmp(want) != 0 {
+		t.Errorf("%s = %#v, want %s", name, got, want.FloatString(2))
+	}
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "ksqldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
@@ -0,0 +1,143 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"hews.co/ksqldb/pkg/ksql"
+	"hews.co/ksqldb/pkg/ksqldbapi"
+)
+
+// Capabilities is what a server supports, as probed by
+// Client.Capabilities.
+type Capabilities struct {
+	Info    ServerInfo
+	Dialect ksql.Dialect
+
+	// HTTP2 is set if the server answered over HTTP/2.
+	HTTP2 bool
+
+	// Endpoints tells, by path, whether the optional endpoints of the
+	// API are served: /query-stream and /close-query.
+	Endpoints map[string]bool
+
+	// QueryStream is set if the v2 /query-stream endpoint is served,
+	// which StreamQuery requires.
+	QueryStream bool
+
+	// Variables is set if the server substitutes variables defined with
+	// DEFINE, or passed with statements, into ${name} references.
+	Variables bool
+}
+
+// probedEndpoints are the endpoints probed by Capabilities: those not
+// served by every server the client talks to.
+var probedEndpoints = []*ksqldbapi.Endpoint{
+	&ksqldbapi.EndpointRunStreamQuery,
+	&ksqldbapi.EndpointCloseQuery,
+}
+
+// HasEndpoint reports whether the server serves an endpoint. Endpoints
+// that are not probed are assumed to be served.
+func (cp *Capabilities) HasEndpoint(endpoint ksqldbapi.Endpoint) bool {
+	served, ok := cp.Endpoints[endpoint.Path]
+	return served || !ok
+}
+
+// Capabilities probes the server once for its version, protocol and
+// optional endpoints, so that features can be checked up front rather
+// than failing at runtime; failed probes are retried on the next call.
+// Once probed, the version also sets the Dialect (unless pinned with
+// ClientOptions.ServerVersion), and StreamQuery fails fast on servers
+// without /query-stream.
+func (cc *Client) Capabilities(ctx context.Context) (*Capabilities, error) {
+	cc.capsMu.Lock()
+	defer cc.capsMu.Unlock()
+	if cc.caps != nil {
+		return cc.caps, nil
+	}
+
+	info, proto, err := cc.serverInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("probing capabilities: %w", err)
+	}
+	cp := &Capabilities{
+		Info:      *info,
+		HTTP2:     proto == 2,
+		Endpoints: make(map[string]bool, len(probedEndpoints)),
+	}
+
+	cc.dialectMu.Lock()
+	if cc.dialect == nil {
+		version, err := ksql.ParseVersion(info.Version)
+		if err != nil {
+			cc.dialectMu.Unlock()
+			return nil, fmt.Errorf("probing capabilities: %w", err)
+		}
+		cc.dialect = &ksql.Dialect{Version: version}
+	}
+	cp.Dialect = *cc.dialect
+	cc.dialectMu.Unlock()
+
+	for _, endpoint := range probedEndpoints {
+		served, err := cc.probeEndpoint(ctx, endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("probing capabilities: %w", err)
+		}
+		cp.Endpoints[endpoint.Path] = served
+	}
+	cp.QueryStream = cp.Endpoints[ksqldbapi.EndpointRunStreamQuery.Path]
+	cp.Variables = cp.Dialect.Supports(ksql.FeatureVariables)
+
+	cc.logger.Log("server capabilities probed", "version", cp.Dialect.Version,
+		"http2", cp.HTTP2, "query_stream", cp.QueryStream, "variables", cp.Variables)
+	cc.caps = cp
+	return cp, nil
+}
+
+// probedCapabilities returns the capabilities if they were probed, or
+// nil, without probing.
+func (cc *Client) probedCapabilities() *Capabilities {
+	cc.capsMu.Lock()
+	defer cc.capsMu.Unlock()
+	return cc.caps
+}
+
+// probeEndpoint reports whether the server serves an endpoint, by
+// posting it an empty object: served endpoints reject it as invalid,
+// others are not found.
+func (cc *Client) probeEndpoint(ctx context.Context, endpoint *ksqldbapi.Endpoint) (bool, error) {
+	rh, err := cc.do(ctx, endpointProbe{endpoint: endpoint})
+	if err != nil {
+		return false, fmt.Errorf("probing %s: %w", endpoint.Path, err)
+	}
+	defer rh.Close()
+	switch rh.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return false, nil
+	}
+	return true, nil
+}
+
+// endpointProbe is the request of probeEndpoint.
+type endpointProbe struct {
+	endpoint *ksqldbapi.Endpoint
+}
+
+// MarshalJSON implements Requester.
+func (ep endpointProbe) MarshalJSON() ([]byte, error) {
+	return []byte("{}"), nil
+}
+
+// Request implements Requester.
+func (ep endpointProbe) Request(serverURL *url.URL) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, ep.endpoint.On(serverURL).String(), strings.NewReader("{}"))
+	if err != nil {
+		return nil, fmt.Errorf("ksql request: creating HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return req, nil
+}
@@ -1,11 +1,19 @@
 package ksqldb
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptrace"
 	"net/url"
+	"sync"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
 )
 
 // Client is the top-level interface to the KsqlDB REST API. It handles
@@ -23,16 +31,211 @@ type Client struct {
 	serverURL  *url.URL
 	httpClient *http.Client
 	httpTrace  *ClientTrace
+	casePolicy ksql.CasePolicy
+	scanGuard  *ScanGuard
+	dropGuard  *DestructiveGuard
+	decodeOpts DecodeOptions
+	timeFormat ksql.TimeFormatter
+	props      Props
+	logger     Logger
+	progress   time.Duration
+	clock      Clock
+	prepared   *preparedCache
+	describes  *describeCache
+	ledger     *idempotencyLedger
+	newID      IDGenerator
+	clusterPin *clusterPin
+	pools      pools
+	queries    openQueries
+
+	disableCompress   bool
+	streamCompression bool
+	compression       compressionCounters
+	throttle          throttleCounters
+	maxRetryAfter     time.Duration
+	responseTee       func(*http.Response) io.Writer
+	history           *debugHistory
+	buffer            StreamBuffer
+	readBuffer        int
+	maxRecord         int
+	recordSplit       func(string) bufio.SplitFunc
+	drainBudget       DrainBudget
+
+	expectContinue int64
+	streamIdle     time.Duration
+	requestTimeout time.Duration
+
+	dialectMu sync.Mutex
+	dialect   *ksql.Dialect
+
+	capsMu sync.Mutex
+	caps   *Capabilities
 }
 
 // ClientOptions are the parameters that may be passed when
 // instantiating a new client.
-//
-// TODO: [PJ] gotta add a logger!
 type ClientOptions struct {
 	URL     string
 	Trace   *ClientTrace
 	Context context.Context
+
+	// Logger receives the client's structured logs. It defaults to
+	// discarding them.
+	Logger Logger
+
+	// ProgressInterval, if set, makes every Rows log its progress (rows,
+	// bytes, rate and lag) to the Logger at this interval, so that
+	// long-running consumers don't look stuck.
+	ProgressInterval time.Duration
+
+	// Clock is the time source for timeouts, polling, idle detection and
+	// the like. It defaults to SystemClock.
+	Clock Clock
+
+	// CasePolicy decides how the client's helpers render the names of
+	// sources and columns, and how names are matched in rows. It
+	// defaults to ksql.UpperCase, mirroring the server.
+	CasePolicy ksql.CasePolicy
+
+	// ScanGuard, if set, is checked before the client's helpers run a
+	// full-table pull query (see Snapshot and LoadAndFollow).
+	ScanGuard *ScanGuard
+
+	// DestructiveGuard, if set, refuses destructive operations, such as
+	// DROP ... DELETE TOPIC, unless confirmed per call (see
+	// ConfirmDestructive) or approved by its callback.
+	DestructiveGuard *DestructiveGuard
+
+	// Decode configures how the values of result rows are decoded.
+	Decode DecodeOptions
+
+	// Props are default streamsProperties, sent with every statement and
+	// query under the request's own, which take precedence: eg.
+	// auto.offset.reset=earliest for all the queries of a backfill job.
+	// Known properties are checked, as by CheckProps.
+	Props Props
+
+	// TimeFormat renders the DATE and TIME values the client writes, eg.
+	// in StreamWriter inserts, in one time zone. It defaults to UTC. See
+	// Client.TimeFormat to render exports alike.
+	TimeFormat ksql.TimeFormatter
+
+	// ServerVersion pins the server version the builders target, eg.
+	// "0.29.0", instead of detecting it (see Client.Dialect).
+	ServerVersion string
+
+	// Concurrency limits the requests of each kind run at once.
+	Concurrency ConcurrencyLimits
+
+	// ResponseHeaderTimeout, if set, bounds the wait for the response
+	// headers after a request is sent, so that a hung server fails the
+	// request fast. It does not limit how long the body may stream: push
+	// queries stay open for as long as their context allows.
+	ResponseHeaderTimeout time.Duration
+
+	// ExpectContinueThreshold, if set, sends requests whose body is at
+	// least this many bytes (large scripts, bulk statements) with
+	// "Expect: 100-continue", so that authentication and validation
+	// failures come back before the body is uploaded.
+	ExpectContinueThreshold int64
+
+	// ExpectContinueTimeout is how long to wait for the server's go-ahead
+	// before sending the body anyway. It defaults to one second.
+	ExpectContinueTimeout time.Duration
+
+	// StreamIdleTimeout, if set, fails push queries whose stream stays
+	// silent for this long with ErrStreamIdle, rather than letting a
+	// silently broken connection block reads forever. The server sends
+	// keep-alives on quiet push queries, which count as activity: set it
+	// well above their interval.
+	StreamIdleTimeout time.Duration
+
+	// RequestTimeout, if set, bounds requests other than push queries,
+	// including the reading of their response, which then fails with
+	// context.DeadlineExceeded. Resources may set their own Timeout, eg.
+	// to bound a push query; DoContext takes a deadline per call.
+	RequestTimeout time.Duration
+
+	// MaxRetryAfter bounds the waits the Retry-After headers of 429 and
+	// 503 responses ask for, where the client retries: reconnecting push
+	// queries and command polls. It defaults to DefaultMaxRetryAfter; a
+	// negative value ignores the headers.
+	MaxRetryAfter time.Duration
+
+	// HTTP2 makes the client speak HTTP/2 only, which /query-stream and
+	// /inserts-stream are designed for: over TLS, and with prior
+	// knowledge (h2c) to plaintext http:// servers. Otherwise the client
+	// speaks HTTP/1.1 to plaintext servers.
+	HTTP2 bool
+
+	// PreparedCacheSize is the number of prepared queries kept (see
+	// Client.Prepare). It defaults to DefaultPreparedCacheSize.
+	PreparedCacheSize int
+
+	// DescribeCacheTTL, if set, caches the descriptions returned by
+	// Describe, and used by the helpers that validate against sources,
+	// for this long. DDL and TERMINATE statements run through the client
+	// drop the cache; see Client.InvalidateDescriptions for others.
+	DescribeCacheTTL time.Duration
+
+	// Idempotency configures the ledger of idempotency keys, which
+	// catches retried requests (see WithIdempotencyKey).
+	Idempotency IdempotencyOptions
+
+	// IDGenerator generates the identifiers the client hands out (see
+	// Client.NewIdempotencyKey). It defaults to RandomID.
+	IDGenerator IDGenerator
+
+	// ExpectedClusterID, if set, pins the client to the Kafka cluster of
+	// this ID: before its first request, the client checks the server's
+	// cluster (see Client.ServerClusterID), and fails every request with
+	// a *ClusterMismatchError if it is another. This keeps tooling that
+	// runs destructive statements off the wrong cluster.
+	ExpectedClusterID string
+
+	// The client asks for gzip- or deflate-compressed responses, which
+	// are decompressed as they stream (see ClientStats.Compression), eg.
+	// to cut the cost of large pull-query results over WAN links. Servers
+	// or gateways that do not compress answer uncompressed, which is read
+	// as usual. DisableCompression stops asking, and StreamCompression
+	// then still asks on queries, on /query and /query-stream.
+	DisableCompression bool
+	StreamCompression  bool
+
+	// ResponseTee, if set, is asked for a writer for each response, to
+	// which its body is copied as it is read, decompressed: eg. a file or
+	// ring buffer capturing the raw stream of queries whose parsing
+	// fails in production. Returning nil skips the response. Writers
+	// that are io.Closers are closed with the body; failing writes stop
+	// the copy, and are logged, but do not fail the reads.
+	ResponseTee func(resp *http.Response) io.Writer
+
+	// DebugHistory, if set, keeps this many of the last requests, and of
+	// the last failed ones, for Client.DebugReport: their endpoint, the
+	// fingerprint of their statement, status, duration and error.
+	DebugHistory int
+
+	// StreamBuffer buffers the records of responses between the reading
+	// of their body and their consumer, and decides what happens once a
+	// slow consumer fills it. It may be set per request with
+	// WithStreamBuffer. Responses are read in lockstep with their
+	// consumer by default.
+	StreamBuffer StreamBuffer
+
+	// ReadBufferSize is the initial size of the buffer the records of
+	// responses are scanned into, which grows up to MaxRecordSize. Larger
+	// records fail the response with a *RecordTooLargeError. They default
+	// to DefaultReadBuffer and DefaultMaxReadBuffer.
+	ReadBufferSize int
+	MaxRecordSize  int
+
+	// RecordSplit returns the function splitting the body of a response,
+	// of the given content type, into records. It defaults to SplitFor.
+	RecordSplit func(contentType string) bufio.SplitFunc
+
+	// DrainBudget bounds the draining of responses given up on, see
+	// Response.Close and Response.Drained.
+	DrainBudget DrainBudget
 }
 
 // ClientTrace extends httptrace.ClientTrace with two final hooks, for
@@ -60,6 +263,15 @@ type ClientTrace struct {
 	// however, at this moment the response header and status have been
 	// delivered and therefore the status of the request can be determined.
 	ResponseDelivered func(*http.Response, error)
+
+	// Throttled is passed the 429 and 503 responses, and the wait their
+	// Retry-After header asks for, if any. It is called for every such
+	// response, sampled or not.
+	Throttled func(resp *http.Response, retryAfter time.Duration)
+
+	// Sampler, if set, limits which requests are traced. All requests
+	// are traced otherwise.
+	Sampler *TraceSampler
 }
 
 // newTransportFromDefault clones the default transport. Why change it?
@@ -88,22 +300,96 @@ func parseServerURL(rawURL string) (*url.URL, error) {
 func NewClient(opts ClientOptions) (*Client, error) {
 	transport := newTransportFromDefault()
 
-	// FIXME: [PJ] for the current streaming setup, it makes a lot more
-	// sense to force uncompressed transport and then scan directly on
-	// the incoming reader. Should move to a system that pipes through
-	// decompression and then scans.
+	// The client negotiates compression itself, and pipes compressed
+	// bodies through decompression before they are scanned (see
+	// decompressResponse), which also counts their bytes: the transport
+	// is kept from doing it behind its back.
 	transport.DisableCompression = true
+	transport.ResponseHeaderTimeout = opts.ResponseHeaderTimeout
+	if opts.ExpectContinueTimeout > 0 {
+		transport.ExpectContinueTimeout = opts.ExpectContinueTimeout
+	}
 
 	serverURL, err := parseServerURL(opts.URL)
 	if err != nil {
 		return nil, fmt.Errorf("initializing ksqldb client: %w", err)
 	}
+	if opts.HTTP2 {
+		if err := enableHTTP2(transport, serverURL.Scheme); err != nil {
+			return nil, fmt.Errorf("initializing ksqldb client: %w", err)
+		}
+	}
+
+	if err := CheckProps(opts.Props); err != nil {
+		return nil, fmt.Errorf("initializing ksqldb client: %w", err)
+	}
+	var props Props
+	if len(opts.Props) > 0 {
+		props = make(Props, len(opts.Props))
+		for name, value := range opts.Props {
+			props[name] = value
+		}
+	}
+
+	var dialect *ksql.Dialect
+	if opts.ServerVersion != "" {
+		version, err := ksql.ParseVersion(opts.ServerVersion)
+		if err != nil {
+			return nil, fmt.Errorf("initializing ksqldb client: %w", err)
+		}
+		dialect = &ksql.Dialect{Version: version}
+	}
 
 	httpClient := &http.Client{Transport: transport}
 	cc := &Client{
 		serverURL:  serverURL,
 		httpClient: httpClient,
 		httpTrace:  opts.Trace,
+		casePolicy: opts.CasePolicy,
+		scanGuard:  opts.ScanGuard,
+		dropGuard:  opts.DestructiveGuard,
+		decodeOpts: opts.Decode,
+		timeFormat: opts.TimeFormat,
+		props:      props,
+		dialect:    dialect,
+		logger:     opts.Logger,
+		progress:   opts.ProgressInterval,
+		clock:      opts.Clock,
+		newID:      opts.IDGenerator,
+		prepared:   newPreparedCache(opts.PreparedCacheSize),
+		pools:      newPools(opts.Concurrency),
+
+		expectContinue: opts.ExpectContinueThreshold,
+		streamIdle:     opts.StreamIdleTimeout,
+		requestTimeout: opts.RequestTimeout,
+
+		disableCompress:   opts.DisableCompression,
+		streamCompression: opts.StreamCompression,
+		maxRetryAfter:     opts.MaxRetryAfter,
+		responseTee:       opts.ResponseTee,
+		history:           newDebugHistory(opts.DebugHistory),
+		buffer:            opts.StreamBuffer,
+		readBuffer:        opts.ReadBufferSize,
+		maxRecord:         opts.MaxRecordSize,
+		recordSplit:       opts.RecordSplit,
+		drainBudget:       opts.DrainBudget,
+	}
+	if cc.logger == nil {
+		cc.logger = nopLogger{}
+	}
+	if cc.clock == nil {
+		cc.clock = SystemClock
+	}
+	if cc.newID == nil {
+		cc.newID = RandomID
+	}
+	if cc.maxRetryAfter == 0 {
+		cc.maxRetryAfter = DefaultMaxRetryAfter
+	}
+	cc.describes = newDescribeCache(opts.DescribeCacheTTL, cc.clock)
+	cc.ledger = newIdempotencyLedger(opts.Idempotency, cc.clock)
+	if opts.ExpectedClusterID != "" {
+		cc.clusterPin = &clusterPin{expected: opts.ExpectedClusterID}
 	}
 	if opts.Context == nil {
 		cc.ctx = context.Background()
@@ -132,6 +418,36 @@ func (cc *Client) HTTPTrace() *ClientTrace {
 	return cc.httpTrace
 }
 
+// CasePolicy gets the private attribute. Not allowing sets here helps
+// keep the client configuration immutable.
+func (cc *Client) CasePolicy() ksql.CasePolicy {
+	return cc.casePolicy
+}
+
+// TimeFormat gets the private attribute, eg. to set as the Times of the
+// sinks exporting rows, so that they render times as the client writes
+// them.
+func (cc *Client) TimeFormat() ksql.TimeFormatter {
+	return cc.timeFormat
+}
+
+// Logger gets the private attribute. Not allowing sets here helps keep
+// the client configuration immutable.
+func (cc *Client) Logger() Logger {
+	return cc.logger
+}
+
+// Clock gets the private attribute. Not allowing sets here helps keep
+// the client configuration immutable.
+func (cc *Client) Clock() Clock {
+	return cc.clock
+}
+
+// ident renders a source or column name under the client's case policy.
+func (cc *Client) ident(name string) string {
+	return cc.casePolicy.Ident(name)
+}
+
 // WithClientConfig runs on every query, attaching the context (see
 // client.Do: the passed context is a cancelable child of the client's
 // context) and any configured tracing to the request. This allows full
@@ -157,29 +473,241 @@ func (cc *Client) WithClientConfig(ctx context.Context, req *http.Request) *http
 // HTTP request with the sole input of the server's URL. All the output
 // is bundled together on return as a KsqlDB Response.
 //
-// TODO: [PJ] allow setting a deadline or timeout for the request's
-// context.
+// A response with a status other than 2xx is returned along with a
+// *ResponseError wrapping the *Error in its body, which remains readable.
+//
+// Do runs under the client's context; see DoContext to set a deadline
+// or timeout per request.
 func (cc *Client) Do(resource Requester) (*Response, error) {
+	return cc.DoContext(cc.ctx, resource)
+}
+
+// DoContext is Do under ctx, which is combined with the client's
+// context: the request, and the reading of its response, end with
+// either.
+func (cc *Client) DoContext(ctx context.Context, resource Requester) (*Response, error) {
+	rr, err := cc.do(ctx, resource)
+	if err != nil || !failed(rr.Response) {
+		return rr, err
+	}
+	byt, err := ioutil.ReadAll(rr.Body)
+	rr.Body.Close()
+	if err != nil {
+		rr.Cancel()
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+	rr.Body = ioutil.NopCloser(bytes.NewReader(byt))
+	return rr, rr.responseError(byt, nil)
+}
+
+// withClientContext derives a cancelable child of ctx that is also
+// canceled whenever the client's own context is done, so per-call
+// contexts never outlive the client.
+func (cc *Client) withClientContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == cc.ctx {
+		return context.WithCancel(ctx)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-cc.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// do is Do with an explicit parent context: the helpers built on top of
+// the client take a context per call, which is combined with the
+// client's context. Requests are recorded in the debug history, if any.
+func (cc *Client) do(ctx context.Context, resource Requester) (*Response, error) {
+	if cc.history == nil {
+		return cc.send(ctx, resource)
+	}
+	start := cc.clock.Now()
+	rr, err := cc.send(ctx, resource)
+	cc.record(resource, start, rr, err)
+	return rr, err
+}
+
+// send sends a request, and wraps its response.
+func (cc *Client) send(ctx context.Context, resource Requester) (*Response, error) {
+	resource = cc.withDefaultProps(resource)
 	req, err := resource.Request(cc.serverURL)
 	if err != nil {
 		return nil, fmt.Errorf("sending ksql request: %w", err)
 	}
-	ctx, cancel := context.WithCancel(cc.ctx)
+	if !unpinnedPaths[req.URL.Path] {
+		if err := cc.clusterPin.check(ctx, cc); err != nil {
+			return nil, fmt.Errorf("sending ksql request: %w", err)
+		}
+	}
+	if err := cc.dropGuard.check(ctx, resource, req); err != nil {
+		return nil, fmt.Errorf("sending ksql request: %w", err)
+	}
+	if cc.expectContinue > 0 && req.ContentLength >= cc.expectContinue {
+		req.Header.Set("Expect", "100-continue")
+	}
+	if key, ok := ctx.Value(idempotencyKeyContext{}).(string); ok && key != "" && req.Header.Get(IdempotencyKeyHeader) == "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	// Keys are forgotten when the request is surely not applied: not
+	// sent, or rejected by the server.
+	key := req.Header.Get(IdempotencyKeyHeader)
+	tracked, duplicate := key != "" && cc.ledger != nil, false
+	if tracked {
+		if duplicate = cc.ledger.begin(key); duplicate {
+			if cc.ledger.policy == DuplicateReject {
+				return nil, fmt.Errorf("sending ksql request: %w: key %s", ErrDuplicateRequest, key)
+			}
+			cc.logger.Log("duplicate request sent", "idempotency_key", key)
+		}
+	}
+	kind := requestKind(resource)
+	if kind == ksql.KindPushQuery && cc.queries.isClosed() {
+		if tracked && !duplicate {
+			cc.ledger.forget(key)
+		}
+		return nil, fmt.Errorf("sending ksql request: %w", ErrClientClosed)
+	}
+	ctx, cancel := cc.withClientContext(ctx)
+	if timeout := cc.timeoutFor(resource, kind); timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = withTimeout(ctx, cc.clock, timeout)
+		cancelClient := cancel
+		cancel = func() {
+			cancelTimeout()
+			cancelClient()
+		}
+	}
+	slot := cc.pools.forKind(kind)
+	if err := slot.acquire(ctx); err != nil {
+		cancel()
+		if tracked && !duplicate {
+			cc.ledger.forget(key)
+		}
+		return nil, fmt.Errorf("sending ksql request: %w", err)
+	}
+	if slot != nil {
+		go func() {
+			<-ctx.Done()
+			slot.release()
+		}()
+	}
+	if !cc.disableCompress || (cc.streamCompression && (kind == ksql.KindPushQuery || kind == ksql.KindPullQuery)) {
+		if req.Header.Get("Accept-Encoding") == "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+	}
 	trace := cc.HTTPTrace()
-	if trace != nil && trace.RequestPrepared != nil {
+	sampled := trace != nil && (trace.Sampler == nil || trace.Sampler.Sample(kind))
+	if sampled && trace.RequestPrepared != nil {
 		trace.RequestPrepared(req)
 	}
-	resp, err := cc.httpClient.Do(cc.WithClientConfig(ctx, req))
+	if sampled {
+		req = cc.WithClientConfig(ctx, req)
+	} else {
+		req = req.WithContext(ctx)
+	}
+	resp, err := cc.httpClient.Do(req)
 	if trace != nil && trace.ResponseDelivered != nil {
-		trace.ResponseDelivered(resp, err)
+		if sampled || (trace.Sampler != nil && trace.Sampler.traceErrors(resp, err)) {
+			trace.ResponseDelivered(resp, err)
+		}
 	}
 	if err != nil {
-		// Avoiding a lost cancel.
+		// Avoiding a lost cancel, which would also hold on to the
+		// request's concurrency slot.
+		cancel()
 		return &Response{cancelFunc: cancel}, fmt.Errorf("sending ksql request: %w", err)
 	}
-	return &Response{
+	var hint time.Duration
+	if isThrottling(resp.StatusCode) {
+		hint = cc.throttled(resp, trace)
+	}
+	decompressResponse(resp, &cc.compression)
+	cc.teeResponse(resp)
+	if tracked && !duplicate && resp.StatusCode >= http.StatusMultipleChoices {
+		cc.ledger.forget(key)
+	}
+	if res, ok := resource.(*Resource); ok && res.Payload != nil && resp.StatusCode < http.StatusMultipleChoices &&
+		res.changesSources() {
+		cc.describes.invalidate()
+	}
+	rr := &Response{
 		Response:   resp,
 		Context:    ctx,
 		cancelFunc: cancel,
-	}, nil
+		casePolicy: cc.casePolicy,
+		decodeOpts: cc.decodeOpts,
+		logger:     cc.logger,
+		progress:   cc.progress,
+		clock:      cc.clock,
+		duplicate:  duplicate,
+		buffer:     cc.streamBuffer(ctx),
+		readBuffer: cc.readBuffer,
+		maxRecord:  cc.maxRecord,
+		split:      cc.recordSplit,
+
+		drainBudget: cc.drainBudget,
+		retryAfter:  hint,
+	}
+	if kind == ksql.KindPushQuery {
+		rr.idleTimeout = cc.streamIdle
+		rr.closeQuery = cc.startedQueryCloser(resource)
+		if !cc.queries.add(rr) {
+			resp.Body.Close()
+			cancel()
+			return nil, fmt.Errorf("sending ksql request: %w", ErrClientClosed)
+		}
+		go func() {
+			<-ctx.Done()
+			rr.closeStarted()
+			cc.queries.remove(rr)
+		}()
+	}
+	return rr, nil
+}
+
+// timeoutFor returns the timeout of a request: the resource's, or the
+// client's RequestTimeout for requests other than push queries.
+func (cc *Client) timeoutFor(resource Requester, kind ksql.StatementKind) time.Duration {
+	switch rr := resource.(type) {
+	case *Resource:
+		if rr.Timeout > 0 {
+			return rr.Timeout
+		}
+	case *StreamResource:
+		if rr.Timeout > 0 {
+			return rr.Timeout
+		}
+	}
+	if kind == ksql.KindPushQuery {
+		return 0
+	}
+	return cc.requestTimeout
+}
+
+// closeQueryTimeout bounds the requests closing canceled push queries.
+const closeQueryTimeout = 5 * time.Second
+
+// startedQueryCloser returns the function closing a canceled push query
+// sent with resource: the /close-query endpoint only knows the queries
+// of /query-stream, so those of /query are terminated instead. The
+// query's own context is done, so the request runs under the client's.
+func (cc *Client) startedQueryCloser(resource Requester) func(queryID string) error {
+	end := cc.terminate
+	if _, ok := resource.(*StreamResource); ok {
+		end = cc.CloseQuery
+	}
+	return func(queryID string) error {
+		ctx, cancel := withTimeout(cc.ctx, cc.clock, closeQueryTimeout)
+		defer cancel()
+		err := end(ctx, queryID)
+		if err != nil {
+			cc.logger.Log("close query failed", "query_id", queryID, "err", err)
+		}
+		return err
+	}
 }
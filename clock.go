@@ -0,0 +1,111 @@
+package ksqldb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for everything the client schedules:
+// timeouts, polling, idle detection, progress reports and staleness.
+// Tests inject a manual clock (see ksqldbtest.ManualClock) to run timing
+// logic instantly and deterministically.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is the subset of *time.Timer used by the client.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker is the subset of *time.Ticker used by the client.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock is the Clock of the time package, the default.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTimer(d time.Duration) Timer { return systemTimer{time.NewTimer(d)} }
+
+func (systemClock) NewTicker(d time.Duration) Ticker { return systemTicker{time.NewTicker(d)} }
+
+type systemTimer struct{ *time.Timer }
+
+func (st systemTimer) C() <-chan time.Time { return st.Timer.C }
+
+type systemTicker struct{ *time.Ticker }
+
+func (st systemTicker) C() <-chan time.Time { return st.Ticker.C }
+
+// since is time.Since on a clock.
+func since(clock Clock, t time.Time) time.Duration {
+	return clock.Now().Sub(t)
+}
+
+// withTimeout is context.WithTimeout on a clock: the context is done
+// with context.DeadlineExceeded once the clock's timer fires. Other
+// clocks than SystemClock do not set the context's deadline, as their
+// time need not be the wall clock's that dialers and servers go by.
+func withTimeout(parent context.Context, clock Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	if clock == SystemClock {
+		return context.WithTimeout(parent, d)
+	}
+	ctx := &clockContext{Context: parent, done: make(chan struct{})}
+	timer := clock.NewTimer(d)
+	stop := make(chan struct{})
+	go func() {
+		defer timer.Stop()
+		select {
+		case <-parent.Done():
+			ctx.end(parent.Err())
+		case <-timer.C():
+			ctx.end(context.DeadlineExceeded)
+		case <-stop:
+			ctx.end(context.Canceled)
+		}
+	}()
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
+// clockContext is a context ended by withTimeout.
+type clockContext struct {
+	context.Context
+	done chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+// end ends the context with err.
+func (cc *clockContext) end(err error) {
+	cc.mu.Lock()
+	cc.err = err
+	cc.mu.Unlock()
+	close(cc.done)
+}
+
+// Done implements context.Context.
+func (cc *clockContext) Done() <-chan struct{} {
+	return cc.done
+}
+
+// Err implements context.Context.
+func (cc *clockContext) Err() error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.err
+}
@@ -0,0 +1,68 @@
+// Command ksqljsonl runs a query and writes its rows to stdout as JSON
+// Lines, for feeding jq pipelines and log shippers:
+//
+//	ksqljsonl -url http://localhost:8088 -schema 'SELECT * FROM users;'
+//
+// With -markdown, the rows are written as a Markdown table instead, for
+// reports posted to chat or pull requests.
+//
+// Push queries run until interrupted (SIGINT or SIGTERM), and are then
+// closed on the server before the command exits.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"hews.co/ksqldb"
+)
+
+func main() {
+	url := flag.String("url", "http://0.0.0.0:8088", "ksqlDB server URL")
+	schema := flag.Bool("schema", false, "write a schema line ahead of the rows")
+	markdown := flag.Bool("markdown", false, "write a Markdown table instead of JSON Lines")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: ksqljsonl [-url url] [-schema] [-markdown] query")
+		os.Exit(2)
+	}
+
+	client, err := ksqldb.NewClient(ksqldb.ClientOptions{URL: *url})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	ctx, shutdown := ksqldb.NotifyShutdown(context.Background(), client, ksqldb.ShutdownOptions{})
+	if err := run(ctx, client, *schema, *markdown); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		shutdown()
+		os.Exit(1)
+	}
+	if err := shutdown(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// run runs the query, writing its rows until it ends or ctx is canceled.
+func run(ctx context.Context, client *ksqldb.Client, schema, markdown bool) error {
+	rows, err := client.Query(ctx, strings.Join(flag.Args(), " "), nil)
+	if err != nil {
+		return err
+	}
+
+	var sink ksqldb.RowSink
+	if markdown {
+		sink = ksqldb.NewMarkdownSink(os.Stdout)
+	} else {
+		jsonl := ksqldb.NewJSONLinesSink(os.Stdout)
+		jsonl.Schema = schema
+		sink = jsonl
+	}
+	if _, err := ksqldb.CopyRows(sink, rows); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
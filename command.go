@@ -0,0 +1,171 @@
+package ksqldb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksqldbapi"
+)
+
+// CommandPollOptions configures WaitForCommand. Polls start fast, since
+// most commands complete within moments, and back off from there so
+// that orchestrating many commands does not hammer the server.
+type CommandPollOptions struct {
+	// InitialInterval is the wait before the second poll. It defaults to
+	// 50 milliseconds.
+	InitialInterval time.Duration
+
+	// MaxInterval caps the wait between polls. It defaults to five
+	// seconds.
+	MaxInterval time.Duration
+
+	// Multiplier grows the wait after each poll. It defaults to 2.
+	Multiplier float64
+
+	// OnPoll, if set, is called after every poll.
+	OnPoll func(CommandPollEvent)
+}
+
+// CommandPollEvent describes a single poll of a command's status.
+type CommandPollEvent struct {
+	CommandID string
+	Attempt   int
+
+	// Status is the status polled, if the poll succeeded.
+	Status *CommandStatus
+	Err    error
+
+	// Hint is the wait the server asked for with Retry-After, if any;
+	// Wait is the wait before the next poll, taking it into account
+	// within the client's MaxRetryAfter.
+	Hint time.Duration
+	Wait time.Duration
+}
+
+// CommandStatus fetches the status of an enqueued command, by the
+// CommandID of its CurrentStatus.
+func (cc *Client) CommandStatus(ctx context.Context, commandID string) (*CommandStatus, error) {
+	status, _, err := cc.commandStatus(ctx, commandID)
+	return status, err
+}
+
+// commandStatus fetches a command's status, along with the server's
+// Retry-After hint, if any.
+func (cc *Client) commandStatus(ctx context.Context, commandID string) (*CommandStatus, time.Duration, error) {
+	endpoint := ksqldbapi.EndpointStatusQuery.Sub(commandID)
+	rh, err := cc.do(ctx, newGetResource(&endpoint))
+	if err != nil {
+		return nil, 0, fmt.Errorf("getting status of command %s: %w", commandID, err)
+	}
+	defer rh.Close()
+
+	hint := retryAfter(rh.Response, cc.clock.Now())
+	byt, err := rh.ReadAll()
+	if err != nil {
+		return nil, hint, fmt.Errorf("getting status of command %s: %w", commandID, err)
+	}
+	if rh.StatusCode != http.StatusOK {
+		return nil, hint, fmt.Errorf("getting status of command %s: %w", commandID, rh.responseError(byt, nil))
+	}
+	var status CommandStatus
+	if err := json.Unmarshal(byt, &status); err != nil {
+		return nil, hint, fmt.Errorf("getting status of command %s: %w", commandID, rh.responseError(byt, fmt.Errorf("decoding response: %w", err)))
+	}
+	return &status, hint, nil
+}
+
+// WaitForCommand polls a command's status until it succeeds, failing if
+// it errors or is terminated instead. Failed polls are retried, after
+// the server's Retry-After if it sent one (see
+// ClientOptions.MaxRetryAfter), until ctx is done.
+func (cc *Client) WaitForCommand(ctx context.Context, commandID string, opts CommandPollOptions) (*CommandStatus, error) {
+	interval := opts.InitialInterval
+	if interval <= 0 {
+		interval = 50 * time.Millisecond
+	}
+	maxInterval := opts.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = 5 * time.Second
+	}
+	multiplier := opts.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		status, hint, err := cc.commandStatus(ctx, commandID)
+		wait := cc.retryWait(interval, hint)
+		if opts.OnPoll != nil {
+			opts.OnPoll(CommandPollEvent{
+				CommandID: commandID,
+				Attempt:   attempt,
+				Status:    status,
+				Err:       err,
+				Hint:      hint,
+				Wait:      wait,
+			})
+		}
+		cc.logger.Log("command poll", "command_id", commandID, "attempt", attempt, "status", statusName(status), "wait", wait)
+
+		if err == nil {
+			switch strings.ToUpper(status.Status) {
+			case "SUCCESS":
+				return status, nil
+			case "ERROR", "TERMINATED":
+				return status, fmt.Errorf("command %s: %s: %s", commandID, status.Status, status.Message)
+			}
+		}
+		lastErr = err
+
+		timer := cc.clock.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if lastErr != nil {
+				return nil, fmt.Errorf("waiting for command %s: %w (last poll: %v)", commandID, ctx.Err(), lastErr)
+			}
+			return status, fmt.Errorf("waiting for command %s: %w", commandID, ctx.Err())
+		case <-timer.C():
+		}
+		interval = time.Duration(float64(interval) * multiplier)
+		if interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+// statusName is the status of a poll, for logging.
+func statusName(status *CommandStatus) string {
+	if status == nil {
+		return ""
+	}
+	return status.Status
+}
+
+// retryAfter parses the Retry-After header of a response, given either
+// in seconds or as an HTTP date, into a wait from now.
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,137 @@
+package ksqldb
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// acceptEncoding is the Accept-Encoding of requests asking for
+// compressed responses.
+const acceptEncoding = "gzip, deflate"
+
+// CompressionStats describes the compressed responses read, see
+// ClientOptions.DisableCompression.
+type CompressionStats struct {
+	// Responses is the number of compressed responses.
+	Responses int64
+
+	// CompressedBytes and DecompressedBytes are the bytes read off the
+	// wire and the bytes they decompressed to.
+	CompressedBytes   int64
+	DecompressedBytes int64
+}
+
+// compressionCounters accumulate the CompressionStats of a client.
+type compressionCounters struct {
+	responses    int64
+	compressed   int64
+	decompressed int64
+}
+
+// stats returns the counters' current values.
+func (cs *compressionCounters) stats() CompressionStats {
+	return CompressionStats{
+		Responses:         atomic.LoadInt64(&cs.responses),
+		CompressedBytes:   atomic.LoadInt64(&cs.compressed),
+		DecompressedBytes: atomic.LoadInt64(&cs.decompressed),
+	}
+}
+
+// decompressResponse replaces the body of a gzip- or deflate-encoded
+// response by its decompressed stream, as net/http would were compression
+// not disabled on the client's transport. Other responses are left alone.
+func decompressResponse(resp *http.Response, counters *compressionCounters) {
+	var newReader func(io.Reader) (io.Reader, error)
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		newReader = newGzipReader
+	case "deflate":
+		newReader = newDeflateReader
+	default:
+		return
+	}
+	atomic.AddInt64(&counters.responses, 1)
+	resp.Body = &decompressingBody{
+		body:      resp.Body,
+		counted:   countingReader{r: resp.Body, n: &counters.compressed},
+		counters:  counters,
+		newReader: newReader,
+	}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
+
+// newGzipReader decompresses a gzip stream.
+func newGzipReader(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// newDeflateReader decompresses a deflate stream: zlib-wrapped, as HTTP
+// has it, or raw, as some servers send it.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// decompressingBody decompresses a response body as it is read. The
+// reader is only created on the first read, as it reads the stream's
+// header, which a streaming server may not have sent yet.
+type decompressingBody struct {
+	body      io.ReadCloser
+	counted   countingReader
+	counters  *compressionCounters
+	newReader func(io.Reader) (io.Reader, error)
+	zr        io.Reader
+	err       error
+}
+
+// Read implements io.Reader.
+func (db *decompressingBody) Read(p []byte) (int, error) {
+	if db.err != nil {
+		return 0, db.err
+	}
+	if db.zr == nil {
+		if db.zr, db.err = db.newReader(&db.counted); db.err != nil {
+			return 0, db.err
+		}
+	}
+	n, err := db.zr.Read(p)
+	atomic.AddInt64(&db.counters.decompressed, int64(n))
+	if err != nil {
+		db.err = err
+	}
+	return n, err
+}
+
+// Close implements io.Closer.
+func (db *decompressingBody) Close() error {
+	return db.body.Close()
+}
+
+// countingReader counts the bytes read through it into n.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+// Read implements io.Reader.
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	atomic.AddInt64(cr.n, int64(n))
+	return n, err
+}
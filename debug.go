@@ -0,0 +1,181 @@
+package ksqldb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DebugRequest is a request kept in the client's debug history, see
+// ClientOptions.DebugHistory.
+type DebugRequest struct {
+	Time time.Time
+
+	// Endpoint is the method and path of the request, eg. "POST /ksql".
+	Endpoint string
+
+	// Fingerprint identifies the statement or query sent, without
+	// revealing it (see QueryFingerprint). Other requests have none.
+	Fingerprint string
+
+	// Status is the response's status, or 0 if none was received, and
+	// Duration the time it took to arrive.
+	Status   int
+	Duration time.Duration
+
+	// Err is the error the request failed with, if any.
+	Err string
+}
+
+// DebugReport is a dump of the client's recent activity, to attach to
+// bug reports and incident timelines.
+type DebugReport struct {
+	Generated time.Time
+
+	// Requests are the last requests, and Errors the last failed ones,
+	// oldest first.
+	Requests []DebugRequest
+	Errors   []DebugRequest
+
+	Stats ClientStats
+}
+
+// DebugReport returns the client's recent requests and errors, kept if
+// ClientOptions.DebugHistory is set, and its statistics.
+func (cc *Client) DebugReport() *DebugReport {
+	report := &DebugReport{Generated: cc.clock.Now(), Stats: cc.Stats()}
+	if cc.history != nil {
+		report.Requests, report.Errors = cc.history.snapshot()
+	}
+	return report
+}
+
+// String renders the report as text, a request per line.
+func (dr *DebugReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "ksqldb debug report, %s\n", dr.Generated.Format(time.RFC3339))
+	fmt.Fprintf(&sb, "\nrequests (%d):\n", len(dr.Requests))
+	for _, req := range dr.Requests {
+		writeDebugRequest(&sb, req)
+	}
+	fmt.Fprintf(&sb, "\nerrors (%d):\n", len(dr.Errors))
+	for _, req := range dr.Errors {
+		writeDebugRequest(&sb, req)
+	}
+	fmt.Fprintf(&sb, "\nstats: %+v\n", dr.Stats)
+	return sb.String()
+}
+
+// writeDebugRequest renders a request of a report.
+func writeDebugRequest(sb *strings.Builder, req DebugRequest) {
+	fmt.Fprintf(sb, "  %s %s status=%d duration=%s", req.Time.Format(time.RFC3339Nano), req.Endpoint, req.Status, req.Duration)
+	if req.Fingerprint != "" {
+		fmt.Fprintf(sb, " fingerprint=%.12s", req.Fingerprint)
+	}
+	if req.Err != "" {
+		fmt.Fprintf(sb, " error=%q", req.Err)
+	}
+	sb.WriteByte('\n')
+}
+
+// debugHistory keeps the last requests, and the last failed ones, in
+// rings of a fixed size.
+type debugHistory struct {
+	mu       sync.Mutex
+	requests debugRing
+	errors   debugRing
+}
+
+// newDebugHistory creates a history of the given size, or returns nil if
+// it is not positive.
+func newDebugHistory(size int) *debugHistory {
+	if size <= 0 {
+		return nil
+	}
+	return &debugHistory{
+		requests: debugRing{entries: make([]DebugRequest, size)},
+		errors:   debugRing{entries: make([]DebugRequest, size)},
+	}
+}
+
+// add records a request.
+func (dh *debugHistory) add(req DebugRequest) {
+	dh.mu.Lock()
+	defer dh.mu.Unlock()
+	dh.requests.add(req)
+	if req.Err != "" || req.Status >= 300 {
+		dh.errors.add(req)
+	}
+}
+
+// snapshot copies the requests and errors out, oldest first.
+func (dh *debugHistory) snapshot() ([]DebugRequest, []DebugRequest) {
+	dh.mu.Lock()
+	defer dh.mu.Unlock()
+	return dh.requests.list(), dh.errors.list()
+}
+
+// debugRing is a ring of requests, overwriting the oldest once full.
+type debugRing struct {
+	entries []DebugRequest
+	next    int
+	full    bool
+}
+
+// add adds a request, overwriting the oldest if full.
+func (dr *debugRing) add(req DebugRequest) {
+	dr.entries[dr.next] = req
+	dr.next = (dr.next + 1) % len(dr.entries)
+	if dr.next == 0 {
+		dr.full = true
+	}
+}
+
+// list copies the requests out, oldest first.
+func (dr *debugRing) list() []DebugRequest {
+	if !dr.full {
+		return append([]DebugRequest(nil), dr.entries[:dr.next]...)
+	}
+	return append(append([]DebugRequest(nil), dr.entries[dr.next:]...), dr.entries[:dr.next]...)
+}
+
+// record adds a request sent by do to the history.
+func (cc *Client) record(resource Requester, start time.Time, rr *Response, err error) {
+	req := DebugRequest{
+		Time:        start,
+		Fingerprint: requestFingerprint(resource),
+		Duration:    since(cc.clock, start),
+	}
+	if rr != nil && rr.Response != nil {
+		req.Status = rr.StatusCode
+		if rr.Request != nil {
+			req.Endpoint = rr.Request.Method + " " + rr.Request.URL.Path
+		}
+	} else if hr, herr := resource.Request(cc.serverURL); herr == nil {
+		req.Endpoint = hr.Method + " " + hr.URL.Path
+	}
+	if err != nil {
+		req.Err = err.Error()
+	}
+	cc.history.add(req)
+}
+
+// requestFingerprint fingerprints the statement or query of a request.
+func requestFingerprint(resource Requester) string {
+	switch rr := resource.(type) {
+	case *Resource:
+		if rr.Payload != nil {
+			return QueryFingerprint(rr.Payload.Ksql, rr.Payload.Props)
+		}
+	case *StreamResource:
+		if rr.Payload != nil {
+			props := make(map[string]string, len(rr.Payload.Properties))
+			for name, value := range rr.Payload.Properties {
+				props[name] = fmt.Sprint(value)
+			}
+			return QueryFingerprint(rr.Payload.SQL, props)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,609 @@
+package ksqldb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// HeaderValueMode decides how the byte values of Kafka record headers,
+// read through HEADERS and HEADER('key') columns, are decoded.
+type HeaderValueMode int
+
+const (
+	// HeaderValuesBytes decodes HEADERS columns into []RecordHeader, and
+	// HEADER('key') columns into []byte.
+	HeaderValuesBytes HeaderValueMode = iota
+
+	// HeaderValuesString decodes HEADERS columns into []StringHeader, and
+	// HEADER('key') columns into string, for headers known to hold text.
+	HeaderValuesString
+)
+
+// RecordHeader is a Kafka record header, as read from a HEADERS column.
+type RecordHeader struct {
+	Key   string
+	Value []byte
+}
+
+// StringHeader is a RecordHeader whose value is decoded as a string.
+type StringHeader struct {
+	Key   string
+	Value string
+}
+
+// MarshalJSON encodes the header as ksqlDB does, with a base64 value,
+// so that rows holding it decode the same way again.
+func (sh StringHeader) MarshalJSON() ([]byte, error) {
+	return json.Marshal(RecordHeader{Key: sh.Key, Value: []byte(sh.Value)})
+}
+
+// DecodeMode decides how tolerant decoding is of rows that do not match
+// their schema.
+type DecodeMode int
+
+const (
+	// DecodeDefault converts the values of known types, fails on those
+	// that cannot be, and passes anything else through as decoded.
+	DecodeDefault DecodeMode = iota
+
+	// DecodeStrict also fails on values whose JSON type does not match
+	// their column (a string in a BIGINT column, say) and on values
+	// beyond the columns of the schema.
+	DecodeStrict
+
+	// DecodeLenient coerces mismatched values where that is safe (the
+	// string "12" in a BIGINT column, say), decodes those it cannot as
+	// NULL, and drops values beyond the columns of the schema, keeping
+	// a warning of each (see Rows.Warnings) instead of failing.
+	DecodeLenient
+)
+
+// DecimalMode decides the Go type DECIMAL values are decoded into.
+type DecimalMode int
+
+const (
+	// DecimalNumber decodes DECIMALs into json.Number, holding their
+	// exact text.
+	DecimalNumber DecimalMode = iota
+
+	// DecimalRat decodes DECIMALs into *big.Rat, for exact arithmetic.
+	DecimalRat
+
+	// DecimalString passes DECIMALs through as their exact text, eg. for
+	// display or for types of another package.
+	DecimalString
+)
+
+// DecodeOptions configures how row values are decoded.
+type DecodeOptions struct {
+	HeaderValues HeaderValueMode
+	Mode         DecodeMode
+	Decimals     DecimalMode
+
+	// Temporal decodes TIMESTAMP and DATE columns into time.Time, and
+	// TIME columns into the time.Duration since midnight, whichever
+	// representation the server sends (see convertTemporal). Otherwise
+	// they are passed through as sent.
+	Temporal bool
+
+	// Location is the location of decoded TIMESTAMPs, which are
+	// instants, and the one DATEs are midnight in. It defaults to UTC.
+	Location *time.Location
+
+	// UseNumber keeps the numbers that are not converted by a column
+	// type (of unknown types, or in rows without a schema) as
+	// json.Number rather than float64, so that integers beyond 2^53
+	// keep their precision.
+	UseNumber bool
+}
+
+// headersType is the type of a HEADERS column, with all quoting and
+// whitespace removed.
+var headersType = strings.NewReplacer("`", "", " ", "").Replace(ksql.HeadersType)
+
+// isHeadersType reports whether a KSQL type is that of a HEADERS column.
+func isHeadersType(typ string) bool {
+	typ = strings.NewReplacer("`", "", " ", "").Replace(strings.ToUpper(typ))
+	return typ == headersType
+}
+
+// convertHeaders decodes the value of a HEADERS column: an array of
+// KEY/VALUE structs with base64-encoded values.
+func convertHeaders(value interface{}, mode HeaderValueMode) (interface{}, error) {
+	elems, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("headers are %T, not an array", value)
+	}
+	bytesHeaders := make([]RecordHeader, 0, len(elems))
+	stringHeaders := make([]StringHeader, 0, len(elems))
+	for _, elem := range elems {
+		fields, ok := elem.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("header is %T, not a struct", elem)
+		}
+		var (
+			key     string
+			encoded string
+		)
+		for name, field := range fields {
+			str, _ := field.(string)
+			switch strings.ToUpper(name) {
+			case "KEY":
+				key = str
+			case "VALUE":
+				encoded = str
+			}
+		}
+		val, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: decoding value: %w", key, err)
+		}
+		bytesHeaders = append(bytesHeaders, RecordHeader{Key: key, Value: val})
+		stringHeaders = append(stringHeaders, StringHeader{Key: key, Value: string(val)})
+	}
+	if mode == HeaderValuesString {
+		return stringHeaders, nil
+	}
+	return bytesHeaders, nil
+}
+
+// headerValue converts the value of a HEADER('key') column, decoded as
+// BYTES, per the HeaderValueMode.
+func headerValue(value interface{}, mode HeaderValueMode) interface{} {
+	if byt, ok := value.([]byte); ok && mode == HeaderValuesString {
+		return string(byt)
+	}
+	return value
+}
+
+// baseType returns a KSQL type without its parameters or members, eg.
+// DECIMAL for DECIMAL(10, 2) and ARRAY for ARRAY<STRING>.
+func baseType(typ string) string {
+	typ = strings.TrimSpace(typ)
+	if idx := strings.IndexAny(typ, "(<"); idx >= 0 {
+		typ = typ[:idx]
+	}
+	return strings.ToUpper(strings.TrimSpace(typ))
+}
+
+// decodeColumn decodes a raw column value according to its KSQL type.
+//
+// Values are first decoded with json.Number, so that nothing is lost to
+// float64 on the way: BIGINTs keep all 19 digits and DECIMALs all of
+// their scale. They are then converted precisely based on the type.
+func decodeColumn(raw json.RawMessage, typ string, opts DecodeOptions) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return convertValue(value, typ, opts)
+}
+
+// convertValue converts a value decoded with json.Number into the Go
+// type matching its KSQL type:
+//
+//	INT, INTEGER  int32
+//	BIGINT        int64
+//	DOUBLE        float64
+//	DECIMAL       json.Number, *big.Rat or string, see DecimalMode
+//	TIMESTAMP     time.Time, if DecodeOptions.Temporal is set
+//	DATE          time.Time, likewise
+//	TIME          time.Duration, likewise
+//	BYTES         []byte, decoded from base64
+//	HEADERS       []RecordHeader or []StringHeader, see DecodeOptions
+//	ARRAY         []interface{}, with elements converted by their type
+//	MAP, STRUCT   map[string]interface{}, likewise
+//
+// Values of other or unknown types are returned as decoded, except that
+// any numbers in them become float64, as with encoding/json, unless
+// DecodeOptions.UseNumber is set.
+//
+// Depending on the DecodeMode, values that do not match their type are
+// rejected or coerced.
+func convertValue(value interface{}, typ string, opts DecodeOptions) (interface{}, error) {
+	converted, err := convertTyped(value, typ, opts)
+	switch {
+	case opts.Mode == DecodeLenient && (err != nil || !matchesType(converted, typ)):
+		if coerced, ok := coerceValue(value, typ); ok {
+			return convertDecimal(coerced, typ, opts.Decimals)
+		}
+		if err == nil {
+			err = fmt.Errorf("%s is not a valid %s", describeValue(value), baseType(typ))
+		}
+		return nil, err
+	case opts.Mode == DecodeStrict && err == nil && !matchesType(converted, typ):
+		return nil, fmt.Errorf("%s is not a valid %s", describeValue(value), baseType(typ))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return convertDecimal(converted, typ, opts.Decimals)
+}
+
+// convertDecimal converts a DECIMAL, decoded into a json.Number, per the
+// DecimalMode. Other values are returned as they are.
+func convertDecimal(value interface{}, typ string, mode DecimalMode) (interface{}, error) {
+	num, ok := value.(json.Number)
+	if !ok || baseType(typ) != "DECIMAL" {
+		return value, nil
+	}
+	switch mode {
+	case DecimalRat:
+		rat, ok := new(big.Rat).SetString(num.String())
+		if !ok {
+			return nil, fmt.Errorf("%s is not a valid DECIMAL", num)
+		}
+		return rat, nil
+	case DecimalString:
+		return num.String(), nil
+	}
+	return num, nil
+}
+
+// convertTyped converts a value per its type, see convertValue.
+func convertTyped(value interface{}, typ string, opts DecodeOptions) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if isHeadersType(typ) {
+		return convertHeaders(value, opts.HeaderValues)
+	}
+	num, isNum := value.(json.Number)
+	switch baseType(typ) {
+	case "ARRAY", "MAP", "STRUCT":
+		return convertNested(value, typ, opts)
+	case "BYTES":
+		if str, ok := value.(string); ok {
+			byt, err := base64.StdEncoding.DecodeString(str)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not valid BYTES: %w", str, err)
+			}
+			return byt, nil
+		}
+	case "TIMESTAMP", "DATE", "TIME":
+		if opts.Temporal {
+			return convertTemporal(value, baseType(typ), opts.Location)
+		}
+	case "BIGINT":
+		if isNum {
+			vv, err := strconv.ParseInt(num.String(), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s is not a valid BIGINT", num)
+			}
+			return vv, nil
+		}
+	case "INT", "INTEGER":
+		if isNum {
+			vv, err := strconv.ParseInt(num.String(), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s is not a valid INT", num)
+			}
+			return int32(vv), nil
+		}
+	case "DOUBLE":
+		if isNum {
+			vv, err := num.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("%s is not a valid DOUBLE", num)
+			}
+			return vv, nil
+		}
+	case "DECIMAL":
+		if isNum {
+			return num, nil
+		}
+		if str, ok := value.(string); ok {
+			// Some serializers send decimals as strings to protect them
+			// from clients; take them at their word.
+			if _, err := strconv.ParseFloat(str, 64); err != nil {
+				return nil, fmt.Errorf("%q is not a valid DECIMAL", str)
+			}
+			return json.Number(str), nil
+		}
+	}
+	return untypedValue(value, opts.UseNumber), nil
+}
+
+// compositeType is the parsed type of an ARRAY, MAP or STRUCT: the type
+// of its elements, values or fields.
+type compositeType struct {
+	elem   string
+	fields map[string]string
+}
+
+// compositeTypes caches the parsed composite types by type.
+var compositeTypes sync.Map
+
+// parseComposite parses the member types of a composite type. Types
+// without members, or that cannot be parsed, have none.
+func parseComposite(typ string) *compositeType {
+	if cached, ok := compositeTypes.Load(typ); ok {
+		return cached.(*compositeType)
+	}
+	ct := &compositeType{}
+	open, end := strings.IndexByte(typ, '<'), strings.LastIndexByte(typ, '>')
+	if open >= 0 && end > open {
+		params := typ[open+1 : end]
+		switch baseType(typ) {
+		case "ARRAY":
+			ct.elem = strings.TrimSpace(params)
+		case "MAP":
+			if parts := splitTopLevel(params, ','); len(parts) == 2 {
+				ct.elem = strings.TrimSpace(parts[1])
+			}
+		case "STRUCT":
+			ct.fields = make(map[string]string)
+			for _, def := range splitTopLevel(params, ',') {
+				if name, fieldType := splitColumnDef(def); name != "" {
+					ct.fields[name] = fieldType
+				}
+			}
+		}
+	}
+	compositeTypes.Store(typ, ct)
+	return ct
+}
+
+// fieldType returns the type of a STRUCT field, matched exactly or else
+// case-insensitively.
+func (ct *compositeType) fieldType(name string) (string, bool) {
+	if typ, ok := ct.fields[name]; ok {
+		return typ, true
+	}
+	for field, typ := range ct.fields {
+		if strings.EqualFold(field, name) {
+			return typ, true
+		}
+	}
+	return "", false
+}
+
+// convertNested converts the members of an ARRAY, MAP or STRUCT value by
+// their types, recursively. Members of unknown types are converted as
+// untyped values.
+func convertNested(value interface{}, typ string, opts DecodeOptions) (interface{}, error) {
+	ct := parseComposite(typ)
+	switch vv := value.(type) {
+	case []interface{}:
+		for i, elem := range vv {
+			converted, err := convertValue(elem, ct.elem, opts)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			vv[i] = converted
+		}
+		return vv, nil
+	case map[string]interface{}:
+		for key, elem := range vv {
+			elemType := ct.elem
+			if ct.fields != nil {
+				elemType, _ = ct.fieldType(key)
+			}
+			converted, err := convertValue(elem, elemType, opts)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			vv[key] = converted
+		}
+		return vv, nil
+	}
+	return untypedValue(value, opts.UseNumber), nil
+}
+
+// matchesType reports whether a converted value has the Go type its
+// KSQL type converts to. Values of types without a fixed conversion
+// always match.
+func matchesType(value interface{}, typ string) bool {
+	if value == nil {
+		return true
+	}
+	var ok bool
+	switch baseType(typ) {
+	case "BIGINT":
+		_, ok = value.(int64)
+	case "INT", "INTEGER":
+		_, ok = value.(int32)
+	case "DOUBLE":
+		_, ok = value.(float64)
+	case "DECIMAL":
+		_, ok = value.(json.Number)
+	case "BYTES":
+		_, ok = value.([]byte)
+	case "BOOLEAN":
+		_, ok = value.(bool)
+	case "STRING", "VARCHAR":
+		_, ok = value.(string)
+	case "ARRAY":
+		_, ok = value.([]interface{})
+		if !ok {
+			_, ok = value.([]RecordHeader)
+		}
+		if !ok {
+			_, ok = value.([]StringHeader)
+		}
+	case "MAP", "STRUCT":
+		_, ok = value.(map[string]interface{})
+	default:
+		ok = true
+	}
+	return ok
+}
+
+// coerceValue converts a mismatched value to its column's type where
+// that loses nothing: numbers and booleans from their text, whole
+// floats to integers, and scalars to their text.
+func coerceValue(value interface{}, typ string) (interface{}, bool) {
+	text := ""
+	switch vv := value.(type) {
+	case string:
+		text = strings.TrimSpace(vv)
+	case json.Number:
+		text = vv.String()
+	case bool:
+		text = strconv.FormatBool(vv)
+	default:
+		return nil, false
+	}
+	switch baseType(typ) {
+	case "BIGINT", "INT", "INTEGER":
+		bits := 64
+		if baseType(typ) != "BIGINT" {
+			bits = 32
+		}
+		vv, err := strconv.ParseInt(text, 10, bits)
+		if err != nil {
+			ff, ferr := strconv.ParseFloat(text, 64)
+			if ferr != nil || ff != float64(int64(ff)) {
+				return nil, false
+			}
+			if vv, err = strconv.ParseInt(strconv.FormatInt(int64(ff), 10), 10, bits); err != nil {
+				return nil, false
+			}
+		}
+		if bits == 32 {
+			return int32(vv), true
+		}
+		return vv, true
+	case "DOUBLE":
+		vv, err := strconv.ParseFloat(text, 64)
+		return vv, err == nil
+	case "DECIMAL":
+		if _, err := strconv.ParseFloat(text, 64); err != nil {
+			return nil, false
+		}
+		return json.Number(text), true
+	case "BOOLEAN":
+		vv, err := strconv.ParseBool(text)
+		return vv, err == nil
+	case "STRING", "VARCHAR":
+		return text, true
+	}
+	return nil, false
+}
+
+// describeValue describes a decoded value for errors.
+func describeValue(value interface{}) string {
+	switch vv := value.(type) {
+	case string:
+		return strconv.Quote(vv)
+	case json.Number:
+		return vv.String()
+	case *big.Rat:
+		return ksql.DecimalString(vv)
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	}
+	return fmt.Sprint(value)
+}
+
+// untypedValue converts the json.Numbers in a decoded value to float64,
+// recursively, unless useNumber is set.
+func untypedValue(value interface{}, useNumber bool) interface{} {
+	if useNumber {
+		return value
+	}
+	switch vv := value.(type) {
+	case json.Number:
+		ff, err := vv.Float64()
+		if err != nil {
+			return vv
+		}
+		return ff
+	case []interface{}:
+		for i, elem := range vv {
+			vv[i] = untypedValue(elem, false)
+		}
+	case map[string]interface{}:
+		for key, elem := range vv {
+			vv[key] = untypedValue(elem, false)
+		}
+	}
+	return value
+}
+
+// encodableValue returns a copy of a decoded value that encodes to JSON
+// as the server would write it, and so decodes to the same types again.
+// At any depth, *big.Rats become their decimal text as a json.Number,
+// where their MarshalText would give quoted fractions, and TIMEs, as
+// time.Duration, become hh:mm:ss text (or milliseconds, out of a day's
+// range), where they would give nanoseconds.
+func encodableValue(value interface{}) interface{} {
+	switch vv := value.(type) {
+	case *big.Rat:
+		if vv != nil {
+			return json.Number(ksql.DecimalString(vv))
+		}
+	case time.Duration:
+		if vv >= 0 && vv < 24*time.Hour {
+			return ksql.TimeFormatter{}.TimeOfDay(vv)
+		}
+		return json.Number(strconv.FormatInt(int64(vv/time.Millisecond), 10))
+	case []interface{}:
+		elems := make([]interface{}, len(vv))
+		for i, elem := range vv {
+			elems[i] = encodableValue(elem)
+		}
+		return elems
+	case map[string]interface{}:
+		elems := make(map[string]interface{}, len(vv))
+		for key, elem := range vv {
+			elems[key] = encodableValue(elem)
+		}
+		return elems
+	}
+	return value
+}
+
+// encodableRow returns a copy of a row whose values are encodable, see
+// encodableValue.
+func encodableRow(row Row) Row {
+	values := make([]interface{}, len(row.Values))
+	for i, value := range row.Values {
+		values[i] = encodableValue(value)
+	}
+	row.Values = values
+	return row
+}
+
+// retypeRow re-applies column types to a row decoded generically (with
+// json.Number) from its own JSON encoding, eg. by a CacheStore.
+func retypeRow(row *Row, opts DecodeOptions) error {
+	for i, value := range row.Values {
+		var col Column
+		if i < len(row.Columns) {
+			col = row.Columns[i]
+		}
+		if _, ok := value.(string); ok && col.HeaderKey != "" && opts.HeaderValues == HeaderValuesString {
+			// Encoded as the text it was decoded into, not as BYTES.
+			continue
+		}
+		if str, ok := value.(string); ok && baseType(col.Type) == "DECIMAL" {
+			// Rows stored before Rats were encodable hold them as "n/d".
+			if rat, ok := new(big.Rat).SetString(str); ok {
+				value = json.Number(ksql.DecimalString(rat))
+			}
+		}
+		converted, err := convertValue(value, col.Type, opts)
+		if err != nil {
+			return err
+		}
+		if col.HeaderKey != "" {
+			converted = headerValue(converted, opts.HeaderValues)
+		}
+		row.Values[i] = converted
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package ksqldb
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeColumn(t *testing.T) {
+	const decimal = "12345678901234567890.123456789012345678"
+	tests := []struct {
+		name    string
+		raw     string
+		typ     string
+		opts    DecodeOptions
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name: "max bigint",
+			raw:  "9223372036854775807",
+			typ:  "BIGINT",
+			want: int64(9223372036854775807),
+		},
+		{
+			name: "min bigint",
+			raw:  "-9223372036854775808",
+			typ:  "BIGINT",
+			want: int64(-9223372036854775808),
+		},
+		{
+			name:    "bigint overflow",
+			raw:     "9223372036854775808",
+			typ:     "BIGINT",
+			wantErr: true,
+		},
+		{
+			name: "decimal as number",
+			raw:  decimal,
+			typ:  "DECIMAL(38, 18)",
+			want: json.Number(decimal),
+		},
+		{
+			name: "decimal as string",
+			raw:  `"` + decimal + `"`,
+			typ:  "DECIMAL(38, 18)",
+			want: json.Number(decimal),
+		},
+		{
+			name: "decimal as rat",
+			raw:  decimal,
+			typ:  "DECIMAL(38, 18)",
+			opts: DecodeOptions{Decimals: DecimalRat},
+			want: mustRat(t, decimal),
+		},
+		{
+			name: "decimal as text",
+			raw:  `"` + decimal + `"`,
+			typ:  "DECIMAL(38, 18)",
+			opts: DecodeOptions{Decimals: DecimalString},
+			want: decimal,
+		},
+		{
+			name: "strict bigint",
+			raw:  "9223372036854775807",
+			typ:  "BIGINT",
+			opts: DecodeOptions{Mode: DecodeStrict},
+			want: int64(9223372036854775807),
+		},
+		{
+			name:    "strict bigint as string",
+			raw:     `"9223372036854775807"`,
+			typ:     "BIGINT",
+			opts:    DecodeOptions{Mode: DecodeStrict},
+			wantErr: true,
+		},
+		{
+			name: "strict decimal as string",
+			raw:  `"` + decimal + `"`,
+			typ:  "DECIMAL(38, 18)",
+			opts: DecodeOptions{Mode: DecodeStrict},
+			want: json.Number(decimal),
+		},
+		{
+			name:    "strict decimal as bool",
+			raw:     "true",
+			typ:     "DECIMAL(38, 18)",
+			opts:    DecodeOptions{Mode: DecodeStrict},
+			wantErr: true,
+		},
+		{
+			name: "lenient bigint as string",
+			raw:  `"9223372036854775807"`,
+			typ:  "BIGINT",
+			opts: DecodeOptions{Mode: DecodeLenient},
+			want: int64(9223372036854775807),
+		},
+		{
+			name: "lenient decimal as rat",
+			raw:  `"` + decimal + `"`,
+			typ:  "DECIMAL(38, 18)",
+			opts: DecodeOptions{Mode: DecodeLenient, Decimals: DecimalRat},
+			want: mustRat(t, decimal),
+		},
+		{
+			name:    "lenient decimal as text",
+			raw:     `"twelve"`,
+			typ:     "DECIMAL(38, 18)",
+			opts:    DecodeOptions{Mode: DecodeLenient},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeColumn(json.RawMessage(tt.raw), tt.typ, tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decodeColumn(%s, %s) = %#v, want an error", tt.raw, tt.typ, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeColumn(%s, %s): %v", tt.raw, tt.typ, err)
+			}
+			if rat, ok := tt.want.(*big.Rat); ok {
+				if gotRat, ok := got.(*big.Rat); !ok || gotRat.Cmp(rat) != 0 {
+					t.Fatalf("decodeColumn(%s, %s) = %#v, want %s", tt.raw, tt.typ, got, rat.FloatString(18))
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("decodeColumn(%s, %s) = %#v, want %#v", tt.raw, tt.typ, got, tt.want)
+			}
+		})
+	}
+}
+
+func mustRat(t *testing.T, text string) *big.Rat {
+	t.Helper()
+	rat, ok := new(big.Rat).SetString(text)
+	if !ok {
+		t.Fatalf("invalid rational %s", text)
+	}
+	return rat
+}
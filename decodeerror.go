@@ -0,0 +1,103 @@
+package ksqldb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxSnippet is the number of bytes of the offending input a DecodeError
+// quotes.
+const maxSnippet = 64
+
+// DecodeError is a failure to decode a row or an entity, with enough
+// context to track down schema drift: where in the response it happened
+// and a snippet of the offending input. The underlying error, such as a
+// *json.UnmarshalTypeError, is available through errors.As.
+type DecodeError struct {
+	// Row is the 1-based number of the row in the response, or zero if
+	// the failure was not in a row.
+	Row int64
+
+	// Column is the name of the column being decoded, if any.
+	Column string
+
+	// Type is the expected type: the column's KSQL type, or the kind of
+	// entity.
+	Type string
+
+	// Snippet is the offending input, around the failure if its offset
+	// is known, truncated.
+	Snippet string
+
+	Err error
+}
+
+// newDecodeError builds a DecodeError quoting the input around where err
+// happened.
+func newDecodeError(input []byte, err error) *DecodeError {
+	return &DecodeError{Snippet: snippet(input, errorOffset(err)), Err: err}
+}
+
+// Error implements error.
+func (de *DecodeError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("decoding")
+	if de.Row > 0 {
+		fmt.Fprintf(&sb, " row %d", de.Row)
+	}
+	if de.Column != "" {
+		fmt.Fprintf(&sb, " column %s", de.Column)
+	}
+	if de.Type != "" {
+		fmt.Fprintf(&sb, " as %s", de.Type)
+	}
+	fmt.Fprintf(&sb, ": %v", de.Err)
+	if de.Snippet != "" {
+		fmt.Fprintf(&sb, " (near %q)", de.Snippet)
+	}
+	return sb.String()
+}
+
+// Unwrap returns the underlying error.
+func (de *DecodeError) Unwrap() error {
+	return de.Err
+}
+
+// errorOffset returns the input offset of a JSON decoding error, or -1.
+func errorOffset(err error) int64 {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return syntaxErr.Offset
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return typeErr.Offset
+	}
+	return -1
+}
+
+// snippet quotes the input around the offset, or from its start if the
+// offset is unknown.
+func snippet(input []byte, offset int64) string {
+	start := int64(0)
+	if offset > maxSnippet/2 {
+		start = offset - maxSnippet/2
+	}
+	if start > int64(len(input)) {
+		start = int64(len(input))
+	}
+	end := start + maxSnippet
+	if end > int64(len(input)) {
+		end = int64(len(input))
+	}
+	quoted := string(input[start:end])
+	if start > 0 {
+		quoted = "..." + quoted
+	}
+	if end < int64(len(input)) {
+		quoted += "..."
+	}
+	return quoted
+}
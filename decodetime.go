@@ -0,0 +1,78 @@
+package ksqldb
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Layouts of the text forms of temporal values, as sent by servers that
+// do not send numbers. TIMESTAMPs carry no zone and are in UTC.
+const (
+	timestampLayout = "2006-01-02T15:04:05.999999999"
+	dateLayout      = "2006-01-02"
+	timeLayout      = "15:04:05.999999999"
+)
+
+// convertTemporal converts the value of a TIMESTAMP, DATE or TIME column,
+// as sent by any server version:
+//
+//	TIMESTAMP  epoch milliseconds, or text without zone in UTC
+//	DATE       days since the epoch, or yyyy-mm-dd
+//	TIME       milliseconds since midnight, or hh:mm:ss[.fff]
+//
+// Text in RFC 3339, as the client encodes times itself (eg. for a
+// CacheStore), is read as well. TIMESTAMPs are returned in loc, and
+// DATEs at midnight in loc.
+func convertTemporal(value interface{}, typ string, loc *time.Location) (interface{}, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	num, isNum := value.(json.Number)
+	str, isStr := value.(string)
+	if !isNum && !isStr {
+		return nil, fmt.Errorf("%s is not a valid %s", describeValue(value), typ)
+	}
+	var count int64
+	if isNum {
+		var err error
+		if count, err = num.Int64(); err != nil {
+			return nil, fmt.Errorf("%s is not a valid %s", num, typ)
+		}
+	}
+
+	switch typ {
+	case "TIMESTAMP":
+		if isNum {
+			return time.Unix(0, count*int64(time.Millisecond)).In(loc), nil
+		}
+		if t, err := time.Parse(timestampLayout, str); err == nil {
+			return t.In(loc), nil
+		}
+		if t, err := time.Parse(time.RFC3339Nano, str); err == nil {
+			return t.In(loc), nil
+		}
+	case "DATE":
+		if isNum {
+			t := time.Unix(count*24*60*60, 0).UTC()
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc), nil
+		}
+		if len(str) > len(dateLayout) {
+			// An RFC 3339 time, keeping its date.
+			if t, err := time.Parse(time.RFC3339Nano, str); err == nil {
+				str = t.Format(dateLayout)
+			}
+		}
+		if t, err := time.ParseInLocation(dateLayout, str, loc); err == nil {
+			return t, nil
+		}
+	case "TIME":
+		if isNum {
+			return time.Duration(count) * time.Millisecond, nil
+		}
+		if t, err := time.Parse(timeLayout, str); err == nil {
+			return t.Sub(time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)), nil
+		}
+	}
+	return nil, fmt.Errorf("%q is not a valid %s", str, typ)
+}
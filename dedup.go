@@ -0,0 +1,130 @@
+package ksqldb
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DedupStore remembers the keys of processed rows for Dedup. Stores
+// shared with other processes (eg. backed by Redis) make dedup survive
+// restarts.
+type DedupStore interface {
+	// Seen records the key, reporting whether it had already been
+	// recorded (and not yet forgotten).
+	Seen(key string) (bool, error)
+}
+
+// Dedup returns a row filter, for Rows.Filter and the like, dropping
+// rows whose key the store has already seen. It makes consumers
+// exactly-once-ish: the rows replayed after a reconnect or a retry are
+// skipped, as long as they are still in the store's window.
+//
+//	window := ksqldb.NewDedupWindow(ksqldb.DedupWindowOptions{TTL: time.Hour})
+//	rows = rows.Filter(ksqldb.Dedup(ksqldb.KeyColumn("EVENT_ID"), window))
+func Dedup(key KeyFunc, store DedupStore) func(Row) (bool, error) {
+	return func(row Row) (bool, error) {
+		k, err := key(row)
+		if err != nil {
+			return false, fmt.Errorf("deduplicating row: %w", err)
+		}
+		seen, err := store.Seen(k)
+		if err != nil {
+			return false, fmt.Errorf("deduplicating row %s: %w", k, err)
+		}
+		return !seen, nil
+	}
+}
+
+// DefaultDedupWindowSize is the size of a DedupWindow created without
+// bounds.
+const DefaultDedupWindowSize = 10000
+
+// DedupWindowOptions bound a DedupWindow. At least one of them must be
+// set.
+type DedupWindowOptions struct {
+	// Size is the number of keys remembered, the oldest being forgotten
+	// first.
+	Size int
+
+	// TTL is how long keys are remembered for.
+	TTL time.Duration
+
+	// Clock is the time source for TTL. It defaults to SystemClock.
+	Clock Clock
+}
+
+// dedupEntry is a key remembered by a DedupWindow.
+type dedupEntry struct {
+	key  string
+	seen time.Time
+}
+
+// DedupWindow is an in-memory DedupStore remembering keys within a
+// bounded window, by count and/or time. It is safe for concurrent use,
+// so that a window can outlive the queries it deduplicates.
+type DedupWindow struct {
+	opts DedupWindowOptions
+
+	mu    sync.Mutex
+	keys  map[string]*list.Element
+	order *list.List
+}
+
+// NewDedupWindow creates a DedupWindow. Without bounds, it remembers
+// DefaultDedupWindowSize keys.
+func NewDedupWindow(opts DedupWindowOptions) *DedupWindow {
+	if opts.Size <= 0 && opts.TTL <= 0 {
+		opts.Size = DefaultDedupWindowSize
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	return &DedupWindow{opts: opts, keys: make(map[string]*list.Element), order: list.New()}
+}
+
+// Seen implements DedupStore. A key seen again is not refreshed: it is
+// forgotten as of when it was first seen.
+func (dw *DedupWindow) Seen(key string) (bool, error) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+
+	now := dw.opts.Clock.Now()
+	dw.expire(now)
+	if _, ok := dw.keys[key]; ok {
+		return true, nil
+	}
+	dw.keys[key] = dw.order.PushBack(dedupEntry{key: key, seen: now})
+	if dw.opts.Size > 0 && dw.order.Len() > dw.opts.Size {
+		dw.remove(dw.order.Front())
+	}
+	return false, nil
+}
+
+// expire forgets the keys older than the TTL.
+func (dw *DedupWindow) expire(now time.Time) {
+	if dw.opts.TTL <= 0 {
+		return
+	}
+	for el := dw.order.Front(); el != nil; el = dw.order.Front() {
+		if now.Sub(el.Value.(dedupEntry).seen) < dw.opts.TTL {
+			return
+		}
+		dw.remove(el)
+	}
+}
+
+// remove forgets a key.
+func (dw *DedupWindow) remove(el *list.Element) {
+	dw.order.Remove(el)
+	delete(dw.keys, el.Value.(dedupEntry).key)
+}
+
+// Len returns the number of keys remembered.
+func (dw *DedupWindow) Len() int {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	dw.expire(dw.opts.Clock.Now())
+	return dw.order.Len()
+}
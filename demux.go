@@ -0,0 +1,275 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// RouteHandler handles the rows of a Demux route.
+type RouteHandler func(ctx context.Context, row Row) error
+
+// DemuxOptions configure a Demux.
+type DemuxOptions struct {
+	// Column is the column rows are routed on.
+	Column string
+
+	// Buffer is the number of rows buffered per route. It defaults to 64.
+	Buffer int
+
+	// Overflow applies to routes whose buffer is full: the query is
+	// never held back by a slow route.
+	Overflow OverflowPolicy
+
+	// Logger logs the errors of the handlers.
+	Logger Logger
+}
+
+// RouteStats describes the rows of a route.
+type RouteStats struct {
+	// Handled is the number of rows handled, and Errors the number the
+	// handler failed, or panicked, on.
+	Handled int64
+	Errors  int64
+
+	// Dropped is the number of rows discarded because the route's
+	// buffer was full, or the route ended under OverflowDisconnect.
+	Dropped int64
+
+	// Err is the last error of the handler, or ErrSubscriberOverflow if
+	// the route ended under OverflowDisconnect.
+	Err error
+}
+
+// DemuxStats describes the routing of a Demux.
+type DemuxStats struct {
+	// Routes are the stats of the routes, by value. Those of the default
+	// route, if any, are under DefaultRoute.
+	Routes map[string]RouteStats
+
+	// Unrouted is the number of rows of no route, discarded.
+	Unrouted int64
+}
+
+// DefaultRoute is the name under which DemuxStats reports the default
+// route.
+const DefaultRoute = "*"
+
+// Demux routes the rows of one push query to handlers by the value of a
+// column, eg. a handler per market on a stream of transactions, rather
+// than running a query per handler on the server. Each route has its own
+// buffer and goroutine, so that a slow or failing handler only holds up
+// its own rows:
+//
+//	demux := ksqldb.NewDemux(ksqldb.DemuxOptions{Column: "MARKETID"})
+//	demux.Handle("22210", handleEUR)
+//	demux.Handle("22211", handleUSD)
+//	err := demux.Run(ctx, rows)
+//
+// Routes are matched on the value as fmt.Sprint renders it.
+type Demux struct {
+	opts DemuxOptions
+
+	mu       sync.Mutex
+	routes   map[string]*route
+	fallback *route
+	unrouted int64
+}
+
+// route is the buffer and handler of a route.
+type route struct {
+	handler RouteHandler
+	ch      chan Row
+	ended   bool
+
+	handled int64
+	errors  int64
+	dropped int64
+	err     atomic.Value
+}
+
+// NewDemux creates a Demux.
+func NewDemux(opts DemuxOptions) *Demux {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 64
+	}
+	if opts.Logger == nil {
+		opts.Logger = nopLogger{}
+	}
+	return &Demux{opts: opts, routes: make(map[string]*route)}
+}
+
+// Handle routes the rows of the value to the handler. It must be called
+// before Run.
+func (dm *Demux) Handle(value string, handler RouteHandler) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.routes[value] = &route{handler: handler}
+}
+
+// HandleDefault routes the rows of no other route to the handler. It
+// must be called before Run.
+func (dm *Demux) HandleDefault(handler RouteHandler) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.fallback = &route{handler: handler}
+}
+
+// Run routes the rows until they end or ctx is done, and waits for the
+// routes to handle the rows buffered (unless ctx is done). The errors of
+// the handlers do not end it, see Stats. A Demux runs once.
+//
+// It returns the rows' error, or ctx's, and closes the rows.
+func (dm *Demux) Run(ctx context.Context, rows *Rows) error {
+	defer rows.Close()
+	routes := dm.all()
+	var wg sync.WaitGroup
+	for name, rt := range routes {
+		rt.ch = make(chan Row, dm.opts.Buffer)
+		wg.Add(1)
+		go func(name string, rt *route) {
+			defer wg.Done()
+			dm.serve(ctx, name, rt)
+		}(name, rt)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			rows.Close()
+		case <-stop:
+		}
+	}()
+	for rows.Next() {
+		dm.route(rows.Row())
+	}
+	for _, rt := range routes {
+		dm.mu.Lock()
+		if !rt.ended {
+			rt.ended = true
+			close(rt.ch)
+		}
+		dm.mu.Unlock()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("demultiplexing rows: %w", err)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("demultiplexing rows: %w", err)
+	}
+	return nil
+}
+
+// all returns the routes by name, the default one under DefaultRoute.
+func (dm *Demux) all() map[string]*route {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	routes := make(map[string]*route, len(dm.routes)+1)
+	for name, rt := range dm.routes {
+		routes[name] = rt
+	}
+	if dm.fallback != nil {
+		routes[DefaultRoute] = dm.fallback
+	}
+	return routes
+}
+
+// route buffers a row on its route without blocking.
+func (dm *Demux) route(row Row) {
+	value, _ := row.Get(dm.opts.Column)
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	rt, ok := dm.routes[fmt.Sprint(value)]
+	if !ok {
+		rt = dm.fallback
+	}
+	if rt == nil {
+		dm.unrouted++
+		return
+	}
+	if rt.ended {
+		atomic.AddInt64(&rt.dropped, 1)
+		return
+	}
+	select {
+	case rt.ch <- row:
+		return
+	default:
+	}
+	atomic.AddInt64(&rt.dropped, 1)
+	if dm.opts.Overflow == OverflowDisconnect {
+		rt.ended = true
+		rt.err.Store(routeErr{ErrSubscriberOverflow})
+		close(rt.ch)
+		return
+	}
+	select {
+	case <-rt.ch:
+	default:
+	}
+	select {
+	case rt.ch <- row:
+	default:
+	}
+}
+
+// serve hands the rows of a route to its handler.
+func (dm *Demux) serve(ctx context.Context, name string, rt *route) {
+	for row := range rt.ch {
+		if ctx.Err() != nil {
+			// The rest of the buffer is dropped.
+			atomic.AddInt64(&rt.dropped, 1)
+			continue
+		}
+		if err := callRoute(ctx, rt.handler, row); err != nil {
+			atomic.AddInt64(&rt.errors, 1)
+			rt.err.Store(routeErr{err})
+			dm.opts.Logger.Log("demux handler failed", "route", name, "err", err)
+			continue
+		}
+		atomic.AddInt64(&rt.handled, 1)
+	}
+}
+
+// callRoute calls a handler, turning a panic into an error so that it
+// only fails the row.
+func callRoute(ctx context.Context, handler RouteHandler, row Row) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("handler panicked: %v", rec)
+		}
+	}()
+	return handler(ctx, row)
+}
+
+// routeErr boxes the errors of a route, which differ in type, for an
+// atomic.Value.
+type routeErr struct {
+	err error
+}
+
+// Stats returns the stats of the routes.
+func (dm *Demux) Stats() DemuxStats {
+	routes := dm.all()
+	stats := DemuxStats{Routes: make(map[string]RouteStats, len(routes))}
+	for name, rt := range routes {
+		rs := RouteStats{
+			Handled: atomic.LoadInt64(&rt.handled),
+			Errors:  atomic.LoadInt64(&rt.errors),
+			Dropped: atomic.LoadInt64(&rt.dropped),
+		}
+		if boxed, ok := rt.err.Load().(routeErr); ok {
+			rs.Err = boxed.err
+		}
+		stats.Routes[name] = rs
+	}
+	dm.mu.Lock()
+	stats.Unrouted = dm.unrouted
+	dm.mu.Unlock()
+	return stats
+}
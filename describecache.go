@@ -0,0 +1,156 @@
+package ksqldb
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// describeCache holds source descriptions by canonical name for a time.
+// A zero TTL disables it.
+type describeCache struct {
+	ttl   time.Duration
+	clock Clock
+
+	mu      sync.Mutex
+	entries map[string]describeEntry
+	// gen counts invalidations, so that descriptions read while one
+	// happened are not cached.
+	gen int64
+
+	hits          int64
+	misses        int64
+	invalidations int64
+}
+
+// describeEntry is a cached description and when it was read.
+type describeEntry struct {
+	desc *SourceDescription
+	read time.Time
+}
+
+// newDescribeCache creates a cache keeping descriptions for ttl.
+func newDescribeCache(ttl time.Duration, clock Clock) *describeCache {
+	return &describeCache{ttl: ttl, clock: clock, entries: make(map[string]describeEntry)}
+}
+
+// get looks up a fresh description, counting the hit or miss. The copy
+// returned may be modified by the caller, except for its slices.
+func (dc *describeCache) get(name string) (*SourceDescription, bool) {
+	if dc.ttl <= 0 {
+		return nil, false
+	}
+	dc.mu.Lock()
+	entry, ok := dc.entries[name]
+	if ok && dc.clock.Now().Sub(entry.read) >= dc.ttl {
+		delete(dc.entries, name)
+		ok = false
+	}
+	dc.mu.Unlock()
+	if !ok {
+		atomic.AddInt64(&dc.misses, 1)
+		return nil, false
+	}
+	atomic.AddInt64(&dc.hits, 1)
+	desc := *entry.desc
+	return &desc, true
+}
+
+// generation returns the current generation, to pass to put.
+func (dc *describeCache) generation() int64 {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.gen
+}
+
+// put caches a description read in the given generation, unless the
+// cache was invalidated since.
+func (dc *describeCache) put(name string, sd *SourceDescription, gen int64) {
+	if dc.ttl <= 0 {
+		return
+	}
+	desc := *sd
+	dc.mu.Lock()
+	if dc.gen == gen {
+		dc.entries[name] = describeEntry{desc: &desc, read: dc.clock.Now()}
+	}
+	dc.mu.Unlock()
+}
+
+// invalidate drops the named descriptions, or all of them.
+func (dc *describeCache) invalidate(names ...string) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.gen++
+	if len(dc.entries) == 0 {
+		return
+	}
+	atomic.AddInt64(&dc.invalidations, 1)
+	if len(names) == 0 {
+		dc.entries = make(map[string]describeEntry)
+		return
+	}
+	for _, name := range names {
+		delete(dc.entries, name)
+	}
+}
+
+// stats reports on the cache.
+func (dc *describeCache) stats() DescribeCacheStats {
+	dc.mu.Lock()
+	size := len(dc.entries)
+	dc.mu.Unlock()
+	return DescribeCacheStats{
+		Hits:          atomic.LoadInt64(&dc.hits),
+		Misses:        atomic.LoadInt64(&dc.misses),
+		Invalidations: atomic.LoadInt64(&dc.invalidations),
+		Size:          size,
+	}
+}
+
+// DescribeCacheStats describes the use of the description cache (see
+// ClientOptions.DescribeCacheTTL).
+type DescribeCacheStats struct {
+	Hits          int64
+	Misses        int64
+	Invalidations int64
+	Size          int
+}
+
+// InvalidateDescriptions drops the cached descriptions of the named
+// sources, or of all sources if none is named, eg. after DDL run by
+// another client. DDL run through this client invalidates the cache by
+// itself.
+func (cc *Client) InvalidateDescriptions(sources ...string) {
+	names := make([]string, len(sources))
+	for i, source := range sources {
+		names[i] = cc.casePolicy.Canonical(source)
+	}
+	cc.describes.invalidate(names...)
+}
+
+// changesSources reports whether a script may change the sources or
+// their queries: DDL, including persistent queries, and TERMINATE.
+func changesSources(script string) bool {
+	for _, stmt := range ksql.SplitStatements(script) {
+		if ksql.KindOf(stmt.Text) == ksql.KindDDL {
+			return true
+		}
+		if fields := strings.Fields(stmt.Text); len(fields) > 0 && strings.EqualFold(fields[0], "TERMINATE") {
+			return true
+		}
+	}
+	return false
+}
+
+// changesSources reports whether the resource's statements may change
+// sources, by its kind if known.
+func (rr *Resource) changesSources() bool {
+	if rr.kind != "" {
+		return rr.kind == ksql.KindDDL
+	}
+	return changesSources(rr.Payload.Ksql)
+}
@@ -0,0 +1,154 @@
+package ksqldb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"hews.co/ksqldb/pkg/ksql"
+	"hews.co/ksqldb/pkg/ksqldbapi"
+)
+
+// DestructiveGuard protects shared environments from scripted accidents:
+// destructive operations (see ksql.Destructive, and TerminateCluster)
+// are refused unless confirmed for the call with ConfirmDestructive, or
+// approved by the Approve callback.
+type DestructiveGuard struct {
+	// Approve, if set, is asked about destructive operations that were
+	// not confirmed, eg. to prompt an operator or check a change ticket.
+	// Returning nil approves the operation.
+	Approve func(ctx context.Context, op DestructiveOperation) error
+}
+
+// DestructiveOperation is an operation stopped by a DestructiveGuard.
+type DestructiveOperation struct {
+	// Statement is the destructive statement, or TERMINATE CLUSTER.
+	Statement string
+
+	// Reason tells what makes it destructive.
+	Reason string
+}
+
+// DestructiveError is returned for destructive operations refused by a
+// DestructiveGuard. Err is the refusal of the Approve callback, if any.
+type DestructiveError struct {
+	Operation DestructiveOperation
+	Err       error
+}
+
+// Error implements error.
+func (err *DestructiveError) Error() string {
+	msg := fmt.Sprintf("refusing destructive operation %q, which %s", err.Operation.Statement, err.Operation.Reason)
+	if err.Err != nil {
+		return msg + ": " + err.Err.Error()
+	}
+	return msg + ": not confirmed"
+}
+
+// Unwrap returns the refusal of the Approve callback, if any.
+func (err *DestructiveError) Unwrap() error {
+	return err.Err
+}
+
+// destructiveConfirmed is the context key of ConfirmDestructive.
+type destructiveConfirmed struct{}
+
+// ConfirmDestructive confirms the destructive operations run with ctx,
+// for a client with a DestructiveGuard:
+//
+//	err := client.TerminateQuery(ksqldb.ConfirmDestructive(ctx), "ALL")
+func ConfirmDestructive(ctx context.Context) context.Context {
+	return context.WithValue(ctx, destructiveConfirmed{}, true)
+}
+
+// check refuses the destructive operations of a request, unless they are
+// confirmed or approved.
+func (dg *DestructiveGuard) check(ctx context.Context, resource Requester, req *http.Request) error {
+	if dg == nil {
+		return nil
+	}
+	if confirmed, _ := ctx.Value(destructiveConfirmed{}).(bool); confirmed {
+		return nil
+	}
+	for _, op := range destructiveOperations(resource, req) {
+		if dg.Approve == nil {
+			return &DestructiveError{Operation: op}
+		}
+		if err := dg.Approve(ctx, op); err != nil {
+			return &DestructiveError{Operation: op, Err: err}
+		}
+	}
+	return nil
+}
+
+// destructiveOperations lists the destructive operations of a request.
+func destructiveOperations(resource Requester, req *http.Request) []DestructiveOperation {
+	if req.URL.Path == ksqldbapi.EndpointTerminate.Path {
+		return []DestructiveOperation{{
+			Statement: "TERMINATE CLUSTER",
+			Reason:    "terminates every query, deletes every source and may delete their topics",
+		}}
+	}
+	res, ok := resource.(*Resource)
+	if !ok || res.Payload == nil || res.kind == ksql.KindPullQuery {
+		return nil
+	}
+	var ops []DestructiveOperation
+	for _, stmt := range ksql.SplitStatements(res.Payload.Ksql) {
+		if reason, ok := ksql.Destructive(stmt.Text); ok {
+			ops = append(ops, DestructiveOperation{Statement: stmt.Text, Reason: reason})
+		}
+	}
+	return ops
+}
+
+// terminateClusterRequest is the request of TerminateCluster.
+type terminateClusterRequest struct {
+	DeleteTopicList []string `json:"deleteTopicList,omitempty"`
+}
+
+// MarshalJSON implements Requester.
+func (tr terminateClusterRequest) MarshalJSON() ([]byte, error) {
+	type plain terminateClusterRequest
+	return json.Marshal(plain(tr))
+}
+
+// Request implements Requester.
+func (tr terminateClusterRequest) Request(serverURL *url.URL) (*http.Request, error) {
+	byt, err := tr.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("ksql request: marshaling request: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, ksqldbapi.EndpointTerminate.On(serverURL).String(), bytes.NewReader(byt))
+	if err != nil {
+		return nil, fmt.Errorf("ksql request: creating HTTP request: %w", err)
+	}
+	for name, value := range DefaultHeaders {
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
+
+// TerminateCluster terminates the server's cluster: every persistent
+// query, and every source, deleting the topics matching the given
+// patterns (eg. "orders_.*"). It is a destructive operation, see
+// DestructiveGuard.
+func (cc *Client) TerminateCluster(ctx context.Context, deleteTopics ...string) error {
+	rh, err := cc.do(ctx, terminateClusterRequest{DeleteTopicList: deleteTopics})
+	if err != nil {
+		return fmt.Errorf("terminating cluster: %w", err)
+	}
+	defer rh.Close()
+
+	byt, err := rh.ReadAll()
+	if err != nil {
+		return fmt.Errorf("terminating cluster: %w", err)
+	}
+	if rh.StatusCode < http.StatusOK || rh.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("terminating cluster: %w", rh.responseError(byt, nil))
+	}
+	return nil
+}
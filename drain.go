@@ -0,0 +1,129 @@
+package ksqldb
+
+import (
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+)
+
+// DrainBudget bounds the draining of a response given up on: the body
+// left unread by Close, and the records still in flight when reading
+// ends early (on cancellation, or a handler's error). Past the budget,
+// the rest is discarded and the body closed, which makes the latency of
+// cancellation predictable, at the cost of the connection.
+type DrainBudget struct {
+	// Records is the number of records still passed on to the consumer
+	// once reading ends. It defaults to no limit.
+	Records int
+
+	// Bytes is the number of bytes drained. It defaults to 256 KiB.
+	Bytes int64
+
+	// Time is the time given to the drain. It defaults to 100ms.
+	Time time.Duration
+}
+
+// withDefaults fills in the defaults of the budget.
+func (db DrainBudget) withDefaults() DrainBudget {
+	if db.Bytes <= 0 {
+		db.Bytes = 256 << 10
+	}
+	if db.Time <= 0 {
+		db.Time = 100 * time.Millisecond
+	}
+	return db
+}
+
+// DrainStats describes what the draining of a response discarded.
+type DrainStats struct {
+	// Records and Bytes are the records (or bytes of an unread body)
+	// discarded rather than passed on.
+	Records int64
+	Bytes   int64
+
+	// Forced is set if the budget ran out, and the body was closed.
+	Forced bool
+}
+
+// Drained reports what the draining of the response discarded.
+func (rr *Response) Drained() DrainStats {
+	return DrainStats{
+		Records: atomic.LoadInt64(&rr.drained.records),
+		Bytes:   atomic.LoadInt64(&rr.drained.bytes),
+		Forced:  atomic.LoadInt32(&rr.drained.forced) == 1,
+	}
+}
+
+// drainCounters accumulate the DrainStats of a response.
+type drainCounters struct {
+	records int64
+	bytes   int64
+	forced  int32
+}
+
+// forceClose closes the body of a response whose drain ran out of
+// budget.
+func (rr *Response) forceClose() {
+	if atomic.CompareAndSwapInt32(&rr.drained.forced, 0, 1) {
+		if rr.logger != nil {
+			rr.logger.Log("response drain out of budget, closing body")
+		}
+		rr.Body.Close()
+	}
+}
+
+// drainBody discards the rest of an unread body, within the budget.
+func (rr *Response) drainBody() {
+	budget := rr.drainBudget.withDefaults()
+	timer := rr.clock.NewTimer(budget.Time)
+	defer timer.Stop()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-timer.C():
+			rr.forceClose()
+		case <-done:
+		}
+	}()
+	n, err := io.CopyN(ioutil.Discard, rr.Body, budget.Bytes)
+	atomic.AddInt64(&rr.drained.bytes, n)
+	if err == nil {
+		// The body goes on past the budget.
+		rr.forceClose()
+	}
+}
+
+// drainRecords passes on the records left in the data channel once
+// reading ended, within the budget, and discards the others, closing the
+// body if the time runs out. It returns once the channel is closed.
+func (rr *Response) drainRecords(dataCh <-chan []byte, keep func([]byte)) {
+	if dataCh == nil {
+		// Already seen closed.
+		return
+	}
+	budget := rr.drainBudget.withDefaults()
+	timer := rr.clock.NewTimer(budget.Time)
+	defer timer.Stop()
+	var records int
+	var size int64
+	for {
+		select {
+		case byt, ok := <-dataCh:
+			if !ok {
+				return
+			}
+			over := budget.Records > 0 && records >= budget.Records
+			if over || size+int64(len(byt)) > budget.Bytes || atomic.LoadInt32(&rr.drained.forced) == 1 {
+				atomic.AddInt64(&rr.drained.records, 1)
+				continue
+			}
+			records++
+			size += int64(len(byt))
+			keep(byt)
+		case <-timer.C():
+			rr.forceClose()
+		}
+	}
+}
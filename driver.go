@@ -0,0 +1,136 @@
+package ksqldb
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// driverRows adapts Rows to database/sql/driver.Rows.
+type driverRows struct {
+	rows   *Rows
+	peeked bool
+	ok     bool
+}
+
+// DriverRows adapts the rows to database/sql/driver.Rows, for tools that
+// consume those (formatters, the raw scan paths of ORMs) without a full
+// driver. Values are converted to the types drivers may return:
+//
+//	INT, BIGINT          int64
+//	DOUBLE               float64
+//	DECIMAL              string, holding the exact decimal
+//	STRING, BOOLEAN      string, bool
+//	BYTES                []byte
+//	ARRAY, MAP, STRUCT   []byte, holding their JSON encoding
+//
+// The returned value takes over the iteration: Next and Row must not be
+// used on the rows anymore.
+func (rs *Rows) DriverRows() driver.Rows {
+	return &driverRows{rows: rs}
+}
+
+// Columns implements driver.Rows. The header arrives with the first
+// record, so this may block until it does.
+func (dr *driverRows) Columns() []string {
+	header := dr.header()
+	if header == nil {
+		return nil
+	}
+	names := make([]string, len(header.Columns))
+	for i, col := range header.Columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// ColumnTypeDatabaseTypeName implements
+// driver.RowsColumnTypeDatabaseTypeName, reporting the KSQL type.
+func (dr *driverRows) ColumnTypeDatabaseTypeName(index int) string {
+	header := dr.header()
+	if header == nil || index >= len(header.Columns) {
+		return ""
+	}
+	return baseType(header.Columns[index].Type)
+}
+
+// header waits for the query header, reading ahead a row if needed.
+func (dr *driverRows) header() *Header {
+	if dr.rows.Header() == nil && !dr.peeked {
+		dr.ok = dr.rows.Next()
+		dr.peeked = true
+	}
+	return dr.rows.Header()
+}
+
+// Next implements driver.Rows.
+func (dr *driverRows) Next(dest []driver.Value) error {
+	ok := dr.ok
+	if dr.peeked {
+		dr.peeked = false
+	} else {
+		ok = dr.rows.Next()
+	}
+	if !ok {
+		if err := dr.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+
+	row := dr.rows.Row()
+	for i := range dest {
+		if i >= len(row.Values) {
+			dest[i] = nil
+			continue
+		}
+		value, err := driverValue(row.Values[i])
+		if err != nil {
+			col := fmt.Sprint(i)
+			if i < len(row.Columns) {
+				col = row.Columns[i].Name
+			}
+			return fmt.Errorf("converting column %s: %w", col, err)
+		}
+		dest[i] = value
+	}
+	return nil
+}
+
+// Close implements driver.Rows.
+func (dr *driverRows) Close() error {
+	return dr.rows.Close()
+}
+
+// driverValue converts a decoded value into a driver.Value.
+func driverValue(value interface{}) (driver.Value, error) {
+	switch vv := value.(type) {
+	case nil:
+		return nil, nil
+	case int64, float64, bool, string, []byte, time.Time:
+		return vv, nil
+	case int32:
+		return int64(vv), nil
+	case time.Duration:
+		return int64(vv), nil
+	case json.Number:
+		return vv.String(), nil
+	case *big.Rat:
+		return ksql.DecimalString(vv), nil
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Slice, reflect.Map, reflect.Struct, reflect.Array:
+		byt, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return byt, nil
+	}
+	return nil, fmt.Errorf("no driver value for %T", value)
+}
@@ -0,0 +1,136 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// Lookup is a local source of rows by key, that streaming rows are
+// enriched from (see Enricher). *TableCache is one.
+type Lookup interface {
+	Get(key string) (Row, bool)
+}
+
+// LookupMap is a Lookup over a map.
+type LookupMap map[string]Row
+
+// Get implements Lookup.
+func (lm LookupMap) Get(key string) (Row, bool) {
+	row, ok := lm[key]
+	return row, ok
+}
+
+// LookupFunc adapts a function to a Lookup, eg. over an LRU cache.
+type LookupFunc func(key string) (Row, bool)
+
+// Get implements Lookup.
+func (lf LookupFunc) Get(key string) (Row, bool) {
+	return lf(key)
+}
+
+// EnrichStats describes the rows an Enricher looked up.
+type EnrichStats struct {
+	Matched int64
+	Missed  int64
+}
+
+// Enricher joins streaming rows against a local Lookup by key, appending
+// the columns of the row looked up to those of the streaming row: the
+// client-side equivalent of a stream-table join, for reference data the
+// server does not have.
+type Enricher struct {
+	// Lookup is the source joined against.
+	Lookup Lookup
+
+	// Key extracts the lookup key of a streaming row, eg. KeyColumn.
+	Key KeyFunc
+
+	// Prefix is prepended to the names of the columns looked up, to keep
+	// them apart from the streaming row's. Their Key flag is dropped.
+	Prefix string
+
+	// Inner drops the rows without a match, like an inner join. They are
+	// otherwise passed on, like a left join: padded with NULLs if Columns
+	// is set, or as they are.
+	Inner bool
+
+	// Columns are the columns of the lookup's rows, to pad unmatched rows
+	// with.
+	Columns []Column
+
+	matched int64
+	missed  int64
+}
+
+// Enrich joins a row, reporting whether it matched.
+func (en *Enricher) Enrich(row Row) (Row, bool, error) {
+	key, err := en.Key(row)
+	if err != nil {
+		return Row{}, false, fmt.Errorf("enriching row: %w", err)
+	}
+	found, ok := en.Lookup.Get(key)
+	if !ok {
+		atomic.AddInt64(&en.missed, 1)
+		if en.Columns == nil {
+			return row, false, nil
+		}
+		found = Row{Columns: en.Columns, Values: make([]interface{}, len(en.Columns))}
+	} else {
+		atomic.AddInt64(&en.matched, 1)
+	}
+
+	enriched := Row{
+		Columns:   make([]Column, 0, len(row.Columns)+len(found.Columns)),
+		Values:    make([]interface{}, 0, len(row.Values)+len(found.Values)),
+		Tombstone: row.Tombstone,
+		policy:    row.policy,
+	}
+	enriched.Columns = append(enriched.Columns, row.Columns...)
+	enriched.Values = append(enriched.Values, row.Values...)
+	for i, col := range found.Columns {
+		enriched.Columns = append(enriched.Columns, Column{Name: en.Prefix + col.Name, Type: col.Type})
+		var value interface{}
+		if i < len(found.Values) {
+			value = found.Values[i]
+		}
+		enriched.Values = append(enriched.Values, value)
+	}
+	return enriched, ok, nil
+}
+
+// Run enriches the rows of a subscription, passing them to handler,
+// until the subscription ends or ctx is done. Rows without a match are
+// dropped under Inner.
+//
+// It returns the subscription's error, the handler's, or ctx's.
+func (en *Enricher) Run(ctx context.Context, sub *Subscription, handler func(context.Context, Row) error) error {
+	for {
+		select {
+		case row, ok := <-sub.C:
+			if !ok {
+				return sub.Err()
+			}
+			enriched, matched, err := en.Enrich(row)
+			if err != nil {
+				return err
+			}
+			if !matched && en.Inner {
+				continue
+			}
+			if err := handler(ctx, enriched); err != nil {
+				return fmt.Errorf("handling enriched row: %w", err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Stats returns the number of rows matched and missed.
+func (en *Enricher) Stats() EnrichStats {
+	return EnrichStats{
+		Matched: atomic.LoadInt64(&en.matched),
+		Missed:  atomic.LoadInt64(&en.missed),
+	}
+}
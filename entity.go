@@ -0,0 +1,350 @@
+package ksqldb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// FieldInfo describes a single column of a source or query schema, as
+// returned in DESCRIBE and EXPLAIN entities.
+type FieldInfo struct {
+	Name   string     `json:"name"`
+	Schema SchemaInfo `json:"schema"`
+
+	// Type is "KEY" for key columns, "HEADER" for columns populated from
+	// Kafka record headers, and empty (or "VALUE") otherwise.
+	Type string `json:"type,omitempty"`
+
+	// HeaderKey is set for HEADER('key') columns, which hold the value of
+	// a single header. HEADERS columns, holding all of them, have none.
+	HeaderKey string `json:"headerKey,omitempty"`
+}
+
+// IsKey reports whether the field is part of the source's key.
+func (fi FieldInfo) IsKey() bool {
+	return fi.Type == "KEY"
+}
+
+// IsHeader reports whether the field is populated from record headers,
+// either a HEADERS or a HEADER('key') column.
+func (fi FieldInfo) IsHeader() bool {
+	return fi.Type == "HEADER"
+}
+
+// SchemaInfo is the (recursive) logical type of a field. Fields is set
+// for STRUCTs and MemberSchema for ARRAYs and MAPs.
+type SchemaInfo struct {
+	Type         string                 `json:"type"`
+	Fields       []FieldInfo            `json:"fields"`
+	MemberSchema *SchemaInfo            `json:"memberSchema"`
+	Parameters   map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// String renders the schema as a KSQL type, eg. ARRAY<BIGINT> or
+// DECIMAL(10, 2).
+func (si SchemaInfo) String() string {
+	switch si.Type {
+	case "ARRAY":
+		if si.MemberSchema != nil {
+			return "ARRAY<" + si.MemberSchema.String() + ">"
+		}
+	case "MAP":
+		if si.MemberSchema != nil {
+			return "MAP<STRING, " + si.MemberSchema.String() + ">"
+		}
+	case "STRUCT":
+		fields := make([]string, len(si.Fields))
+		for i, field := range si.Fields {
+			fields[i] = ksql.Quote(field.Name) + " " + field.Schema.String()
+		}
+		return "STRUCT<" + strings.Join(fields, ", ") + ">"
+	case "DECIMAL":
+		if precision, ok := si.Parameters["precision"]; ok {
+			return fmt.Sprintf("DECIMAL(%v, %v)", precision, si.Parameters["scale"])
+		}
+	}
+	return si.Type
+}
+
+// CurrentStatus is the entity returned by statements that enqueue a
+// command, such as DDL and persistent queries.
+type CurrentStatus struct {
+	StatementText         string        `json:"statementText"`
+	CommandID             string        `json:"commandId"`
+	CommandStatus         CommandStatus `json:"commandStatus"`
+	CommandSequenceNumber int64         `json:"commandSequenceNumber"`
+
+	// Warnings are the server's warnings about the statement.
+	Warnings []StatementWarning `json:"warnings,omitempty"`
+}
+
+// CommandStatus is the execution status of an enqueued command.
+type CommandStatus struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	QueryID string `json:"queryId,omitempty"`
+}
+
+// QueryDescription is the entity returned by EXPLAIN.
+type QueryDescription struct {
+	ID            string      `json:"id"`
+	StatementText string      `json:"statementText"`
+	WindowType    string      `json:"windowType"`
+	Fields        []FieldInfo `json:"fields"`
+	Sources       []string    `json:"sources"`
+	Sinks         []string    `json:"sinks"`
+	Topology      string      `json:"topology"`
+	ExecutionPlan string      `json:"executionPlan"`
+	QueryType     string      `json:"queryType"`
+	State         string      `json:"state"`
+}
+
+// SourceDescription is the entity returned by DESCRIBE for a stream or
+// table.
+type SourceDescription struct {
+	Name         string         `json:"name"`
+	WindowType   string         `json:"windowType"`
+	ReadQueries  []RunningQuery `json:"readQueries"`
+	WriteQueries []RunningQuery `json:"writeQueries"`
+	Fields       []FieldInfo    `json:"fields"`
+	Type         string         `json:"type"`
+	Timestamp    string         `json:"timestamp"`
+	Statistics   string         `json:"statistics"`
+	ErrorStats   string         `json:"errorStats"`
+	Extended     bool           `json:"extended"`
+	KeyFormat    string         `json:"keyFormat"`
+	ValueFormat  string         `json:"valueFormat"`
+	Topic        string         `json:"topic"`
+	Partitions   int            `json:"partitions"`
+	Replication  int            `json:"replication"`
+	Statement    string         `json:"statement"`
+}
+
+// WithOptions returns the source's WITH properties, parsed from its
+// statement and completed from the description's own fields.
+func (sd *SourceDescription) WithOptions() (ksql.WithOptions, error) {
+	wo, err := ksql.ParseWith(sd.Statement)
+	if err != nil {
+		return wo, fmt.Errorf("parsing properties of %s: %w", sd.Name, err)
+	}
+	if wo.KafkaTopic == "" {
+		wo.KafkaTopic = sd.Topic
+	}
+	if wo.KeyFormat == "" && wo.Format == "" {
+		wo.KeyFormat = sd.KeyFormat
+	}
+	if wo.ValueFormat == "" && wo.Format == "" {
+		wo.ValueFormat = sd.ValueFormat
+	}
+	if wo.Timestamp == "" {
+		wo.Timestamp = sd.Timestamp
+	}
+	if wo.Partitions == 0 {
+		wo.Partitions = sd.Partitions
+	}
+	if wo.Replicas == 0 {
+		wo.Replicas = sd.Replication
+	}
+	return wo, nil
+}
+
+// KeySchema is the key of a source: its format and columns.
+type KeySchema struct {
+	// Format is the key format, KAFKA on servers that do not report one.
+	Format string
+	// Columns are the key columns, in order. Servers before named key
+	// columns report the implicit ROWKEY.
+	Columns []FieldInfo
+	// Windowed is set for windowed sources, whose keys also hold the
+	// window bounds (see WINDOWSTART and WINDOWEND).
+	Windowed bool
+}
+
+// Key returns the source's key schema.
+func (sd *SourceDescription) Key() KeySchema {
+	ks := KeySchema{Format: sd.KeyFormat, Windowed: sd.WindowType != ""}
+	if ks.Format == "" {
+		ks.Format = ksql.DefaultKeyFormat
+	}
+	for _, field := range sd.Fields {
+		if field.IsKey() {
+			ks.Columns = append(ks.Columns, field)
+		}
+	}
+	if len(ks.Columns) == 0 {
+		for _, field := range sd.Fields {
+			if field.Name == "ROWKEY" {
+				ks.Columns = append(ks.Columns, field)
+			}
+		}
+	}
+	return ks
+}
+
+// Check checks that the key columns can be serialized in the key format,
+// see ksql.CheckKeyFormat.
+func (ks KeySchema) Check() error {
+	types := make([]string, len(ks.Columns))
+	for i, col := range ks.Columns {
+		types[i] = col.Schema.String()
+	}
+	return ksql.CheckKeyFormat(ks.Format, types)
+}
+
+// TimestampFormat returns the format of the source's TIMESTAMP column,
+// and false if the source has no TIMESTAMP_FORMAT.
+func (sd *SourceDescription) TimestampFormat() (ksql.TimestampFormat, bool, error) {
+	wo, err := sd.WithOptions()
+	if err != nil || wo.TimestampFormat == "" {
+		return ksql.TimestampFormat{}, false, err
+	}
+	tf, err := ksql.ParseTimestampFormat(wo.TimestampFormat)
+	if err != nil {
+		return tf, false, fmt.Errorf("parsing properties of %s: %w", sd.Name, err)
+	}
+	return tf, true, nil
+}
+
+// RunningQuery is a persistent query as listed by SHOW QUERIES and
+// DESCRIBE.
+type RunningQuery struct {
+	QueryString string   `json:"queryString"`
+	Sinks       []string `json:"sinks"`
+	ID          QueryID  `json:"id"`
+	QueryType   string   `json:"queryType,omitempty"`
+	State       string   `json:"state,omitempty"`
+}
+
+// SourceInfo is a stream or table as listed by SHOW STREAMS and SHOW
+// TABLES.
+type SourceInfo struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Topic       string `json:"topic"`
+	KeyFormat   string `json:"keyFormat"`
+	ValueFormat string `json:"valueFormat"`
+	IsWindowed  bool   `json:"isWindowed"`
+}
+
+// QueryID is the ID of a persistent query. Older servers send it
+// wrapped in an object ({"id": "..."}), newer ones as a plain string:
+// both decode.
+type QueryID string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (id *QueryID) UnmarshalJSON(byt []byte) error {
+	var plain string
+	if err := json.Unmarshal(byt, &plain); err == nil {
+		*id = QueryID(plain)
+		return nil
+	}
+	var wrapped struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(byt, &wrapped); err != nil {
+		return fmt.Errorf("decoding query id: %w", err)
+	}
+	*id = QueryID(wrapped.ID)
+	return nil
+}
+
+// entityEnvelope picks out the discriminator shared by all /ksql
+// entities.
+type entityEnvelope struct {
+	Type string `json:"@type"`
+}
+
+// findEntity returns the first entity of the given @type.
+func findEntity(entities []json.RawMessage, typ string) (json.RawMessage, error) {
+	for _, raw := range entities {
+		var env entityEnvelope
+		if err := json.Unmarshal(raw, &env); err != nil {
+			decErr := newDecodeError(raw, err)
+			decErr.Type = "entity"
+			return nil, decErr
+		}
+		if env.Type == typ {
+			return raw, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s entity in response", typ)
+}
+
+// decodeEntity finds the first entity of the given @type and decodes
+// its named member into v. Passing an empty member decodes the whole
+// entity.
+func decodeEntity(entities []json.RawMessage, typ, member string, v interface{}) error {
+	raw, err := findEntity(entities, typ)
+	if err != nil {
+		return err
+	}
+	if member != "" {
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &members); err != nil {
+			decErr := newDecodeError(raw, err)
+			decErr.Type = typ + " entity"
+			return decErr
+		}
+		raw = members[member]
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		decErr := newDecodeError(raw, err)
+		decErr.Type = typ + " entity"
+		return decErr
+	}
+	return nil
+}
+
+// Explain runs EXPLAIN for the given statement (which need not have been
+// executed yet) and returns the server's description of the query it
+// would run, including its output schema.
+func (cc *Client) Explain(ctx context.Context, ksql string) (*QueryDescription, error) {
+	entities, err := cc.runStatement(ctx, "EXPLAIN "+strings.TrimSpace(ksql), nil)
+	if err != nil {
+		return nil, fmt.Errorf("explaining statement: %w", err)
+	}
+	var qd QueryDescription
+	if err := decodeEntity(entities, "queryDescription", "queryDescription", &qd); err != nil {
+		return nil, fmt.Errorf("explaining statement: %w", err)
+	}
+	return &qd, nil
+}
+
+// Describe runs DESCRIBE for the named stream or table. Descriptions are
+// cached if the client is configured to (see DescribeCacheTTL).
+func (cc *Client) Describe(ctx context.Context, source string) (*SourceDescription, error) {
+	name := cc.casePolicy.Canonical(source)
+	if sd, ok := cc.describes.get(name); ok {
+		return sd, nil
+	}
+	gen := cc.describes.generation()
+	sd, err := cc.describe(ctx, "DESCRIBE %s;", source)
+	if err != nil {
+		return nil, err
+	}
+	cc.describes.put(name, sd, gen)
+	return sd, nil
+}
+
+// DescribeExtended runs DESCRIBE EXTENDED for the named stream or table,
+// which adds runtime statistics to the description.
+func (cc *Client) DescribeExtended(ctx context.Context, source string) (*SourceDescription, error) {
+	return cc.describe(ctx, "DESCRIBE EXTENDED %s;", source)
+}
+
+// describe runs the given DESCRIBE statement format for the source.
+func (cc *Client) describe(ctx context.Context, format, source string) (*SourceDescription, error) {
+	entities, err := cc.runStatement(ctx, fmt.Sprintf(format, cc.ident(source)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("describing %s: %w", source, err)
+	}
+	var sd SourceDescription
+	if err := decodeEntity(entities, "sourceDescription", "sourceDescription", &sd); err != nil {
+		return nil, fmt.Errorf("describing %s: %w", source, err)
+	}
+	return &sd, nil
+}
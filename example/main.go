@@ -79,6 +79,7 @@ func main() {
 			panic(err)
 		}
 		byt, err := rh.ReadAll()
+		rh.Close()
 		if err != nil {
 			panic(err)
 		}
@@ -86,15 +87,15 @@ func main() {
 	}
 
 	// This example shows a streaming query, sending new records while
-	// the query is going. It also shows setting a client context that
-	// times out: not really important (per-request timeouts would be,
-	// but are not implemented) but useful here.
+	// the query is going. It also shows setting a per-request context
+	// that times out, ending the query after a few seconds.
 	fmt.Println("\n> STREAMING EXAMPLE:")
-	ctx, _ := context.WithTimeout(context.Background(), 6*time.Second)
-	client, err = ksqldb.NewClient(ksqldb.ClientOptions{
-		URL:     "http://0.0.0.0:8088",
-		Context: ctx,
-	})
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+	// Interrupting the example closes the query on the server, rather
+	// than leave it to notice the connection going away.
+	ctx, shutdown := ksqldb.NotifyShutdown(ctx, client, ksqldb.ShutdownOptions{})
+	defer shutdown()
 
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -106,15 +107,16 @@ func main() {
 				`INSERT INTO transactions (accountID, marketID, amount, unit)
 				VALUES (456, 22210, ` + strconv.Itoa(i) + `, 'USD');`,
 			)
-			_, err := client.Do(rr)
+			rh, err := client.Do(rr)
 			if err != nil {
 				panic(err)
 			}
+			rh.Close()
 		}
 	}()
 
 	rr := ksqldb.NewQuery("SELECT * FROM transactions EMIT CHANGES;")
-	rh, err := client.Do(rr)
+	rh, err := client.DoContext(ctx, rr)
 	if err != nil {
 		panic(err)
 	}
@@ -123,7 +125,7 @@ func main() {
 		fmt.Println("<< " + string(byt))
 		return nil
 	})
-	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
 		panic(err)
 	} else {
 		fmt.Println("\nEt voilà!")
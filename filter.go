@@ -0,0 +1,43 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// QuerySelect runs a query built with ksql.Select, under the client's
+// case policy and for the server's dialect. The parts of its filter that
+// render into KSQL are pushed down to the server; the rest are evaluated
+// on the rows as they arrive, so callers get the same rows either way:
+//
+//	rows, err := client.QuerySelect(ctx, ksql.Select{
+//		From: "orders",
+//		Where: ksql.And(
+//			ksql.Field("region").Eq("EU"),
+//			ksql.MatchFunc(isSuspicious),
+//		),
+//	}, nil)
+func (cc *Client) QuerySelect(ctx context.Context, sel ksql.Select, props map[string]string) (*Rows, error) {
+	dialect, err := cc.Dialect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("running select: %w", err)
+	}
+	sel.Policy = cc.casePolicy
+	sel.Dialect = dialect
+	statement, rest, err := sel.Build()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := cc.Query(ctx, statement, props)
+	if err != nil {
+		return nil, err
+	}
+	if rest != nil {
+		rows.Filter(func(row Row) (bool, error) {
+			return rest.Match(row.Get)
+		})
+	}
+	return rows, nil
+}
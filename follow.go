@@ -0,0 +1,178 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+)
+
+// FollowHandler receives the rows delivered by LoadAndFollow. All of
+// its hooks are called from a single goroutine, in order: Snapshot for
+// every row of the table's current state, Change for the changes the
+// strategy reconciles with it, Ready once that state is complete, then
+// Change for every later changelog row. Returning an error
+// from any hook stops LoadAndFollow, which returns it.
+type FollowHandler struct {
+	Snapshot func(Row) error
+	Ready    func() error
+	Change   func(Row) error
+}
+
+// ConsistencyStrategy decides how the snapshot and the changelog are
+// stitched together. Changes that happen while the snapshot is being
+// read are either missed, if the changelog is only opened afterwards,
+// or seen twice, if it is opened first: the strategy picks which, and
+// can reconcile the changes buffered while the snapshot was loading.
+type ConsistencyStrategy interface {
+	// SubscribeFirst reports whether the changelog subscription should
+	// be opened before the snapshot query is run.
+	SubscribeFirst() bool
+
+	// Reconcile is passed the changes received while the snapshot was
+	// loading (only when subscribing first) and returns those to be
+	// delivered, in order, before any later change.
+	Reconcile(buffered []Row) []Row
+}
+
+// followAfterSnapshot opens the changelog only once the snapshot is
+// complete: no duplicates, but changes made in between are missed.
+type followAfterSnapshot struct{}
+
+func (followAfterSnapshot) SubscribeFirst() bool           { return false }
+func (followAfterSnapshot) Reconcile(buffered []Row) []Row { return buffered }
+
+// replayDuringSnapshot opens the changelog first and replays everything
+// buffered while the snapshot loaded: no gaps, but rows may be seen
+// both in the snapshot and as changes.
+type replayDuringSnapshot struct{}
+
+func (replayDuringSnapshot) SubscribeFirst() bool           { return true }
+func (replayDuringSnapshot) Reconcile(buffered []Row) []Row { return buffered }
+
+var (
+	// FollowAfterSnapshot subscribes once the snapshot is read. Changes
+	// made while it was loading may be missed.
+	FollowAfterSnapshot ConsistencyStrategy = followAfterSnapshot{}
+
+	// ReplayDuringSnapshot subscribes before the snapshot is read and
+	// replays the changes received meanwhile. Nothing is missed, but the
+	// handler must tolerate seeing a row more than once. This is the
+	// default.
+	ReplayDuringSnapshot ConsistencyStrategy = replayDuringSnapshot{}
+)
+
+// FollowOptions configures LoadAndFollow.
+type FollowOptions struct {
+	// Strategy defaults to ReplayDuringSnapshot.
+	Strategy ConsistencyStrategy
+
+	// Props are sent as streamsProperties with both queries.
+	Props map[string]string
+
+	// AllowLargeScan skips the client's ScanGuard, if any.
+	AllowLargeScan bool
+
+	// SelectRowTime selects ROWTIME as a column of its own in both
+	// queries (SELECT *, ROWTIME), for handlers that checkpoint by it:
+	// current servers leave it out of SELECT *.
+	SelectRowTime bool
+}
+
+// LoadAndFollow loads the current state of a table with a pull query,
+// then follows its changelog with an EMIT CHANGES push query, stitching
+// the two together with the configured strategy. It is the usual way to
+// warm a cache and keep it up to date, and runs until the context is
+// canceled, the changelog ends or a handler returns an error.
+func (cc *Client) LoadAndFollow(ctx context.Context, table string, handler FollowHandler, opts FollowOptions) error {
+	strategy := opts.Strategy
+	if strategy == nil {
+		strategy = ReplayDuringSnapshot
+	}
+	if !opts.AllowLargeScan {
+		if err := cc.GuardScan(ctx, table); err != nil {
+			return fmt.Errorf("loading %s: %w", table, err)
+		}
+	}
+	projection := "*"
+	if opts.SelectRowTime {
+		projection = "*, ROWTIME"
+	}
+	changelogQuery := fmt.Sprintf("SELECT %s FROM %s EMIT CHANGES;", projection, cc.ident(table))
+
+	var changes *rowStream
+	if strategy.SubscribeFirst() {
+		rows, err := cc.Query(ctx, changelogQuery, opts.Props)
+		if err != nil {
+			return fmt.Errorf("following %s: %w", table, err)
+		}
+		changes = newRowStream(rows)
+		defer changes.Close()
+	}
+
+	rows, err := cc.Query(ctx, fmt.Sprintf("SELECT %s FROM %s;", projection, cc.ident(table)), opts.Props)
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", table, err)
+	}
+	snapshot := newRowStream(rows)
+	defer snapshot.Close()
+
+	var buffered []Row
+	for loading := true; loading; {
+		var changeCh chan Row
+		if changes != nil {
+			changeCh = changes.C
+		}
+		select {
+		case row, ok := <-snapshot.C:
+			if !ok {
+				if err := snapshot.Err(); err != nil {
+					return fmt.Errorf("loading %s: %w", table, err)
+				}
+				loading = false
+				break
+			}
+			if handler.Snapshot != nil {
+				if err := handler.Snapshot(row); err != nil {
+					return err
+				}
+			}
+		case row, ok := <-changeCh:
+			if !ok {
+				return fmt.Errorf("following %s: changelog ended while loading: %v", table, changes.Err())
+			}
+			buffered = append(buffered, row)
+		}
+	}
+
+	if changes == nil {
+		rows, err := cc.Query(ctx, changelogQuery, opts.Props)
+		if err != nil {
+			return fmt.Errorf("following %s: %w", table, err)
+		}
+		changes = newRowStream(rows)
+		defer changes.Close()
+	}
+	for _, row := range strategy.Reconcile(buffered) {
+		if handler.Change != nil {
+			if err := handler.Change(row); err != nil {
+				return err
+			}
+		}
+	}
+	if handler.Ready != nil {
+		if err := handler.Ready(); err != nil {
+			return err
+		}
+	}
+
+	for row := range changes.C {
+		if handler.Change != nil {
+			if err := handler.Change(row); err != nil {
+				return err
+			}
+		}
+	}
+	if err := changes.Err(); err != nil {
+		return fmt.Errorf("following %s: %w", table, err)
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,183 @@
+package ksqldb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// FunctionDescription is the entity returned by DESCRIBE FUNCTION.
+type FunctionDescription struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Author      string            `json:"author"`
+	Version     string            `json:"version"`
+	Path        string            `json:"path"`
+	Type        string            `json:"type"`
+	Functions   []FunctionVariant `json:"functions"`
+}
+
+// FunctionVariant is a single signature of a function.
+type FunctionVariant struct {
+	Description string             `json:"description"`
+	ReturnType  string             `json:"returnType"`
+	Arguments   []FunctionArgument `json:"arguments"`
+}
+
+// FunctionArgument is a parameter of a function variant.
+type FunctionArgument struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	IsVariadic  bool   `json:"isVariadic"`
+}
+
+// DescribeFunction runs DESCRIBE FUNCTION for the named function.
+func (cc *Client) DescribeFunction(ctx context.Context, name string) (*FunctionDescription, error) {
+	entities, err := cc.runStatement(ctx, fmt.Sprintf("DESCRIBE FUNCTION %s;", name), nil)
+	if err != nil {
+		return nil, fmt.Errorf("describing function %s: %w", name, err)
+	}
+	var fd FunctionDescription
+	if err := decodeEntity(entities, "describe_function", "", &fd); err != nil {
+		return nil, fmt.Errorf("describing function %s: %w", name, err)
+	}
+	return &fd, nil
+}
+
+// CallFunction renders a call to a UDF or UDAF with ksql.Call, after
+// checking the arguments against the function's signatures: some
+// variant must take that many arguments, of compatible types. Argument
+// types are only checked where both sides are known; ksql.Expr
+// arguments and generic parameters accept anything.
+func (cc *Client) CallFunction(ctx context.Context, name string, args ...interface{}) (string, error) {
+	fd, err := cc.DescribeFunction(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	var problems []string
+	for _, variant := range fd.Functions {
+		problem := variant.accepts(args)
+		if problem == "" {
+			return ksql.Call(fd.Name, args...)
+		}
+		problems = append(problems, problem)
+	}
+	if len(problems) == 0 {
+		return "", fmt.Errorf("calling %s: function has no signatures", name)
+	}
+	return "", fmt.Errorf("calling %s: no signature matches: %s", name, strings.Join(problems, "; "))
+}
+
+// accepts returns why the variant does not accept the arguments, or
+// an empty string if it does.
+func (fv FunctionVariant) accepts(args []interface{}) string {
+	params := fv.Arguments
+	variadic := len(params) > 0 && params[len(params)-1].IsVariadic
+	sig := fv.signature()
+	switch {
+	case variadic && len(args) < len(params)-1:
+		return fmt.Sprintf("%s takes at least %d arguments", sig, len(params)-1)
+	case !variadic && len(args) != len(params):
+		return fmt.Sprintf("%s takes %d arguments", sig, len(params))
+	}
+	for i, arg := range args {
+		var typ string
+		if variadic && i >= len(params)-1 {
+			// Variadic parameters are reported as arrays of their type.
+			typ = params[len(params)-1].Type
+			typ = strings.TrimSuffix(strings.TrimPrefix(typ, "ARRAY<"), ">")
+		} else {
+			typ = params[i].Type
+		}
+		if !argumentMatches(arg, typ) {
+			return fmt.Sprintf("%s: argument %d (%T) is not %s", sig, i+1, arg, typ)
+		}
+	}
+	return ""
+}
+
+// signature renders the variant's parameter types.
+func (fv FunctionVariant) signature() string {
+	types := make([]string, len(fv.Arguments))
+	for i, arg := range fv.Arguments {
+		types[i] = arg.Type
+		if arg.IsVariadic {
+			types[i] += "..."
+		}
+	}
+	return "(" + strings.Join(types, ", ") + ")"
+}
+
+// argumentMatches reports whether a Go argument can be passed for a
+// parameter of the given KSQL type, as far as can be told.
+func argumentMatches(arg interface{}, typ string) bool {
+	if arg == nil {
+		return true
+	}
+	switch arg.(type) {
+	case ksql.Expr:
+		return true
+	case json.Number:
+		return isNumericType(baseType(typ)) || !isKnownType(typ)
+	case time.Time, *time.Time:
+		return baseType(typ) == "TIMESTAMP" || !isKnownType(typ)
+	}
+	if !isKnownType(typ) {
+		return true
+	}
+	rv := reflect.ValueOf(arg)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return true
+		}
+		rv = rv.Elem()
+	}
+	base := baseType(typ)
+	switch rv.Kind() {
+	case reflect.String:
+		return base == "STRING" || base == "VARCHAR"
+	case reflect.Bool:
+		return base == "BOOLEAN"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return isNumericType(base)
+	case reflect.Float32, reflect.Float64:
+		return base == "DOUBLE" || base == "DECIMAL"
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return base == "BYTES"
+		}
+		return base == "ARRAY"
+	case reflect.Map:
+		return base == "MAP"
+	case reflect.Struct:
+		return base == "STRUCT"
+	}
+	return true
+}
+
+// isNumericType reports whether a base type holds numbers.
+func isNumericType(base string) bool {
+	switch base {
+	case "INT", "INTEGER", "BIGINT", "DOUBLE", "DECIMAL":
+		return true
+	}
+	return false
+}
+
+// isKnownType reports whether a parameter type is concrete, rather than
+// generic (eg. T or ARRAY<T>) or loosely typed (ANY, OBJECT).
+func isKnownType(typ string) bool {
+	switch baseType(typ) {
+	case "STRING", "VARCHAR", "BOOLEAN", "INT", "INTEGER", "BIGINT", "DOUBLE",
+		"DECIMAL", "BYTES", "TIMESTAMP", "DATE", "TIME", "ARRAY", "MAP", "STRUCT":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package ksqldb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"hews.co/ksqldb/pkg/ksqldbapi"
+)
+
+// closeQueryResource is a request to the /close-query endpoint.
+type closeQueryResource struct {
+	QueryID string `json:"queryId"`
+}
+
+// MarshalJSON implements Requester.
+func (cq *closeQueryResource) MarshalJSON() ([]byte, error) {
+	type payload closeQueryResource
+	return json.Marshal((*payload)(cq))
+}
+
+// Request implements Requester.
+func (cq *closeQueryResource) Request(serverURL *url.URL) (*http.Request, error) {
+	byt, err := cq.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("ksql request: marshaling close query: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, ksqldbapi.EndpointCloseQuery.On(serverURL).String(), bytes.NewReader(byt))
+	if err != nil {
+		return nil, fmt.Errorf("ksql request: creating HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// CloseQuery asks the server to close a push query started on
+// /query-stream (see StreamQuery) by its ID, as found in the query's
+// Header. Closing the connection of a push query ends it too, but only
+// once the server notices. The push queries of /query are terminated
+// instead, see TerminateQuery.
+func (cc *Client) CloseQuery(ctx context.Context, queryID string) error {
+	rh, err := cc.do(ctx, &closeQueryResource{QueryID: queryID})
+	if err != nil {
+		return fmt.Errorf("closing query %s: %w", queryID, err)
+	}
+	defer rh.Close()
+
+	byt, err := rh.ReadAll()
+	if err != nil {
+		return fmt.Errorf("closing query %s: %w", queryID, err)
+	}
+	if rh.StatusCode < http.StatusOK || rh.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("closing query %s: %w", queryID, rh.responseError(byt, nil))
+	}
+	return nil
+}
+
+// TerminateQuery ends a query by its ID, eg. one orphaned by a crashed
+// consumer. The ID is tried with CloseQuery first, which ends the push
+// queries of /query-stream; the server does not know the others there,
+// persistent queries and the push queries of /query, which are then
+// terminated with TERMINATE, as is ALL.
+func (cc *Client) TerminateQuery(ctx context.Context, queryID string) error {
+	if !validQueryID.MatchString(queryID) {
+		return fmt.Errorf("terminating query %q: invalid query id", queryID)
+	}
+	if strings.EqualFold(queryID, "ALL") {
+		return cc.terminate(ctx, queryID)
+	}
+	err := cc.CloseQuery(ctx, queryID)
+	if err == nil || !unknownQuery(err) {
+		return err
+	}
+	return cc.terminate(ctx, queryID)
+}
+
+// unknownQuery reports whether CloseQuery failed for not knowing the
+// query, which the server answers with a 400 or 404.
+func unknownQuery(err error) bool {
+	var re *ResponseError
+	if !errors.As(err, &re) {
+		return false
+	}
+	return re.StatusCode == http.StatusBadRequest || re.StatusCode == http.StatusNotFound
+}
+
+// terminate ends a query by its ID with TERMINATE, which also ends the
+// push queries of /query.
+func (cc *Client) terminate(ctx context.Context, queryID string) error {
+	if !validQueryID.MatchString(queryID) {
+		return fmt.Errorf("terminating query %q: invalid query id", queryID)
+	}
+	if _, err := cc.runStatement(ctx, fmt.Sprintf("TERMINATE %s;", queryID), nil); err != nil {
+		return fmt.Errorf("terminating query %s: %w", queryID, err)
+	}
+	return nil
+}
+
+// validQueryID matches the query IDs the server generates.
+var validQueryID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// QueryGroup ties related queries together, so that a composite
+// operation (a snapshot and the push query following it, say) is torn
+// down with a single call to Cancel:
+//
+//	group := client.NewQueryGroup(ctx)
+//	defer group.Cancel()
+//	snapshot, err := group.Query("SELECT * FROM users;", nil)
+//	...
+//	changes, err := group.Query("SELECT * FROM users EMIT CHANGES;", nil)
+//
+// Helpers that take a context, such as Snapshot, join the group when
+// passed its Context.
+type QueryGroup struct {
+	client *Client
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	queries  []*Rows
+	canceled bool
+}
+
+// NewQueryGroup creates a group whose queries run under ctx.
+func (cc *Client) NewQueryGroup(ctx context.Context) *QueryGroup {
+	ctx, cancel := context.WithCancel(ctx)
+	return &QueryGroup{client: cc, ctx: ctx, cancel: cancel}
+}
+
+// Context returns the group's context, which is done once the group is
+// canceled.
+func (qg *QueryGroup) Context() context.Context {
+	return qg.ctx
+}
+
+// Query runs a query in the group.
+func (qg *QueryGroup) Query(ksqlQuery string, props map[string]string) (*Rows, error) {
+	qg.mu.Lock()
+	canceled := qg.canceled
+	qg.mu.Unlock()
+	if canceled {
+		return nil, fmt.Errorf("running ksql query: %w", context.Canceled)
+	}
+
+	rows, err := qg.client.Query(qg.ctx, ksqlQuery, props)
+	if err != nil {
+		return nil, err
+	}
+	qg.mu.Lock()
+	defer qg.mu.Unlock()
+	qg.queries = append(qg.queries, rows)
+	return rows, nil
+}
+
+// Cancel ends all the group's queries: it cancels the group's context,
+// closes the rows, and asks the server to close the push queries that
+// had started, returning the first error doing so. It is safe to call
+// more than once.
+func (qg *QueryGroup) Cancel() error {
+	qg.mu.Lock()
+	queries := qg.queries
+	qg.queries = nil
+	qg.canceled = true
+	qg.mu.Unlock()
+
+	qg.cancel()
+	var firstErr error
+	for _, rows := range queries {
+		rows.Close()
+		// Closing the rows has the push queries closed on the server;
+		// this waits for that to be done.
+		if err := rows.resp.closeStarted(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
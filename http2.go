@@ -0,0 +1,16 @@
+//go:build go1.24
+// +build go1.24
+
+package ksqldb
+
+import "net/http"
+
+// enableHTTP2 makes the transport speak only HTTP/2: negotiated with
+// ALPN over TLS, and with prior knowledge (h2c) to http:// URLs.
+func enableHTTP2(transport *http.Transport, scheme string) error {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	transport.Protocols = protocols
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build !go1.24
+// +build !go1.24
+
+package ksqldb
+
+import (
+	"errors"
+	"net/http"
+)
+
+// enableHTTP2 makes the transport attempt HTTP/2 over TLS. Before Go
+// 1.24, net/http cannot speak HTTP/2 without TLS.
+func enableHTTP2(transport *http.Transport, scheme string) error {
+	if scheme != "https" {
+		return errors.New("http/2 without tls (h2c) requires go 1.24")
+	}
+	transport.ForceAttemptHTTP2 = true
+	return nil
+}
@@ -0,0 +1,526 @@
+package ksqldb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSubscriberOverflow ends a Hub subscription that could not keep up
+// with its stream under the OverflowDisconnect policy.
+var ErrSubscriberOverflow = errors.New("ksqldb: subscriber overflowed its buffer")
+
+// OverflowPolicy decides what happens to rows that arrive for a
+// consumer whose buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest discards the oldest buffered row to make room
+	// for the new one.
+	OverflowDropOldest OverflowPolicy = iota
+
+	// OverflowDisconnect ends the consumer with ErrSubscriberOverflow.
+	OverflowDisconnect
+)
+
+// QueryFingerprint identifies a query by its text and properties,
+// ignoring differences in whitespace and trailing semicolons, so that
+// equivalent queries issued from different places compare equal.
+func QueryFingerprint(ksql string, props map[string]string) string {
+	hash := sha256.New()
+	hash.Write([]byte(normalizeKsql(ksql)))
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		hash.Write([]byte{0})
+		hash.Write([]byte(name + "=" + props[name]))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// normalizeKsql collapses runs of whitespace outside of quoted strings
+// and identifiers, and trims trailing semicolons.
+func normalizeKsql(ksql string) string {
+	var (
+		sb    strings.Builder
+		quote byte
+		space bool
+	)
+	for i := 0; i < len(ksql); i++ {
+		c := ksql[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '`' || c == '"':
+			quote = c
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+			continue
+		}
+		if space && sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		space = false
+		sb.WriteByte(c)
+	}
+	return strings.TrimRight(sb.String(), "; ")
+}
+
+// HubOptions configures a Hub.
+type HubOptions struct {
+	// Buffer is the number of rows buffered per subscriber. It defaults
+	// to 64.
+	Buffer int
+
+	// Overflow applies to subscribers whose buffer is full: the shared
+	// stream never waits for a slow subscriber.
+	Overflow OverflowPolicy
+
+	// LagSmoothing is the smoothing of the subscribers' lag estimates
+	// (see LagEstimator).
+	LagSmoothing float64
+
+	// Replay is the number of recent rows kept per stream and delivered
+	// immediately to late subscribers, eg. dashboards attaching to a
+	// stream that is already running. Zero disables replay.
+	Replay int
+}
+
+// Hub shares push queries between subscribers in the same process:
+// subscribing to a query that is already running (by fingerprint) adds
+// a local subscriber to it instead of starting another query on the
+// server. Each subscriber has its own buffer, so a slow one cannot hold
+// back the others.
+type Hub struct {
+	client *Client
+	opts   HubOptions
+
+	mu      sync.Mutex
+	streams map[string]*sharedStream
+}
+
+// NewHub creates a Hub issuing its queries through client.
+func NewHub(client *Client, opts HubOptions) *Hub {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 64
+	}
+	return &Hub{client: client, opts: opts, streams: make(map[string]*sharedStream)}
+}
+
+// sharedStream is a single upstream query and its subscribers. It is
+// registered with the hub as soon as it is first subscribed to, and ready
+// is closed once its query has started, or failed to with startErr.
+// waiting counts the subscribers yet to join, and pending holds those
+// added for them when the query started, so that they miss no row. Once
+// closed, it takes no more subscribers.
+type sharedStream struct {
+	hub         *Hub
+	fingerprint string
+	ctx         context.Context
+	cancel      context.CancelFunc
+	ready       chan struct{}
+
+	mu       sync.Mutex
+	subs     map[*Subscription]struct{}
+	replay   *rowRing
+	waiting  int
+	pending  []*Subscription
+	closed   bool
+	startErr error
+}
+
+// rowRing is a fixed-size ring buffer of the most recent rows.
+type rowRing struct {
+	rows  []Row
+	next  int
+	count int
+}
+
+// newRowRing creates a ring holding up to size rows, or nil for none.
+func newRowRing(size int) *rowRing {
+	if size <= 0 {
+		return nil
+	}
+	return &rowRing{rows: make([]Row, size)}
+}
+
+// push adds a row, evicting the oldest if full.
+func (rr *rowRing) push(row Row) {
+	if rr == nil {
+		return
+	}
+	rr.rows[rr.next] = row
+	rr.next = (rr.next + 1) % len(rr.rows)
+	if rr.count < len(rr.rows) {
+		rr.count++
+	}
+}
+
+// snapshot returns the buffered rows, oldest first.
+func (rr *rowRing) snapshot() []Row {
+	if rr == nil {
+		return nil
+	}
+	rows := make([]Row, 0, rr.count)
+	start := (rr.next - rr.count + len(rr.rows)) % len(rr.rows)
+	for i := 0; i < rr.count; i++ {
+		rows = append(rows, rr.rows[(start+i)%len(rr.rows)])
+	}
+	return rows
+}
+
+// Subscription is a subscriber's view of a shared stream. Rows arrive on
+// C, which is closed when the subscription ends; Err then reports why.
+type Subscription struct {
+	C <-chan Row
+
+	ch      chan Row
+	done    chan struct{}
+	stream  *sharedStream
+	err     error
+	dropped int64
+
+	// lag estimates the subscriber's lag from the oldest row waiting in
+	// its buffer, whose ROWTIME is found among those of the latest rows
+	// pushed, kept in a ring as large as the buffer.
+	lag      LagEstimator
+	rowtimes []int64
+	next     int
+}
+
+// Subscribe joins the push query's shared stream, starting it if this
+// is its first subscriber. The subscription ends when ctx is canceled,
+// Close is called, or the upstream query ends.
+//
+// The query is started without the hub locked, so that a slow server
+// only holds up the subscribers of that query, which ctx can interrupt.
+func (h *Hub) Subscribe(ctx context.Context, ksql string, props map[string]string) (*Subscription, error) {
+	fingerprint := QueryFingerprint(ksql, props)
+	for {
+		h.mu.Lock()
+		stream, ok := h.streams[fingerprint]
+		if !ok {
+			stream = h.newStream(fingerprint)
+			h.streams[fingerprint] = stream
+			go stream.start(ksql, props)
+		}
+		stream.mu.Lock()
+		stream.waiting++
+		stream.mu.Unlock()
+		h.mu.Unlock()
+
+		select {
+		case <-stream.ready:
+		case <-ctx.Done():
+			stream.abandon()
+			return nil, ctx.Err()
+		}
+		sub, err := stream.join()
+		if err != nil {
+			return nil, err
+		}
+		if sub == nil {
+			// The stream ended before it could be joined: start anew.
+			continue
+		}
+
+		go func() {
+			select {
+			case <-ctx.Done():
+				sub.Close()
+			case <-sub.done:
+			}
+		}()
+		return sub, nil
+	}
+}
+
+// newStream creates the stream of a query, yet to be started.
+func (h *Hub) newStream(fingerprint string) *sharedStream {
+	ctx, cancel := context.WithCancel(h.client.ctx)
+	return &sharedStream{
+		hub:         h,
+		fingerprint: fingerprint,
+		ctx:         ctx,
+		cancel:      cancel,
+		ready:       make(chan struct{}),
+		subs:        make(map[*Subscription]struct{}),
+		replay:      newRowRing(h.opts.Replay),
+	}
+}
+
+// start runs the upstream query and fans its rows out, to the
+// subscribers waiting first.
+func (ss *sharedStream) start(ksql string, props map[string]string) {
+	rows, err := ss.hub.client.Query(ss.ctx, normalizeKsql(ksql)+";", props)
+
+	ss.hub.mu.Lock()
+	ss.mu.Lock()
+	closed := ss.closed
+	switch {
+	case closed:
+	case err != nil:
+		ss.startErr = err
+		ss.closeLocked()
+	default:
+		for i := 0; i < ss.waiting; i++ {
+			ss.pending = append(ss.pending, ss.addLocked())
+		}
+	}
+	close(ss.ready)
+	ss.mu.Unlock()
+	ss.hub.mu.Unlock()
+	if err != nil {
+		return
+	}
+	if closed {
+		// Every subscriber gave up while the query was starting.
+		rows.Close()
+		return
+	}
+
+	go func() {
+		defer rows.Close()
+		for rows.Next() {
+			ss.broadcast(rows.Row())
+		}
+		ss.end(rows.Err())
+	}()
+}
+
+// join returns the subscription of a subscriber that waited for the
+// stream to start. It returns the error the stream failed to start
+// with, or no subscription if the stream has already ended.
+func (ss *sharedStream) join() (*Subscription, error) {
+	ss.hub.mu.Lock()
+	defer ss.hub.mu.Unlock()
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.waiting--
+	if ss.startErr != nil {
+		return nil, ss.startErr
+	}
+	if sub := ss.popPending(); sub != nil {
+		// The subscription may have been disconnected already, and the
+		// stream left without subscribers.
+		ss.closeIfIdleLocked()
+		return sub, nil
+	}
+	if ss.closed {
+		return nil, nil
+	}
+	return ss.addLocked(), nil
+}
+
+// abandon withdraws a subscriber that gave up waiting for the stream to
+// start, closing the stream if it was the last one.
+func (ss *sharedStream) abandon() {
+	ss.hub.mu.Lock()
+	defer ss.hub.mu.Unlock()
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.waiting--
+	if len(ss.pending) > ss.waiting {
+		ss.removeLocked(ss.popPending(), nil)
+	}
+	ss.closeIfIdleLocked()
+}
+
+// closeIfIdle closes the stream if it has no subscribers left, nor any
+// waiting to join.
+func (ss *sharedStream) closeIfIdle() {
+	ss.hub.mu.Lock()
+	defer ss.hub.mu.Unlock()
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.closeIfIdleLocked()
+}
+
+// closeIfIdleLocked is closeIfIdle with the hub and the stream locked.
+func (ss *sharedStream) closeIfIdleLocked() {
+	if ss.waiting == 0 && len(ss.subs) == 0 {
+		ss.closeLocked()
+	}
+}
+
+// popPending takes one of the subscriptions added for the subscribers
+// waiting, or returns nil. It is called with the stream locked.
+func (ss *sharedStream) popPending() *Subscription {
+	if len(ss.pending) == 0 {
+		return nil
+	}
+	sub := ss.pending[len(ss.pending)-1]
+	ss.pending = ss.pending[:len(ss.pending)-1]
+	return sub
+}
+
+// closeLocked unregisters the stream and cancels its query. It is called
+// with the hub and the stream locked.
+func (ss *sharedStream) closeLocked() {
+	if ss.closed {
+		return
+	}
+	ss.closed = true
+	if ss.hub.streams[ss.fingerprint] == ss {
+		delete(ss.hub.streams, ss.fingerprint)
+	}
+	ss.cancel()
+}
+
+// addLocked registers a new subscriber, priming its buffer with the
+// replay. The buffer is grown to fit the replay if needed. It is called
+// with the stream locked.
+func (ss *sharedStream) addLocked() *Subscription {
+	replay := ss.replay.snapshot()
+	size := ss.hub.opts.Buffer
+	if len(replay) > size {
+		size = len(replay)
+	}
+	ch := make(chan Row, size)
+	sub := &Subscription{
+		C:        ch,
+		ch:       ch,
+		done:     make(chan struct{}),
+		stream:   ss,
+		rowtimes: make([]int64, size),
+	}
+	sub.lag.Clock = ss.hub.client.clock
+	sub.lag.Smoothing = ss.hub.opts.LagSmoothing
+	for _, row := range replay {
+		ch <- row
+		sub.pushed(row)
+	}
+	ss.subs[sub] = struct{}{}
+	return sub
+}
+
+// broadcast delivers a row to every subscriber without blocking. The
+// stream is closed if that disconnects its last subscriber.
+func (ss *sharedStream) broadcast(row Row) {
+	if ss.deliver(row) {
+		ss.closeIfIdle()
+	}
+}
+
+// deliver delivers a row to every subscriber, reporting whether any was
+// disconnected.
+func (ss *sharedStream) deliver(row Row) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	disconnected := false
+	ss.replay.push(row)
+	for sub := range ss.subs {
+		select {
+		case sub.ch <- row:
+			sub.pushed(row)
+			continue
+		default:
+		}
+		sub.dropped++
+		if ss.hub.opts.Overflow == OverflowDisconnect {
+			ss.removeLocked(sub, ErrSubscriberOverflow)
+			disconnected = true
+			continue
+		}
+		select {
+		case <-sub.ch:
+		default:
+		}
+		select {
+		case sub.ch <- row:
+			sub.pushed(row)
+		default:
+		}
+	}
+	return disconnected
+}
+
+// pushed records a row added to the subscriber's buffer, and observes
+// the lag of the oldest row still buffered. It is called with the
+// stream locked.
+func (sub *Subscription) pushed(row Row) {
+	rowtime, _ := rowTime(row)
+	sub.rowtimes[sub.next] = rowtime
+	sub.next = (sub.next + 1) % len(sub.rowtimes)
+
+	buffered := len(sub.ch)
+	if buffered == 0 {
+		buffered = 1
+	}
+	oldest := sub.rowtimes[(sub.next-buffered+len(sub.rowtimes))%len(sub.rowtimes)]
+	if oldest > 0 {
+		sub.lag.Observe(oldest)
+	}
+}
+
+// end closes every subscriber once the upstream query is over.
+func (ss *sharedStream) end(err error) {
+	ss.hub.mu.Lock()
+	if ss.hub.streams[ss.fingerprint] == ss {
+		delete(ss.hub.streams, ss.fingerprint)
+	}
+	ss.hub.mu.Unlock()
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.closed = true
+	for sub := range ss.subs {
+		ss.removeLocked(sub, err)
+	}
+}
+
+// removeLocked ends a subscription. It is called with the stream locked.
+func (ss *sharedStream) removeLocked(sub *Subscription, err error) {
+	if _, ok := ss.subs[sub]; !ok {
+		return
+	}
+	delete(ss.subs, sub)
+	sub.err = err
+	close(sub.ch)
+	close(sub.done)
+}
+
+// Close ends the subscription. The upstream query is closed along with
+// its last subscriber.
+func (sub *Subscription) Close() {
+	ss := sub.stream
+	ss.hub.mu.Lock()
+	defer ss.hub.mu.Unlock()
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.removeLocked(sub, nil)
+	ss.closeIfIdleLocked()
+}
+
+// Err returns the error that ended the subscription, if any. It is only
+// meaningful once C has been closed.
+func (sub *Subscription) Err() error {
+	return sub.err
+}
+
+// Lag returns the subscriber's estimated end-to-end lag, from the
+// ROWTIME of the oldest row waiting in its buffer as each row arrives:
+// it grows when either the upstream query or the subscriber falls
+// behind. It is false until a row with a ROWTIME has arrived.
+func (sub *Subscription) Lag() (time.Duration, bool) {
+	return sub.lag.Lag()
+}
+
+// Dropped returns how many rows this subscriber missed because its
+// buffer was full.
+func (sub *Subscription) Dropped() int64 {
+	sub.stream.mu.Lock()
+	defer sub.stream.mu.Unlock()
+	return sub.dropped
+}
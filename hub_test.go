@@ -0,0 +1,135 @@
+package ksqldb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"hews.co/ksqldb"
+)
+
+const pricesSchema = "`SYMBOL` STRING, `PRICE` BIGINT"
+
+func TestHubSharesStreams(t *testing.T) {
+	server := newFakeServer(t, func(ksql string) (fakeQuery, int) {
+		return fakeQuery{schema: pricesSchema, push: true, rows: []string{`["A",1]`, `["B",2]`}}, 0
+	})
+	hub := ksqldb.NewHub(server.client(t, ksqldb.ClientOptions{}), ksqldb.HubOptions{Replay: 2})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first, err := hub.Subscribe(ctx, "SELECT * FROM prices EMIT CHANGES;", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSymbols(t, first, "A", "B")
+	// Equivalent up to whitespace, and joining the running stream: the
+	// late subscriber is primed with the replay.
+	second, err := hub.Subscribe(ctx, "SELECT *\n  FROM prices EMIT CHANGES", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSymbols(t, second, "A", "B")
+	if got := len(server.queries()); got != 1 {
+		t.Errorf("%d queries started, want 1", got)
+	}
+
+	first.Close()
+	second.Close()
+	if _, ok := <-second.C; ok {
+		t.Error("C not closed after Close")
+	}
+}
+
+func TestHubStartsStreamsUnlocked(t *testing.T) {
+	release := make(chan struct{})
+	server := newFakeServer(t, func(ksql string) (fakeQuery, int) {
+		query := fakeQuery{schema: pricesSchema, push: true, rows: []string{`["A",1]`}}
+		if ksql == "SELECT * FROM slow EMIT CHANGES;" {
+			query.wait = release
+		}
+		return query, 0
+	})
+	hub := ksqldb.NewHub(server.client(t, ksqldb.ClientOptions{}), ksqldb.HubOptions{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	slow := make(chan *ksqldb.Subscription, 1)
+	go func() {
+		sub, err := hub.Subscribe(ctx, "SELECT * FROM slow EMIT CHANGES;", nil)
+		if err != nil {
+			t.Error(err)
+		}
+		slow <- sub
+	}()
+	waitFor(t, func() bool { return len(server.queries()) == 1 })
+
+	// Another query is not held up by the slow one.
+	fast, err := hub.Subscribe(ctx, "SELECT * FROM fast EMIT CHANGES;", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSymbols(t, fast, "A")
+
+	// Nor is a subscriber of the slow one that gives up.
+	waitCtx, waitCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer waitCancel()
+	if _, err := hub.Subscribe(waitCtx, "SELECT * FROM slow EMIT CHANGES;", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Subscribe() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	select {
+	case sub := <-slow:
+		assertSymbols(t, sub, "A")
+		sub.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow subscription did not start")
+	}
+	fast.Close()
+}
+
+func TestHubOverflowDisconnect(t *testing.T) {
+	server := newFakeServer(t, func(ksql string) (fakeQuery, int) {
+		return fakeQuery{schema: pricesSchema, push: true, rows: []string{`["A",1]`, `["B",2]`, `["C",3]`}}, 0
+	})
+	hub := ksqldb.NewHub(server.client(t, ksqldb.ClientOptions{}), ksqldb.HubOptions{
+		Buffer:   1,
+		Overflow: ksqldb.OverflowDisconnect,
+	})
+	sub, err := hub.Subscribe(context.Background(), "SELECT * FROM prices EMIT CHANGES;", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without reading, the buffer of one row overflows.
+	waitFor(t, func() bool { return sub.Dropped() > 0 })
+	for range sub.C {
+	}
+	if err := sub.Err(); !errors.Is(err, ksqldb.ErrSubscriberOverflow) {
+		t.Errorf("Err() = %v, want %v", err, ksqldb.ErrSubscriberOverflow)
+	}
+	// The stream is closed along with its last subscriber.
+	waitFor(t, func() bool {
+		sent := server.sent()
+		return sent[len(sent)-1] == "TERMINATE q1;"
+	})
+}
+
+// assertSymbols reads the SYMBOL of the next rows of a subscription.
+func assertSymbols(t *testing.T, sub *ksqldb.Subscription, symbols ...string) {
+	t.Helper()
+	for _, want := range symbols {
+		select {
+		case row, ok := <-sub.C:
+			if !ok {
+				t.Fatalf("subscription ended: %v", sub.Err())
+			}
+			if got, _ := row.Get("SYMBOL"); got != want {
+				t.Errorf("SYMBOL = %v, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no row %s", want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package ksqldb
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IdempotencyKeyHeader is the request header carrying an idempotency
+// key, see WithIdempotencyKey.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// ErrDuplicateRequest is returned for requests whose idempotency key was
+// already sent, under DuplicateReject.
+var ErrDuplicateRequest = errors.New("duplicate request")
+
+// idempotencyKeyContext is the context key of idempotency keys.
+type idempotencyKeyContext struct{}
+
+// WithIdempotencyKey attaches an idempotency key to the requests made
+// with ctx, sent in the Idempotency-Key header. Retrying a non-idempotent
+// statement, such as INSERT INTO ... VALUES, with the same key lets the
+// client's ledger catch the duplicate (see IdempotencyOptions):
+//
+//	ctx = ksqldb.WithIdempotencyKey(ctx, client.NewIdempotencyKey())
+//	err := writer.Insert(ctx, order) // retried with the same ctx
+//
+// Requests built by hand may set the header themselves instead.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContext{}, key)
+}
+
+// NewIdempotencyKey returns a random key for WithIdempotencyKey, see
+// RandomID.
+func NewIdempotencyKey() string {
+	return RandomID()
+}
+
+// IDGenerator generates the identifiers the client hands out, such as
+// idempotency keys, eg. UUIDv7s or ULIDs, so that they follow the
+// conventions of the application's logs and traces.
+type IDGenerator func() string
+
+// RandomID is the default IDGenerator: 16 random bytes, in hex.
+func RandomID() string {
+	var byt [16]byte
+	if _, err := rand.Read(byt[:]); err != nil {
+		panic("ksqldb: reading random id: " + err.Error())
+	}
+	return hex.EncodeToString(byt[:])
+}
+
+// NewIdempotencyKey returns a key for WithIdempotencyKey, from the
+// client's IDGenerator.
+func (cc *Client) NewIdempotencyKey() string {
+	return cc.newID()
+}
+
+// DuplicatePolicy decides what happens to requests whose idempotency key
+// was already sent.
+type DuplicatePolicy int
+
+const (
+	// DuplicateReject fails duplicates with ErrDuplicateRequest, without
+	// sending them.
+	DuplicateReject DuplicatePolicy = iota
+
+	// DuplicateFlag sends duplicates anyway, logging them and marking
+	// their Response (see Response.Duplicate).
+	DuplicateFlag
+)
+
+// IdempotencyOptions configure the client's ledger of the idempotency
+// keys it sent.
+type IdempotencyOptions struct {
+	// TTL, if set, keeps a ledger of the keys sent for this long, which
+	// catches retries of requests that may have been applied: those in
+	// flight, answered with a 2xx status, or whose response was lost.
+	// Requests the server rejected may be retried freely.
+	TTL time.Duration
+
+	Policy DuplicatePolicy
+}
+
+// IdempotencyStats describes the use of the idempotency ledger.
+type IdempotencyStats struct {
+	Keys       int
+	Duplicates int64
+}
+
+// idempotencyLedger remembers the idempotency keys sent, in the order
+// they were sent.
+type idempotencyLedger struct {
+	ttl    time.Duration
+	policy DuplicatePolicy
+	clock  Clock
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+
+	duplicates int64
+}
+
+// idempotencyEntry is a key in the ledger.
+type idempotencyEntry struct {
+	key  string
+	sent time.Time
+}
+
+// newIdempotencyLedger creates a ledger, or returns nil if the options
+// do not enable one.
+func newIdempotencyLedger(opts IdempotencyOptions, clock Clock) *idempotencyLedger {
+	if opts.TTL <= 0 {
+		return nil
+	}
+	return &idempotencyLedger{
+		ttl:     opts.TTL,
+		policy:  opts.Policy,
+		clock:   clock,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// begin records a key about to be sent, reporting whether it is a
+// duplicate.
+func (il *idempotencyLedger) begin(key string) bool {
+	il.mu.Lock()
+	defer il.mu.Unlock()
+	now := il.clock.Now()
+	for front := il.order.Front(); front != nil; front = il.order.Front() {
+		entry := front.Value.(*idempotencyEntry)
+		if now.Sub(entry.sent) < il.ttl {
+			break
+		}
+		il.order.Remove(front)
+		delete(il.entries, entry.key)
+	}
+	if _, ok := il.entries[key]; ok {
+		atomic.AddInt64(&il.duplicates, 1)
+		return true
+	}
+	il.entries[key] = il.order.PushBack(&idempotencyEntry{key: key, sent: now})
+	return false
+}
+
+// forget drops a key whose request was rejected, so that it may be
+// retried.
+func (il *idempotencyLedger) forget(key string) {
+	il.mu.Lock()
+	defer il.mu.Unlock()
+	if elem, ok := il.entries[key]; ok {
+		il.order.Remove(elem)
+		delete(il.entries, key)
+	}
+}
+
+// stats reports on the ledger, which may be nil.
+func (il *idempotencyLedger) stats() IdempotencyStats {
+	if il == nil {
+		return IdempotencyStats{}
+	}
+	il.mu.Lock()
+	keys := len(il.entries)
+	il.mu.Unlock()
+	return IdempotencyStats{Keys: keys, Duplicates: atomic.LoadInt64(&il.duplicates)}
+}
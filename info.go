@@ -0,0 +1,73 @@
+package ksqldb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"hews.co/ksqldb/pkg/ksql"
+	"hews.co/ksqldb/pkg/ksqldbapi"
+)
+
+// ServerInfo is the server's self-description, from the /info endpoint.
+type ServerInfo struct {
+	Version        string `json:"version"`
+	KafkaClusterID string `json:"kafkaClusterId"`
+	KsqlServiceID  string `json:"ksqlServiceId"`
+	ServerStatus   string `json:"serverStatus"`
+}
+
+// ServerInfo fetches the server's version, cluster and status.
+func (cc *Client) ServerInfo(ctx context.Context) (*ServerInfo, error) {
+	info, _, err := cc.serverInfo(ctx)
+	return info, err
+}
+
+// serverInfo fetches the server info, along with the major version of
+// the HTTP protocol it was served over.
+func (cc *Client) serverInfo(ctx context.Context) (*ServerInfo, int, error) {
+	rh, err := cc.do(ctx, newGetResource(&ksqldbapi.EndpointStatusServer))
+	if err != nil {
+		return nil, 0, fmt.Errorf("getting server info: %w", err)
+	}
+	defer rh.Close()
+
+	byt, err := rh.ReadAll()
+	if err != nil {
+		return nil, 0, fmt.Errorf("getting server info: %w", err)
+	}
+	if rh.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("getting server info: %w", rh.responseError(byt, nil))
+	}
+	var wrapped struct {
+		Info ServerInfo `json:"KsqlServerInfo"`
+	}
+	if err := json.Unmarshal(byt, &wrapped); err != nil {
+		return nil, 0, fmt.Errorf("getting server info: %w", rh.responseError(byt, fmt.Errorf("decoding response: %w", err)))
+	}
+	return &wrapped.Info, rh.ProtoMajor, nil
+}
+
+// Dialect returns the dialect of the server, adapting the ksql builders
+// to its version. The version is detected once, with ServerInfo, unless
+// set with ClientOptions.ServerVersion; failed detections are retried on
+// the next call.
+func (cc *Client) Dialect(ctx context.Context) (ksql.Dialect, error) {
+	cc.dialectMu.Lock()
+	defer cc.dialectMu.Unlock()
+	if cc.dialect != nil {
+		return *cc.dialect, nil
+	}
+
+	info, err := cc.ServerInfo(ctx)
+	if err != nil {
+		return ksql.Dialect{}, fmt.Errorf("detecting server version: %w", err)
+	}
+	version, err := ksql.ParseVersion(info.Version)
+	if err != nil {
+		return ksql.Dialect{}, fmt.Errorf("detecting server version: %w", err)
+	}
+	cc.dialect = &ksql.Dialect{Version: version}
+	return *cc.dialect, nil
+}
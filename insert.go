@@ -0,0 +1,271 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// StreamWriter inserts Go structs into a stream or table with INSERT
+// INTO ... VALUES, mapping exported fields to columns through their
+// `ksql` tags (see structField). Key columns are designated with the
+// "key" tag option:
+//
+//	type Transaction struct {
+//		AccountID int64  `ksql:"ACCOUNTID,key"`
+//		Amount    int64  `ksql:"AMOUNT"`
+//	}
+//
+// The target is described once, when the writer is created, and every
+// insert is validated against it: fields must map to known columns, key
+// columns must be tagged as keys (and only they), and the key must be
+// serializable in the source's key format.
+//
+// Columns can be given hooks, with Transform, that encrypt or otherwise
+// serialize their values before they are written. Times written to the
+// TIMESTAMP column of a source with a TIMESTAMP_FORMAT are rendered in
+// that format.
+type StreamWriter struct {
+	client *Client
+	target string
+	desc   *SourceDescription
+	hooks  map[string][]ColumnTransform
+
+	// timestampColumn is the source's TIMESTAMP column, if it has a
+	// TIMESTAMP_FORMAT, and timestamp that format.
+	timestampColumn string
+	timestamp       ksql.TimestampFormat
+}
+
+// NewStreamWriter describes the target and returns a writer for it.
+func (cc *Client) NewStreamWriter(ctx context.Context, target string) (*StreamWriter, error) {
+	sd, err := cc.Describe(ctx, target)
+	if err != nil {
+		return nil, fmt.Errorf("creating writer for %s: %w", target, err)
+	}
+	sw := &StreamWriter{client: cc, target: target, desc: sd}
+	tf, ok, err := sd.TimestampFormat()
+	if err != nil {
+		return nil, fmt.Errorf("creating writer for %s: %w", target, err)
+	}
+	if ok {
+		wo, _ := sd.WithOptions()
+		sw.timestampColumn, sw.timestamp = wo.Timestamp, tf
+	}
+	return sw, nil
+}
+
+// Transform registers a hook applied to the values written to the named
+// column, eg. to encrypt a field or tokenize PII before it reaches
+// Kafka. Several hooks of a column apply in order; the result must suit
+// the column's type.
+func (sw *StreamWriter) Transform(column string, fn ColumnTransform) error {
+	field, ok := sw.findField(column, sw.client.casePolicy)
+	if !ok {
+		return fmt.Errorf("transforming %s: no column %s", sw.target, column)
+	}
+	if sw.hooks == nil {
+		sw.hooks = make(map[string][]ColumnTransform)
+	}
+	sw.hooks[field.Name] = append(sw.hooks[field.Name], fn)
+	return nil
+}
+
+// insertColumn is a column of an INSERT and the value written to it.
+type insertColumn struct {
+	field FieldInfo
+	value interface{}
+}
+
+// Insert writes the struct (or pointer to struct) v as a single row.
+func (sw *StreamWriter) Insert(ctx context.Context, v interface{}) error {
+	columns, err := sw.columns(v)
+	if err != nil {
+		return fmt.Errorf("inserting into %s: %w", sw.target, err)
+	}
+
+	names := make([]string, len(columns))
+	values := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = ksql.Quote(col.field.Name)
+		value := col.value
+		for _, hook := range sw.hooks[col.field.Name] {
+			if value, err = hook(value); err != nil {
+				return fmt.Errorf("inserting into %s: column %s: %w", sw.target, col.field.Name, err)
+			}
+		}
+		if sw.isTimestamp(col.field) {
+			value = sw.formatTimestamp(value)
+		}
+		if values[i], err = columnLiteral(value, col.field.Schema, sw.client.timeFormat); err != nil {
+			return fmt.Errorf("inserting into %s: column %s: %w", sw.target, col.field.Name, err)
+		}
+	}
+	statement := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s);",
+		ksql.Quote(sw.desc.Name), strings.Join(names, ", "), strings.Join(values, ", "),
+	)
+	if _, err := sw.client.runStatement(ctx, statement, nil); err != nil {
+		return fmt.Errorf("inserting into %s: %w", sw.target, err)
+	}
+	return nil
+}
+
+// isTimestamp reports whether the field is the source's TIMESTAMP column
+// parsed with a TIMESTAMP_FORMAT.
+func (sw *StreamWriter) isTimestamp(field FieldInfo) bool {
+	return sw.timestampColumn != "" && sw.client.casePolicy.Match(sw.timestampColumn, field.Name)
+}
+
+// formatTimestamp renders a time in the source's TIMESTAMP_FORMAT, and
+// leaves other values alone.
+func (sw *StreamWriter) formatTimestamp(value interface{}) interface{} {
+	switch vv := value.(type) {
+	case time.Time:
+		return sw.timestamp.Format(vv)
+	case *time.Time:
+		if vv != nil {
+			return sw.timestamp.Format(*vv)
+		}
+	}
+	return value
+}
+
+// columns maps the struct's fields onto the described columns,
+// validating the key designation.
+func (sw *StreamWriter) columns(v interface{}) ([]insertColumn, error) {
+	vv := reflect.ValueOf(v)
+	for vv.Kind() == reflect.Ptr {
+		if vv.IsNil() {
+			return nil, fmt.Errorf("nil %T", v)
+		}
+		vv = vv.Elem()
+	}
+	if vv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot insert %T: not a struct", v)
+	}
+
+	var (
+		columns []insertColumn
+		keys    []FieldInfo
+	)
+	policy := sw.client.casePolicy
+	for _, sf := range structFields(vv.Type()) {
+		field, ok := sw.findField(sf.Name, policy)
+		if !ok {
+			return nil, fmt.Errorf("field %s: no column %s", vv.Type().Field(sf.Index[0]).Name, sf.Name)
+		}
+		if field.IsHeader() {
+			return nil, fmt.Errorf("column %s is populated from record headers and cannot be inserted", field.Name)
+		}
+		isKey := field.IsKey() || (field.Name == "ROWKEY" && !sw.hasKeyColumns())
+		switch {
+		case sf.Key && !isKey:
+			return nil, fmt.Errorf("column %s is tagged as a key but is not part of the key", field.Name)
+		case !sf.Key && isKey:
+			return nil, fmt.Errorf("column %s is a key column: tag it with the key option", field.Name)
+		}
+		if isKey {
+			keys = append(keys, field)
+		}
+		columns = append(columns, insertColumn{field: field, value: vv.FieldByIndex(sf.Index).Interface()})
+	}
+
+	if err := sw.validateKey(keys); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// validateKey checks the key columns given against the source's key:
+// tables require all of them, and they must be serializable in the key
+// format.
+func (sw *StreamWriter) validateKey(keys []FieldInfo) error {
+	ks := sw.desc.Key()
+	if strings.EqualFold(sw.desc.Type, "TABLE") {
+		if len(keys) == 0 {
+			return fmt.Errorf("table %s requires its key columns", sw.desc.Name)
+		}
+		for _, want := range ks.Columns {
+			if !containsField(keys, want.Name) {
+				return fmt.Errorf("table %s requires its key column %s", sw.desc.Name, want.Name)
+			}
+		}
+	}
+	ks.Columns = keys
+	return ks.Check()
+}
+
+// containsField reports whether the fields include the named one.
+func containsField(fields []FieldInfo, name string) bool {
+	for _, field := range fields {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// findField finds the described column a struct field maps to.
+func (sw *StreamWriter) findField(name string, policy ksql.CasePolicy) (FieldInfo, bool) {
+	for _, field := range sw.desc.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	for _, field := range sw.desc.Fields {
+		if policy.Match(name, field.Name) {
+			return field, true
+		}
+	}
+	return FieldInfo{}, false
+}
+
+// hasKeyColumns reports whether the source declares key columns, as
+// opposed to the implicit ROWKEY of older servers.
+func (sw *StreamWriter) hasKeyColumns() bool {
+	for _, field := range sw.desc.Fields {
+		if field.IsKey() {
+			return true
+		}
+	}
+	return false
+}
+
+// columnLiteral renders a value for a column of the given type. Values
+// written to STRING columns are serialized as strings whatever their Go
+// type, so that eg. an int64 account ID is a valid STRING key, and
+// strings and byte arrays written to BYTES columns are sent as bytes.
+// Times written to DATE and TIME columns are rendered in the zone of the
+// client's TimeFormat.
+func columnLiteral(value interface{}, schema SchemaInfo, times ksql.TimeFormatter) (string, error) {
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	switch schema.Type {
+	case "BYTES":
+		switch {
+		case rv.Kind() == reflect.String:
+			return ksql.Literal([]byte(rv.String()))
+		case rv.Kind() == reflect.Array && rv.Type().Elem().Kind() == reflect.Uint8:
+			byt := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(byt), rv)
+			return ksql.Literal(byt)
+		}
+	case "STRING", "VARCHAR":
+		switch rv.Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return ksql.String(fmt.Sprint(rv.Interface())), nil
+		}
+	case "DATE", "TIME":
+		return times.Literal(value, schema.Type)
+	}
+	return ksql.Literal(value)
+}
@@ -0,0 +1,147 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// BuildJoin validates a join query against the schemas of its sources,
+// looked up with DESCRIBE, and renders it. It catches what the server
+// would otherwise reject with little explanation:
+//
+//   - stream-stream joins without a WITHIN window, and windows on joins
+//     involving a table,
+//   - a table joined to a stream on the left,
+//   - join keys that do not exist or whose types differ.
+//
+// The query is built under the client's case policy, for the server's
+// dialect.
+func (cc *Client) BuildJoin(ctx context.Context, jq ksql.JoinQuery) (string, error) {
+	dialect, err := cc.Dialect(ctx)
+	if err != nil {
+		return "", fmt.Errorf("building join: %w", err)
+	}
+	jq.Policy = cc.casePolicy
+	jq.Dialect = dialect
+	if err := cc.ValidateJoin(ctx, jq); err != nil {
+		return "", err
+	}
+	return jq.Build()
+}
+
+// ValidateJoin runs the checks of BuildJoin without rendering the query.
+func (cc *Client) ValidateJoin(ctx context.Context, jq ksql.JoinQuery) error {
+	sources := make(map[string]*SourceDescription, len(jq.Joins)+1)
+	describe := func(js ksql.JoinSource) (*SourceDescription, error) {
+		sd, err := cc.Describe(ctx, js.Name)
+		if err != nil {
+			return nil, fmt.Errorf("validating join: %w", err)
+		}
+		sources[js.Ref()] = sd
+		return sd, nil
+	}
+
+	left, err := describe(jq.From)
+	if err != nil {
+		return err
+	}
+	for _, join := range jq.Joins {
+		right, err := describe(join.Source)
+		if err != nil {
+			return err
+		}
+		// Each join's result is the left side of the next. Tables cannot
+		// be joined to streams, so it stays whatever the first source is.
+		if err := cc.validateJoin(jq, join, left, right, sources); err != nil {
+			return fmt.Errorf("validating join of %s: %w", join.Source.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateJoin checks a single join against the schemas of its sides.
+func (cc *Client) validateJoin(jq ksql.JoinQuery, join ksql.Join, left, right *SourceDescription, sources map[string]*SourceDescription) error {
+	switch {
+	case isTable(left) && isTable(right):
+		if join.Within > 0 {
+			return fmt.Errorf("joins with a table cannot have a WITHIN window")
+		}
+	case !isTable(left) && !isTable(right):
+		if join.Within <= 0 {
+			return fmt.Errorf("stream-stream joins require a WITHIN window")
+		}
+	case isTable(left) && !isTable(right):
+		return fmt.Errorf("a table cannot be joined to a stream; put the stream %s on the left", right.Name)
+	default:
+		if join.Within > 0 {
+			return fmt.Errorf("joins with a table cannot have a WITHIN window")
+		}
+	}
+
+	leftRef, leftCol := ksql.SplitQualified(join.LeftKey)
+	if leftRef == "" {
+		leftRef = jq.From.Ref()
+	}
+	leftSource, ok := cc.joinSource(sources, leftRef)
+	if !ok {
+		return fmt.Errorf("left key %s refers to unknown source %s", join.LeftKey, leftRef)
+	}
+	leftField, ok := cc.joinField(leftSource, leftCol)
+	if !ok {
+		return fmt.Errorf("left key %s not in %s", leftCol, leftSource.Name)
+	}
+	_, rightCol := ksql.SplitQualified(join.RightKey)
+	rightField, ok := cc.joinField(right, rightCol)
+	if !ok {
+		return fmt.Errorf("right key %s not in %s", rightCol, right.Name)
+	}
+
+	if isTable(left) && isTable(right) {
+		// Joining on a value column of the left table, rather than its
+		// key, is a foreign key join; the right side must be keyed.
+		if !rightField.IsKey() {
+			return fmt.Errorf("right key %s is not the primary key of %s", rightField.Name, right.Name)
+		}
+		if !leftField.IsKey() {
+			if err := jq.Dialect.Check(ksql.FeatureForeignKeyJoin); err != nil {
+				return err
+			}
+		}
+	}
+	if got, want := leftField.Schema.String(), rightField.Schema.String(); got != want {
+		return fmt.Errorf("key types differ: %s.%s is %s, %s.%s is %s",
+			leftSource.Name, leftField.Name, got, right.Name, rightField.Name, want)
+	}
+	return nil
+}
+
+// joinSource finds a described source by its alias or name.
+func (cc *Client) joinSource(sources map[string]*SourceDescription, ref string) (*SourceDescription, bool) {
+	if sd, ok := sources[ref]; ok {
+		return sd, true
+	}
+	for name, sd := range sources {
+		if cc.casePolicy.Match(ref, name) || cc.casePolicy.Match(ref, sd.Name) {
+			return sd, true
+		}
+	}
+	return nil, false
+}
+
+// joinField finds a column of a source under the case policy.
+func (cc *Client) joinField(sd *SourceDescription, name string) (FieldInfo, bool) {
+	for _, field := range sd.Fields {
+		if cc.casePolicy.Match(name, field.Name) {
+			return field, true
+		}
+	}
+	return FieldInfo{}, false
+}
+
+// isTable reports whether a described source is a table.
+func isTable(sd *SourceDescription) bool {
+	return strings.EqualFold(sd.Type, "TABLE")
+}
@@ -0,0 +1,175 @@
+package ksqldb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// JSONLinesSink writes rows as JSON Lines (NDJSON): one object per row,
+// keyed by column name in column order, for jq pipelines and log
+// shippers. With Schema set, the rows are preceded by a line describing
+// the columns:
+//
+//	{"schema":{"columns":[{"name":"ID","type":"BIGINT"},...]}}
+//	{"ID":1,...}
+type JSONLinesSink struct {
+	// Schema writes the schema line ahead of the rows.
+	Schema bool
+
+	// Times renders decoded TIMESTAMP, DATE and TIME values (see
+	// DecodeOptions.Temporal), as strings.
+	Times ksql.TimeFormatter
+
+	writer *bufio.Writer
+	buf    bytes.Buffer
+}
+
+// NewJSONLinesSink creates a JSONLinesSink writing to w.
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{writer: bufio.NewWriter(w)}
+}
+
+// jsonLinesColumn is a column of the schema line.
+type jsonLinesColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// WriteHeader implements RowSink.
+func (js *JSONLinesSink) WriteHeader(columns []Column) error {
+	if !js.Schema {
+		return nil
+	}
+	schema := make([]jsonLinesColumn, len(columns))
+	for i, col := range columns {
+		schema[i] = jsonLinesColumn{Name: col.Name, Type: col.Type}
+	}
+	js.buf.Reset()
+	err := js.encode(map[string]interface{}{
+		"schema": map[string]interface{}{"columns": schema},
+	})
+	if err != nil {
+		return fmt.Errorf("writing json lines schema: %w", err)
+	}
+	return js.writeLine(js.buf.Bytes())
+}
+
+// WriteRow implements RowSink.
+func (js *JSONLinesSink) WriteRow(row Row) error {
+	js.buf.Reset()
+	if err := encodeRowJSON(&js.buf, row, js.Times); err != nil {
+		return fmt.Errorf("writing json lines row: %w", err)
+	}
+	return js.writeLine(js.buf.Bytes())
+}
+
+// encode appends the JSON encoding of v to the line being built.
+func (js *JSONLinesSink) encode(v interface{}) error {
+	return encodeJSON(&js.buf, v)
+}
+
+// encodeRowJSON appends the row to buf as a JSON object keyed by column
+// name, in column order, with times rendered by times.
+func encodeRowJSON(buf *bytes.Buffer, row Row, times ksql.TimeFormatter) error {
+	buf.WriteByte('{')
+	for i, value := range row.Values {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name := fmt.Sprint(i)
+		if i < len(row.Columns) {
+			name = row.Columns[i].Name
+		}
+		encodeJSON(buf, name)
+		buf.WriteByte(':')
+		if text, ok := times.Format(value, columnType(row, i)); ok {
+			buf.WriteString(strconv.Quote(text))
+			continue
+		}
+		if err := encodeJSON(buf, value); err != nil {
+			return fmt.Errorf("column %s: %w", name, err)
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// encodeJSON appends the JSON encoding of v to buf, without escaping
+// HTML characters, which are common in types (ARRAY<INT>). Decimals and
+// TIME values are written as the server writes them, at any depth, see
+// encodableValue.
+func encodeJSON(buf *bytes.Buffer, v interface{}) error {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(encodableValue(v)); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1) // Encode ends with a newline.
+	return nil
+}
+
+// writeLine writes a line.
+func (js *JSONLinesSink) writeLine(byt []byte) error {
+	if _, err := js.writer.Write(byt); err != nil {
+		return fmt.Errorf("writing json lines: %w", err)
+	}
+	if err := js.writer.WriteByte('\n'); err != nil {
+		return fmt.Errorf("writing json lines: %w", err)
+	}
+	return nil
+}
+
+// Flush implements RowSink.
+func (js *JSONLinesSink) Flush() error {
+	if err := js.writer.Flush(); err != nil {
+		return fmt.Errorf("flushing json lines: %w", err)
+	}
+	return nil
+}
+
+// CopyRows writes all the rows into the sink, with the header first and
+// a flush at the end, and closes the rows. It returns the number of rows
+// written.
+func CopyRows(sink RowSink, rows *Rows) (int64, error) {
+	defer rows.Close()
+
+	var count int64
+	wroteHeader := false
+	writeHeader := func() error {
+		wroteHeader = true
+		var columns []Column
+		if header := rows.Header(); header != nil {
+			columns = header.Columns
+		}
+		return sink.WriteHeader(columns)
+	}
+	for rows.Next() {
+		if !wroteHeader {
+			if err := writeHeader(); err != nil {
+				return count, fmt.Errorf("copying rows: %w", err)
+			}
+		}
+		if err := sink.WriteRow(rows.Row()); err != nil {
+			return count, fmt.Errorf("copying rows: %w", err)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, fmt.Errorf("copying rows: %w", err)
+	}
+	if !wroteHeader {
+		if err := writeHeader(); err != nil {
+			return count, fmt.Errorf("copying rows: %w", err)
+		}
+	}
+	if err := sink.Flush(); err != nil {
+		return count, fmt.Errorf("copying rows: %w", err)
+	}
+	return count, nil
+}
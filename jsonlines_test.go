@@ -0,0 +1,60 @@
+package ksqldb
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestJSONLinesSinkDecimals(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONLinesSink(&buf)
+	row := Row{
+		Columns: []Column{
+			{Name: "PRICE", Type: "DECIMAL(10, 2)"},
+			{Name: "PRICES", Type: "ARRAY<DECIMAL(10, 2)>"},
+			{Name: "LINE", Type: "STRUCT<`PRICE` DECIMAL(10, 2)>"},
+		},
+		Values: []interface{}{
+			big.NewRat(123, 100),
+			[]interface{}{big.NewRat(1, 4), nil},
+			map[string]interface{}{"PRICE": big.NewRat(-5, 2)},
+		},
+	}
+	if err := sink.WriteRow(row); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"PRICE":1.23,"PRICES":[0.25,null],"LINE":{"PRICE":-2.5}}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestJSONLinesSinkTimes(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONLinesSink(&buf)
+	row := Row{
+		Columns: []Column{
+			{Name: "OPENS", Type: "TIME"},
+			{Name: "BREAKS", Type: "ARRAY<TIME>"},
+		},
+		Values: []interface{}{
+			5 * time.Second,
+			[]interface{}{12*time.Hour + 1500*time.Millisecond},
+		},
+	}
+	if err := sink.WriteRow(row); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"OPENS":"00:00:05","BREAKS":["12:00:01.5"]}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
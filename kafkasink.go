@@ -0,0 +1,157 @@
+package ksqldb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// KafkaMessage is a record to produce to Kafka.
+type KafkaMessage struct {
+	Topic     string
+	Key       []byte
+	Value     []byte
+	Headers   []RecordHeader
+	Timestamp time.Time
+}
+
+// KafkaProducer produces records to Kafka. The client has no Kafka
+// dependency of its own: adapt the producer of whichever Kafka library
+// the program uses. Produce should return once the record is
+// acknowledged, or the sink's delivery guarantees are the producer's.
+type KafkaProducer interface {
+	Produce(ctx context.Context, msg KafkaMessage) error
+}
+
+// KafkaProducerFunc adapts a function to a KafkaProducer.
+type KafkaProducerFunc func(ctx context.Context, msg KafkaMessage) error
+
+// Produce implements KafkaProducer.
+func (fn KafkaProducerFunc) Produce(ctx context.Context, msg KafkaMessage) error {
+	return fn(ctx, msg)
+}
+
+// KafkaSinkOptions configure a KafkaSink.
+type KafkaSinkOptions struct {
+	// Topic is the topic produced to.
+	Topic string
+
+	// Key, if set, extracts the records' keys from the rows. Records are
+	// produced without keys otherwise.
+	Key KeyFunc
+
+	// Transform, if set, is applied to each row before it is produced,
+	// eg. to enrich it from another service. Returning false drops the
+	// row.
+	Transform func(ctx context.Context, row Row) (Row, bool, error)
+
+	// Encode serializes the rows into the records' values. It defaults
+	// to a JSON object keyed by column name, with times rendered by Times.
+	Encode func(row Row) ([]byte, error)
+	Times  ksql.TimeFormatter
+}
+
+// KafkaSink republishes result rows to a Kafka topic through a
+// KafkaProducer, for enrichment loops that ksqlDB alone cannot express:
+// rows are read from a query, transformed in Go and written back for
+// ksqlDB (or anyone else) to consume. Records carry the rows' ROWTIME
+// as their timestamp, when there is one.
+//
+// It is a RowSink, and consumes hub subscriptions with Run.
+type KafkaSink struct {
+	producer KafkaProducer
+	opts     KafkaSinkOptions
+	buf      bytes.Buffer
+}
+
+// NewKafkaSink creates a KafkaSink producing with producer.
+func NewKafkaSink(producer KafkaProducer, opts KafkaSinkOptions) (*KafkaSink, error) {
+	if opts.Topic == "" {
+		return nil, fmt.Errorf("creating kafka sink: no topic")
+	}
+	return &KafkaSink{producer: producer, opts: opts}, nil
+}
+
+// WriteHeader implements RowSink.
+func (ks *KafkaSink) WriteHeader([]Column) error {
+	return nil
+}
+
+// WriteRow implements RowSink.
+func (ks *KafkaSink) WriteRow(row Row) error {
+	return ks.produce(context.Background(), row)
+}
+
+// Flush implements RowSink. Records are produced as rows are written,
+// so there is nothing to flush.
+func (ks *KafkaSink) Flush() error {
+	return nil
+}
+
+// produce transforms, encodes and produces a row.
+func (ks *KafkaSink) produce(ctx context.Context, row Row) error {
+	if ks.opts.Transform != nil {
+		var (
+			keep bool
+			err  error
+		)
+		if row, keep, err = ks.opts.Transform(ctx, row); err != nil {
+			return fmt.Errorf("producing to %s: transforming row: %w", ks.opts.Topic, err)
+		}
+		if !keep {
+			return nil
+		}
+	}
+
+	msg := KafkaMessage{Topic: ks.opts.Topic}
+	if ks.opts.Key != nil {
+		key, err := ks.opts.Key(row)
+		if err != nil {
+			return fmt.Errorf("producing to %s: %w", ks.opts.Topic, err)
+		}
+		msg.Key = []byte(key)
+	}
+	if ks.opts.Encode != nil {
+		value, err := ks.opts.Encode(row)
+		if err != nil {
+			return fmt.Errorf("producing to %s: encoding row: %w", ks.opts.Topic, err)
+		}
+		msg.Value = value
+	} else {
+		ks.buf.Reset()
+		if err := encodeRowJSON(&ks.buf, row, ks.opts.Times); err != nil {
+			return fmt.Errorf("producing to %s: encoding row: %w", ks.opts.Topic, err)
+		}
+		// The producer may hold on to the value.
+		msg.Value = append([]byte(nil), ks.buf.Bytes()...)
+	}
+	if rowtime, ok := rowTime(row); ok {
+		msg.Timestamp = time.Unix(0, rowtime*int64(time.Millisecond))
+	}
+
+	if err := ks.producer.Produce(ctx, msg); err != nil {
+		return fmt.Errorf("producing to %s: %w", ks.opts.Topic, err)
+	}
+	return nil
+}
+
+// Run republishes the subscription's rows until it ends or ctx is done.
+// The error is the subscription's, if it ended with one.
+func (ks *KafkaSink) Run(ctx context.Context, sub *Subscription) error {
+	for {
+		select {
+		case row, ok := <-sub.C:
+			if !ok {
+				return sub.Err()
+			}
+			if err := ks.produce(ctx, row); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package ksqldb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error is the error body ksqlDB sends with a 4xx or 5xx status, eg. for
+// a statement that does not parse. Do and ReadAll return it wrapped in a
+// *ResponseError, so that callers may branch on it:
+//
+//	var kerr *ksqldb.Error
+//	if errors.As(err, &kerr) && kerr.ErrorCode == 40001 {
+//		// ...
+//	}
+type Error struct {
+	Type          string            `json:"@type"`
+	ErrorCode     int               `json:"error_code"`
+	Message       string            `json:"message"`
+	StatementText string            `json:"statementText,omitempty"`
+	Entities      []json.RawMessage `json:"entities,omitempty"`
+
+	// StatusCode is the HTTP status the error came with.
+	StatusCode int `json:"-"`
+}
+
+// Error implements error.
+func (ke *Error) Error() string {
+	if ke.ErrorCode != 0 {
+		return fmt.Sprintf("ksqldb error %d: %s", ke.ErrorCode, ke.Message)
+	}
+	return fmt.Sprintf("ksqldb error: %s", ke.Message)
+}
+
+// Sentinel errors for well-known ksqlDB error codes, matched by an *Error
+// with errors.Is:
+//
+//	if errors.Is(err, ksqldb.ErrNotReady) {
+//		// retry on another node
+//	}
+var (
+	ErrBadRequest      = errors.New("ksqldb: bad request")
+	ErrBadStatement    = errors.New("ksqldb: bad statement")
+	ErrUnauthorized    = errors.New("ksqldb: unauthorized")
+	ErrForbidden       = errors.New("ksqldb: forbidden")
+	ErrNotFound        = errors.New("ksqldb: not found")
+	ErrTooManyRequests = errors.New("ksqldb: too many requests")
+	ErrServerError     = errors.New("ksqldb: server error")
+	ErrNotReady        = errors.New("ksqldb: server not ready")
+)
+
+// errorCodes maps ksqlDB error codes to their sentinel errors.
+var errorCodes = map[int]error{
+	40000: ErrBadRequest,
+	40001: ErrBadStatement,
+	40002: ErrBadStatement, // a query sent to /ksql
+	40100: ErrUnauthorized,
+	40101: ErrUnauthorized,
+	40300: ErrForbidden,
+	40301: ErrForbidden, // Kafka access
+	40302: ErrForbidden, // Schema Registry access
+	40400: ErrNotFound,
+	42900: ErrTooManyRequests,
+	50000: ErrServerError,
+	50300: ErrNotReady,
+	50301: ErrNotReady, // not the active node
+	50302: ErrNotReady, // command queue catching up
+	50303: ErrNotReady, // shutting down
+}
+
+// Is matches the sentinel error of the error code, if any.
+func (ke *Error) Is(target error) bool {
+	sentinel, ok := errorCodes[ke.ErrorCode]
+	return ok && sentinel == target
+}
+
+// parseError parses the body of a failed response, returning nil if it
+// is not a ksqlDB error (eg. a proxy's HTML page).
+func parseError(body []byte, statusCode int) *Error {
+	var ke Error
+	if err := json.Unmarshal(body, &ke); err != nil {
+		return nil
+	}
+	if ke.ErrorCode == 0 && ke.Message == "" {
+		return nil
+	}
+	ke.StatusCode = statusCode
+	return &ke
+}
+
+// failed reports whether the response has a status other than 2xx.
+func failed(resp *http.Response) bool {
+	return resp != nil && (resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices)
+}
@@ -0,0 +1,78 @@
+package ksqldb
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultLagSmoothing is the weight a LagEstimator gives each new
+// observation by default.
+const DefaultLagSmoothing = 0.2
+
+// LagEstimator estimates how far behind real time a consumer is, from
+// the ROWTIME of the rows it handles: the lag of a row is the wall clock
+// time at which it is handled minus its ROWTIME, and the estimate is an
+// exponentially weighted moving average of those, so that a single late
+// row does not trip an alert. It is safe for concurrent use.
+type LagEstimator struct {
+	// Smoothing is the weight, in (0, 1], of each new observation. It
+	// defaults to DefaultLagSmoothing; 1 disables smoothing.
+	Smoothing float64
+
+	// Clock is the wall clock. It defaults to SystemClock.
+	Clock Clock
+
+	mu       sync.Mutex
+	smoothed float64
+	last     time.Duration
+	observed bool
+}
+
+// Observe records a row with the given ROWTIME, in epoch milliseconds,
+// handled now.
+func (le *LagEstimator) Observe(rowtime int64) {
+	clock := le.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+	le.observe(clock.Now().Sub(fromEpochMillis(rowtime)))
+}
+
+// observe records a lag.
+func (le *LagEstimator) observe(lag time.Duration) {
+	alpha := le.Smoothing
+	if alpha <= 0 || alpha > 1 {
+		alpha = DefaultLagSmoothing
+	}
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	le.last = lag
+	if !le.observed {
+		le.smoothed = float64(lag)
+		le.observed = true
+		return
+	}
+	le.smoothed += alpha * (float64(lag) - le.smoothed)
+}
+
+// ObserveRow records a row handled now, if it has a ROWTIME.
+func (le *LagEstimator) ObserveRow(row Row) {
+	if rowtime, ok := rowTime(row); ok {
+		le.Observe(rowtime)
+	}
+}
+
+// Lag returns the smoothed lag estimate, and false if nothing has been
+// observed yet.
+func (le *LagEstimator) Lag() (time.Duration, bool) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	return time.Duration(le.smoothed), le.observed
+}
+
+// LastLag returns the lag of the latest row observed.
+func (le *LagEstimator) LastLag() time.Duration {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	return le.last
+}
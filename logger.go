@@ -0,0 +1,130 @@
+package ksqldb
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Logger is the structured logger the client writes to: a message with
+// alternating keys and values, eg.
+//
+//	logger.Log("stream progress", "query_id", id, "rows", 1024)
+//
+// Adapters for logging libraries are a few lines; see LoggerFunc.
+type Logger interface {
+	Log(msg string, keyvals ...interface{})
+}
+
+// LoggerFunc adapts a function to a Logger.
+type LoggerFunc func(msg string, keyvals ...interface{})
+
+// Log implements Logger.
+func (fn LoggerFunc) Log(msg string, keyvals ...interface{}) {
+	fn(msg, keyvals...)
+}
+
+// nopLogger discards everything, standing in for an unset Logger.
+type nopLogger struct{}
+
+// Log implements Logger.
+func (nopLogger) Log(string, ...interface{}) {}
+
+// streamProgress counts what a stream of rows has delivered, and logs
+// it at an interval until stopped, so that long-running consumers show
+// signs of life.
+type streamProgress struct {
+	rows        int64
+	bytes       int64
+	lastRowTime int64
+
+	clock    Clock
+	logger   Logger
+	queryID  atomic.Value
+	started  time.Time
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// newStreamProgress starts logging progress at the interval, until
+// stopped or the context is done.
+func newStreamProgress(ctx context.Context, clock Clock, logger Logger, interval time.Duration) *streamProgress {
+	if clock == nil {
+		clock = SystemClock
+	}
+	sp := &streamProgress{
+		clock:   clock,
+		logger:  logger,
+		started: clock.Now(),
+		stopCh:  make(chan struct{}),
+	}
+	go sp.run(ctx, interval)
+	return sp
+}
+
+// record counts a raw record and, if known, the ROWTIME of its row.
+func (sp *streamProgress) record(size int, rowtime int64, isRow bool) {
+	atomic.AddInt64(&sp.bytes, int64(size))
+	if isRow {
+		atomic.AddInt64(&sp.rows, 1)
+	}
+	if rowtime > 0 {
+		atomic.StoreInt64(&sp.lastRowTime, rowtime)
+	}
+}
+
+// setQueryID attaches the query's ID to subsequent log lines.
+func (sp *streamProgress) setQueryID(id string) {
+	sp.queryID.Store(id)
+}
+
+// run logs at each interval until stopped.
+func (sp *streamProgress) run(ctx context.Context, interval time.Duration) {
+	ticker := sp.clock.NewTicker(interval)
+	defer ticker.Stop()
+	var lastRows int64
+	lastTick := sp.started
+	for {
+		select {
+		case <-sp.stopCh:
+			sp.log("stream finished", sp.clock.Now(), &lastRows, &lastTick)
+			return
+		case <-ctx.Done():
+			sp.log("stream canceled", sp.clock.Now(), &lastRows, &lastTick)
+			return
+		case now := <-ticker.C():
+			sp.log("stream progress", now, &lastRows, &lastTick)
+		}
+	}
+}
+
+// log writes a single progress line. The rate is over the last
+// interval; the lag is the age of the latest ROWTIME seen, an estimate
+// of how far behind the stream's head the consumer is.
+func (sp *streamProgress) log(msg string, now time.Time, lastRows *int64, lastTick *time.Time) {
+	rows := atomic.LoadInt64(&sp.rows)
+	rate := 0.0
+	if elapsed := now.Sub(*lastTick).Seconds(); elapsed > 0 {
+		rate = float64(rows-*lastRows) / elapsed
+	}
+	*lastRows, *lastTick = rows, now
+
+	queryID, _ := sp.queryID.Load().(string)
+	keyvals := []interface{}{
+		"query_id", queryID,
+		"rows", rows,
+		"bytes", atomic.LoadInt64(&sp.bytes),
+		"rows_per_sec", rate,
+		"elapsed", now.Sub(sp.started),
+	}
+	if rowtime := atomic.LoadInt64(&sp.lastRowTime); rowtime > 0 {
+		keyvals = append(keyvals, "lag", now.Sub(fromEpochMillis(rowtime)))
+	}
+	sp.logger.Log(msg, keyvals...)
+}
+
+// stop ends the logging, with a final line.
+func (sp *streamProgress) stop() {
+	sp.stopOnce.Do(func() { close(sp.stopCh) })
+}
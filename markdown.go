@@ -0,0 +1,282 @@
+package ksqldb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// MarkdownSink writes rows as a Markdown table, for reports posted to
+// chat or pull requests. Numeric columns are right-aligned, and values
+// are formatted by type: NULL for nulls, nested values as inline JSON
+// code, BYTES as base64, and times by Times.
+type MarkdownSink struct {
+	// MaxRows, if positive, caps the rows of the table. The rows left out
+	// are counted in a line below it.
+	MaxRows int
+
+	// Times renders decoded TIMESTAMP, DATE and TIME values (see
+	// DecodeOptions.Temporal).
+	Times ksql.TimeFormatter
+
+	writer  *bufio.Writer
+	buf     bytes.Buffer
+	rows    int
+	omitted int
+}
+
+// NewMarkdownSink creates a MarkdownSink writing to w.
+func NewMarkdownSink(w io.Writer) *MarkdownSink {
+	return &MarkdownSink{writer: bufio.NewWriter(w)}
+}
+
+// WriteHeader implements RowSink.
+func (ms *MarkdownSink) WriteHeader(columns []Column) error {
+	names := make([]string, len(columns))
+	aligns := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = escapeMarkdown(col.Name)
+		aligns[i] = "---"
+		if numericType(col.Type) {
+			aligns[i] = "--:"
+		}
+	}
+	ms.buf.Reset()
+	writeMarkdownRow(&ms.buf, names)
+	writeMarkdownRow(&ms.buf, aligns)
+	return ms.write()
+}
+
+// WriteRow implements RowSink.
+func (ms *MarkdownSink) WriteRow(row Row) error {
+	if ms.MaxRows > 0 && ms.rows >= ms.MaxRows {
+		ms.omitted++
+		return nil
+	}
+	ms.rows++
+	cells := make([]string, len(row.Values))
+	for i, value := range row.Values {
+		if text, ok := ms.Times.Format(value, columnType(row, i)); ok {
+			cells[i] = text
+			continue
+		}
+		cell, err := formatMarkdownValue(value)
+		if err != nil {
+			return fmt.Errorf("writing markdown row: %w", err)
+		}
+		cells[i] = cell
+	}
+	ms.buf.Reset()
+	writeMarkdownRow(&ms.buf, cells)
+	return ms.write()
+}
+
+// Flush implements RowSink.
+func (ms *MarkdownSink) Flush() error {
+	if ms.omitted > 0 {
+		ms.buf.Reset()
+		fmt.Fprintf(&ms.buf, "\n_%d rows not shown._\n", ms.omitted)
+		ms.omitted = 0
+		if err := ms.write(); err != nil {
+			return err
+		}
+	}
+	if err := ms.writer.Flush(); err != nil {
+		return fmt.Errorf("flushing markdown: %w", err)
+	}
+	return nil
+}
+
+// write writes the buffered lines.
+func (ms *MarkdownSink) write() error {
+	if _, err := ms.writer.Write(ms.buf.Bytes()); err != nil {
+		return fmt.Errorf("writing markdown: %w", err)
+	}
+	return nil
+}
+
+// WriteMarkdownEntities renders the entities of a statement's response
+// (see Response.ReadAll) as Markdown: statuses as lines, listings such
+// as SHOW STREAMS and DESCRIBE as tables, and other entities as tables
+// of their members.
+func WriteMarkdownEntities(w io.Writer, entities []json.RawMessage) error {
+	var buf bytes.Buffer
+	for i, raw := range entities {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		if err := writeMarkdownEntity(&buf, raw); err != nil {
+			return fmt.Errorf("writing markdown entities: %w", err)
+		}
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("writing markdown entities: %w", err)
+	}
+	return nil
+}
+
+// writeMarkdownEntity renders a single entity.
+func writeMarkdownEntity(buf *bytes.Buffer, raw json.RawMessage) error {
+	var env entityEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		decErr := newDecodeError(raw, err)
+		decErr.Type = "entity"
+		return decErr
+	}
+	var err error
+	switch env.Type {
+	case "currentStatus":
+		var status CurrentStatus
+		if err = json.Unmarshal(raw, &status); err == nil {
+			fmt.Fprintf(buf, "%s: **%s** %s\n", markdownCode(status.StatementText),
+				status.CommandStatus.Status, escapeMarkdown(status.CommandStatus.Message))
+		}
+	case "streams", "tables":
+		var list struct {
+			Streams []SourceInfo `json:"streams"`
+			Tables  []SourceInfo `json:"tables"`
+		}
+		if err = json.Unmarshal(raw, &list); err == nil {
+			writeMarkdownRow(buf, []string{"Name", "Topic", "Key Format", "Value Format", "Windowed"})
+			writeMarkdownRow(buf, []string{"---", "---", "---", "---", "---"})
+			for _, source := range append(list.Streams, list.Tables...) {
+				writeMarkdownRow(buf, []string{escapeMarkdown(source.Name), escapeMarkdown(source.Topic),
+					source.KeyFormat, source.ValueFormat, fmt.Sprint(source.IsWindowed)})
+			}
+		}
+	case "queries":
+		var list struct {
+			Queries []RunningQuery `json:"queries"`
+		}
+		if err = json.Unmarshal(raw, &list); err == nil {
+			writeMarkdownRow(buf, []string{"ID", "State", "Sinks", "Query"})
+			writeMarkdownRow(buf, []string{"---", "---", "---", "---"})
+			for _, query := range list.Queries {
+				writeMarkdownRow(buf, []string{escapeMarkdown(string(query.ID)), query.State,
+					escapeMarkdown(strings.Join(query.Sinks, ", ")), markdownCode(query.QueryString)})
+			}
+		}
+	case "sourceDescription":
+		var desc struct {
+			Source SourceDescription `json:"sourceDescription"`
+		}
+		if err = json.Unmarshal(raw, &desc); err == nil {
+			fmt.Fprintf(buf, "**%s** %s (topic %s)\n\n", escapeMarkdown(desc.Source.Name),
+				desc.Source.Type, markdownCode(desc.Source.Topic))
+			writeMarkdownRow(buf, []string{"Field", "Type", "Kind"})
+			writeMarkdownRow(buf, []string{"---", "---", "---"})
+			for _, field := range desc.Source.Fields {
+				writeMarkdownRow(buf, []string{escapeMarkdown(field.Name),
+					escapeMarkdown(field.Schema.String()), field.Type})
+			}
+		}
+	default:
+		var members map[string]interface{}
+		if err = json.Unmarshal(raw, &members); err == nil {
+			err = writeMarkdownMembers(buf, members)
+		}
+	}
+	if err != nil {
+		decErr := newDecodeError(raw, err)
+		decErr.Type = env.Type + " entity"
+		return decErr
+	}
+	return nil
+}
+
+// writeMarkdownMembers renders an entity of no known type as a table of
+// its members, sorted by name.
+func writeMarkdownMembers(buf *bytes.Buffer, members map[string]interface{}) error {
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeMarkdownRow(buf, []string{"Member", "Value"})
+	writeMarkdownRow(buf, []string{"---", "---"})
+	for _, name := range names {
+		cell, err := formatMarkdownValue(members[name])
+		if err != nil {
+			return err
+		}
+		writeMarkdownRow(buf, []string{escapeMarkdown(name), cell})
+	}
+	return nil
+}
+
+// writeMarkdownRow appends a table row of already formatted cells.
+func writeMarkdownRow(buf *bytes.Buffer, cells []string) {
+	buf.WriteByte('|')
+	for _, cell := range cells {
+		buf.WriteByte(' ')
+		buf.WriteString(cell)
+		buf.WriteString(" |")
+	}
+	buf.WriteByte('\n')
+}
+
+// formatMarkdownValue renders a decoded value as a table cell.
+func formatMarkdownValue(value interface{}) (string, error) {
+	switch vv := value.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return escapeMarkdown(vv), nil
+	case bool, float64, json.Number, int, int32, int64:
+		return fmt.Sprint(vv), nil
+	case *big.Rat:
+		return ksql.DecimalString(vv), nil
+	case []byte:
+		return markdownCode(base64.StdEncoding.EncodeToString(vv)), nil
+	}
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, value); err != nil {
+		return "", err
+	}
+	return markdownCode(buf.String()), nil
+}
+
+// markdownCode renders text as an inline code span in a table cell.
+func markdownCode(text string) string {
+	if text == "" {
+		return ""
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	fence := "`"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		text = " " + text + " "
+	}
+	return fence + strings.ReplaceAll(text, "|", `\|`) + fence
+}
+
+// markdownEscaper escapes the characters that would end a table cell or
+// turn text into markup.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`",
+	"<", "&lt;", ">", "&gt;", "\r\n", "<br>", "\n", "<br>",
+)
+
+// escapeMarkdown renders text as a table cell.
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+// numericType reports whether values of a KSQL type are numbers.
+func numericType(typ string) bool {
+	switch baseType(typ) {
+	case "INT", "INTEGER", "BIGINT", "DOUBLE", "DECIMAL":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package ksqldb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"hews.co/ksqldb/pkg/ksqldbapi"
+)
+
+// ServerMetadata is the server's version and cluster, from the
+// /v1/metadata endpoint.
+type ServerMetadata struct {
+	Version   string          `json:"version"`
+	ClusterID ServerClusterID `json:"clusterId"`
+}
+
+// ServerClusterID identifies the cluster a server belongs to, from the
+// /v1/metadata/id endpoint.
+type ServerClusterID struct {
+	ID    string `json:"id"`
+	Scope struct {
+		Path     []string          `json:"path"`
+		Clusters map[string]string `json:"clusters"`
+	} `json:"scope"`
+}
+
+// KafkaClusterID returns the ID of the Kafka cluster the server uses.
+func (sc ServerClusterID) KafkaClusterID() string {
+	return sc.Scope.Clusters["kafka-cluster"]
+}
+
+// KsqlServiceID returns the ksql.service.id of the server.
+func (sc ServerClusterID) KsqlServiceID() string {
+	return sc.Scope.Clusters["ksql-cluster"]
+}
+
+// ServerMetadata fetches the server's version and cluster.
+func (cc *Client) ServerMetadata(ctx context.Context) (*ServerMetadata, error) {
+	var md ServerMetadata
+	if err := cc.getJSON(ctx, &ksqldbapi.EndpointMetadata, &md); err != nil {
+		return nil, fmt.Errorf("getting server metadata: %w", err)
+	}
+	return &md, nil
+}
+
+// ServerClusterID fetches the cluster the server belongs to.
+func (cc *Client) ServerClusterID(ctx context.Context) (*ServerClusterID, error) {
+	var id ServerClusterID
+	if err := cc.getJSON(ctx, &ksqldbapi.EndpointMetadataID, &id); err != nil {
+		return nil, fmt.Errorf("getting server cluster id: %w", err)
+	}
+	return &id, nil
+}
+
+// getJSON decodes the response of a GET endpoint into v.
+func (cc *Client) getJSON(ctx context.Context, endpoint *ksqldbapi.Endpoint, v interface{}) error {
+	rh, err := cc.do(ctx, newGetResource(endpoint))
+	if err != nil {
+		return err
+	}
+	defer rh.Close()
+
+	byt, err := rh.ReadAll()
+	if err != nil {
+		return err
+	}
+	if rh.StatusCode != http.StatusOK {
+		return rh.responseError(byt, nil)
+	}
+	if err := json.Unmarshal(byt, v); err != nil {
+		return rh.responseError(byt, fmt.Errorf("decoding response: %w", err))
+	}
+	return nil
+}
+
+// ClusterMismatchError is returned for every request of a client pinned
+// to a Kafka cluster (see ClientOptions.ExpectedClusterID) whose server
+// belongs to another.
+type ClusterMismatchError struct {
+	Expected string
+	Actual   string
+}
+
+// Error implements error.
+func (err *ClusterMismatchError) Error() string {
+	return fmt.Sprintf("server is on kafka cluster %q, not the expected %q", err.Actual, err.Expected)
+}
+
+// clusterPin checks, once, that the server is on the expected cluster.
+type clusterPin struct {
+	expected string
+
+	mu  sync.Mutex
+	err error // the mismatch, once checked
+	ok  bool
+}
+
+// check verifies the server's cluster, unless done already. Failures
+// to fetch the cluster are retried on the next check.
+func (cp *clusterPin) check(ctx context.Context, cc *Client) error {
+	if cp == nil {
+		return nil
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.ok || cp.err != nil {
+		return cp.err
+	}
+
+	actual := ""
+	id, err := cc.ServerClusterID(ctx)
+	switch {
+	case err == nil:
+		actual = id.KafkaClusterID()
+	default:
+		// Servers from before /v1/metadata tell their cluster in /info.
+		info, infoErr := cc.ServerInfo(ctx)
+		if infoErr != nil {
+			return fmt.Errorf("verifying server cluster: %w", err)
+		}
+		actual = info.KafkaClusterID
+	}
+	if actual != cp.expected {
+		cp.err = &ClusterMismatchError{Expected: cp.expected, Actual: actual}
+		cc.logger.Log("server cluster mismatch", "expected", cp.expected, "actual", actual)
+		return cp.err
+	}
+	cp.ok = true
+	return nil
+}
+
+// unpinnedPaths are the endpoints requested without checking the
+// cluster pin, as they serve to check it.
+var unpinnedPaths = map[string]bool{
+	ksqldbapi.EndpointMetadata.Path:     true,
+	ksqldbapi.EndpointMetadataID.Path:   true,
+	ksqldbapi.EndpointStatusServer.Path: true,
+}
@@ -0,0 +1,224 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// PersistentQueryOptions configures CreatePersistentQuery.
+type PersistentQueryOptions struct {
+	// Props are sent as the statement's streamsProperties.
+	Props map[string]string
+
+	// SchemaRegistry enables the AVRO compatibility pre-check: the
+	// statement is EXPLAINed first and its projected value schema is
+	// checked against the registry before anything is created. Only set
+	// it for statements that write AVRO.
+	SchemaRegistry *SchemaRegistry
+
+	// Subject overrides the registry subject checked against. It
+	// defaults to "<topic>-value", where the topic is the statement's
+	// KAFKA_TOPIC, or else the name of the sink.
+	Subject string
+}
+
+// CreatePersistentQuery runs a CREATE STREAM/TABLE AS SELECT (or other
+// persistent query) statement, optionally pre-checking the schema it
+// will register. A persistent query whose output schema is rejected by
+// the registry dies on its first record; failing here instead surfaces
+// a *SchemaCompatibilityError before the query is created.
+func (cc *Client) CreatePersistentQuery(ctx context.Context, ksql string, opts PersistentQueryOptions) (*CurrentStatus, error) {
+	if opts.SchemaRegistry != nil {
+		if err := cc.checkAvroCompatibility(ctx, ksql, opts); err != nil {
+			return nil, fmt.Errorf("creating persistent query: %w", err)
+		}
+	}
+
+	entities, err := cc.runStatement(ctx, ksql, opts.Props)
+	if err != nil {
+		return nil, fmt.Errorf("creating persistent query: %w", err)
+	}
+	var status CurrentStatus
+	if err := decodeEntity(entities, "currentStatus", "", &status); err != nil {
+		return nil, fmt.Errorf("creating persistent query: %w", err)
+	}
+	return &status, nil
+}
+
+// checkAvroCompatibility explains the statement, renders the value
+// schema ksqlDB would register and asks the registry about it.
+func (cc *Client) checkAvroCompatibility(ctx context.Context, statement string, opts PersistentQueryOptions) error {
+	qd, err := cc.Explain(ctx, statement)
+	if err != nil {
+		return fmt.Errorf("checking avro compatibility: %w", err)
+	}
+
+	subject := opts.Subject
+	if subject == "" {
+		wo, err := ksql.ParseWith(statement)
+		if err != nil {
+			return fmt.Errorf("checking avro compatibility: %w", err)
+		}
+		topic := wo.KafkaTopic
+		if topic == "" && len(qd.Sinks) > 0 {
+			topic = qd.Sinks[0]
+		}
+		if topic == "" {
+			return fmt.Errorf("checking avro compatibility: cannot determine sink topic, set a subject")
+		}
+		subject = topic + "-value"
+	}
+
+	schema, err := avroValueSchema(qd.Fields)
+	if err != nil {
+		return fmt.Errorf("checking avro compatibility: %w", err)
+	}
+	result, err := opts.SchemaRegistry.CheckCompatibility(ctx, subject, schema)
+	if err != nil {
+		return fmt.Errorf("checking avro compatibility: %w", err)
+	}
+	if !result.Compatible {
+		return &SchemaCompatibilityError{Subject: subject, Messages: result.Messages}
+	}
+	return nil
+}
+
+// SchemaMismatchError is returned when a query's projection does not
+// match the schema of the source it would write into.
+type SchemaMismatchError struct {
+	Target   string
+	Problems []string
+}
+
+// Error implements error.
+func (err *SchemaMismatchError) Error() string {
+	return fmt.Sprintf("projection does not match %s: %s", err.Target, strings.Join(err.Problems, "; "))
+}
+
+// PersistentQuery is a handle on a running persistent query.
+type PersistentQuery struct {
+	ID     string
+	client *Client
+}
+
+// createdQueryID extracts the query ID from the status message of older
+// servers, which do not report it separately.
+var createdQueryID = regexp.MustCompile(`query with ID (\S+)`)
+
+// createdQuery returns the ID of the query a statement created, or an
+// empty string.
+func createdQuery(status *CurrentStatus) string {
+	if status.CommandStatus.QueryID != "" {
+		return status.CommandStatus.QueryID
+	}
+	if match := createdQueryID.FindStringSubmatch(status.CommandStatus.Message); match != nil {
+		return strings.TrimRight(match[1], ".")
+	}
+	return ""
+}
+
+// InsertIntoSelect starts an INSERT INTO target SELECT ... persistent
+// query, writing the results of the given SELECT into an existing
+// stream. The projection is first validated against the target's
+// schema, column by column, so that a mismatch is reported as a
+// *SchemaMismatchError rather than a failed query.
+func (cc *Client) InsertIntoSelect(ctx context.Context, target, selectQuery string, opts PersistentQueryOptions) (*PersistentQuery, error) {
+	selectQuery = strings.TrimRight(strings.TrimSpace(selectQuery), ";")
+	if err := cc.checkProjection(ctx, target, selectQuery); err != nil {
+		return nil, fmt.Errorf("inserting into %s: %w", target, err)
+	}
+
+	status, err := cc.CreatePersistentQuery(ctx, fmt.Sprintf("INSERT INTO %s %s;", cc.ident(target), selectQuery), opts)
+	if err != nil {
+		return nil, fmt.Errorf("inserting into %s: %w", target, err)
+	}
+	id := createdQuery(status)
+	if id == "" {
+		return nil, fmt.Errorf("inserting into %s: no query id in status %q", target, status.CommandStatus.Message)
+	}
+	return &PersistentQuery{ID: id, client: cc}, nil
+}
+
+// checkProjection compares the columns of the query's projection with
+// those of the target.
+func (cc *Client) checkProjection(ctx context.Context, target, selectQuery string) error {
+	sd, err := cc.Describe(ctx, target)
+	if err != nil {
+		return err
+	}
+	qd, err := cc.Explain(ctx, selectQuery)
+	if err != nil {
+		return err
+	}
+
+	targetFields := make(map[string]FieldInfo, len(sd.Fields))
+	for _, field := range sd.Fields {
+		if field.Name != "ROWTIME" {
+			targetFields[field.Name] = field
+		}
+	}
+	var problems []string
+	for _, field := range qd.Fields {
+		if field.Name == "ROWTIME" {
+			continue
+		}
+		want, ok := targetFields[field.Name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("column %s not in target", field.Name))
+			continue
+		}
+		delete(targetFields, field.Name)
+		if got, exp := field.Schema.String(), want.Schema.String(); got != exp {
+			problems = append(problems, fmt.Sprintf("column %s is %s, target expects %s", field.Name, got, exp))
+		}
+	}
+	for name := range targetFields {
+		problems = append(problems, fmt.Sprintf("target column %s not projected", name))
+	}
+	if len(problems) > 0 {
+		return &SchemaMismatchError{Target: target, Problems: problems}
+	}
+	return nil
+}
+
+// State returns the query's current state, eg. RUNNING or ERROR.
+func (pq *PersistentQuery) State(ctx context.Context) (string, error) {
+	qd, err := pq.client.Explain(ctx, pq.ID)
+	if err != nil {
+		return "", fmt.Errorf("getting state of query %s: %w", pq.ID, err)
+	}
+	return qd.State, nil
+}
+
+// WaitForState watches the query, polling its state at the interval
+// (default one second), until it reaches the wanted state. It fails
+// early if the query enters the ERROR state instead.
+func (pq *PersistentQuery) WaitForState(ctx context.Context, state string, interval time.Duration) error {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := pq.client.clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		current, err := pq.State(ctx)
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(current, state) {
+			return nil
+		}
+		if strings.EqualFold(current, "ERROR") {
+			return fmt.Errorf("query %s entered ERROR state", pq.ID)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C():
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package ksql
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Incompatibility is a statement using syntax the target server version
+// does not accept.
+type Incompatibility struct {
+	Statement Statement
+	Feature   Feature
+	Since     Version
+}
+
+// String renders the incompatibility for reports, eg. in CI logs.
+func (ic Incompatibility) String() string {
+	return fmt.Sprintf("line %d: %s requires ksqlDB %s", ic.Statement.Line, ic.Feature, ic.Since)
+}
+
+// featurePatterns detect the use of features in masked statement text
+// (see Statement). Detection is syntactic, and only covers what can be
+// told without the schemas involved: foreign key joins, for one, are
+// not detected.
+var featurePatterns = []struct {
+	feature Feature
+	pattern *regexp.Regexp
+}{
+	{FeatureEmitChanges, regexp.MustCompile(`(?i)\bEMIT\s+CHANGES\b`)},
+	{FeaturePrimaryKey, regexp.MustCompile(`(?i)\bPRIMARY\s+KEY\b`)},
+	{FeatureKeyColumns, regexp.MustCompile(`(?i)(?:^|[^Y\s])\s+KEY\s*[,)]`)},
+	{FeatureCreateOrReplace, regexp.MustCompile(`(?i)\bCREATE\s+OR\s+REPLACE\b`)},
+	{FeatureWindowRetention, regexp.MustCompile(`(?i)\bWINDOW\s+\w+\s*\([^)]*\bRETENTION\b`)},
+	{FeatureWindowGrace, regexp.MustCompile(`(?i)\bWINDOW\s+\w+\s*\([^)]*\bGRACE\s+PERIOD\b`)},
+	{FeatureJoinGrace, regexp.MustCompile(`(?i)\bWITHIN\s+(?:\([^)]*\)|\d+\s+\w+)\s+GRACE\s+PERIOD\b`)},
+	{FeatureRightJoin, regexp.MustCompile(`(?i)\bRIGHT\s+(?:OUTER\s+)?JOIN\b`)},
+	{FeatureTimestampType, regexp.MustCompile(`(?i)\b(?:TIMESTAMP|DATE|TIME)\b\s*(?:[,)>]|$|\s+(?:KEY|PRIMARY|HEADERS?)\b)`)},
+	{FeatureBytesType, regexp.MustCompile(`(?i)\bBYTES\b`)},
+	{FeatureHeaders, regexp.MustCompile(`(?i)\bHEADERS\b|\bHEADER\s*\(`)},
+	{FeatureAssertStatements, regexp.MustCompile(`(?i)^\s*ASSERT\b`)},
+}
+
+// Features reports the version-dependent features a statement uses.
+func (st Statement) Features() []Feature {
+	masked := st.masked
+	if masked == "" {
+		masked = st.Text
+	}
+	var features []Feature
+	for _, fp := range featurePatterns {
+		if fp.pattern.MatchString(masked) {
+			features = append(features, fp.feature)
+		}
+	}
+	return features
+}
+
+// CheckScript reports the statements of a script using syntax the
+// given server version does not accept. It works offline, on the text
+// alone, so that scripts can be checked in CI without a cluster.
+func CheckScript(script string, version Version) []Incompatibility {
+	dialect := Dialect{Version: version}
+	var found []Incompatibility
+	for _, stmt := range SplitStatements(script) {
+		for _, ft := range stmt.Features() {
+			if !dialect.Supports(ft) {
+				found = append(found, Incompatibility{Statement: stmt, Feature: ft, Since: ft.Since()})
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,90 @@
+package ksql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CreateAs is the head of a CREATE STREAM/TABLE ... AS SELECT statement.
+type CreateAs struct {
+	Table       bool
+	OrReplace   bool
+	IfNotExists bool
+
+	// Name is the sink, as written (quoted identifiers keep their
+	// backticks).
+	Name string
+
+	// createEnd is the offset of the end of CREATE in the statement.
+	createEnd int
+}
+
+var (
+	// createAsHead matches the head of a CREATE ... AS SELECT, up to the
+	// sink's name.
+	createAsHead = regexp.MustCompile(`(?i)^(CREATE)\s+(OR\s+REPLACE\s+)?(STREAM|TABLE)\s+(IF\s+NOT\s+EXISTS\s+)?`)
+
+	// asSelect detects the query of a CREATE ... AS SELECT.
+	asSelect = regexp.MustCompile(`(?i)\bAS\s+SELECT\b`)
+
+	// bareName matches an unquoted identifier.
+	bareName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*`)
+)
+
+// ParseCreateAs parses the head of a CREATE STREAM/TABLE ... AS SELECT
+// statement.
+func ParseCreateAs(statement string) (CreateAs, error) {
+	// The head is matched on the statement itself, past any leading
+	// comments, as masking blanks out quoted names.
+	masked := maskTopLevel(statement)
+	start := len(masked) - len(strings.TrimLeft(masked, " \t\r\n"))
+	loc := createAsHead.FindStringSubmatchIndex(statement[start:])
+	if loc == nil || !asSelect.MatchString(masked) {
+		return CreateAs{}, fmt.Errorf("not a CREATE STREAM/TABLE ... AS SELECT statement")
+	}
+	for i := range loc {
+		if loc[i] >= 0 {
+			loc[i] += start
+		}
+	}
+	ca := CreateAs{
+		OrReplace:   loc[4] >= 0,
+		Table:       strings.EqualFold(statement[loc[6]:loc[7]], "TABLE"),
+		IfNotExists: loc[8] >= 0,
+		createEnd:   loc[3],
+	}
+	rest := statement[loc[1]:]
+	switch {
+	case strings.HasPrefix(rest, "`"):
+		end := 1
+		for {
+			i := strings.IndexByte(rest[end:], '`')
+			if i < 0 {
+				return CreateAs{}, fmt.Errorf("unterminated quoted identifier")
+			}
+			end += i + 1
+			if end < len(rest) && rest[end] == '`' {
+				end++
+				continue
+			}
+			break
+		}
+		ca.Name = rest[:end]
+	default:
+		ca.Name = bareName.FindString(rest)
+	}
+	if ca.Name == "" {
+		return CreateAs{}, fmt.Errorf("no sink name")
+	}
+	return ca, nil
+}
+
+// WithOrReplace returns the statement as a CREATE OR REPLACE, which it
+// must be the head of.
+func (ca CreateAs) WithOrReplace(statement string) string {
+	if ca.OrReplace {
+		return statement
+	}
+	return statement[:ca.createEnd] + " OR REPLACE" + statement[ca.createEnd:]
+}
@@ -0,0 +1,307 @@
+package ksql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ColumnRole is what a column of a CREATE STREAM/TABLE statement holds,
+// beyond its value.
+type ColumnRole int
+
+const (
+	// ValueColumn is an ordinary column, read from the record value.
+	ValueColumn ColumnRole = iota
+
+	// KeyColumn is read from the record key: KEY on streams, PRIMARY KEY
+	// on tables.
+	KeyColumn
+
+	// HeadersColumn holds all of the record's headers, as
+	// ARRAY<STRUCT<KEY STRING, VALUE BYTES>>.
+	HeadersColumn
+
+	// HeaderColumn holds the value of a single header, named by the
+	// column's HeaderKey, as BYTES.
+	HeaderColumn
+)
+
+// HeadersType is the type of a HEADERS column.
+const HeadersType = "ARRAY<STRUCT<`KEY` STRING, `VALUE` BYTES>>"
+
+// Column is a column definition of a CREATE STREAM/TABLE statement.
+// Type is rendered verbatim; header columns default to their only valid
+// type when it is left empty.
+type Column struct {
+	Name      string
+	Type      string
+	Role      ColumnRole
+	HeaderKey string
+}
+
+// CreateSource builds a CREATE STREAM or CREATE TABLE statement.
+type CreateSource struct {
+	// Table creates a table rather than a stream.
+	Table bool
+
+	OrReplace   bool
+	IfNotExists bool
+	Name        string
+	Columns     []Column
+
+	// Options are the WITH properties, eg. KAFKA_TOPIC, rendered as
+	// literals and in name order.
+	Options WithOptions
+
+	// With holds further WITH properties, by name, for those Options
+	// lack a field for. A property cannot be set in both.
+	With map[string]interface{}
+
+	// Policy is the case policy identifiers are rendered under.
+	Policy CasePolicy
+
+	// Dialect is the server version the statement is built for.
+	Dialect Dialect
+}
+
+// Build validates the definition and renders the statement.
+func (cs CreateSource) Build() (string, error) {
+	kind := "STREAM"
+	if cs.Table {
+		kind = "TABLE"
+	}
+	if cs.Name == "" {
+		return "", fmt.Errorf("building CREATE %s: no name", kind)
+	}
+	if cs.OrReplace {
+		if err := cs.Dialect.Check(FeatureCreateOrReplace); err != nil {
+			return "", fmt.Errorf("building CREATE %s %s: %w", kind, cs.Name, err)
+		}
+	}
+
+	var (
+		defs    []string
+		headers bool
+		header  bool
+	)
+	for _, col := range cs.Columns {
+		def, err := cs.column(col)
+		if err != nil {
+			return "", fmt.Errorf("building CREATE %s %s: column %s: %w", kind, cs.Name, col.Name, err)
+		}
+		switch col.Role {
+		case HeadersColumn:
+			if headers {
+				return "", fmt.Errorf("building CREATE %s %s: more than one HEADERS column", kind, cs.Name)
+			}
+			headers = true
+		case HeaderColumn:
+			header = true
+		}
+		defs = append(defs, def)
+	}
+	if headers && header {
+		return "", fmt.Errorf("building CREATE %s %s: a HEADERS column cannot be combined with HEADER('key') columns", kind, cs.Name)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("CREATE ")
+	if cs.OrReplace {
+		sb.WriteString("OR REPLACE ")
+	}
+	sb.WriteString(kind)
+	if cs.IfNotExists {
+		sb.WriteString(" IF NOT EXISTS")
+	}
+	sb.WriteString(" " + cs.Policy.Ident(cs.Name))
+	if len(defs) > 0 {
+		sb.WriteString(" (" + strings.Join(defs, ", ") + ")")
+	}
+	props := cs.Options.Props()
+	for name, value := range cs.With {
+		if _, ok := props[strings.ToUpper(name)]; ok {
+			return "", fmt.Errorf("building CREATE %s %s: property %s set twice", kind, cs.Name, strings.ToUpper(name))
+		}
+		props[strings.ToUpper(name)] = value
+	}
+	if err := cs.checkKey(props); err != nil {
+		return "", fmt.Errorf("building CREATE %s %s: %w", kind, cs.Name, err)
+	}
+	if err := cs.checkTimestamp(props); err != nil {
+		return "", fmt.Errorf("building CREATE %s %s: %w", kind, cs.Name, err)
+	}
+	if len(props) > 0 {
+		with, err := withClause(props)
+		if err != nil {
+			return "", fmt.Errorf("building CREATE %s %s: %w", kind, cs.Name, err)
+		}
+		sb.WriteString(" " + with)
+	}
+	sb.WriteString(";")
+	return sb.String(), nil
+}
+
+// column renders a column definition.
+func (cs CreateSource) column(col Column) (string, error) {
+	typ := strings.TrimSpace(col.Type)
+	name := cs.Policy.Ident(col.Name)
+	if err := cs.Dialect.checkType(typ); err != nil {
+		return "", err
+	}
+	switch col.Role {
+	case ValueColumn:
+		if typ == "" {
+			return "", fmt.Errorf("no type")
+		}
+		return name + " " + typ, nil
+	case KeyColumn:
+		if typ == "" {
+			return "", fmt.Errorf("no type")
+		}
+		if err := cs.Dialect.Check(FeatureKeyColumns); err != nil {
+			return "", err
+		}
+		if cs.Table {
+			return name + " " + typ + " PRIMARY KEY", nil
+		}
+		return name + " " + typ + " KEY", nil
+	case HeadersColumn:
+		if err := cs.Dialect.Check(FeatureHeaders); err != nil {
+			return "", err
+		}
+		if typ == "" {
+			typ = HeadersType
+		} else if normalizeType(typ) != normalizeType(HeadersType) {
+			return "", fmt.Errorf("HEADERS column must be %s, not %s", HeadersType, typ)
+		}
+		return name + " " + typ + " HEADERS", nil
+	case HeaderColumn:
+		if err := cs.Dialect.Check(FeatureHeaders); err != nil {
+			return "", err
+		}
+		if col.HeaderKey == "" {
+			return "", fmt.Errorf("HEADER column without a header key")
+		}
+		if typ == "" {
+			typ = "BYTES"
+		} else if normalizeType(typ) != "BYTES" {
+			return "", fmt.Errorf("HEADER column must be BYTES, not %s", typ)
+		}
+		return name + " " + typ + " HEADER(" + String(col.HeaderKey) + ")", nil
+	}
+	return "", fmt.Errorf("unknown column role %d", col.Role)
+}
+
+// checkKey checks the key columns against the key format, when the
+// statement sets one, and the dialect.
+func (cs CreateSource) checkKey(props map[string]interface{}) error {
+	var types []string
+	for _, col := range cs.Columns {
+		if col.Role == KeyColumn {
+			types = append(types, col.Type)
+		}
+	}
+	if len(types) > 1 {
+		if err := cs.Dialect.Check(FeatureMultiColumnKeys); err != nil {
+			return err
+		}
+	}
+	format, ok := props["KEY_FORMAT"]
+	if ok {
+		if err := cs.Dialect.Check(FeatureKeyFormat); err != nil {
+			return err
+		}
+	} else if format, ok = props["FORMAT"]; !ok {
+		// The server's default key format applies, which may be any.
+		return nil
+	}
+	name, isString := format.(string)
+	if !isString {
+		return fmt.Errorf("key format must be a string, got %v", format)
+	}
+	return CheckKeyFormat(name, types)
+}
+
+// checkTimestamp validates the TIMESTAMP and TIMESTAMP_FORMAT properties
+// against the columns: the timestamp column must exist, and be a STRING
+// parsed with a valid format, or else a BIGINT or TIMESTAMP.
+func (cs CreateSource) checkTimestamp(props map[string]interface{}) error {
+	column, _ := props["TIMESTAMP"].(string)
+	format, hasFormat := props["TIMESTAMP_FORMAT"]
+	if hasFormat {
+		pattern, ok := format.(string)
+		if !ok {
+			return fmt.Errorf("TIMESTAMP_FORMAT must be a string, got %v", format)
+		}
+		if column == "" {
+			return fmt.Errorf("TIMESTAMP_FORMAT without a TIMESTAMP column")
+		}
+		if _, err := ParseTimestampFormat(pattern); err != nil {
+			return err
+		}
+	}
+	if column == "" || len(cs.Columns) == 0 {
+		return nil
+	}
+	for _, col := range cs.Columns {
+		if !cs.Policy.Match(column, cs.Policy.Canonical(col.Name)) {
+			continue
+		}
+		if col.Role == HeadersColumn || col.Role == HeaderColumn {
+			return fmt.Errorf("TIMESTAMP column %s is a header column", col.Name)
+		}
+		switch typ := normalizeType(col.Type); {
+		case hasFormat && typ != "STRING" && typ != "VARCHAR":
+			return fmt.Errorf("TIMESTAMP column %s with a TIMESTAMP_FORMAT must be a STRING, not %s", col.Name, col.Type)
+		case !hasFormat && typ != "BIGINT" && typ != "TIMESTAMP":
+			return fmt.Errorf("TIMESTAMP column %s must be a BIGINT or TIMESTAMP, or a STRING with a TIMESTAMP_FORMAT, not %s", col.Name, col.Type)
+		}
+		return nil
+	}
+	return fmt.Errorf("TIMESTAMP column %s is not defined", column)
+}
+
+// withClause renders a WITH clause from its properties.
+func withClause(props map[string]interface{}) (string, error) {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		lit, err := Literal(props[name])
+		if err != nil {
+			return "", fmt.Errorf("property %s: %w", name, err)
+		}
+		parts = append(parts, strings.ToUpper(name)+"="+lit)
+	}
+	return "WITH (" + strings.Join(parts, ", ") + ")", nil
+}
+
+// checkType checks that the types used in a column type are supported.
+func (dd Dialect) checkType(typ string) error {
+	words := strings.FieldsFunc(strings.ToUpper(typ), func(c rune) bool {
+		return !(c >= 'A' && c <= 'Z' || c == '_')
+	})
+	for _, word := range words {
+		switch word {
+		case "TIMESTAMP", "DATE", "TIME":
+			if err := dd.Check(FeatureTimestampType); err != nil {
+				return err
+			}
+		case "BYTES":
+			if err := dd.Check(FeatureBytesType); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeType upper-cases a type and strips its quoting and spacing,
+// for comparison.
+func normalizeType(typ string) string {
+	return strings.NewReplacer("`", "", " ", "").Replace(strings.ToUpper(typ))
+}
@@ -0,0 +1,186 @@
+package ksql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a ksqlDB server version.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// String renders the version as MAJOR.MINOR.PATCH.
+func (vv Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", vv.Major, vv.Minor, vv.Patch)
+}
+
+// Less reports whether the version is older than another.
+func (vv Version) Less(other Version) bool {
+	if vv.Major != other.Major {
+		return vv.Major < other.Major
+	}
+	if vv.Minor != other.Minor {
+		return vv.Minor < other.Minor
+	}
+	return vv.Patch < other.Patch
+}
+
+// IsZero reports whether the version is unset.
+func (vv Version) IsZero() bool {
+	return vv == Version{}
+}
+
+// platformVersions maps Confluent Platform releases, which report their
+// own version, onto the ksqlDB release they ship.
+var platformVersions = map[[2]int]Version{
+	{5, 4}: {0, 6, 0},
+	{5, 5}: {0, 8, 0},
+	{6, 0}: {0, 10, 0},
+	{6, 1}: {0, 15, 0},
+	{6, 2}: {0, 17, 0},
+	{7, 0}: {0, 21, 0},
+	{7, 1}: {0, 23, 0},
+	{7, 2}: {0, 26, 0},
+	{7, 3}: {0, 28, 0},
+	{7, 4}: {0, 29, 0},
+}
+
+// ParseVersion parses a version as reported by the server's /info
+// endpoint, eg. "0.29.0" or "7.3.1-ce". Confluent Platform versions are
+// translated to the ksqlDB version they ship.
+func ParseVersion(raw string) (Version, error) {
+	trimmed := strings.TrimPrefix(strings.TrimSpace(raw), "v")
+	if idx := strings.IndexAny(trimmed, "-+"); idx >= 0 {
+		trimmed = trimmed[:idx]
+	}
+	parts := strings.Split(trimmed, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Version{}, fmt.Errorf("invalid version %q", raw)
+	}
+	nums := make([]int, 3)
+	for i, part := range parts {
+		num, err := strconv.Atoi(part)
+		if err != nil || num < 0 {
+			return Version{}, fmt.Errorf("invalid version %q", raw)
+		}
+		nums[i] = num
+	}
+	vv := Version{Major: nums[0], Minor: nums[1], Patch: nums[2]}
+	if vv.Major >= 5 {
+		platform, ok := platformVersions[[2]int{vv.Major, vv.Minor}]
+		if !ok {
+			// Unknown releases ship at least the ksqlDB of the latest
+			// known release before them. Releases from before 5.4 ran
+			// KSQL, which is treated as 0.5.
+			platform = Version{0, 5, 0}
+			for key, ksqlVersion := range platformVersions {
+				if key[0] < vv.Major || (key[0] == vv.Major && key[1] < vv.Minor) {
+					if platform.Less(ksqlVersion) {
+						platform = ksqlVersion
+					}
+				}
+			}
+		}
+		vv = platform
+	}
+	return vv, nil
+}
+
+// Feature is a piece of syntax not accepted by every server version.
+type Feature string
+
+// Features checked by the builders, see Dialect.
+const (
+	FeatureEmitChanges      Feature = "EMIT CHANGES"
+	FeatureKeyColumns       Feature = "named KEY columns"
+	FeaturePrimaryKey       Feature = "PRIMARY KEY"
+	FeatureCreateOrReplace  Feature = "CREATE OR REPLACE"
+	FeatureWindowRetention  Feature = "window RETENTION"
+	FeatureWindowGrace      Feature = "window GRACE PERIOD"
+	FeatureJoinGrace        Feature = "join GRACE PERIOD"
+	FeatureRightJoin        Feature = "RIGHT JOIN"
+	FeatureForeignKeyJoin   Feature = "foreign key table-table joins"
+	FeatureTimestampType    Feature = "TIMESTAMP type"
+	FeatureBytesType        Feature = "BYTES type"
+	FeatureHeaders          Feature = "HEADERS columns"
+	FeatureAssertStatements Feature = "ASSERT statements"
+	FeatureKeyFormat        Feature = "KEY_FORMAT"
+	FeatureMultiColumnKeys  Feature = "multi-column keys"
+	FeatureVariables        Feature = "variable substitution"
+)
+
+// featureVersions are the first ksqlDB versions accepting each feature.
+var featureVersions = map[Feature]Version{
+	FeatureEmitChanges:      {0, 6, 0},
+	FeatureKeyColumns:       {0, 10, 0},
+	FeaturePrimaryKey:       {0, 10, 0},
+	FeatureCreateOrReplace:  {0, 12, 0},
+	FeatureWindowRetention:  {0, 6, 0},
+	FeatureWindowGrace:      {0, 6, 0},
+	FeatureForeignKeyJoin:   {0, 19, 0},
+	FeatureTimestampType:    {0, 17, 0},
+	FeatureBytesType:        {0, 21, 0},
+	FeatureRightJoin:        {0, 24, 0},
+	FeatureHeaders:          {0, 24, 0},
+	FeatureJoinGrace:        {0, 28, 0},
+	FeatureAssertStatements: {0, 27, 0},
+	FeatureKeyFormat:        {0, 15, 0},
+	FeatureMultiColumnKeys:  {0, 15, 0},
+	FeatureVariables:        {0, 18, 0},
+}
+
+// Since returns the first version accepting a feature.
+func (ft Feature) Since() Version {
+	return featureVersions[ft]
+}
+
+// UnsupportedError is returned by builders for syntax the target server
+// version does not accept.
+type UnsupportedError struct {
+	Feature Feature
+	Version Version
+}
+
+// Error implements error.
+func (err *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s requires ksqlDB %s, server is %s", err.Feature, err.Feature.Since(), err.Version)
+}
+
+// Dialect adapts the builders to a server version. The zero Dialect,
+// with no version, targets the latest server and accepts everything.
+type Dialect struct {
+	Version Version
+}
+
+// Supports reports whether the target version accepts a feature.
+func (dd Dialect) Supports(ft Feature) bool {
+	if dd.Version.IsZero() {
+		return true
+	}
+	return !dd.Version.Less(ft.Since())
+}
+
+// Check returns an *UnsupportedError for the first feature the target
+// version does not accept.
+func (dd Dialect) Check(features ...Feature) error {
+	for _, ft := range features {
+		if !dd.Supports(ft) {
+			return &UnsupportedError{Feature: ft, Version: dd.Version}
+		}
+	}
+	return nil
+}
+
+// EmitChanges returns the clause ending a push query: EMIT CHANGES, or
+// nothing on servers from before it was introduced, where every
+// non-pull query was a push query.
+func (dd Dialect) EmitChanges() string {
+	if dd.Supports(FeatureEmitChanges) {
+		return " EMIT CHANGES"
+	}
+	return ""
+}
@@ -0,0 +1,5 @@
+// Package ksql builds KSQL statements and expressions: pieces of SQL
+// that are easy to get subtly wrong by hand, such as time predicates,
+// identifiers and literals. It renders strings only, and knows nothing
+// about the client or the server.
+package ksql
@@ -0,0 +1,380 @@
+package ksql
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+// Getter looks up the value of a row's column by name.
+type Getter func(column string) (interface{}, bool)
+
+// Predicate is a row filter that can be rendered into a WHERE clause,
+// pushing the filtering down to the server, or else evaluated on the
+// client against decoded rows. Build one from Field, And, Or and Not:
+//
+//	ksql.And(
+//		ksql.Field("region").Eq("EU"),
+//		ksql.Field("amount").Ge(100),
+//	)
+//
+// As in a WHERE clause, comparisons with NULL are never true.
+type Predicate interface {
+	// SQL renders the predicate as a KSQL boolean expression, or
+	// reports false if it cannot be rendered and must be evaluated on
+	// the client.
+	SQL(policy CasePolicy) (string, bool)
+
+	// Match evaluates the predicate against a row.
+	Match(get Getter) (bool, error)
+}
+
+// MatchFunc is a Predicate evaluated only on the client, for conditions
+// KSQL cannot express.
+type MatchFunc func(get Getter) (bool, error)
+
+// SQL implements Predicate: a MatchFunc is never rendered.
+func (fn MatchFunc) SQL(CasePolicy) (string, bool) { return "", false }
+
+// Match implements Predicate.
+func (fn MatchFunc) Match(get Getter) (bool, error) { return fn(get) }
+
+// FieldRef is a column to build comparisons on.
+type FieldRef string
+
+// Field refers to a column by name, matched under the case policy.
+func Field(name string) FieldRef {
+	return FieldRef(name)
+}
+
+// Eq is true where the column equals the value.
+func (fr FieldRef) Eq(value interface{}) Predicate { return comparison{fr, "=", value} }
+
+// Ne is true where the column differs from the value.
+func (fr FieldRef) Ne(value interface{}) Predicate { return comparison{fr, "!=", value} }
+
+// Lt is true where the column is less than the value.
+func (fr FieldRef) Lt(value interface{}) Predicate { return comparison{fr, "<", value} }
+
+// Le is true where the column is at most the value.
+func (fr FieldRef) Le(value interface{}) Predicate { return comparison{fr, "<=", value} }
+
+// Gt is true where the column is greater than the value.
+func (fr FieldRef) Gt(value interface{}) Predicate { return comparison{fr, ">", value} }
+
+// Ge is true where the column is at least the value.
+func (fr FieldRef) Ge(value interface{}) Predicate { return comparison{fr, ">=", value} }
+
+// Between is true where the column is within [lo, hi].
+func (fr FieldRef) Between(lo, hi interface{}) Predicate {
+	return And(fr.Ge(lo), fr.Le(hi))
+}
+
+// In is true where the column equals one of the values.
+func (fr FieldRef) In(values ...interface{}) Predicate { return in{fr, values} }
+
+// IsNull is true where the column is NULL.
+func (fr FieldRef) IsNull() Predicate { return null{fr, true} }
+
+// IsNotNull is true where the column is not NULL.
+func (fr FieldRef) IsNotNull() Predicate { return null{fr, false} }
+
+// value looks up the column.
+func (fr FieldRef) value(get Getter) (interface{}, error) {
+	value, ok := get(string(fr))
+	if !ok {
+		return nil, fmt.Errorf("no column %s", fr)
+	}
+	return value, nil
+}
+
+// comparison compares a column to a value.
+type comparison struct {
+	field FieldRef
+	op    string
+	value interface{}
+}
+
+func (cm comparison) SQL(policy CasePolicy) (string, bool) {
+	lit, err := Literal(cm.value)
+	if err != nil || cm.value == nil {
+		return "", false
+	}
+	return policy.Ident(string(cm.field)) + " " + cm.op + " " + lit, true
+}
+
+func (cm comparison) Match(get Getter) (bool, error) {
+	value, err := cm.field.value(get)
+	if err != nil {
+		return false, err
+	}
+	if value == nil || cm.value == nil {
+		return false, nil
+	}
+	cmp, err := compare(value, cm.value)
+	if err != nil {
+		return false, fmt.Errorf("comparing %s: %w", cm.field, err)
+	}
+	switch cm.op {
+	case "=":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	}
+	return cmp >= 0, nil
+}
+
+// in matches a column against a list of values.
+type in struct {
+	field  FieldRef
+	values []interface{}
+}
+
+func (ii in) SQL(policy CasePolicy) (string, bool) {
+	if len(ii.values) == 0 {
+		return "", false
+	}
+	lits := make([]string, len(ii.values))
+	for i, value := range ii.values {
+		lit, err := Literal(value)
+		if err != nil {
+			return "", false
+		}
+		lits[i] = lit
+	}
+	return policy.Ident(string(ii.field)) + " IN (" + strings.Join(lits, ", ") + ")", true
+}
+
+func (ii in) Match(get Getter) (bool, error) {
+	for _, value := range ii.values {
+		ok, err := comparison{ii.field, "=", value}.Match(get)
+		if ok || err != nil {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// null checks a column for NULL.
+type null struct {
+	field FieldRef
+	is    bool
+}
+
+func (nn null) SQL(policy CasePolicy) (string, bool) {
+	if nn.is {
+		return policy.Ident(string(nn.field)) + " IS NULL", true
+	}
+	return policy.Ident(string(nn.field)) + " IS NOT NULL", true
+}
+
+func (nn null) Match(get Getter) (bool, error) {
+	value, err := nn.field.value(get)
+	if err != nil {
+		return false, err
+	}
+	return (value == nil) == nn.is, nil
+}
+
+// and is a conjunction.
+type and []Predicate
+
+// And is true where all the predicates are.
+func And(preds ...Predicate) Predicate { return and(preds) }
+
+func (aa and) SQL(policy CasePolicy) (string, bool) { return joinPredicates(aa, " AND ", policy) }
+
+func (aa and) Match(get Getter) (bool, error) {
+	for _, pred := range aa {
+		if ok, err := pred.Match(get); !ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// or is a disjunction.
+type or []Predicate
+
+// Or is true where any of the predicates is.
+func Or(preds ...Predicate) Predicate { return or(preds) }
+
+func (oo or) SQL(policy CasePolicy) (string, bool) {
+	if len(oo) == 0 {
+		return "FALSE", true
+	}
+	return joinPredicates(oo, " OR ", policy)
+}
+
+func (oo or) Match(get Getter) (bool, error) {
+	for _, pred := range oo {
+		if ok, err := pred.Match(get); ok || err != nil {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// not is a negation.
+type not struct {
+	pred Predicate
+}
+
+// Not is true where the predicate is not. Unlike in KSQL, a negated
+// comparison with NULL evaluated on the client is true.
+func Not(pred Predicate) Predicate { return not{pred} }
+
+func (nn not) SQL(policy CasePolicy) (string, bool) {
+	sql, ok := nn.pred.SQL(policy)
+	if !ok {
+		return "", false
+	}
+	return "NOT (" + sql + ")", true
+}
+
+func (nn not) Match(get Getter) (bool, error) {
+	ok, err := nn.pred.Match(get)
+	return !ok && err == nil, err
+}
+
+// joinPredicates renders predicates joined by an operator, parenthesizing
+// compound ones.
+func joinPredicates(preds []Predicate, op string, policy CasePolicy) (string, bool) {
+	if len(preds) == 0 {
+		return "TRUE", true
+	}
+	parts := make([]string, len(preds))
+	for i, pred := range preds {
+		sql, ok := pred.SQL(policy)
+		if !ok {
+			return "", false
+		}
+		if len(preds) > 1 {
+			switch pred.(type) {
+			case comparison, in, null:
+			default:
+				sql = "(" + sql + ")"
+			}
+		}
+		parts[i] = sql
+	}
+	return strings.Join(parts, op), true
+}
+
+// Pushdown splits a predicate into a WHERE clause for the server and a
+// remainder, nil if there is none, to evaluate on the client. Of a
+// conjunction, the parts that can be rendered are pushed down even if
+// others cannot.
+func Pushdown(pred Predicate, policy CasePolicy) (where string, rest Predicate) {
+	if pred == nil {
+		return "", nil
+	}
+	if sql, ok := pred.SQL(policy); ok {
+		return sql, nil
+	}
+	conj, ok := pred.(and)
+	if !ok {
+		return "", pred
+	}
+	var pushed, kept []Predicate
+	for _, part := range conj {
+		if sub, subRest := Pushdown(part, policy); subRest == nil {
+			pushed = append(pushed, part)
+		} else if sub != "" {
+			pushed = append(pushed, rendered(sub))
+			kept = append(kept, subRest)
+		} else {
+			kept = append(kept, part)
+		}
+	}
+	if len(pushed) > 0 {
+		where, _ = joinPredicates(pushed, " AND ", policy)
+	}
+	switch len(kept) {
+	case 0:
+		return where, nil
+	case 1:
+		return where, kept[0]
+	}
+	return where, And(kept...)
+}
+
+// rendered is an already rendered predicate, used by Pushdown.
+type rendered string
+
+func (rr rendered) SQL(CasePolicy) (string, bool) { return string(rr), true }
+
+func (rr rendered) Match(Getter) (bool, error) {
+	return false, fmt.Errorf("cannot evaluate %s on the client", string(rr))
+}
+
+// compare orders two values: numbers numerically, strings and booleans
+// by value.
+func compare(a, b interface{}) (int, error) {
+	if an, ok := number(a); ok {
+		bn, ok := number(b)
+		if !ok {
+			return 0, fmt.Errorf("cannot compare %T to %T", a, b)
+		}
+		switch {
+		case an < bn:
+			return -1, nil
+		case an > bn:
+			return 1, nil
+		}
+		return 0, nil
+	}
+	switch av := a.(type) {
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			return 0, fmt.Errorf("cannot compare %T to %T", a, b)
+		}
+		return strings.Compare(av, bv), nil
+	case bool:
+		bv, ok := b.(bool)
+		if !ok {
+			return 0, fmt.Errorf("cannot compare %T to %T", a, b)
+		}
+		if av == bv {
+			return 0, nil
+		} else if !av {
+			return -1, nil
+		}
+		return 1, nil
+	}
+	if reflect.DeepEqual(a, b) {
+		return 0, nil
+	}
+	return 0, fmt.Errorf("cannot compare %T to %T", a, b)
+}
+
+// number converts any numeric value to a float64.
+func number(value interface{}) (float64, bool) {
+	switch nn := value.(type) {
+	case json.Number:
+		f, err := nn.Float64()
+		return f, err == nil
+	case *big.Rat:
+		f, _ := nn.Float64()
+		return f, true
+	}
+	vv := reflect.ValueOf(value)
+	switch vv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(vv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(vv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return vv.Float(), true
+	}
+	return 0, false
+}
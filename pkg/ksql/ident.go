@@ -0,0 +1,113 @@
+package ksql
+
+import "strings"
+
+// CasePolicy decides how identifiers are rendered into KSQL and how
+// names are matched against the identifiers the server reports.
+//
+// ksqlDB upper-cases unquoted identifiers, so "accountId" in a statement
+// becomes the column ACCOUNTID, while "`accountId`" keeps its case. The
+// builders, the row scanner and the struct mapper all need to agree on
+// which of those was meant.
+type CasePolicy int
+
+const (
+	// UpperCase leaves identifiers unquoted where possible, letting the
+	// server upper-case them, and matches names case-insensitively. This
+	// is ksqlDB's own default behavior.
+	UpperCase CasePolicy = iota
+
+	// PreserveCase always quotes identifiers, so that their case is kept
+	// as given, and matches names exactly.
+	PreserveCase
+)
+
+// reservedWords are the KSQL keywords most likely to collide with
+// identifiers, which must be quoted to be used as names.
+var reservedWords = map[string]bool{
+	"ALL": true, "AND": true, "AS": true, "BETWEEN": true, "BY": true,
+	"CASE": true, "CREATE": true, "DROP": true, "ELSE": true, "EMIT": true,
+	"END": true, "FALSE": true, "FROM": true, "GROUP": true, "HAVING": true,
+	"IN": true, "INSERT": true, "INTO": true, "IS": true, "JOIN": true,
+	"KEY": true, "LIMIT": true, "NOT": true, "NULL": true, "ON": true,
+	"OR": true, "PARTITION": true, "SELECT": true, "STREAM": true,
+	"TABLE": true, "THEN": true, "TRUE": true, "VALUES": true, "WHEN": true,
+	"WHERE": true, "WINDOW": true, "WITH": true, "WITHIN": true,
+}
+
+// Ident renders a name as an identifier under the policy. Names that are
+// already backtick-quoted are returned unchanged.
+func (cp CasePolicy) Ident(name string) string {
+	if IsQuoted(name) {
+		return name
+	}
+	if cp == PreserveCase {
+		return Quote(name)
+	}
+	if reservedWords[strings.ToUpper(name)] {
+		return Quote(strings.ToUpper(name))
+	}
+	if !isBareIdent(name) {
+		return Quote(name)
+	}
+	return name
+}
+
+// Canonical returns the name as the server will report it once rendered
+// with Ident.
+func (cp CasePolicy) Canonical(name string) string {
+	if IsQuoted(name) {
+		return Unquote(name)
+	}
+	if cp == PreserveCase || (!isBareIdent(name) && !reservedWords[strings.ToUpper(name)]) {
+		return name
+	}
+	return strings.ToUpper(name)
+}
+
+// Match reports whether a name given by the caller refers to an
+// identifier reported by the server.
+func (cp CasePolicy) Match(name, ident string) bool {
+	if IsQuoted(name) {
+		return Unquote(name) == ident
+	}
+	if cp == PreserveCase {
+		return name == ident
+	}
+	return strings.EqualFold(name, ident)
+}
+
+// Quote backtick-quotes an identifier, escaping any backticks in it.
+func Quote(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// IsQuoted reports whether the identifier is backtick-quoted.
+func IsQuoted(name string) bool {
+	return len(name) >= 2 && name[0] == '`' && name[len(name)-1] == '`'
+}
+
+// Unquote removes backtick quoting from an identifier, if any.
+func Unquote(name string) string {
+	if !IsQuoted(name) {
+		return name
+	}
+	return strings.ReplaceAll(name[1:len(name)-1], "``", "`")
+}
+
+// isBareIdent reports whether the name can be used unquoted: a letter or
+// underscore followed by letters, digits or underscores.
+func isBareIdent(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,197 @@
+package ksql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JoinType is the kind of a join.
+type JoinType string
+
+// Join types.
+const (
+	InnerJoin JoinType = "INNER JOIN"
+	LeftJoin  JoinType = "LEFT JOIN"
+	RightJoin JoinType = "RIGHT JOIN"
+	FullJoin  JoinType = "FULL OUTER JOIN"
+)
+
+// JoinSource is a stream or table taking part in a join.
+type JoinSource struct {
+	Name  string
+	Alias string
+}
+
+// Ref returns the name the source's columns are qualified with: its
+// alias, or else its name.
+func (js JoinSource) Ref() string {
+	if js.Alias != "" {
+		return js.Alias
+	}
+	return js.Name
+}
+
+// Join joins a source into a JoinQuery.
+type Join struct {
+	Type   JoinType
+	Source JoinSource
+
+	// LeftKey and RightKey are the columns joined on. LeftKey may be
+	// qualified ("alias.column") to refer to any source joined before;
+	// unqualified, it refers to the query's first source.
+	LeftKey  string
+	RightKey string
+
+	// Within is the join window, required for (and only allowed in)
+	// stream-stream joins.
+	Within time.Duration
+
+	// GracePeriod is the grace period of the join window, see
+	// NoGracePeriod.
+	GracePeriod time.Duration
+}
+
+// JoinQuery builds a SELECT over joined sources.
+type JoinQuery struct {
+	// Columns are the projection, rendered verbatim. Empty selects *.
+	Columns []string
+	From    JoinSource
+	Joins   []Join
+
+	// Where is an optional predicate, rendered verbatim.
+	Where string
+
+	// EmitChanges makes the query a push query.
+	EmitChanges bool
+
+	// Policy is the case policy identifiers are rendered under.
+	Policy CasePolicy
+
+	// Dialect is the server version the query is built for. On servers
+	// from before EMIT CHANGES, it is left out of push queries.
+	Dialect Dialect
+}
+
+// Build checks the query's syntax and renders it. Checks that need the
+// sources' schemas, such as whether a WITHIN is required or whether key
+// types match, are left to the caller; see Client.BuildJoin.
+func (jq JoinQuery) Build() (string, error) {
+	if jq.From.Name == "" {
+		return "", fmt.Errorf("building join: no source")
+	}
+	if len(jq.Joins) == 0 {
+		return "", fmt.Errorf("building join: nothing joined to %s", jq.From.Name)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	if len(jq.Columns) == 0 {
+		sb.WriteString("*")
+	} else {
+		sb.WriteString(strings.Join(jq.Columns, ", "))
+	}
+	sb.WriteString(" FROM " + jq.source(jq.From))
+	for _, join := range jq.Joins {
+		clause, err := jq.join(join)
+		if err != nil {
+			return "", fmt.Errorf("building join of %s: %w", join.Source.Name, err)
+		}
+		sb.WriteString(" " + clause)
+	}
+	if where := strings.TrimSpace(jq.Where); where != "" {
+		sb.WriteString(" WHERE " + where)
+	}
+	if jq.EmitChanges {
+		sb.WriteString(jq.Dialect.EmitChanges())
+	}
+	sb.WriteString(";")
+	return sb.String(), nil
+}
+
+// source renders a source with its alias.
+func (jq JoinQuery) source(js JoinSource) string {
+	if js.Alias == "" {
+		return jq.Policy.Ident(js.Name)
+	}
+	return jq.Policy.Ident(js.Name) + " " + jq.Policy.Ident(js.Alias)
+}
+
+// join renders a single JOIN clause.
+func (jq JoinQuery) join(join Join) (string, error) {
+	if join.Source.Name == "" {
+		return "", fmt.Errorf("no source")
+	}
+	if join.LeftKey == "" || join.RightKey == "" {
+		return "", fmt.Errorf("no join keys")
+	}
+	typ := join.Type
+	if typ == "" {
+		typ = InnerJoin
+	}
+	switch typ {
+	case InnerJoin, LeftJoin, FullJoin:
+	case RightJoin:
+		if err := jq.Dialect.Check(FeatureRightJoin); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unknown join type %q", typ)
+	}
+
+	clause := string(typ) + " " + jq.source(join.Source)
+	if join.Within < 0 {
+		return "", fmt.Errorf("negative join window %s", join.Within)
+	}
+	if join.Within > 0 {
+		within, err := Duration(join.Within)
+		if err != nil {
+			return "", fmt.Errorf("join window: %w", err)
+		}
+		clause += " WITHIN " + within
+		if join.GracePeriod != 0 {
+			if err := jq.Dialect.Check(FeatureJoinGrace); err != nil {
+				return "", err
+			}
+			grace := join.GracePeriod
+			if grace == NoGracePeriod {
+				grace = 0
+			}
+			period, err := Duration(grace)
+			if err != nil {
+				return "", fmt.Errorf("grace period: %w", err)
+			}
+			clause += " GRACE PERIOD " + period
+		}
+	} else if join.GracePeriod != 0 {
+		return "", fmt.Errorf("grace period without a join window")
+	}
+
+	leftRef, leftCol := SplitQualified(join.LeftKey)
+	if leftRef == "" {
+		leftRef = jq.From.Ref()
+	}
+	rightRef, rightCol := SplitQualified(join.RightKey)
+	if rightRef == "" {
+		rightRef = join.Source.Ref()
+	}
+	clause += fmt.Sprintf(" ON %s.%s = %s.%s",
+		jq.Policy.Ident(leftRef), jq.Policy.Ident(leftCol),
+		jq.Policy.Ident(rightRef), jq.Policy.Ident(rightCol))
+	return clause, nil
+}
+
+// SplitQualified splits a column reference "source.column" into its
+// source and column. Unqualified references have an empty source.
+func SplitQualified(ref string) (source, column string) {
+	inQuote := false
+	for i, c := range ref {
+		switch {
+		case c == '`':
+			inQuote = !inQuote
+		case c == '.' && !inQuote:
+			return ref[:i], ref[i+1:]
+		}
+	}
+	return "", ref
+}
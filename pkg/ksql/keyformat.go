@@ -0,0 +1,57 @@
+package ksql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultKeyFormat is the key format of sources that do not set one,
+// unless the server is configured otherwise.
+const DefaultKeyFormat = "KAFKA"
+
+// CheckKeyFormat checks that key columns of the given types can be
+// serialized in a key format: NONE allows no key columns, KAFKA a single
+// INT, BIGINT, DOUBLE, STRING or BYTES one, DELIMITED only primitive
+// types, and the schema formats (JSON, AVRO, PROTOBUF and their variants)
+// any. Unknown formats are accepted.
+func CheckKeyFormat(format string, types []string) error {
+	format = strings.ToUpper(strings.TrimSpace(format))
+	if format == "" {
+		format = DefaultKeyFormat
+	}
+	switch format {
+	case "NONE":
+		if len(types) > 0 {
+			return fmt.Errorf("key format NONE supports no key columns, got %d", len(types))
+		}
+	case "KAFKA":
+		if len(types) > 1 {
+			return fmt.Errorf("key format KAFKA supports a single key column, got %d", len(types))
+		}
+		for _, typ := range types {
+			switch normalizeType(typ) {
+			case "INT", "INTEGER", "BIGINT", "DOUBLE", "STRING", "VARCHAR", "BYTES":
+			default:
+				return fmt.Errorf("key format KAFKA cannot serialize %s keys", typ)
+			}
+		}
+	case "DELIMITED":
+		for _, typ := range types {
+			switch baseTypeOf(typ) {
+			case "ARRAY", "MAP", "STRUCT":
+				return fmt.Errorf("key format DELIMITED cannot serialize %s keys", typ)
+			}
+		}
+	}
+	return nil
+}
+
+// baseTypeOf returns a type without its parameters or members, eg. ARRAY
+// for ARRAY<STRING>.
+func baseTypeOf(typ string) string {
+	typ = normalizeType(typ)
+	if idx := strings.IndexAny(typ, "(<"); idx >= 0 {
+		typ = typ[:idx]
+	}
+	return typ
+}
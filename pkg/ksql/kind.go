@@ -0,0 +1,83 @@
+package ksql
+
+import (
+	"regexp"
+	"strings"
+)
+
+// StatementKind is a coarse classification of statements, for policies
+// that treat them differently (sampling, retries, confirmation).
+type StatementKind string
+
+// Statement kinds.
+const (
+	KindPullQuery StatementKind = "pull_query"
+	KindPushQuery StatementKind = "push_query"
+	KindInsert    StatementKind = "insert"
+	KindDDL       StatementKind = "ddl"
+	KindAdmin     StatementKind = "admin"
+	KindOther     StatementKind = "other"
+)
+
+var (
+	// emitChanges detects push queries.
+	emitChanges = regexp.MustCompile(`(?i)\bEMIT\s+CHANGES\b`)
+
+	// selectKeyword detects INSERT INTO ... SELECT.
+	selectKeyword = regexp.MustCompile(`(?i)\bSELECT\b`)
+
+	// deleteTopic detects DROP ... DELETE TOPIC.
+	deleteTopic = regexp.MustCompile(`(?i)\bDELETE\s+TOPIC\b`)
+)
+
+// KindOf classifies a single statement by its leading keywords.
+func KindOf(statement string) StatementKind {
+	masked := statement
+	if stmts := SplitStatements(statement); len(stmts) > 0 {
+		masked = stmts[0].masked
+	}
+	fields := strings.Fields(strings.ToUpper(masked))
+	if len(fields) == 0 {
+		return KindOther
+	}
+	switch fields[0] {
+	case "SELECT":
+		if emitChanges.MatchString(masked) {
+			return KindPushQuery
+		}
+		return KindPullQuery
+	case "INSERT":
+		// INSERT INTO ... SELECT starts a persistent query, which is
+		// DDL in all but name.
+		if len(fields) > 1 && fields[1] == "INTO" && selectKeyword.MatchString(masked) {
+			return KindDDL
+		}
+		return KindInsert
+	case "CREATE", "DROP", "ALTER":
+		return KindDDL
+	case "SHOW", "LIST", "DESCRIBE", "EXPLAIN", "TERMINATE", "PRINT",
+		"SET", "UNSET", "DEFINE", "UNDEFINE", "PAUSE", "RESUME", "ASSERT":
+		return KindAdmin
+	}
+	return KindOther
+}
+
+// Destructive reports whether a single statement does damage that
+// cannot be undone by running DDL again, and why: DROP ... DELETE TOPIC
+// deletes the source's data, and TERMINATE ALL stops every persistent
+// query.
+func Destructive(statement string) (string, bool) {
+	masked := statement
+	if stmts := SplitStatements(statement); len(stmts) > 0 {
+		masked = stmts[0].masked
+	}
+	fields := strings.Fields(strings.ToUpper(masked))
+	switch {
+	case len(fields) == 0:
+	case fields[0] == "DROP" && deleteTopic.MatchString(masked):
+		return "deletes the topic of the source", true
+	case fields[0] == "TERMINATE" && len(fields) > 1 && strings.TrimSuffix(fields[1], ";") == "ALL":
+		return "terminates all persistent queries", true
+	}
+	return "", false
+}
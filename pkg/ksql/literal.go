@@ -0,0 +1,220 @@
+package ksql
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// String renders a string literal, escaping single quotes.
+func String(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// DecimalString renders a rational as a decimal, exactly if it has a
+// finite decimal expansion (as DECIMAL values do), and otherwise rounded
+// to 38 places, the most a DECIMAL holds.
+func DecimalString(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	// A reduced fraction has a finite expansion if its denominator is
+	// 2^a * 5^b, with max(a, b) places.
+	denom := new(big.Int).Set(r.Denom())
+	places := 0
+	for _, factor := range []int64{2, 5} {
+		count := 0
+		f := big.NewInt(factor)
+		mod := new(big.Int)
+		for {
+			quo, rem := new(big.Int).QuoRem(denom, f, mod)
+			if rem.Sign() != 0 {
+				break
+			}
+			denom = quo
+			count++
+		}
+		if count > places {
+			places = count
+		}
+	}
+	if denom.Cmp(big.NewInt(1)) != 0 || places > 38 {
+		places = 38
+	}
+	return r.FloatString(places)
+}
+
+// Expr is a KSQL expression, such as a column reference or a nested
+// function call, that Literal renders verbatim.
+type Expr string
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Literal renders a Go value as a KSQL literal. Pointers are followed,
+// and:
+//
+//	nil                    NULL
+//	string                 a quoted string
+//	bool, ints, floats     as themselves
+//	[]byte                 TO_BYTES('<base64>', 'BASE64')
+//	time.Time              FROM_UNIXTIME(<epoch millis>), a TIMESTAMP
+//	big.Rat, big.Float     decimals, see DecimalString
+//	slices and arrays      ARRAY[...]
+//	maps                   MAP(key := value, ...), in key order
+//	structs                STRUCT(NAME := value, ...), named as by the
+//	                       `ksql` tag, or else the field name
+//	Expr                   verbatim
+func Literal(value interface{}) (string, error) {
+	switch vv := value.(type) {
+	case json.Number:
+		return vv.String(), nil
+	case Expr:
+		return string(vv), nil
+	}
+	return literal(reflect.ValueOf(value))
+}
+
+// literal renders a reflected value.
+func literal(vv reflect.Value) (string, error) {
+	for vv.Kind() == reflect.Ptr || vv.Kind() == reflect.Interface {
+		if vv.IsNil() {
+			return "NULL", nil
+		}
+		vv = vv.Elem()
+	}
+	if vv.IsValid() && vv.CanInterface() {
+		switch val := vv.Interface().(type) {
+		case json.Number:
+			return val.String(), nil
+		case Expr:
+			return string(val), nil
+		case big.Rat:
+			return DecimalString(&val), nil
+		case big.Float:
+			return val.Text('f', -1), nil
+		}
+	}
+	if vv.IsValid() && vv.Type() == timeType {
+		return fmt.Sprintf("FROM_UNIXTIME(%d)", Millis(vv.Interface().(time.Time))), nil
+	}
+
+	switch vv.Kind() {
+	case reflect.Invalid:
+		return "NULL", nil
+	case reflect.String:
+		return String(vv.String()), nil
+	case reflect.Bool:
+		return strconv.FormatBool(vv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(vv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(vv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(vv.Float(), 'g', -1, vv.Type().Bits()), nil
+	case reflect.Slice, reflect.Array:
+		if vv.Type().Elem().Kind() == reflect.Uint8 {
+			if vv.Kind() == reflect.Slice && vv.IsNil() {
+				return "NULL", nil
+			}
+			byt := make([]byte, vv.Len())
+			reflect.Copy(reflect.ValueOf(byt), vv)
+			return fmt.Sprintf("TO_BYTES(%s, 'BASE64')", String(base64.StdEncoding.EncodeToString(byt))), nil
+		}
+		if vv.Kind() == reflect.Slice && vv.IsNil() {
+			return "NULL", nil
+		}
+		elems := make([]string, vv.Len())
+		for i := range elems {
+			elem, err := literal(vv.Index(i))
+			if err != nil {
+				return "", fmt.Errorf("element %d: %w", i, err)
+			}
+			elems[i] = elem
+		}
+		return "ARRAY[" + strings.Join(elems, ", ") + "]", nil
+	case reflect.Map:
+		if vv.IsNil() {
+			return "NULL", nil
+		}
+		entries := make([]string, 0, vv.Len())
+		iter := vv.MapRange()
+		for iter.Next() {
+			key, err := literal(iter.Key())
+			if err != nil {
+				return "", fmt.Errorf("map key: %w", err)
+			}
+			val, err := literal(iter.Value())
+			if err != nil {
+				return "", fmt.Errorf("map value %s: %w", key, err)
+			}
+			entries = append(entries, key+" := "+val)
+		}
+		sort.Strings(entries)
+		return "MAP(" + strings.Join(entries, ", ") + ")", nil
+	case reflect.Struct:
+		fields, err := structLiteralFields(vv)
+		if err != nil {
+			return "", err
+		}
+		return "STRUCT(" + strings.Join(fields, ", ") + ")", nil
+	}
+	return "", fmt.Errorf("no KSQL literal for %s", vv.Type())
+}
+
+// structLiteralFields renders the fields of a struct value, following
+// embedded structs.
+func structLiteralFields(vv reflect.Value) ([]string, error) {
+	var fields []string
+	typ := vv.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, tagged := field.Tag.Lookup("ksql")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && !tagged && field.Type.Kind() == reflect.Struct {
+			embedded, err := structLiteralFields(vv.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, embedded...)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if idx := strings.IndexByte(tag, ','); idx >= 0 {
+			tag = tag[:idx]
+		}
+		if tag != "" {
+			name = tag
+		}
+		val, err := literal(vv.Field(i))
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		fields = append(fields, UpperCase.Ident(name)+" := "+val)
+	}
+	return fields, nil
+}
+
+// Call renders a function call, with each argument rendered by Literal.
+// Pass column references and other expressions as Expr.
+func Call(name string, args ...interface{}) (string, error) {
+	rendered := make([]string, len(args))
+	for i, arg := range args {
+		lit, err := Literal(arg)
+		if err != nil {
+			return "", fmt.Errorf("calling %s: argument %d: %w", name, i+1, err)
+		}
+		rendered[i] = lit
+	}
+	return name + "(" + strings.Join(rendered, ", ") + ")", nil
+}
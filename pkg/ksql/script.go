@@ -0,0 +1,116 @@
+package ksql
+
+import "strings"
+
+// Statement is a single statement of a script.
+type Statement struct {
+	// Text is the statement as written, without its terminating
+	// semicolon and surrounding whitespace.
+	Text string
+
+	// Line is the (1-based) line of the script the statement starts on.
+	Line int
+
+	// masked is the text with comments removed and the contents of
+	// string literals and quoted identifiers blanked out, so that it can
+	// be searched for syntax.
+	masked string
+}
+
+// SplitStatements splits a script into its statements on semicolons,
+// ignoring those in string literals, quoted identifiers and comments.
+// Empty statements are dropped.
+func SplitStatements(script string) []Statement {
+	var (
+		stmts  []Statement
+		text   strings.Builder
+		masked strings.Builder
+		line   = 1
+		start  = 0
+	)
+	flush := func() {
+		if strings.TrimSpace(masked.String()) != "" {
+			stmts = append(stmts, Statement{
+				Text:   strings.TrimSpace(text.String()),
+				Line:   start,
+				masked: masked.String(),
+			})
+		}
+		text.Reset()
+		masked.Reset()
+		start = 0
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		if start == 0 && !isSpace(c) && !strings.HasPrefix(script[i:], "--") && !strings.HasPrefix(script[i:], "/*") {
+			start = line
+		}
+		switch {
+		case c == '\n':
+			line++
+			text.WriteByte(c)
+			masked.WriteByte(c)
+		case c == ';':
+			flush()
+		case strings.HasPrefix(script[i:], "--"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			if start != 0 {
+				text.WriteString(script[i : i+end])
+			}
+			i += end - 1
+		case strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				end = len(script) - i
+			} else {
+				end += 4
+			}
+			comment := script[i : i+end]
+			if start != 0 {
+				text.WriteString(comment)
+			}
+			line += strings.Count(comment, "\n")
+			masked.WriteString(" ")
+			i += end - 1
+		case c == '\'' || c == '`':
+			// Quotes are escaped by doubling them.
+			end := i + 1
+			for end < len(script) {
+				if script[end] == c {
+					if end+1 < len(script) && script[end+1] == c {
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+			if end >= len(script) {
+				end = len(script) - 1
+			}
+			quoted := script[i : end+1]
+			text.WriteString(quoted)
+			masked.WriteByte(c)
+			if len(quoted) >= 2 {
+				masked.WriteString(strings.Repeat("x", len(quoted)-2))
+			}
+			masked.WriteByte(c)
+			line += strings.Count(quoted, "\n")
+			i = end
+		default:
+			text.WriteByte(c)
+			masked.WriteByte(c)
+		}
+	}
+	flush()
+	return stmts
+}
+
+// isSpace reports whether a byte is ASCII whitespace.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
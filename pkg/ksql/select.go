@@ -0,0 +1,62 @@
+package ksql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Select builds a SELECT over a single source, with its filter given as
+// a Predicate so that what can be is pushed down into the WHERE clause.
+type Select struct {
+	// Columns are the projection, as identifiers. Empty selects *.
+	// Columns a client-side filter needs must be selected.
+	Columns []string
+	From    string
+	Where   Predicate
+
+	// EmitChanges makes the query a push query.
+	EmitChanges bool
+
+	// Limit, if positive, ends the query after that many rows. It applies
+	// on the server, before any filtering left to the client.
+	Limit int
+
+	// Policy is the case policy identifiers are rendered under.
+	Policy CasePolicy
+
+	// Dialect is the server version the query is built for.
+	Dialect Dialect
+}
+
+// Build renders the query. The part of Where that could not be rendered
+// is returned, or nil, for the caller to evaluate on the rows.
+func (sel Select) Build() (string, Predicate, error) {
+	if sel.From == "" {
+		return "", nil, fmt.Errorf("building select: no source")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	if len(sel.Columns) == 0 {
+		sb.WriteString("*")
+	} else {
+		cols := make([]string, len(sel.Columns))
+		for i, col := range sel.Columns {
+			cols[i] = sel.Policy.Ident(col)
+		}
+		sb.WriteString(strings.Join(cols, ", "))
+	}
+	sb.WriteString(" FROM " + sel.Policy.Ident(sel.From))
+	where, rest := Pushdown(sel.Where, sel.Policy)
+	if where != "" {
+		sb.WriteString(" WHERE " + where)
+	}
+	if sel.EmitChanges {
+		sb.WriteString(sel.Dialect.EmitChanges())
+	}
+	if sel.Limit > 0 {
+		sb.WriteString(fmt.Sprintf(" LIMIT %d", sel.Limit))
+	}
+	sb.WriteString(";")
+	return sb.String(), rest, nil
+}
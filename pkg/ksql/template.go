@@ -0,0 +1,96 @@
+package ksql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Template is a statement with ? placeholders for values, parsed once
+// and rendered many times, as for keyed lookups that differ only in
+// their key:
+//
+//	tmpl, err := ksql.ParseTemplate("SELECT * FROM users WHERE ID = ?;")
+//	...
+//	statement, err := tmpl.Render("u-42")
+//
+// Question marks in string literals, quoted identifiers and comments are
+// not placeholders.
+type Template struct {
+	// Kind is the kind of the statement.
+	Kind StatementKind
+
+	parts []string
+}
+
+// ParseTemplate parses a single statement into a template.
+func ParseTemplate(statement string) (Template, error) {
+	stmts := SplitStatements(statement)
+	if len(stmts) != 1 {
+		return Template{}, fmt.Errorf("parsing template: expected one statement, got %d", len(stmts))
+	}
+	text := stmts[0].Text
+
+	var (
+		parts []string
+		start int
+	)
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '\'' || c == '`':
+			// Quotes are escaped by doubling them, which this handles as
+			// a closing quote followed by an opening one.
+			end := strings.IndexByte(text[i+1:], c)
+			if end < 0 {
+				return Template{}, fmt.Errorf("parsing template: unterminated quote")
+			}
+			i += end + 1
+		case strings.HasPrefix(text[i:], "--"):
+			end := strings.IndexByte(text[i:], '\n')
+			if end < 0 {
+				end = len(text) - i
+			}
+			i += end - 1
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return Template{}, fmt.Errorf("parsing template: unterminated comment")
+			}
+			i += end + 3
+		case c == '?':
+			parts = append(parts, text[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, text[start:]+";")
+	return Template{Kind: KindOf(text), parts: parts}, nil
+}
+
+// NumArgs returns the number of placeholders.
+func (tt Template) NumArgs() int {
+	if len(tt.parts) == 0 {
+		return 0
+	}
+	return len(tt.parts) - 1
+}
+
+// Render substitutes the values, rendered with Literal, for the
+// placeholders, in order.
+func (tt Template) Render(args ...interface{}) (string, error) {
+	if len(tt.parts) == 0 {
+		return "", fmt.Errorf("rendering template: empty template")
+	}
+	if len(args) != tt.NumArgs() {
+		return "", fmt.Errorf("rendering template: expected %d arguments, got %d", tt.NumArgs(), len(args))
+	}
+	var sb strings.Builder
+	for i, arg := range args {
+		lit, err := Literal(arg)
+		if err != nil {
+			return "", fmt.Errorf("rendering template: argument %d: %w", i+1, err)
+		}
+		sb.WriteString(tt.parts[i])
+		sb.WriteString(lit)
+	}
+	sb.WriteString(tt.parts[len(tt.parts)-1])
+	return sb.String(), nil
+}
@@ -0,0 +1,106 @@
+package ksql
+
+import (
+	"time"
+)
+
+// Default layouts of a TimeFormatter, those of the server's own output.
+const (
+	DefaultTimestampLayout = "2006-01-02T15:04:05.000"
+	DefaultDateLayout      = "2006-01-02"
+	DefaultTimeLayout      = "15:04:05.999999999"
+)
+
+// TimeFormatter renders TIMESTAMP, DATE and TIME values as text, in one
+// time zone and set of layouts, so that the literals and exports of
+// services running in different zones agree. The zero value renders as
+// the server does, in UTC.
+type TimeFormatter struct {
+	// Location is the zone times are rendered in. It defaults to UTC.
+	Location *time.Location
+
+	// TimestampLayout, DateLayout and TimeLayout are Go layouts, which
+	// default to DefaultTimestampLayout, DefaultDateLayout and
+	// DefaultTimeLayout.
+	TimestampLayout string
+	DateLayout      string
+	TimeLayout      string
+}
+
+// Timestamp renders a TIMESTAMP.
+func (tf TimeFormatter) Timestamp(t time.Time) string {
+	return t.In(tf.location()).Format(orDefault(tf.TimestampLayout, DefaultTimestampLayout))
+}
+
+// Date renders the DATE of a time, in the formatter's zone.
+func (tf TimeFormatter) Date(t time.Time) string {
+	return t.In(tf.location()).Format(orDefault(tf.DateLayout, DefaultDateLayout))
+}
+
+// Time renders the TIME of a time, its wall clock in the formatter's
+// zone.
+func (tf TimeFormatter) Time(t time.Time) string {
+	return t.In(tf.location()).Format(orDefault(tf.TimeLayout, DefaultTimeLayout))
+}
+
+// TimeOfDay renders a TIME given as the time since midnight, as it is
+// decoded. It does not depend on the zone.
+func (tf TimeFormatter) TimeOfDay(d time.Duration) string {
+	midnight := time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)
+	return midnight.Add(d).Format(orDefault(tf.TimeLayout, DefaultTimeLayout))
+}
+
+// Format renders a time.Time or time.Duration as a value of the given
+// KSQL type, reporting false for other values. Times of other or unknown
+// types render as TIMESTAMPs, and durations as TIMEs.
+func (tf TimeFormatter) Format(value interface{}, typ string) (string, bool) {
+	switch vv := value.(type) {
+	case time.Time:
+		switch baseTypeOf(typ) {
+		case "DATE":
+			return tf.Date(vv), true
+		case "TIME":
+			return tf.Time(vv), true
+		}
+		return tf.Timestamp(vv), true
+	case *time.Time:
+		if vv != nil {
+			return tf.Format(*vv, typ)
+		}
+	case time.Duration:
+		return tf.TimeOfDay(vv), true
+	}
+	return "", false
+}
+
+// Literal renders a value as a literal of the given KSQL type: times of
+// DATE and TIME columns as quoted text in the formatter's zone, which the
+// server casts (the layouts are the server's, whatever the formatter's).
+// Other values, and TIMESTAMPs, which are rendered as epoch milliseconds
+// and so do not depend on the zone, are rendered by Literal.
+func (tf TimeFormatter) Literal(value interface{}, typ string) (string, error) {
+	switch baseTypeOf(typ) {
+	case "DATE", "TIME":
+		server := TimeFormatter{Location: tf.Location}
+		if text, ok := server.Format(value, typ); ok {
+			return String(text), nil
+		}
+	}
+	return Literal(value)
+}
+
+// location returns the zone times are rendered in.
+func (tf TimeFormatter) location() *time.Location {
+	if tf.Location == nil {
+		return time.UTC
+	}
+	return tf.Location
+}
+
+// orDefault returns layout, or def if it is empty.
+func orDefault(layout, def string) string {
+	if layout == "" {
+		return def
+	}
+	return layout
+}
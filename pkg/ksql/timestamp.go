@@ -0,0 +1,144 @@
+package ksql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimestampFormat is a TIMESTAMP_FORMAT pattern, in the syntax of Java's
+// DateTimeFormatter, checked and translated to a Go layout so that the
+// values written to and read from a source's timestamp column agree with
+// what the server parses.
+type TimestampFormat struct {
+	pattern string
+	layout  string
+}
+
+// javaLayouts maps the supported runs of pattern letters to Go layouts.
+var javaLayouts = map[string]string{
+	"yyyy": "2006", "uuuu": "2006", "yy": "06", "uu": "06",
+	"M": "1", "MM": "01", "MMM": "Jan", "MMMM": "January",
+	"d": "2", "dd": "02",
+	"EEE": "Mon", "EEEE": "Monday",
+	"HH": "15",
+	"h":  "3", "hh": "03",
+	"m": "4", "mm": "04",
+	"s": "5", "ss": "05",
+	"a": "PM",
+	"X": "Z07", "XX": "Z0700", "XXX": "Z07:00",
+	"x": "-07", "xx": "-0700", "xxx": "-07:00",
+	"Z": "-0700", "ZZ": "-0700", "ZZZ": "-0700", "ZZZZZ": "Z07:00",
+	"z": "MST", "zz": "MST", "zzz": "MST",
+}
+
+// goLayoutChunks are the Go layout elements that literal text must not
+// contain, lest Go read them as fields.
+var goLayoutChunks = []string{"Jan", "Mon", "MST", "PM", "pm"}
+
+// ParseTimestampFormat checks a TIMESTAMP_FORMAT pattern. Patterns are
+// limited to what Go layouts can represent: fractions of seconds (S)
+// must follow a '.' or ',', literal text may not contain digits, and
+// optional sections are not supported.
+func ParseTimestampFormat(pattern string) (TimestampFormat, error) {
+	var layout strings.Builder
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+		switch {
+		case c == '\'':
+			end := i + 1
+			var text strings.Builder
+			for {
+				j := strings.IndexByte(pattern[end:], '\'')
+				if j < 0 {
+					return TimestampFormat{}, fmt.Errorf("timestamp format %q: unterminated quote", pattern)
+				}
+				text.WriteString(pattern[end : end+j])
+				end += j + 1
+				if end < len(pattern) && pattern[end] == '\'' {
+					text.WriteByte('\'')
+					end++
+					continue
+				}
+				break
+			}
+			if i+1 == end-1 {
+				text.WriteByte('\'')
+			}
+			if err := checkLiteralText(pattern, text.String()); err != nil {
+				return TimestampFormat{}, err
+			}
+			layout.WriteString(text.String())
+			i = end
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(pattern) && pattern[j] == c {
+				j++
+			}
+			run := pattern[i:j]
+			if c == 'S' {
+				if i == 0 || (pattern[i-1] != '.' && pattern[i-1] != ',') {
+					return TimestampFormat{}, fmt.Errorf("timestamp format %q: fraction of second must follow '.' or ','", pattern)
+				}
+				layout.WriteString(strings.Repeat("0", len(run)))
+			} else if goLayout, ok := javaLayouts[run]; ok {
+				layout.WriteString(goLayout)
+			} else {
+				return TimestampFormat{}, fmt.Errorf("timestamp format %q: unsupported pattern %q", pattern, run)
+			}
+			i = j
+		case c == '[' || c == ']' || c == '{' || c == '}' || c == '#':
+			return TimestampFormat{}, fmt.Errorf("timestamp format %q: unsupported character %q", pattern, c)
+		default:
+			if err := checkLiteralText(pattern, string(c)); err != nil {
+				return TimestampFormat{}, err
+			}
+			layout.WriteByte(c)
+			i++
+		}
+	}
+	if layout.Len() == 0 {
+		return TimestampFormat{}, fmt.Errorf("timestamp format: empty")
+	}
+	return TimestampFormat{pattern: pattern, layout: layout.String()}, nil
+}
+
+// checkLiteralText checks that literal text of a pattern cannot be taken
+// for fields of the Go layout.
+func checkLiteralText(pattern, text string) error {
+	if strings.ContainsAny(text, "0123456789") {
+		return fmt.Errorf("timestamp format %q: digits in literal text are not supported", pattern)
+	}
+	for _, chunk := range goLayoutChunks {
+		if strings.Contains(text, chunk) {
+			return fmt.Errorf("timestamp format %q: literal text %q is not supported", pattern, text)
+		}
+	}
+	return nil
+}
+
+// Pattern returns the pattern, as given to TIMESTAMP_FORMAT.
+func (tf TimestampFormat) Pattern() string {
+	return tf.pattern
+}
+
+// Layout returns the equivalent Go layout.
+func (tf TimestampFormat) Layout() string {
+	return tf.layout
+}
+
+// Format renders a time in the format. Times are rendered in their own
+// location: patterns without an offset are read by the server in UTC
+// (or the source's timezone), so convert them first as needed.
+func (tf TimestampFormat) Format(t time.Time) string {
+	return t.Format(tf.layout)
+}
+
+// Parse parses a value in the format, as UTC unless it has an offset.
+func (tf TimestampFormat) Parse(value string) (time.Time, error) {
+	t, err := time.Parse(tf.layout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing timestamp in format %q: %w", tf.pattern, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,106 @@
+package ksql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// whereKeyword finds the WHERE clause.
+	whereKeyword = regexp.MustCompile(`(?i)\bWHERE\b`)
+
+	// joinKeyword detects joins.
+	joinKeyword = regexp.MustCompile(`(?i)\bJOIN\b`)
+
+	// afterWhere finds the clauses following WHERE.
+	afterWhere = regexp.MustCompile(`(?i)\b(GROUP\s+BY|PARTITION\s+BY|HAVING|EMIT|LIMIT)\b`)
+)
+
+// AddPredicate ANDs a predicate into the WHERE clause of a single
+// SELECT, adding the clause if there is none, as when resuming a push
+// query from a checkpoint:
+//
+//	ksql.AddPredicate("SELECT * FROM pageviews EMIT CHANGES;", "ROWTIME > 1600000000000")
+//	// SELECT * FROM pageviews WHERE ROWTIME > 1600000000000 EMIT CHANGES;
+//
+// Joins are refused, since their columns would need qualifying.
+func AddPredicate(statement, predicate string) (string, error) {
+	stmts := SplitStatements(statement)
+	if len(stmts) != 1 {
+		return "", fmt.Errorf("adding predicate: expected one statement, got %d", len(stmts))
+	}
+	text := stmts[0].Text
+	if kind := KindOf(text); kind != KindPullQuery && kind != KindPushQuery {
+		return "", fmt.Errorf("adding predicate: not a query")
+	}
+
+	masked := maskTopLevel(text)
+	if joinKeyword.MatchString(masked) {
+		return "", fmt.Errorf("adding predicate: cannot add predicates to joins")
+	}
+	if loc := whereKeyword.FindStringIndex(masked); loc != nil {
+		end := len(text)
+		if next := afterWhere.FindStringIndex(masked[loc[1]:]); next != nil {
+			end = loc[1] + next[0]
+		}
+		existing := strings.TrimSpace(text[loc[1]:end])
+		rest := strings.TrimSpace(text[end:])
+		text = fmt.Sprintf("%s %s AND (%s)", text[:loc[1]], predicate, existing)
+		if rest != "" {
+			text += " " + rest
+		}
+		return text + ";", nil
+	}
+	if next := afterWhere.FindStringIndex(masked); next != nil {
+		return fmt.Sprintf("%sWHERE %s %s;", text[:next[0]], predicate, text[next[0]:]), nil
+	}
+	return fmt.Sprintf("%s WHERE %s;", text, predicate), nil
+}
+
+// maskTopLevel blanks out the comments, quoted text and parenthesized
+// expressions of a statement, keeping offsets, so that its top-level
+// clauses can be searched for.
+func maskTopLevel(text string) string {
+	masked := []byte(text)
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		start := i
+		switch c := text[i]; {
+		case c == '\'' || c == '`':
+			// Doubled quotes are escapes, which this handles as a
+			// closing quote followed by an opening one.
+			if end := strings.IndexByte(text[i+1:], c); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(text) - 1
+			}
+		case strings.HasPrefix(text[i:], "--"):
+			if end := strings.IndexByte(text[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(text) - 1
+			}
+		case strings.HasPrefix(text[i:], "/*"):
+			if end := strings.Index(text[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(text) - 1
+			}
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			masked[i] = ' '
+			continue
+		default:
+			if depth == 0 {
+				continue
+			}
+		}
+		for j := start; j <= i; j++ {
+			masked[j] = ' '
+		}
+	}
+	return string(masked)
+}
@@ -0,0 +1,176 @@
+package ksql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WindowType is the kind of windowing of a windowed table.
+type WindowType string
+
+const (
+	// Tumbling windows are fixed-size and non-overlapping.
+	Tumbling WindowType = "TUMBLING"
+
+	// Hopping windows are fixed-size and may overlap.
+	Hopping WindowType = "HOPPING"
+
+	// Session windows grow with activity and have no fixed size.
+	Session WindowType = "SESSION"
+)
+
+// WindowRange selects the windows of a windowed table by time, instead
+// of raw epoch milliseconds (or, worse, seconds).
+type WindowRange struct {
+	Type WindowType
+	From time.Time
+	To   time.Time
+}
+
+// Predicate renders the range as a WHERE predicate on the window bounds.
+// Fixed-size windows (tumbling and hopping) are selected by their start,
+// in [From, To). Session windows have no fixed size, so those overlapping
+// [From, To) are selected instead, bounding both WINDOWSTART and
+// WINDOWEND.
+func (wr WindowRange) Predicate() (string, error) {
+	if wr.To.Before(wr.From) {
+		return "", fmt.Errorf("window range ends (%s) before it starts (%s)", wr.To, wr.From)
+	}
+	switch wr.Type {
+	case Tumbling, Hopping:
+		return fmt.Sprintf("WINDOWSTART >= %d AND WINDOWSTART < %d", Millis(wr.From), Millis(wr.To)), nil
+	case Session:
+		return fmt.Sprintf("WINDOWSTART < %d AND WINDOWEND > %d", Millis(wr.To), Millis(wr.From)), nil
+	}
+	return "", fmt.Errorf("unknown window type %q", wr.Type)
+}
+
+// Millis converts a time into epoch milliseconds, the unit of ROWTIME,
+// WINDOWSTART and WINDOWEND.
+func Millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// NoGracePeriod sets an explicit grace period of zero, rather than
+// leaving the server's default.
+const NoGracePeriod time.Duration = -1
+
+// Window is a WINDOW clause of an aggregation.
+type Window struct {
+	Type WindowType
+
+	// Size is the window size, or the inactivity gap of session windows.
+	Size time.Duration
+
+	// AdvanceBy is the hop of hopping windows.
+	AdvanceBy time.Duration
+
+	// Retention is how long windows are kept for pull queries. It must
+	// cover the size plus the grace period.
+	Retention time.Duration
+
+	// GracePeriod is how long late records are still accepted into a
+	// closed window. Zero leaves the server default, see NoGracePeriod.
+	GracePeriod time.Duration
+
+	// Dialect is the server version the clause is built for.
+	Dialect Dialect
+}
+
+// Clause validates the window and renders it as a WINDOW clause, eg.
+// "WINDOW HOPPING (SIZE 1 HOURS, ADVANCE BY 10 MINUTES, GRACE PERIOD 0 MILLISECONDS)".
+func (ww Window) Clause() (string, error) {
+	if ww.Size <= 0 {
+		return "", fmt.Errorf("%s window without size", ww.Type)
+	}
+	size, err := Duration(ww.Size)
+	if err != nil {
+		return "", fmt.Errorf("window size: %w", err)
+	}
+
+	var parts []string
+	switch ww.Type {
+	case Tumbling, Session:
+		if ww.AdvanceBy != 0 {
+			return "", fmt.Errorf("%s window cannot advance by an interval", ww.Type)
+		}
+		if ww.Type == Tumbling {
+			parts = append(parts, "SIZE "+size)
+		} else {
+			parts = append(parts, size)
+		}
+	case Hopping:
+		if ww.AdvanceBy <= 0 || ww.AdvanceBy > ww.Size {
+			return "", fmt.Errorf("hopping window must advance by more than zero and at most its size, not %s", ww.AdvanceBy)
+		}
+		advance, err := Duration(ww.AdvanceBy)
+		if err != nil {
+			return "", fmt.Errorf("window advance: %w", err)
+		}
+		parts = append(parts, "SIZE "+size, "ADVANCE BY "+advance)
+	default:
+		return "", fmt.Errorf("unknown window type %q", ww.Type)
+	}
+
+	grace := ww.GracePeriod
+	if grace == NoGracePeriod {
+		grace = 0
+	} else if grace < 0 {
+		return "", fmt.Errorf("negative grace period %s", grace)
+	}
+	if ww.Retention != 0 {
+		if err := ww.Dialect.Check(FeatureWindowRetention); err != nil {
+			return "", err
+		}
+		if ww.Retention < ww.Size+grace {
+			return "", fmt.Errorf("window retention %s is less than size %s plus grace period %s", ww.Retention, ww.Size, grace)
+		}
+		retention, err := Duration(ww.Retention)
+		if err != nil {
+			return "", fmt.Errorf("window retention: %w", err)
+		}
+		parts = append(parts, "RETENTION "+retention)
+	}
+	if ww.GracePeriod != 0 {
+		if err := ww.Dialect.Check(FeatureWindowGrace); err != nil {
+			return "", err
+		}
+		period, err := Duration(grace)
+		if err != nil {
+			return "", fmt.Errorf("grace period: %w", err)
+		}
+		parts = append(parts, "GRACE PERIOD "+period)
+	}
+	return fmt.Sprintf("WINDOW %s (%s)", ww.Type, strings.Join(parts, ", ")), nil
+}
+
+// durationUnits are the KSQL time units, largest first.
+var durationUnits = []struct {
+	unit time.Duration
+	name string
+}{
+	{24 * time.Hour, "DAYS"},
+	{time.Hour, "HOURS"},
+	{time.Minute, "MINUTES"},
+	{time.Second, "SECONDS"},
+	{time.Millisecond, "MILLISECONDS"},
+}
+
+// Duration renders a duration as a KSQL interval in the largest unit
+// that holds it exactly, eg. "90 MINUTES". KSQL has no unit finer than
+// milliseconds.
+func Duration(d time.Duration) (string, error) {
+	if d < 0 {
+		return "", fmt.Errorf("negative duration %s", d)
+	}
+	if d == 0 {
+		return "0 MILLISECONDS", nil
+	}
+	for _, du := range durationUnits {
+		if d%du.unit == 0 {
+			return fmt.Sprintf("%d %s", d/du.unit, du.name), nil
+		}
+	}
+	return "", fmt.Errorf("duration %s is not a whole number of milliseconds", d)
+}
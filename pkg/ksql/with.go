@@ -0,0 +1,274 @@
+package ksql
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WithOptions are the properties of a WITH clause, typed, so that the
+// DDL builders, the parsing of existing sources' statements and their
+// comparison share a single definition. Zero values are left out.
+type WithOptions struct {
+	KafkaTopic      string
+	Format          string
+	KeyFormat       string
+	ValueFormat     string
+	ValueDelimiter  string
+	Timestamp       string
+	TimestampFormat string
+	Partitions      int
+	Replicas        int
+	WrapSingleValue *bool
+	KeySchemaID     int
+	ValueSchemaID   int
+	WindowType      string
+	WindowSize      string
+
+	// Extra holds any other property, by upper-case name.
+	Extra map[string]interface{}
+}
+
+// Props returns the options as properties, by upper-case name.
+func (wo WithOptions) Props() map[string]interface{} {
+	props := make(map[string]interface{})
+	setString := func(name, value string) {
+		if value != "" {
+			props[name] = value
+		}
+	}
+	setInt := func(name string, value int) {
+		if value != 0 {
+			props[name] = value
+		}
+	}
+	setString("KAFKA_TOPIC", wo.KafkaTopic)
+	setString("FORMAT", wo.Format)
+	setString("KEY_FORMAT", wo.KeyFormat)
+	setString("VALUE_FORMAT", wo.ValueFormat)
+	setString("VALUE_DELIMITER", wo.ValueDelimiter)
+	setString("TIMESTAMP", wo.Timestamp)
+	setString("TIMESTAMP_FORMAT", wo.TimestampFormat)
+	setInt("PARTITIONS", wo.Partitions)
+	setInt("REPLICAS", wo.Replicas)
+	if wo.WrapSingleValue != nil {
+		props["WRAP_SINGLE_VALUE"] = *wo.WrapSingleValue
+	}
+	setInt("KEY_SCHEMA_ID", wo.KeySchemaID)
+	setInt("VALUE_SCHEMA_ID", wo.ValueSchemaID)
+	setString("WINDOW_TYPE", wo.WindowType)
+	setString("WINDOW_SIZE", wo.WindowSize)
+	for name, value := range wo.Extra {
+		props[strings.ToUpper(name)] = value
+	}
+	return props
+}
+
+// Clause renders the options as a WITH clause, with the properties in
+// name order, or an empty string if there are none.
+func (wo WithOptions) Clause() (string, error) {
+	props := wo.Props()
+	if len(props) == 0 {
+		return "", nil
+	}
+	return withClause(props)
+}
+
+// set sets a property by name, parsed from its literal.
+func (wo *WithOptions) set(name string, value interface{}) error {
+	str := func() (string, error) {
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return "", fmt.Errorf("property %s: expected a string, got %v", name, value)
+	}
+	num := func() (int, error) {
+		if n, ok := value.(int); ok {
+			return n, nil
+		}
+		if s, ok := value.(string); ok {
+			if n, err := strconv.Atoi(s); err == nil {
+				return n, nil
+			}
+		}
+		return 0, fmt.Errorf("property %s: expected an integer, got %v", name, value)
+	}
+
+	var err error
+	switch name = strings.ToUpper(name); name {
+	case "KAFKA_TOPIC":
+		wo.KafkaTopic, err = str()
+	case "FORMAT":
+		wo.Format, err = str()
+	case "KEY_FORMAT":
+		wo.KeyFormat, err = str()
+	case "VALUE_FORMAT":
+		wo.ValueFormat, err = str()
+	case "VALUE_DELIMITER":
+		wo.ValueDelimiter, err = str()
+	case "TIMESTAMP":
+		wo.Timestamp, err = str()
+	case "TIMESTAMP_FORMAT":
+		wo.TimestampFormat, err = str()
+	case "PARTITIONS":
+		wo.Partitions, err = num()
+	case "REPLICAS":
+		wo.Replicas, err = num()
+	case "WRAP_SINGLE_VALUE":
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("property %s: expected a boolean, got %v", name, value)
+		}
+		wo.WrapSingleValue = &b
+	case "KEY_SCHEMA_ID":
+		wo.KeySchemaID, err = num()
+	case "VALUE_SCHEMA_ID":
+		wo.ValueSchemaID, err = num()
+	case "WINDOW_TYPE":
+		wo.WindowType, err = str()
+	case "WINDOW_SIZE":
+		wo.WindowSize, err = str()
+	default:
+		if wo.Extra == nil {
+			wo.Extra = make(map[string]interface{})
+		}
+		wo.Extra[name] = value
+	}
+	return err
+}
+
+// Diff returns the names of the properties whose values differ between
+// the two options, in name order. Formats are compared ignoring case.
+func (wo WithOptions) Diff(other WithOptions) []string {
+	props, otherProps := wo.Props(), other.Props()
+	var names []string
+	for name, value := range props {
+		if !sameProperty(value, otherProps[name]) {
+			names = append(names, name)
+		}
+	}
+	for name := range otherProps {
+		if _, ok := props[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sameProperty compares property values.
+func sameProperty(a, b interface{}) bool {
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if aok && bok {
+		return strings.EqualFold(as, bs)
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// withKeyword finds a top-level WITH.
+var withKeyword = regexp.MustCompile(`(?i)\bWITH\b`)
+
+// ParseWith parses the WITH clause of a statement, eg. the statement
+// of a DESCRIBE'd source. A statement without a WITH clause yields empty
+// options.
+func ParseWith(statement string) (WithOptions, error) {
+	var wo WithOptions
+	masked := maskTopLevel(statement)
+	for _, loc := range withKeyword.FindAllStringIndex(masked, -1) {
+		rest := strings.TrimLeft(statement[loc[1]:], " \t\r\n")
+		if !strings.HasPrefix(rest, "(") {
+			continue
+		}
+		body, ok := parenthesized(rest)
+		if !ok {
+			return wo, fmt.Errorf("parsing WITH clause: unterminated")
+		}
+		for _, prop := range splitOutsideQuotes(body, ',') {
+			if strings.TrimSpace(prop) == "" {
+				continue
+			}
+			eq := strings.IndexByte(prop, '=')
+			if eq < 0 {
+				return wo, fmt.Errorf("parsing WITH clause: no value in %q", strings.TrimSpace(prop))
+			}
+			name := strings.TrimSpace(prop[:eq])
+			value, err := parseLiteral(strings.TrimSpace(prop[eq+1:]))
+			if err != nil {
+				return wo, fmt.Errorf("parsing WITH clause: property %s: %w", name, err)
+			}
+			if err := wo.set(name, value); err != nil {
+				return wo, fmt.Errorf("parsing WITH clause: %w", err)
+			}
+		}
+		return wo, nil
+	}
+	return wo, nil
+}
+
+// parenthesized returns the contents of the parentheses s starts with.
+func parenthesized(s string) (string, bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'', '`':
+			end := strings.IndexByte(s[i+1:], s[i])
+			if end < 0 {
+				return "", false
+			}
+			i += end + 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return s[1:i], true
+			}
+		}
+	}
+	return "", false
+}
+
+// splitOutsideQuotes splits s on sep, ignoring those in quotes.
+func splitOutsideQuotes(s string, sep byte) []string {
+	var (
+		parts []string
+		start int
+		quote byte
+	)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '`':
+			quote = c
+		case c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseLiteral parses a string, integer or boolean literal.
+func parseLiteral(lit string) (interface{}, error) {
+	switch {
+	case len(lit) >= 2 && lit[0] == '\'' && lit[len(lit)-1] == '\'':
+		return strings.Replace(lit[1:len(lit)-1], "''", "'", -1), nil
+	case strings.EqualFold(lit, "TRUE"):
+		return true, nil
+	case strings.EqualFold(lit, "FALSE"):
+		return false, nil
+	}
+	if n, err := strconv.Atoi(lit); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(lit, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unsupported literal %s", lit)
+}
@@ -1,6 +1,9 @@
 package ksqldbapi
 
-import "net/url"
+import (
+	"net/url"
+	"strings"
+)
 
 var (
 	// EndpointStatusQuery is used to introspect query status.
@@ -18,8 +21,18 @@ var (
 	// EndpointRunStreamQuery is used to run push and pull queries.
 	EndpointRunStreamQuery = newEndpoint("/query-stream")
 
+	// EndpointCloseQuery is used to close a push query by its ID.
+	EndpointCloseQuery = newEndpoint("/close-query")
+
 	// EndpointTerminate is used to terminate a cluster.
 	EndpointTerminate = newEndpoint("/ksql/terminate")
+
+	// EndpointMetadata is used to introspect the server's version and
+	// cluster.
+	EndpointMetadata = newEndpoint("/v1/metadata")
+
+	// EndpointMetadataID is used to introspect the server's cluster.
+	EndpointMetadataID = newEndpoint("/v1/metadata/id")
 )
 
 // Endpoint embeds and decorates a basic URL.
@@ -37,3 +50,9 @@ func newEndpoint(path string) Endpoint {
 func (ep *Endpoint) On(host *url.URL) *url.URL {
 	return host.ResolveReference(ep.URL)
 }
+
+// Sub returns the endpoint with a path element appended, for endpoints
+// addressing a resource by ID, eg. /status/<commandId>.
+func (ep *Endpoint) Sub(elem string) Endpoint {
+	return Endpoint{URL: &url.URL{Path: strings.TrimSuffix(ep.Path, "/") + "/" + elem}}
+}
@@ -0,0 +1,171 @@
+// Package ksqldbtest provides helpers for testing code built on the
+// ksqldb client, without a server or real time passing.
+package ksqldbtest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"hews.co/ksqldb"
+)
+
+// ManualClock is a ksqldb.Clock that only moves when told to. Timers and
+// tickers fire, in deadline order, as Advance moves past them, so that
+// timeouts, polling and idle detection can be tested instantly and
+// deterministically.
+type ManualClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*manualWaiter
+}
+
+// manualWaiter is a pending timer or ticker.
+type manualWaiter struct {
+	clock    *ManualClock
+	ch       chan time.Time
+	deadline time.Time
+	period   time.Duration
+	active   bool
+}
+
+// NewManualClock creates a ManualClock set to the given time.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now implements ksqldb.Clock.
+func (mc *ManualClock) Now() time.Time {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.now
+}
+
+// NewTimer implements ksqldb.Clock.
+func (mc *ManualClock) NewTimer(d time.Duration) ksqldb.Timer {
+	return mc.add(d, 0)
+}
+
+// NewTicker implements ksqldb.Clock.
+func (mc *ManualClock) NewTicker(d time.Duration) ksqldb.Ticker {
+	if d <= 0 {
+		panic("ksqldbtest: non-positive interval for NewTicker")
+	}
+	return manualTicker{mc.add(d, d)}
+}
+
+// add registers a waiter firing after d, and every period after that if
+// the period is set.
+func (mc *ManualClock) add(d, period time.Duration) *manualWaiter {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mw := &manualWaiter{
+		clock:    mc,
+		ch:       make(chan time.Time, 1),
+		deadline: mc.now.Add(d),
+		period:   period,
+		active:   true,
+	}
+	mc.waiters = append(mc.waiters, mw)
+	return mw
+}
+
+// Waiters returns the number of active timers and tickers, so that tests
+// can wait for the code under test to start waiting before advancing.
+func (mc *ManualClock) Waiters() int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	count := 0
+	for _, mw := range mc.waiters {
+		if mw.active {
+			count++
+		}
+	}
+	return count
+}
+
+// Advance moves the clock forward, firing every timer and ticker due
+// along the way. As with the time package, a tick is dropped if the
+// previous one has not been received yet.
+func (mc *ManualClock) Advance(d time.Duration) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	target := mc.now.Add(d)
+	for {
+		var due []*manualWaiter
+		for _, mw := range mc.waiters {
+			if mw.active && !mw.deadline.After(target) {
+				due = append(due, mw)
+			}
+		}
+		if len(due) == 0 {
+			break
+		}
+		sort.Slice(due, func(i, j int) bool { return due[i].deadline.Before(due[j].deadline) })
+		mw := due[0]
+		mc.now = mw.deadline
+		select {
+		case mw.ch <- mc.now:
+		default:
+		}
+		if mw.period > 0 {
+			mw.deadline = mw.deadline.Add(mw.period)
+		} else {
+			mw.active = false
+		}
+	}
+	mc.now = target
+	mc.prune()
+}
+
+// prune drops stopped waiters.
+func (mc *ManualClock) prune() {
+	active := mc.waiters[:0]
+	for _, mw := range mc.waiters {
+		if mw.active {
+			active = append(active, mw)
+		}
+	}
+	mc.waiters = active
+}
+
+// C implements ksqldb.Timer.
+func (mw *manualWaiter) C() <-chan time.Time {
+	return mw.ch
+}
+
+// Stop implements ksqldb.Timer, reporting whether the timer was still
+// active.
+func (mw *manualWaiter) Stop() bool {
+	mw.clock.mu.Lock()
+	defer mw.clock.mu.Unlock()
+	wasActive := mw.active
+	mw.active = false
+	return wasActive
+}
+
+// Reset implements ksqldb.Timer.
+func (mw *manualWaiter) Reset(d time.Duration) bool {
+	mw.clock.mu.Lock()
+	defer mw.clock.mu.Unlock()
+	wasActive := mw.active
+	mw.deadline = mw.clock.now.Add(d)
+	mw.active = true
+	for _, other := range mw.clock.waiters {
+		if other == mw {
+			return wasActive
+		}
+	}
+	mw.clock.waiters = append(mw.clock.waiters, mw)
+	return wasActive
+}
+
+// manualTicker adapts a periodic waiter to ksqldb.Ticker.
+type manualTicker struct {
+	*manualWaiter
+}
+
+// Stop implements ksqldb.Ticker.
+func (mt manualTicker) Stop() {
+	mt.manualWaiter.Stop()
+}
@@ -0,0 +1,251 @@
+package ksqldbtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"hews.co/ksqldb"
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// scriptEvent is a single step of a ScriptedStream.
+type scriptEvent struct {
+	row       []interface{}
+	tombstone bool
+	err       error
+	delay     time.Duration
+	final     string
+	end       bool
+}
+
+// ScriptedStream is a fake query response that tests script step by
+// step: rows, errors, delays and disconnects. It is served in the v1
+// /query format through a real ksqldb.Response, so consumers of Rows and
+// of the lower-level readers can be tested without any HTTP:
+//
+//	stream := ksqldbtest.NewScriptedStream("query_1",
+//		ksqldb.Column{Name: "ID", Type: "STRING"},
+//		ksqldb.Column{Name: "AMOUNT", Type: "BIGINT"},
+//	)
+//	stream.PushRow("a", 10)
+//	stream.PushDelay(time.Minute)
+//	stream.PushError(io.ErrUnexpectedEOF)
+//	rows := stream.Rows(ctx)
+//
+// Steps may be pushed before or while the stream is read.
+type ScriptedStream struct {
+	// Clock times delays. It defaults to ksqldb.SystemClock; with a
+	// ManualClock, delays last until the clock is advanced past them.
+	Clock ksqldb.Clock
+
+	queryID string
+	columns []ksqldb.Column
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	events []scriptEvent
+	closed bool
+}
+
+// NewScriptedStream creates a stream for a query with the given columns.
+func NewScriptedStream(queryID string, columns ...ksqldb.Column) *ScriptedStream {
+	ss := &ScriptedStream{queryID: queryID, columns: columns}
+	ss.cond = sync.NewCond(&ss.mu)
+	return ss
+}
+
+// push appends a step.
+func (ss *ScriptedStream) push(ev scriptEvent) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.closed {
+		panic("ksqldbtest: push to a finished ScriptedStream")
+	}
+	ss.events = append(ss.events, ev)
+	if ev.end || ev.err != nil {
+		ss.closed = true
+	}
+	ss.cond.Broadcast()
+}
+
+// PushRow sends a row, with values in column order.
+func (ss *ScriptedStream) PushRow(values ...interface{}) {
+	ss.push(scriptEvent{row: values})
+}
+
+// PushTombstone sends a table changelog row deleting its key.
+func (ss *ScriptedStream) PushTombstone(values ...interface{}) {
+	ss.push(scriptEvent{row: values, tombstone: true})
+}
+
+// PushDelay pauses the stream before its next step.
+func (ss *ScriptedStream) PushDelay(d time.Duration) {
+	ss.push(scriptEvent{delay: d})
+}
+
+// PushError fails the stream: reading the body returns err, as it
+// would on a broken connection. Nothing can be pushed after it.
+func (ss *ScriptedStream) PushError(err error) {
+	ss.push(scriptEvent{err: err})
+}
+
+// Disconnect drops the stream mid-response, without the closing of the
+// JSON array, as a server going away would.
+func (ss *ScriptedStream) Disconnect() {
+	ss.PushError(io.ErrUnexpectedEOF)
+}
+
+// Finish ends the stream cleanly, as a pull query or a push query with
+// a LIMIT does. A non-empty message is sent as the finalMessage.
+func (ss *ScriptedStream) Finish(message string) {
+	ss.push(scriptEvent{final: message, end: true})
+}
+
+// next blocks for the next step, or returns false once the context is
+// done.
+func (ss *ScriptedStream) next(ctx context.Context) (scriptEvent, bool) {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			ss.mu.Lock()
+			ss.cond.Broadcast()
+			ss.mu.Unlock()
+		case <-stop:
+		}
+	}()
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for len(ss.events) == 0 {
+		if ctx.Err() != nil {
+			return scriptEvent{}, false
+		}
+		ss.cond.Wait()
+	}
+	ev := ss.events[0]
+	ss.events = ss.events[1:]
+	return ev, true
+}
+
+// Response serves the stream as a ksqldb.Response.
+func (ss *ScriptedStream) Response(ctx context.Context) *ksqldb.Response {
+	body := &scriptedBody{stream: ss, ctx: ctx}
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       body,
+	}
+	rr := ksqldb.NewResponse(ctx, resp)
+	body.ctx = rr.Context
+	return rr
+}
+
+// Rows serves the stream as ksqldb.Rows.
+func (ss *ScriptedStream) Rows(ctx context.Context) *ksqldb.Rows {
+	return ss.Response(ctx).Rows()
+}
+
+// header renders the v1 header record.
+func (ss *ScriptedStream) header() []byte {
+	defs := make([]string, len(ss.columns))
+	for i, col := range ss.columns {
+		defs[i] = ksql.Quote(col.Name) + " " + col.Type
+	}
+	byt, _ := json.Marshal(map[string]interface{}{
+		"header": map[string]string{
+			"queryId": ss.queryID,
+			"schema":  strings.Join(defs, ", "),
+		},
+	})
+	return append(append([]byte("["), byt...), ",\n"...)
+}
+
+// scriptedBody renders the steps of a stream as a response body.
+type scriptedBody struct {
+	stream  *ScriptedStream
+	ctx     context.Context
+	started bool
+	buf     bytes.Buffer
+	err     error
+}
+
+// Read implements io.Reader.
+func (sb *scriptedBody) Read(p []byte) (int, error) {
+	if !sb.started {
+		sb.started = true
+		sb.buf.Write(sb.stream.header())
+	}
+	for sb.buf.Len() == 0 {
+		if sb.err != nil {
+			return 0, sb.err
+		}
+		if err := sb.step(); err != nil {
+			sb.err = err
+		}
+	}
+	return sb.buf.Read(p)
+}
+
+// step renders the next step into the buffer.
+func (sb *scriptedBody) step() error {
+	ev, ok := sb.stream.next(sb.ctx)
+	if !ok {
+		return sb.ctx.Err()
+	}
+	switch {
+	case ev.err != nil:
+		return ev.err
+	case ev.delay > 0:
+		clock := sb.stream.Clock
+		if clock == nil {
+			clock = ksqldb.SystemClock
+		}
+		timer := clock.NewTimer(ev.delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C():
+		case <-sb.ctx.Done():
+			return sb.ctx.Err()
+		}
+	case ev.end:
+		if ev.final != "" {
+			byt, _ := json.Marshal(map[string]string{"finalMessage": ev.final})
+			sb.buf.Write(byt)
+			sb.buf.WriteString("\n")
+		}
+		sb.buf.WriteString("]\n")
+		return io.EOF
+	default:
+		row := map[string]interface{}{"columns": ev.row}
+		if ev.tombstone {
+			row["tombstone"] = true
+		}
+		byt, err := json.Marshal(map[string]interface{}{"row": row})
+		if err != nil {
+			return fmt.Errorf("ksqldbtest: encoding row: %w", err)
+		}
+		sb.buf.Write(byt)
+		sb.buf.WriteString(",\n")
+	}
+	return nil
+}
+
+// Close implements io.Closer.
+func (sb *scriptedBody) Close() error {
+	return nil
+}
+
+var _ io.ReadCloser = (*scriptedBody)(nil)
@@ -0,0 +1,130 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// ConcurrencyLimits caps the requests of each kind the client runs at
+// once, so that a burst of slow pull queries cannot starve DDL or other
+// statements sharing the client. Zero leaves a kind unlimited. Requests
+// without a statement, such as health checks, are never limited.
+//
+// A request holds its slot until its response is done with: read to the
+// end, closed or canceled. For push queries, that is the whole life of
+// the stream.
+type ConcurrencyLimits struct {
+	PullQueries int
+	PushQueries int
+
+	// Statements covers everything else: DDL, inserts and admin
+	// statements such as SHOW or TERMINATE.
+	Statements int
+}
+
+// PoolStats describes the use of one of the client's concurrency pools.
+type PoolStats struct {
+	Limit int
+	InUse int
+
+	// Waits counts the requests that had to wait for a slot.
+	Waits int64
+}
+
+// ConcurrencyStats describes the use of the client's concurrency pools.
+type ConcurrencyStats struct {
+	PullQueries PoolStats
+	PushQueries PoolStats
+	Statements  PoolStats
+}
+
+// pool is a counting semaphore. A nil pool is unlimited.
+type pool struct {
+	slots chan struct{}
+	waits int64
+}
+
+// newPool creates a pool of the given size, or nil if unlimited.
+func newPool(size int) *pool {
+	if size <= 0 {
+		return nil
+	}
+	return &pool{slots: make(chan struct{}, size)}
+}
+
+// acquire takes a slot, waiting for one as long as the context allows.
+func (pp *pool) acquire(ctx context.Context) error {
+	if pp == nil {
+		return nil
+	}
+	select {
+	case pp.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	atomic.AddInt64(&pp.waits, 1)
+	select {
+	case pp.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for a request slot: %w", ctx.Err())
+	}
+}
+
+// release gives a slot back.
+func (pp *pool) release() {
+	if pp != nil {
+		<-pp.slots
+	}
+}
+
+// stats reports on the pool.
+func (pp *pool) stats() PoolStats {
+	if pp == nil {
+		return PoolStats{}
+	}
+	return PoolStats{
+		Limit: cap(pp.slots),
+		InUse: len(pp.slots),
+		Waits: atomic.LoadInt64(&pp.waits),
+	}
+}
+
+// pools are the client's concurrency pools, by kind of request.
+type pools struct {
+	pull, push, statements *pool
+}
+
+// newPools creates the pools for the limits.
+func newPools(limits ConcurrencyLimits) pools {
+	return pools{
+		pull:       newPool(limits.PullQueries),
+		push:       newPool(limits.PushQueries),
+		statements: newPool(limits.Statements),
+	}
+}
+
+// forKind returns the pool requests of a kind are limited by.
+func (ps pools) forKind(kind ksql.StatementKind) *pool {
+	switch kind {
+	case ksql.KindPullQuery:
+		return ps.pull
+	case ksql.KindPushQuery:
+		return ps.push
+	case ksql.KindInsert, ksql.KindDDL, ksql.KindAdmin:
+		return ps.statements
+	}
+	return nil
+}
+
+// stats reports on the pools.
+func (ps pools) stats() ConcurrencyStats {
+	return ConcurrencyStats{
+		PullQueries: ps.pull.stats(),
+		PushQueries: ps.push.stats(),
+		Statements:  ps.statements.stats(),
+	}
+}
@@ -0,0 +1,69 @@
+package ksqldb_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"hews.co/ksqldb"
+)
+
+func TestConcurrencyLimitsPerKind(t *testing.T) {
+	server := newFakeServer(t, func(ksql string) (fakeQuery, int) {
+		push := strings.Contains(ksql, "EMIT CHANGES")
+		return fakeQuery{schema: pricesSchema, rows: []string{`["A",1]`}, push: push}, 0
+	})
+	client := server.client(t, ksqldb.ClientOptions{
+		Concurrency: ksqldb.ConcurrencyLimits{PullQueries: 1, PushQueries: 1},
+	})
+	ctx := context.Background()
+
+	stream, err := client.Query(ctx, "SELECT * FROM prices EMIT CHANGES;", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	// The push query holds the only push slot, not the pull one.
+	rows, err := client.Query(ctx, "SELECT * FROM prices;", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	// Slots are given back as their request's context ends.
+	waitFor(t, func() bool { return client.Stats().Concurrency.PullQueries.InUse == 0 })
+
+	// Another push query waits for the slot as long as its context lets it.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := client.Query(canceled, "SELECT * FROM prices EMIT CHANGES;", nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("second push query: err = %v, want %v", err, context.Canceled)
+	}
+	stats := client.Stats().Concurrency
+	if want := (ksqldb.PoolStats{Limit: 1, InUse: 1, Waits: 1}); stats.PushQueries != want {
+		t.Errorf("push pool = %+v, want %+v", stats.PushQueries, want)
+	}
+	if want := (ksqldb.PoolStats{Limit: 1}); stats.PullQueries != want {
+		t.Errorf("pull pool = %+v, want %+v", stats.PullQueries, want)
+	}
+	if want := (ksqldb.PoolStats{}); stats.Statements != want {
+		t.Errorf("statements pool = %+v, want %+v", stats.Statements, want)
+	}
+
+	// Closing the stream gives its slot to the next push query.
+	stream.Close()
+	next, err := client.Query(ctx, "SELECT * FROM prices EMIT CHANGES;", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next.Close()
+	if got := len(server.queries()); got != 3 {
+		t.Errorf("%d queries reached the server, want 3", got)
+	}
+}
@@ -0,0 +1,168 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"hews.co/ksqldb/pkg/ksql"
+	"hews.co/ksqldb/pkg/ksqldbapi"
+)
+
+// DefaultPreparedCacheSize is the number of prepared statements a client
+// keeps by default.
+const DefaultPreparedCacheSize = 256
+
+// PreparedQuery is a pull query with ? placeholders, parsed and
+// classified once, for repeated keyed lookups that differ only in their
+// key values.
+type PreparedQuery struct {
+	client   *Client
+	template ksql.Template
+}
+
+// Prepare parses a pull query with ? placeholders for values. Prepared
+// queries are cached by their text, so preparing the same text again is
+// cheap; see ClientStats for the cache's hit rate.
+func (cc *Client) Prepare(statement string) (*PreparedQuery, error) {
+	if pq, ok := cc.prepared.get(statement); ok {
+		return pq, nil
+	}
+	tmpl, err := ksql.ParseTemplate(statement)
+	if err != nil {
+		return nil, fmt.Errorf("preparing query: %w", err)
+	}
+	if tmpl.Kind != ksql.KindPullQuery {
+		return nil, fmt.Errorf("preparing query: not a pull query (%s)", tmpl.Kind)
+	}
+	pq := &PreparedQuery{client: cc, template: tmpl}
+	cc.prepared.put(statement, pq)
+	return pq, nil
+}
+
+// NumArgs returns the number of values the query takes.
+func (pq *PreparedQuery) NumArgs() int {
+	return pq.template.NumArgs()
+}
+
+// Query runs the query with the values substituted for its placeholders,
+// in order. The rendered statement is sent as the pull query it was
+// prepared as, without being classified again.
+func (pq *PreparedQuery) Query(ctx context.Context, props map[string]string, args ...interface{}) (*Rows, error) {
+	statement, err := pq.template.Render(args...)
+	if err != nil {
+		return nil, fmt.Errorf("running prepared query: %w", err)
+	}
+	res := newResource(&ksqldbapi.EndpointRunQuery, statement, props)
+	res.kind = pq.template.Kind
+	return pq.client.runQuery(ctx, res)
+}
+
+// QueryPrepared prepares (or finds in the cache) a pull query and runs
+// it with the given values.
+func (cc *Client) QueryPrepared(ctx context.Context, statement string, props map[string]string, args ...interface{}) (*Rows, error) {
+	pq, err := cc.Prepare(statement)
+	if err != nil {
+		return nil, err
+	}
+	return pq.Query(ctx, props, args...)
+}
+
+// preparedCache holds prepared queries by text, evicting the oldest
+// once full.
+type preparedCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*PreparedQuery
+	order   []string
+
+	hits   int64
+	misses int64
+}
+
+// newPreparedCache creates a cache of the given size.
+func newPreparedCache(size int) *preparedCache {
+	if size <= 0 {
+		size = DefaultPreparedCacheSize
+	}
+	return &preparedCache{size: size, entries: make(map[string]*PreparedQuery)}
+}
+
+// get looks up a prepared query, counting the hit or miss.
+func (pc *preparedCache) get(statement string) (*PreparedQuery, bool) {
+	pc.mu.Lock()
+	pq, ok := pc.entries[statement]
+	pc.mu.Unlock()
+	if ok {
+		atomic.AddInt64(&pc.hits, 1)
+	} else {
+		atomic.AddInt64(&pc.misses, 1)
+	}
+	return pq, ok
+}
+
+// put adds a prepared query.
+func (pc *preparedCache) put(statement string, pq *PreparedQuery) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if _, ok := pc.entries[statement]; ok {
+		return
+	}
+	if len(pc.order) >= pc.size {
+		delete(pc.entries, pc.order[0])
+		pc.order = pc.order[1:]
+	}
+	pc.entries[statement] = pq
+	pc.order = append(pc.order, statement)
+}
+
+// stats reports on the cache.
+func (pc *preparedCache) stats() PreparedCacheStats {
+	pc.mu.Lock()
+	size := len(pc.entries)
+	pc.mu.Unlock()
+	return PreparedCacheStats{
+		Hits:   atomic.LoadInt64(&pc.hits),
+		Misses: atomic.LoadInt64(&pc.misses),
+		Size:   size,
+	}
+}
+
+// PreparedCacheStats describes the use of the prepared query cache.
+type PreparedCacheStats struct {
+	Hits   int64
+	Misses int64
+	Size   int
+}
+
+// HitRate returns the share of lookups that found a prepared query, or
+// zero before any lookup.
+func (ps PreparedCacheStats) HitRate() float64 {
+	if ps.Hits+ps.Misses == 0 {
+		return 0
+	}
+	return float64(ps.Hits) / float64(ps.Hits+ps.Misses)
+}
+
+// ClientStats are counters on the client's internals.
+type ClientStats struct {
+	Prepared    PreparedCacheStats
+	Describe    DescribeCacheStats
+	Concurrency ConcurrencyStats
+	Idempotency IdempotencyStats
+	Compression CompressionStats
+	Throttle    ThrottleStats
+}
+
+// Stats returns the client's current statistics.
+func (cc *Client) Stats() ClientStats {
+	return ClientStats{
+		Prepared:    cc.prepared.stats(),
+		Describe:    cc.describes.stats(),
+		Concurrency: cc.pools.stats(),
+		Idempotency: cc.ledger.stats(),
+		Compression: cc.compression.stats(),
+		Throttle:    cc.throttle.stats(),
+	}
+}
@@ -0,0 +1,213 @@
+package ksqldb
+
+import (
+	"encoding"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Props are the streamsProperties of a request, which the server takes
+// as strings. Its setters serialize typed values the way the server
+// parses them, and check the values of known properties, which the
+// server would otherwise ignore or reject late:
+//
+//	props := ksqldb.Props{}
+//	if err := props.SetDuration("commit.interval.ms", 500*time.Millisecond); err != nil {
+//		...
+//	}
+//	rows, err := client.Query(ctx, "SELECT * FROM views EMIT CHANGES;", props)
+type Props map[string]string
+
+// propKind is the type of a known property's value.
+type propKind int
+
+const (
+	propString propKind = iota
+	propInt
+	propBool
+	propDuration // an integer number of milliseconds
+)
+
+// propSpec describes the values a known property accepts.
+type propSpec struct {
+	kind propKind
+	min  int64
+
+	// values, if set, are the accepted values of a string property.
+	values []string
+}
+
+// knownProps are the properties whose values are checked, by name
+// without any "ksql.streams." prefix.
+var knownProps = map[string]propSpec{
+	"auto.offset.reset":                              {kind: propString, values: []string{"earliest", "latest"}},
+	"processing.guarantee":                           {kind: propString, values: []string{"at_least_once", "exactly_once", "exactly_once_beta", "exactly_once_v2"}},
+	"commit.interval.ms":                             {kind: propDuration},
+	"max.task.idle.ms":                               {kind: propDuration, min: -1},
+	"cache.max.bytes.buffering":                      {kind: propInt},
+	"num.stream.threads":                             {kind: propInt, min: 1},
+	"ksql.query.pull.table.scan.enabled":             {kind: propBool},
+	"ksql.query.pull.max.allowed.offset.lag":         {kind: propInt},
+	"ksql.query.push.v2.enabled":                     {kind: propBool},
+	"ksql.query.push.v2.continuation.tokens.enabled": {kind: propBool},
+}
+
+// lookupProp returns the spec of a known property.
+func lookupProp(name string) (propSpec, bool) {
+	spec, ok := knownProps[strings.TrimPrefix(name, "ksql.streams.")]
+	return spec, ok
+}
+
+// checkProp checks the text of a property's value, if it is known.
+func checkProp(name, value string) error {
+	spec, ok := lookupProp(name)
+	if !ok {
+		return nil
+	}
+	switch spec.kind {
+	case propString:
+		if len(spec.values) == 0 {
+			return nil
+		}
+		for _, accepted := range spec.values {
+			if value == accepted {
+				return nil
+			}
+		}
+		return fmt.Errorf("property %s: %q is not one of %s", name, value, strings.Join(spec.values, ", "))
+	case propInt, propDuration:
+		num, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("property %s: %q is not an integer", name, value)
+		}
+		if num < spec.min {
+			return fmt.Errorf("property %s: %d is below %d", name, num, spec.min)
+		}
+	case propBool:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("property %s: %q is not true or false", name, value)
+		}
+	}
+	return nil
+}
+
+// CheckProps checks the values of the known properties in props, eg.
+// of properties read from configuration.
+func CheckProps(props map[string]string) error {
+	for name, value := range props {
+		if err := checkProp(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// set checks and sets a property of the given kind.
+func (pp Props) set(name string, kind propKind, value string) error {
+	if spec, ok := lookupProp(name); ok && spec.kind != kind &&
+		!(spec.kind == propDuration && kind == propInt) {
+		return fmt.Errorf("property %s: wrong type of value %s", name, value)
+	}
+	if err := checkProp(name, value); err != nil {
+		return err
+	}
+	pp[name] = value
+	return nil
+}
+
+// SetString sets a property to a string.
+func (pp Props) SetString(name, value string) error {
+	return pp.set(name, propString, value)
+}
+
+// SetInt sets a property to an integer, or a number of milliseconds.
+func (pp Props) SetInt(name string, value int64) error {
+	return pp.set(name, propInt, strconv.FormatInt(value, 10))
+}
+
+// SetBool sets a property to "true" or "false".
+func (pp Props) SetBool(name string, value bool) error {
+	return pp.set(name, propBool, strconv.FormatBool(value))
+}
+
+// SetDuration sets a property to a duration in milliseconds, which it
+// must be a whole number of.
+func (pp Props) SetDuration(name string, value time.Duration) error {
+	if value%time.Millisecond != 0 {
+		return fmt.Errorf("property %s: %s is not a whole number of milliseconds", name, value)
+	}
+	return pp.set(name, propDuration, strconv.FormatInt(int64(value/time.Millisecond), 10))
+}
+
+// Set sets a property to a value of any type with a setter, or to the
+// text of an encoding.TextMarshaler, for custom serializations.
+func (pp Props) Set(name string, value interface{}) error {
+	switch vv := value.(type) {
+	case string:
+		return pp.SetString(name, vv)
+	case bool:
+		return pp.SetBool(name, vv)
+	case int:
+		return pp.SetInt(name, int64(vv))
+	case int32:
+		return pp.SetInt(name, int64(vv))
+	case int64:
+		return pp.SetInt(name, vv)
+	case time.Duration:
+		return pp.SetDuration(name, vv)
+	case encoding.TextMarshaler:
+		text, err := vv.MarshalText()
+		if err != nil {
+			return fmt.Errorf("property %s: %w", name, err)
+		}
+		if err := checkProp(name, string(text)); err != nil {
+			return err
+		}
+		pp[name] = string(text)
+		return nil
+	}
+	return fmt.Errorf("property %s: unsupported value type %T", name, value)
+}
+
+// withDefaultProps returns the resource with the client's default
+// properties merged under its own. The caller's resource is left alone.
+func (cc *Client) withDefaultProps(resource Requester) Requester {
+	if len(cc.props) == 0 {
+		return resource
+	}
+	switch rr := resource.(type) {
+	case *Resource:
+		if rr.Payload == nil {
+			return resource
+		}
+		payload := *rr.Payload
+		payload.Props = make(map[string]string, len(cc.props)+len(rr.Payload.Props))
+		for name, value := range cc.props {
+			payload.Props[name] = value
+		}
+		for name, value := range rr.Payload.Props {
+			payload.Props[name] = value
+		}
+		merged := *rr
+		merged.Payload = &payload
+		return &merged
+	case *StreamResource:
+		if rr.Payload == nil {
+			return resource
+		}
+		payload := *rr.Payload
+		payload.Properties = make(map[string]interface{}, len(cc.props)+len(rr.Payload.Properties))
+		for name, value := range cc.props {
+			payload.Properties[name] = value
+		}
+		for name, value := range rr.Payload.Properties {
+			payload.Properties[name] = value
+		}
+		merged := *rr
+		merged.Payload = &payload
+		return &merged
+	}
+	return resource
+}
@@ -0,0 +1,173 @@
+package ksqldb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksqldbapi"
+)
+
+// ContentTypeDelimited is the v2 API's line-delimited response format:
+// a JSON header line (queryId, columnNames, columnTypes) followed by a
+// JSON array per row, without any enclosing array.
+const ContentTypeDelimited = "application/vnd.ksqlapi.delimited.v1"
+
+// DefaultStreamHeaders are the default headers of StreamResources. They
+// ask for the delimited format, which is the simplest to stream; should
+// a server answer in JSON instead, that is read as well.
+var DefaultStreamHeaders = map[string]string{
+	"Content-Type": "application/json; charset=utf-8",
+	"Accept":       ContentTypeDelimited,
+}
+
+// StreamPayload is the JSON body of a query on the v2 /query-stream
+// endpoint.
+type StreamPayload struct {
+	SQL        string                 `json:"sql"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// StreamResource is a push or pull query on the v2 /query-stream
+// endpoint, the modern replacement for /query.
+type StreamResource struct {
+	Payload *StreamPayload
+	Headers map[string]string
+
+	// Timeout, if set, bounds the request, including the reading of its
+	// response, overriding the client's RequestTimeout.
+	Timeout time.Duration
+}
+
+// NewStreamQuery provisions a push or pull query for the /query-stream
+// endpoint.
+func NewStreamQuery(sql string) Requester {
+	return newStreamResource(sql, nil)
+}
+
+// newStreamResource builds a v2 query resource, copying in any
+// properties.
+func newStreamResource(sql string, props map[string]interface{}) *StreamResource {
+	payload := &StreamPayload{SQL: sql}
+	if len(props) > 0 {
+		payload.Properties = make(map[string]interface{}, len(props))
+		for name, value := range props {
+			payload.Properties[name] = value
+		}
+	}
+	return &StreamResource{Payload: payload, Headers: DefaultStreamHeaders}
+}
+
+// MarshalJSON marshals the resource to its payload.
+func (sr *StreamResource) MarshalJSON() ([]byte, error) {
+	return json.Marshal(sr.Payload)
+}
+
+// Request implements Requester.
+func (sr *StreamResource) Request(serverURL *url.URL) (*http.Request, error) {
+	byt, err := sr.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("ksql request: marshaling query: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, ksqldbapi.EndpointRunStreamQuery.On(serverURL).String(), bytes.NewReader(byt))
+	if err != nil {
+		return nil, fmt.Errorf("ksql request: creating HTTP request: %w", err)
+	}
+	for name, value := range sr.Headers {
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
+
+// StreamQuery runs a pull or push query on the v2 /query-stream endpoint
+// and returns an iterator over its rows, as Query does for /query.
+func (cc *Client) StreamQuery(ctx context.Context, sql string, props map[string]interface{}) (*Rows, error) {
+	if cp := cc.probedCapabilities(); cp != nil && !cp.QueryStream {
+		return nil, fmt.Errorf("running ksql query: server %s does not serve %s", cp.Info.Version, ksqldbapi.EndpointRunStreamQuery.Path)
+	}
+	rh, err := cc.do(ctx, newStreamResource(sql, props))
+	if err != nil {
+		return nil, fmt.Errorf("running ksql query: %w", err)
+	}
+	if rh.StatusCode < http.StatusOK || rh.StatusCode >= http.StatusMultipleChoices {
+		byt, _ := rh.ReadAll()
+		return nil, fmt.Errorf("running ksql query: %w", rh.responseError(byt, nil))
+	}
+	return rh.Rows(), nil
+}
+
+// ResponseFormat is the format of a query response.
+type ResponseFormat int
+
+const (
+	// FormatV1 is the JSON array of the v1 /query endpoint, with one
+	// record per line.
+	FormatV1 ResponseFormat = iota
+
+	// FormatV2JSON is the JSON array of the v2 /query-stream endpoint.
+	FormatV2JSON
+
+	// FormatV2Delimited is the line-delimited format of the v2
+	// /query-stream endpoint, see ContentTypeDelimited.
+	FormatV2Delimited
+)
+
+// Format returns the format of the response, from its content type and
+// the endpoint it is from.
+func (rr *Response) Format() ResponseFormat {
+	if rr.Response == nil {
+		return FormatV1
+	}
+	if mediaType, _, err := mime.ParseMediaType(rr.Response.Header.Get("Content-Type")); err == nil && mediaType == ContentTypeDelimited {
+		return FormatV2Delimited
+	}
+	if req := rr.Response.Request; req != nil && req.URL != nil &&
+		strings.HasSuffix(req.URL.Path, ksqldbapi.EndpointRunStreamQuery.Path) {
+		return FormatV2JSON
+	}
+	return FormatV1
+}
+
+// queryHeaderV2 is the header of a v2 /query-stream response.
+type queryHeaderV2 struct {
+	QueryID     string   `json:"queryId"`
+	ColumnNames []string `json:"columnNames"`
+	ColumnTypes []string `json:"columnTypes"`
+}
+
+// columns pairs the header's names and types.
+func (hv queryHeaderV2) columns() []Column {
+	columns := make([]Column, len(hv.ColumnNames))
+	for i, name := range hv.ColumnNames {
+		columns[i].Name = name
+		if i < len(hv.ColumnTypes) {
+			columns[i].Type = hv.ColumnTypes[i]
+		}
+	}
+	return columns
+}
+
+// trimRecordV2 strips the JSON array framing of a v2 /query-stream
+// response in application/json: a "[" opening the array before the
+// header, commas between records, and the "]" closing it after the last
+// record. Before the header has been seen, a leading "[{" is taken to
+// open the array, not a row starting with a STRUCT or MAP.
+func trimRecordV2(byt []byte, beforeHeader bool) []byte {
+	byt = bytes.TrimSpace(bytes.Trim(bytes.TrimSpace(byt), ","))
+	if beforeHeader && bytes.HasPrefix(byt, []byte("[{")) {
+		byt = byt[1:]
+	}
+	if len(byt) > 0 && byt[len(byt)-1] == ']' && !json.Valid(byt) {
+		byt = bytes.TrimSpace(byt[:len(byt)-1])
+	}
+	if bytes.Equal(byt, []byte("]")) || bytes.Equal(byt, []byte("[")) {
+		return nil
+	}
+	return byt
+}
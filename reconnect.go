@@ -0,0 +1,305 @@
+package ksqldb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// ReconnectOptions configures QueryReconnecting. Reconnects back off
+// exponentially while they keep failing, and start over from the
+// initial backoff once rows flow again.
+type ReconnectOptions struct {
+	// InitialBackoff is the wait before the first reconnect. It defaults
+	// to 100 milliseconds.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the wait between reconnects. It defaults to 30
+	// seconds.
+	MaxBackoff time.Duration
+
+	// Multiplier grows the wait after each failed reconnect. It
+	// defaults to 2.
+	Multiplier float64
+
+	// MaxAttempts, if set, is the number of consecutive reconnects
+	// after which the query fails with the last error.
+	MaxAttempts int
+
+	// Retryable decides which errors end the query and which have it
+	// re-issued. It defaults to IsTransient errors and throttling (see
+	// RetryAfter), after which the query waits for the server's
+	// Retry-After if longer than the backoff.
+	Retryable func(error) bool
+
+	// OnReconnect, if set, is called before every reconnect. Unless
+	// resumed, the query is re-issued from scratch, so rows delivered
+	// before the failure may be delivered again: this is where to
+	// prepare for that (see also Dedup).
+	OnReconnect func(ReconnectEvent)
+
+	// Resume re-issues the query with a ROWTIME > checkpoint predicate
+	// (see ksql.AddPredicate), and auto.offset.reset set to earliest
+	// unless given, so that it picks up after the checkpoint rather
+	// than from scratch. The checkpoint is the ROWTIME of the last row
+	// delivered, unless Checkpoints is set. Rows sharing the checkpoint's
+	// ROWTIME but not yet delivered are skipped, and joins cannot be
+	// resumed.
+	//
+	// Current servers leave ROWTIME out of SELECT *: the query must
+	// select it (SELECT *, ROWTIME ...), or the rows carry none and the
+	// query is re-issued from scratch after all, which is logged.
+	Resume bool
+
+	// Checkpoints, if set, supplies the checkpoint to resume from, eg.
+	// the ROWTIME the application has durably processed. It is also
+	// consulted for the first connection.
+	Checkpoints CheckpointSource
+}
+
+// CheckpointSource supplies the ROWTIME, in epoch milliseconds, up to
+// which rows have been processed, or zero if none have.
+type CheckpointSource interface {
+	LastCheckpoint() (int64, error)
+}
+
+// CheckpointFunc adapts a function to a CheckpointSource.
+type CheckpointFunc func() (int64, error)
+
+// LastCheckpoint implements CheckpointSource.
+func (fn CheckpointFunc) LastCheckpoint() (int64, error) {
+	return fn()
+}
+
+// ReconnectEvent describes a reconnect of a push query.
+type ReconnectEvent struct {
+	// Attempt counts the consecutive reconnects, from 1.
+	Attempt int
+	// Err is the error that ended the previous connection.
+	Err error
+	// Wait is the backoff before the query is re-issued.
+	Wait time.Duration
+	// RetryAfter is the wait the server asked for, if Err is throttling;
+	// Wait honors it within the client's MaxRetryAfter.
+	RetryAfter time.Duration
+	// Delivered is the number of rows delivered so far, over all the
+	// connections.
+	Delivered int64
+	// Checkpoint is the ROWTIME the query resumes after, if resumed.
+	Checkpoint int64
+}
+
+// IsTransient reports whether the error is a network failure, such as
+// a reset connection, a stream cut short or gone idle, that re-issuing
+// the request may get past.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, ErrStreamIdle) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// ReconnectingRows iterates over a push query's rows like Rows, but
+// re-issues the query whenever it fails with a retryable error (see
+// ReconnectOptions), so that long-lived EMIT CHANGES consumers survive
+// network failures and server restarts.
+//
+//	rows := client.QueryReconnecting(ctx, "SELECT * FROM pageviews EMIT CHANGES;", nil, opts)
+//	defer rows.Close()
+//	for rows.Next() {
+//		...
+//	}
+type ReconnectingRows struct {
+	client *Client
+	ctx    context.Context
+	cancel context.CancelFunc
+	query  string
+	props  map[string]string
+	opts   ReconnectOptions
+
+	rows      *Rows
+	row       Row
+	err       error
+	attempt   int
+	delivered int64
+	rowtime   int64
+}
+
+// QueryReconnecting runs a push query that reconnects on failure. The
+// query is only issued by the first call to Next, and any error is
+// reported by Err.
+func (cc *Client) QueryReconnecting(ctx context.Context, ksql string, props map[string]string, opts ReconnectOptions) *ReconnectingRows {
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 30 * time.Second
+	}
+	if opts.Multiplier < 1 {
+		opts.Multiplier = 2
+	}
+	if opts.Retryable == nil {
+		opts.Retryable = isRetryable
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &ReconnectingRows{client: cc, ctx: ctx, cancel: cancel, query: ksql, props: props, opts: opts}
+}
+
+// Next advances to the next row, reconnecting as needed. It returns
+// false once the query ends cleanly, fails with an error that is not
+// retryable, runs out of attempts, or is closed.
+func (rr *ReconnectingRows) Next() bool {
+	for rr.err == nil {
+		if rr.rows == nil {
+			if err := rr.connect(); err != nil {
+				rr.fail(err)
+				continue
+			}
+		}
+		if rr.rows.Next() {
+			rr.row = rr.rows.Row()
+			rr.attempt = 0
+			rr.delivered++
+			if rowtime, ok := rowTime(rr.row); ok {
+				rr.rowtime = rowtime
+			}
+			return true
+		}
+		err := rr.rows.Err()
+		rr.rows.Close()
+		rr.rows = nil
+		if err == nil {
+			if rr.ctx.Err() != nil {
+				rr.err = fmt.Errorf("reading rows: %w", rr.ctx.Err())
+			}
+			return false
+		}
+		rr.fail(err)
+	}
+	return false
+}
+
+// connect issues the query, resumed after the checkpoint if any.
+func (rr *ReconnectingRows) connect() error {
+	query, props := rr.query, rr.props
+	checkpoint, err := rr.checkpoint()
+	if err != nil {
+		return err
+	}
+	if checkpoint > 0 {
+		if query, err = ksql.AddPredicate(query, fmt.Sprintf("ROWTIME > %d", checkpoint)); err != nil {
+			return fmt.Errorf("resuming query: %w", err)
+		}
+		props = map[string]string{"auto.offset.reset": "earliest"}
+		for name, value := range rr.props {
+			props[name] = value
+		}
+	}
+	rows, err := rr.client.Query(rr.ctx, query, props)
+	if err != nil {
+		return err
+	}
+	rr.rows = rows
+	return nil
+}
+
+// checkpoint returns the ROWTIME to resume after, or zero.
+func (rr *ReconnectingRows) checkpoint() (int64, error) {
+	if rr.opts.Checkpoints != nil {
+		checkpoint, err := rr.opts.Checkpoints.LastCheckpoint()
+		if err != nil {
+			return 0, fmt.Errorf("resuming query: loading checkpoint: %w", err)
+		}
+		return checkpoint, nil
+	}
+	if rr.opts.Resume {
+		return rr.rowtime, nil
+	}
+	return 0, nil
+}
+
+// fail handles the failure of a connection: the error is kept if it is
+// final, otherwise this waits out the backoff before the next attempt.
+func (rr *ReconnectingRows) fail(err error) {
+	if rr.ctx.Err() != nil || !rr.opts.Retryable(err) {
+		rr.err = err
+		return
+	}
+	rr.attempt++
+	if rr.opts.MaxAttempts > 0 && rr.attempt > rr.opts.MaxAttempts {
+		rr.err = fmt.Errorf("reconnecting after %d attempts: %w", rr.opts.MaxAttempts, err)
+		return
+	}
+
+	wait := rr.opts.InitialBackoff
+	for i := 1; i < rr.attempt && wait < rr.opts.MaxBackoff; i++ {
+		wait = time.Duration(float64(wait) * rr.opts.Multiplier)
+	}
+	if wait > rr.opts.MaxBackoff {
+		wait = rr.opts.MaxBackoff
+	}
+	hint, _ := RetryAfter(err)
+	wait = rr.client.retryWait(wait, hint)
+	if rr.opts.OnReconnect != nil {
+		event := ReconnectEvent{
+			Attempt:    rr.attempt,
+			Err:        err,
+			Wait:       wait,
+			RetryAfter: hint,
+			Delivered:  rr.delivered,
+		}
+		if rr.opts.Resume && rr.opts.Checkpoints == nil {
+			event.Checkpoint = rr.rowtime
+		}
+		rr.opts.OnReconnect(event)
+	}
+	if rr.opts.Resume && rr.opts.Checkpoints == nil && rr.rowtime == 0 && rr.delivered > 0 {
+		rr.client.logger.Log("rows have no ROWTIME to resume after, re-issuing the query from scratch", "query", rr.query)
+	}
+	rr.client.logger.Log("query reconnect", "attempt", rr.attempt, "err", err, "wait", wait)
+
+	timer := rr.client.clock.NewTimer(wait)
+	select {
+	case <-rr.ctx.Done():
+		timer.Stop()
+		rr.err = fmt.Errorf("reconnecting: %w (last error: %v)", rr.ctx.Err(), err)
+	case <-timer.C():
+	}
+}
+
+// Row returns the current row.
+func (rr *ReconnectingRows) Row() Row {
+	return rr.row
+}
+
+// Header returns the current connection's header, if it has arrived.
+func (rr *ReconnectingRows) Header() *Header {
+	if rr.rows == nil {
+		return nil
+	}
+	return rr.rows.Header()
+}
+
+// Err returns the error, if any, that ended the iteration.
+func (rr *ReconnectingRows) Err() error {
+	return rr.err
+}
+
+// Close stops the query, interrupting any backoff. It is safe to call
+// from another goroutine than the one iterating.
+func (rr *ReconnectingRows) Close() error {
+	rr.cancel()
+	return nil
+}
@@ -0,0 +1,137 @@
+package ksqldb_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hews.co/ksqldb"
+	"hews.co/ksqldb/pkg/ksqldbtest"
+)
+
+const ticksSchema = "`SYMBOL` STRING, `ROWTIME` BIGINT"
+
+func TestReconnectingRowsBacksOffAndResumes(t *testing.T) {
+	var calls int
+	server := newFakeServer(t, func(ksql string) (fakeQuery, int) {
+		calls++
+		switch calls {
+		case 1:
+			return fakeQuery{schema: ticksSchema, rows: []string{`["A",100]`}, cut: true}, 0
+		case 2:
+			return fakeQuery{schema: ticksSchema, cut: true}, 0
+		default:
+			return fakeQuery{schema: ticksSchema, rows: []string{`["B",200]`}, push: true}, 0
+		}
+	})
+	clock := ksqldbtest.NewManualClock(time.Unix(0, 0))
+	client := server.client(t, ksqldb.ClientOptions{Clock: clock})
+	holdTerminates(t, server)
+
+	var mu sync.Mutex
+	var events []ksqldb.ReconnectEvent
+	rows := client.QueryReconnecting(context.Background(), "SELECT *, ROWTIME FROM ticks EMIT CHANGES;", nil, ksqldb.ReconnectOptions{
+		InitialBackoff: time.Second,
+		Resume:         true,
+		OnReconnect: func(event ksqldb.ReconnectEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, event)
+		},
+	})
+	defer rows.Close()
+	symbols := make(chan string)
+	go func() {
+		defer close(symbols)
+		for rows.Next() {
+			symbol, _ := rows.Row().Get("SYMBOL")
+			symbols <- symbol.(string)
+		}
+	}()
+
+	if got := <-symbols; got != "A" {
+		t.Fatalf("SYMBOL = %s, want A", got)
+	}
+	// Each reconnect waits out its backoff, doubling while they fail.
+	// The TERMINATE of every failed connection is pending meanwhile.
+	for i, wait := range []time.Duration{time.Second, 2 * time.Second} {
+		waitFor(t, func() bool { return clock.Waiters() == i+2 })
+		clock.Advance(wait - time.Millisecond)
+		if got := len(server.queries()); got != i+1 {
+			t.Fatalf("%d queries sent before the backoff of %v, want %d", got, wait, i+1)
+		}
+		clock.Advance(time.Millisecond)
+		waitFor(t, func() bool { return len(server.queries()) == i+2 })
+	}
+	if got := <-symbols; got != "B" {
+		t.Fatalf("SYMBOL = %s, want B", got)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 {
+		t.Fatalf("%d reconnects, want 2", len(events))
+	}
+	for i, event := range events {
+		if event.Attempt != i+1 || event.Wait != time.Second<<i || event.Checkpoint != 100 || event.Delivered != 1 {
+			t.Errorf("reconnect %d = %+v", i+1, event)
+		}
+	}
+	for _, query := range server.queries()[1:] {
+		if !strings.Contains(query, "ROWTIME > 100") {
+			t.Errorf("resumed query %q does not start after the checkpoint", query)
+		}
+	}
+}
+
+func TestReconnectingRowsStopsOnPermanentError(t *testing.T) {
+	var calls int
+	server := newFakeServer(t, func(ksql string) (fakeQuery, int) {
+		calls++
+		if calls == 1 {
+			return fakeQuery{schema: ticksSchema, rows: []string{`["A",100]`}, cut: true}, 0
+		}
+		return fakeQuery{}, http.StatusBadRequest
+	})
+	clock := ksqldbtest.NewManualClock(time.Unix(0, 0))
+	client := server.client(t, ksqldb.ClientOptions{Clock: clock})
+	holdTerminates(t, server)
+
+	rows := client.QueryReconnecting(context.Background(), "SELECT *, ROWTIME FROM ticks EMIT CHANGES;", nil, ksqldb.ReconnectOptions{
+		InitialBackoff: time.Second,
+	})
+	defer rows.Close()
+	done := make(chan int)
+	go func() {
+		var n int
+		for rows.Next() {
+			n++
+		}
+		done <- n
+	}()
+
+	waitFor(t, func() bool { return clock.Waiters() == 2 })
+	clock.Advance(time.Second)
+	if n := <-done; n != 1 {
+		t.Errorf("%d rows, want 1", n)
+	}
+	if rows.Err() == nil {
+		t.Error("Err() = nil, want the server's error")
+	}
+	// Without Resume, the query is re-issued from scratch.
+	if queries := server.queries(); len(queries) != 2 || queries[1] != queries[0] {
+		t.Errorf("queries = %q, want the same query twice", queries)
+	}
+}
+
+// holdTerminates keeps the server from answering the TERMINATE closing
+// every failed connection until the test ends, so that the timers
+// bounding them are predictably pending on the clock.
+func holdTerminates(t *testing.T, server *fakeServer) {
+	hold := make(chan struct{})
+	server.hold = hold
+	t.Cleanup(func() { close(hold) })
+}
@@ -0,0 +1,253 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// ReplaceStrategy is how ReplacePersistentQuery swaps queries.
+type ReplaceStrategy int
+
+const (
+	// ReplaceInPlace upgrades the query with CREATE OR REPLACE, keeping
+	// its sink, topic and consumer offsets. The server only accepts
+	// compatible changes (eg. new projected columns, not new sources),
+	// and is checked with EXPLAIN beforehand. It is rolled back by
+	// replacing the query with its previous statement again.
+	ReplaceInPlace ReplaceStrategy = iota
+
+	// ReplaceBlueGreen creates the new query alongside the old one, into
+	// a new sink, and only terminates the old one once the new one is
+	// verified. Consumers must move to the new sink. It is rolled back
+	// by terminating and dropping the new query and sink.
+	ReplaceBlueGreen
+)
+
+// ReplaceOptions configures ReplacePersistentQuery.
+type ReplaceOptions struct {
+	Strategy ReplaceStrategy
+
+	// Replaces names the sink written by the old query. It is required
+	// for ReplaceBlueGreen, and defaults to the statement's sink for
+	// ReplaceInPlace.
+	Replaces string
+
+	// Query configures the creation of the new query, eg. with its
+	// properties or an AVRO compatibility pre-check.
+	Query PersistentQueryOptions
+
+	// VerifyTimeout bounds the wait for the new query to be RUNNING, and
+	// the Verify hook. It defaults to two minutes.
+	VerifyTimeout time.Duration
+
+	// PollInterval is the interval at which the new query's state is
+	// polled. It defaults to one second.
+	PollInterval time.Duration
+
+	// Verify, if set, is called once the new query runs, eg. to check
+	// that its sink receives the expected rows. An error rolls back the
+	// replacement.
+	Verify func(ctx context.Context, pq *PersistentQuery) error
+
+	// DropReplaced drops the old sink, but not its topic, once its
+	// queries are terminated by ReplaceBlueGreen.
+	DropReplaced bool
+}
+
+// ReplaceError is returned by ReplacePersistentQuery when a step fails
+// after the new query was created.
+type ReplaceError struct {
+	// Step is the step that failed.
+	Step string
+	Err  error
+
+	// RolledBack is set if the replacement was undone, and RollbackErr
+	// holds the error of the rollback otherwise. Errors of the last
+	// step of ReplaceBlueGreen, once the new query is verified, leave
+	// both queries running and are not rolled back.
+	RolledBack  bool
+	RollbackErr error
+}
+
+// Error implements error.
+func (err *ReplaceError) Error() string {
+	switch {
+	case err.RolledBack:
+		return fmt.Sprintf("replacing query: %s: %v (rolled back)", err.Step, err.Err)
+	case err.RollbackErr != nil:
+		return fmt.Sprintf("replacing query: %s: %v (rollback failed: %v)", err.Step, err.Err, err.RollbackErr)
+	}
+	return fmt.Sprintf("replacing query: %s: %v", err.Step, err.Err)
+}
+
+// Unwrap returns the error of the failed step.
+func (err *ReplaceError) Unwrap() error {
+	return err.Err
+}
+
+// ReplacePersistentQuery replaces a running CREATE STREAM/TABLE AS
+// SELECT query with the given statement, then verifies that the new
+// query runs (and passes the Verify hook), rolling back if it does not:
+//
+//	pq, err := client.ReplacePersistentQuery(ctx,
+//		"CREATE TABLE totals AS SELECT account, SUM(amount) AS total FROM txns GROUP BY account;",
+//		ksqldb.ReplaceOptions{},
+//	)
+//
+// Errors before the new query is created leave everything as it was;
+// later ones are a *ReplaceError telling whether the rollback worked.
+func (cc *Client) ReplacePersistentQuery(ctx context.Context, statement string, opts ReplaceOptions) (*PersistentQuery, error) {
+	if opts.VerifyTimeout <= 0 {
+		opts.VerifyTimeout = 2 * time.Minute
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	ca, err := ksql.ParseCreateAs(statement)
+	if err != nil {
+		return nil, fmt.Errorf("replacing query: %w", err)
+	}
+	if opts.Replaces == "" {
+		if opts.Strategy == ReplaceBlueGreen {
+			return nil, fmt.Errorf("replacing query: blue/green replacement requires the replaced sink")
+		}
+		opts.Replaces = ca.Name
+	}
+	old, err := cc.Describe(ctx, opts.Replaces)
+	if err != nil {
+		return nil, fmt.Errorf("replacing query: %w", err)
+	}
+	if len(old.WriteQueries) == 0 {
+		return nil, fmt.Errorf("replacing query: %s is not written by a query", opts.Replaces)
+	}
+
+	if opts.Strategy == ReplaceBlueGreen {
+		return cc.replaceBlueGreen(ctx, statement, ca, old, opts)
+	}
+	return cc.replaceInPlace(ctx, statement, ca, old, opts)
+}
+
+// replaceInPlace runs the statement as a CREATE OR REPLACE.
+func (cc *Client) replaceInPlace(ctx context.Context, statement string, ca ksql.CreateAs, old *SourceDescription, opts ReplaceOptions) (*PersistentQuery, error) {
+	if ca.IfNotExists {
+		return nil, fmt.Errorf("replacing query: IF NOT EXISTS cannot be replaced in place")
+	}
+	if !cc.casePolicy.Match(ca.Name, old.Name) {
+		return nil, fmt.Errorf("replacing query: in place replacement must write %s, not %s", old.Name, ca.Name)
+	}
+	if len(old.WriteQueries) > 1 {
+		return nil, fmt.Errorf("replacing query: %s is written by %d queries", old.Name, len(old.WriteQueries))
+	}
+	dialect, err := cc.Dialect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("replacing query: %w", err)
+	}
+	if err := dialect.Check(ksql.FeatureCreateOrReplace); err != nil {
+		return nil, fmt.Errorf("replacing query: %w", err)
+	}
+	previous := old.WriteQueries[0]
+	rollback, err := ksql.ParseCreateAs(previous.QueryString)
+	if err != nil {
+		return nil, fmt.Errorf("replacing query: cannot roll back to the statement of %s: %w", previous.ID, err)
+	}
+
+	statement = ca.WithOrReplace(statement)
+	if _, err := cc.Explain(ctx, statement); err != nil {
+		return nil, fmt.Errorf("replacing query: %w", err)
+	}
+	status, err := cc.CreatePersistentQuery(ctx, statement, opts.Query)
+	if err != nil {
+		return nil, fmt.Errorf("replacing query: %w", err)
+	}
+	id := createdQuery(status)
+	if id == "" {
+		id = string(previous.ID)
+	}
+	pq := &PersistentQuery{ID: id, client: cc}
+	cc.logger.Log("replacement query created", "query", id, "strategy", "in_place")
+
+	if step, err := cc.verifyReplacement(ctx, pq, opts); err != nil {
+		rerr := &ReplaceError{Step: step, Err: err}
+		ctx, cancel := cc.rollbackContext(opts)
+		defer cancel()
+		_, rerr.RollbackErr = cc.runStatement(ctx, rollback.WithOrReplace(previous.QueryString), opts.Query.Props)
+		rerr.RolledBack = rerr.RollbackErr == nil
+		cc.logger.Log("query replacement rolled back", "query", id, "err", err, "rollback_err", rerr.RollbackErr)
+		return nil, rerr
+	}
+	return pq, nil
+}
+
+// replaceBlueGreen creates the new query next to the old ones, and
+// terminates those once it is verified.
+func (cc *Client) replaceBlueGreen(ctx context.Context, statement string, ca ksql.CreateAs, old *SourceDescription, opts ReplaceOptions) (*PersistentQuery, error) {
+	if cc.casePolicy.Match(ca.Name, old.Name) {
+		return nil, fmt.Errorf("replacing query: blue/green replacement must write a new sink, not %s", old.Name)
+	}
+	status, err := cc.CreatePersistentQuery(ctx, statement, opts.Query)
+	if err != nil {
+		return nil, fmt.Errorf("replacing query: %w", err)
+	}
+	id := createdQuery(status)
+	if id == "" {
+		return nil, fmt.Errorf("replacing query: no query id in status %q", status.CommandStatus.Message)
+	}
+	pq := &PersistentQuery{ID: id, client: cc}
+	cc.logger.Log("replacement query created", "query", id, "strategy", "blue_green")
+
+	if step, err := cc.verifyReplacement(ctx, pq, opts); err != nil {
+		rerr := &ReplaceError{Step: step, Err: err}
+		ctx, cancel := cc.rollbackContext(opts)
+		defer cancel()
+		rerr.RollbackErr = cc.TerminateQuery(ctx, id)
+		if rerr.RollbackErr == nil {
+			kind := "STREAM"
+			if ca.Table {
+				kind = "TABLE"
+			}
+			_, rerr.RollbackErr = cc.runStatement(ctx, fmt.Sprintf("DROP %s %s;", kind, ca.Name), nil)
+		}
+		rerr.RolledBack = rerr.RollbackErr == nil
+		cc.logger.Log("query replacement rolled back", "query", id, "err", err, "rollback_err", rerr.RollbackErr)
+		return nil, rerr
+	}
+
+	for _, query := range old.WriteQueries {
+		if err := cc.TerminateQuery(ctx, string(query.ID)); err != nil {
+			return pq, &ReplaceError{Step: "terminating replaced queries", Err: err}
+		}
+	}
+	if opts.DropReplaced {
+		statement := fmt.Sprintf("DROP %s %s;", strings.ToUpper(old.Type), cc.ident(old.Name))
+		if _, err := cc.runStatement(ctx, statement, nil); err != nil {
+			return pq, &ReplaceError{Step: "dropping replaced sink", Err: err}
+		}
+	}
+	return pq, nil
+}
+
+// rollbackContext returns the context rollbacks run under: the caller's
+// may be why the replacement failed, so the client's is used.
+func (cc *Client) rollbackContext(opts ReplaceOptions) (context.Context, context.CancelFunc) {
+	return withTimeout(cc.ctx, cc.clock, opts.VerifyTimeout)
+}
+
+// verifyReplacement waits for the new query to run, and calls the
+// Verify hook, returning the step that failed if any.
+func (cc *Client) verifyReplacement(ctx context.Context, pq *PersistentQuery, opts ReplaceOptions) (string, error) {
+	ctx, cancel := withTimeout(ctx, cc.clock, opts.VerifyTimeout)
+	defer cancel()
+	if err := pq.WaitForState(ctx, "RUNNING", opts.PollInterval); err != nil {
+		return "waiting for new query", err
+	}
+	if opts.Verify != nil {
+		if err := opts.Verify(ctx, pq); err != nil {
+			return "verifying new query", err
+		}
+	}
+	return "", nil
+}
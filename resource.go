@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"time"
 
+	"hews.co/ksqldb/pkg/ksql"
 	"hews.co/ksqldb/pkg/ksqldbapi"
 )
 
@@ -27,6 +30,14 @@ type Resource struct {
 	Method     string
 	Headers    map[string]string
 	APIVersion string
+
+	// Timeout, if set, bounds the request, including the reading of its
+	// response, overriding the client's RequestTimeout.
+	Timeout time.Duration
+
+	// kind is the kind of the statement when known ahead, eg. from a
+	// prepared query's template, sparing its classification per request.
+	kind ksql.StatementKind
 }
 
 // Payload represents the JSON body sent as a KSQL statement or query to
@@ -39,27 +50,39 @@ type Payload struct {
 
 // NewStatement provisions a KSQL statement as a Resource.
 func NewStatement(ksql string) Requester {
+	return newResource(&ksqldbapi.EndpointRunStatement, ksql, nil)
+}
+
+// NewQuery provisions a KSQL query (ie, a SELECT statement) as a
+// Resource.
+func NewQuery(ksql string) Requester {
+	return newResource(&ksqldbapi.EndpointRunQuery, ksql, nil)
+}
+
+// newGetResource builds a v1 resource for the GET endpoints, which take
+// no payload.
+func newGetResource(endpoint *ksqldbapi.Endpoint) *Resource {
 	return &Resource{
-		Payload: &Payload{
-			Ksql:  ksql,
-			Props: make(map[string]string),
-		},
-		Endpoint:   &ksqldbapi.EndpointRunStatement,
-		Method:     http.MethodPost,
+		Endpoint:   endpoint,
+		Method:     http.MethodGet,
 		Headers:    DefaultHeaders,
 		APIVersion: "v1",
 	}
 }
 
-// NewQuery provisions a KSQL query (ie, a SELECT statement) as a
-// Resource.
-func NewQuery(ksql string) Requester {
+// newResource builds the v1 resource shared by statements and queries,
+// copying in any streams properties.
+func newResource(endpoint *ksqldbapi.Endpoint, ksql string, props map[string]string) *Resource {
+	payload := &Payload{
+		Ksql:  ksql,
+		Props: make(map[string]string, len(props)),
+	}
+	for name, value := range props {
+		payload.Props[name] = value
+	}
 	return &Resource{
-		Payload: &Payload{
-			Ksql:  ksql,
-			Props: make(map[string]string),
-		},
-		Endpoint:   &ksqldbapi.EndpointRunQuery,
+		Payload:    payload,
+		Endpoint:   endpoint,
 		Method:     http.MethodPost,
 		Headers:    DefaultHeaders,
 		APIVersion: "v1",
@@ -81,11 +104,15 @@ type Requester interface {
 // TODO: [PJ] this will take into account the request, etc. As needed we
 // can also add configuration that would get activated here.
 func createRequest(method string, url string, payload *Payload, headers map[string]string) (*http.Request, error) {
-	byt, err := json.Marshal(payload)
-	if err != nil {
-		return nil, fmt.Errorf("ksql request: unmarshaling query: %w", err)
+	var body io.Reader
+	if payload != nil {
+		byt, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("ksql request: unmarshaling query: %w", err)
+		}
+		body = bytes.NewBuffer(byt)
 	}
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(byt))
+	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return nil, fmt.Errorf("ksql request: creating HTTP request: %w", err)
 	}
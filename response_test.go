@@ -0,0 +1,96 @@
+package ksqldb
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testStreamBody = `{"queryId":"q1","columnNames":["V"],"columnTypes":["STRING"]}
+["aaaaaaaaaaaaaaaa"]
+
+["bbbbbbbbbbbbbbbb"]
+["cccccccccccccccc"]
+`
+
+func newTestResponse(body string) *Response {
+	rr := NewResponse(context.Background(), &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/vnd.ksqlapi.delimited.v1"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	})
+	// A small buffer, so that the scanner reuses it between records.
+	rr.readBuffer = 32
+	return rr
+}
+
+func TestReadStreamingRecordsAreCopies(t *testing.T) {
+	rr := newTestResponse(testStreamBody)
+	var kept [][]byte
+	if err := rr.ReadStreaming(func(byt []byte) error {
+		kept = append(kept, byt)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	assertRecords(t, kept)
+}
+
+func TestReadStreamingZeroCopy(t *testing.T) {
+	rr := newTestResponse(testStreamBody)
+	var kept [][]byte
+	if err := rr.ReadStreamingZeroCopy(func(byt []byte) error {
+		kept = append(kept, append([]byte(nil), byt...))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	assertRecords(t, kept)
+	if got := rr.QueryID(); got != "q1" {
+		t.Errorf("QueryID() = %q, want q1", got)
+	}
+}
+
+func TestReadStreamingZeroCopyHandlerError(t *testing.T) {
+	rr := newTestResponse(testStreamBody)
+	stop := errors.New("stop")
+	calls := 0
+	err := rr.ReadStreamingZeroCopy(func([]byte) error {
+		calls++
+		return stop
+	})
+	if err != stop {
+		t.Errorf("ReadStreamingZeroCopy() = %v, want %v", err, stop)
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+	if rr.Context.Err() == nil {
+		t.Error("response not canceled")
+	}
+}
+
+func TestReadStreamingZeroCopyAfterClose(t *testing.T) {
+	rr := newTestResponse(testStreamBody)
+	rr.Close()
+	err := rr.ReadStreamingZeroCopy(func([]byte) error { return nil })
+	if !errors.Is(err, ErrResponseClosed) {
+		t.Errorf("ReadStreamingZeroCopy() = %v, want %v", err, ErrResponseClosed)
+	}
+}
+
+func assertRecords(t *testing.T, kept [][]byte) {
+	t.Helper()
+	want := strings.Split(strings.Replace(strings.TrimSpace(testStreamBody), "\n\n", "\n", 1), "\n")
+	if len(kept) != len(want) {
+		t.Fatalf("got %d records, want %d", len(kept), len(want))
+	}
+	for i, byt := range kept {
+		if string(byt) != want[i] {
+			t.Errorf("record %d = %s, want %s", i, byt, want[i])
+		}
+	}
+}
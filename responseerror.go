@@ -0,0 +1,131 @@
+package ksqldb
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxPreview is the number of bytes of a response body a ResponseError
+// previews.
+const maxPreview = 512
+
+// ResponseError is an unexpected response from the server: a status
+// other than 2xx, or a body that could not be decoded (an HTML error
+// page from a proxy, truncated JSON). It tells where the response came
+// from, and previews its body.
+type ResponseError struct {
+	StatusCode int
+	Status     string
+
+	// Endpoint is the method and path of the request, eg. "POST /ksql".
+	Endpoint    string
+	ContentType string
+
+	// Preview is the start of the body, with its whitespace collapsed
+	// and control characters and invalid UTF-8 replaced, truncated to a
+	// few hundred bytes.
+	Preview string
+
+	// RetryAfter is the wait the Retry-After header of a 429 or 503
+	// response to the client's request asked for, if any (see
+	// RetryAfter).
+	RetryAfter time.Duration
+
+	// Err is the decoding error of a 2xx response, or the *Error parsed
+	// from the body of a failed one, if any.
+	Err error
+}
+
+// newResponseError describes an unexpected response, with the body read
+// from it. resp may be nil, eg. in a Response built by hand.
+func newResponseError(resp *http.Response, body []byte, err error) *ResponseError {
+	re := &ResponseError{Preview: previewBody(body), Err: err}
+	if resp == nil {
+		return re
+	}
+	if err == nil && failed(resp) {
+		if ke := parseError(body, resp.StatusCode); ke != nil {
+			re.Err = ke
+		}
+	}
+	re.StatusCode = resp.StatusCode
+	re.Status = resp.Status
+	re.ContentType = resp.Header.Get("Content-Type")
+	if req := resp.Request; req != nil && req.URL != nil {
+		re.Endpoint = req.Method + " " + req.URL.Path
+	}
+	return re
+}
+
+// responseError describes the response as unexpected, see
+// newResponseError, with the Retry-After hint read when it arrived.
+func (rr *Response) responseError(body []byte, err error) *ResponseError {
+	re := newResponseError(rr.Response, body, err)
+	re.RetryAfter = rr.retryAfter
+	return re
+}
+
+// Error implements error.
+func (re *ResponseError) Error() string {
+	var sb strings.Builder
+	if re.Status != "" {
+		sb.WriteString(re.Status)
+	} else {
+		fmt.Fprintf(&sb, "status %d", re.StatusCode)
+	}
+	if re.Endpoint != "" {
+		fmt.Fprintf(&sb, " from %s", re.Endpoint)
+	}
+	if re.Err != nil {
+		fmt.Fprintf(&sb, ": %v", re.Err)
+	}
+	if re.ContentType != "" && !strings.Contains(re.ContentType, "json") {
+		fmt.Fprintf(&sb, " (%s)", re.ContentType)
+	}
+	if _, ok := re.Err.(*Error); ok {
+		// The body is the error, already told.
+		return sb.String()
+	}
+	if re.Preview != "" {
+		fmt.Fprintf(&sb, ": %s", re.Preview)
+	}
+	return sb.String()
+}
+
+// Unwrap returns the decoding error or *Error, if any.
+func (re *ResponseError) Unwrap() error {
+	return re.Err
+}
+
+// previewBody renders the start of a body for an error: whitespace runs
+// become single spaces, control characters and invalid UTF-8 become
+// U+FFFD, and it is cut at maxPreview bytes, on a character boundary.
+func previewBody(body []byte) string {
+	var sb strings.Builder
+	space := false
+	for len(body) > 0 {
+		r, size := utf8.DecodeRune(body)
+		body = body[size:]
+		switch {
+		case unicode.IsSpace(r):
+			space = sb.Len() > 0
+			continue
+		case r == utf8.RuneError || unicode.IsControl(r):
+			r = utf8.RuneError
+		}
+		if space {
+			sb.WriteByte(' ')
+			space = false
+		}
+		if sb.Len()+utf8.RuneLen(r) > maxPreview {
+			sb.WriteString("...")
+			break
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,273 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// RollupOptions configure a Rollup.
+type RollupOptions struct {
+	// Window is the size of the tumbling windows.
+	Window time.Duration
+
+	// KeyColumn, if set, keeps an aggregate per value of the column,
+	// as fmt.Sprint renders it. Otherwise rows are aggregated together.
+	KeyColumn string
+
+	// ValueColumn, if set, is the numeric column summed, and of which the
+	// minimum and maximum are kept. Otherwise rows are only counted.
+	ValueColumn string
+
+	// TimeColumn is the column windowing rows, in epoch milliseconds or
+	// decoded. It defaults to ROWTIME; rows without it are windowed by
+	// the time they are added.
+	TimeColumn string
+
+	// Grace is how long a window stays open past its end, for rows
+	// arriving out of order. Later rows are dropped (see Rollup.Late).
+	Grace time.Duration
+
+	// Clock decides the time rows without a time column are added at,
+	// and when Run closes windows. It defaults to SystemClock.
+	Clock Clock
+}
+
+// Aggregate is the rollup of the rows of a key over a window.
+type Aggregate struct {
+	Key         string
+	WindowStart time.Time
+	WindowEnd   time.Time
+
+	// Count is the number of rows, and Values the number of those whose
+	// value column is not NULL, of which Sum, Min and Max are.
+	Count  int64
+	Values int64
+	Sum    float64
+	Min    float64
+	Max    float64
+}
+
+// Rollup aggregates rows over tumbling windows on the client, for
+// lightweight rollups where creating a persistent query on the server is
+// not permitted. Windows are closed, and their aggregates emitted, once
+// rows past their end and grace arrive, or the clock passes it (see
+// Run). A Rollup is not safe for concurrent use.
+type Rollup struct {
+	opts RollupOptions
+
+	open map[rollupKey]*Aggregate
+	late int64
+
+	// watermark is the latest event time seen, and added the clock's
+	// time when the last row was added.
+	watermark time.Time
+	added     time.Time
+}
+
+// rollupKey identifies an open window of a key.
+type rollupKey struct {
+	key   string
+	start int64
+}
+
+// NewRollup creates a Rollup.
+func NewRollup(opts RollupOptions) (*Rollup, error) {
+	if opts.Window <= 0 {
+		return nil, fmt.Errorf("creating rollup: window must be positive, got %s", opts.Window)
+	}
+	if opts.TimeColumn == "" {
+		opts.TimeColumn = "ROWTIME"
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	return &Rollup{opts: opts, open: make(map[rollupKey]*Aggregate)}, nil
+}
+
+// Add aggregates a row, returning the aggregates of the windows it
+// closed, if any.
+func (ru *Rollup) Add(row Row) ([]Aggregate, error) {
+	t, err := ru.rowTime(row)
+	if err != nil {
+		return nil, fmt.Errorf("rolling up row: %w", err)
+	}
+	value, hasValue, err := ru.rowValue(row)
+	if err != nil {
+		return nil, fmt.Errorf("rolling up row: %w", err)
+	}
+	// Windows are aligned on the epoch, as the server's are.
+	nanos := t.UnixNano()
+	start := time.Unix(0, nanos-nanos%int64(ru.opts.Window)).UTC()
+	if !ru.watermark.IsZero() && !start.Add(ru.opts.Window+ru.opts.Grace).After(ru.watermark) {
+		ru.late++
+		return nil, nil
+	}
+
+	var key string
+	if ru.opts.KeyColumn != "" {
+		kv, _ := row.Get(ru.opts.KeyColumn)
+		key = fmt.Sprint(kv)
+	}
+	rk := rollupKey{key: key, start: start.UnixNano()}
+	agg, ok := ru.open[rk]
+	if !ok {
+		agg = &Aggregate{Key: key, WindowStart: start, WindowEnd: start.Add(ru.opts.Window)}
+		ru.open[rk] = agg
+	}
+	agg.Count++
+	if hasValue {
+		agg.Values++
+		if agg.Values == 1 || value < agg.Min {
+			agg.Min = value
+		}
+		if agg.Values == 1 || value > agg.Max {
+			agg.Max = value
+		}
+		agg.Sum += value
+	}
+
+	ru.added = ru.opts.Clock.Now()
+	if t.After(ru.watermark) {
+		ru.watermark = t
+	}
+	return ru.Expire(ru.watermark), nil
+}
+
+// Expire closes the windows whose end and grace are not after now, in
+// event time, returning their aggregates, oldest first. Rows of the
+// windows closed are late from then on.
+func (ru *Rollup) Expire(now time.Time) []Aggregate {
+	var closed []Aggregate
+	for rk, agg := range ru.open {
+		if !agg.WindowEnd.Add(ru.opts.Grace).After(now) {
+			closed = append(closed, *agg)
+			delete(ru.open, rk)
+		}
+	}
+	if now.After(ru.watermark) {
+		ru.watermark = now
+	}
+	sortAggregates(closed)
+	return closed
+}
+
+// Flush closes every open window, returning their aggregates, oldest
+// first.
+func (ru *Rollup) Flush() []Aggregate {
+	closed := make([]Aggregate, 0, len(ru.open))
+	for rk, agg := range ru.open {
+		closed = append(closed, *agg)
+		delete(ru.open, rk)
+	}
+	sortAggregates(closed)
+	return closed
+}
+
+// Late returns the number of rows dropped for arriving after their
+// window closed.
+func (ru *Rollup) Late() int64 {
+	return ru.late
+}
+
+// Run aggregates the rows of a subscription, passing the aggregates of
+// the windows closed to emit, until the subscription ends or ctx is
+// done. Windows are also closed while the subscription is quiet, as if
+// event time went on with the clock from the last row, so that the last
+// windows still report; rows that keep arriving, even far behind the
+// clock (eg. replayed from the earliest offset), are windowed by their
+// own time alone. The open windows are flushed when the subscription
+// ends.
+//
+// It returns the subscription's error, emit's, or ctx's.
+func (ru *Rollup) Run(ctx context.Context, sub *Subscription, emit func(Aggregate) error) error {
+	ticker := ru.opts.Clock.NewTicker(ru.opts.Window)
+	defer ticker.Stop()
+	emitAll := func(aggs []Aggregate) error {
+		for _, agg := range aggs {
+			if err := emit(agg); err != nil {
+				return fmt.Errorf("emitting aggregate: %w", err)
+			}
+		}
+		return nil
+	}
+	for {
+		select {
+		case row, ok := <-sub.C:
+			if !ok {
+				if err := emitAll(ru.Flush()); err != nil {
+					return err
+				}
+				return sub.Err()
+			}
+			closed, err := ru.Add(row)
+			if err != nil {
+				return err
+			}
+			if err := emitAll(closed); err != nil {
+				return err
+			}
+		case now := <-ticker.C():
+			if err := emitAll(ru.Expire(ru.idleWatermark(now))); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// idleWatermark estimates the event time at the clock's time now: the
+// watermark, advanced by the time since the last row was added. It is
+// zero before any row.
+func (ru *Rollup) idleWatermark(now time.Time) time.Time {
+	if ru.watermark.IsZero() {
+		return time.Time{}
+	}
+	if idle := now.Sub(ru.added); idle > 0 {
+		return ru.watermark.Add(idle)
+	}
+	return ru.watermark
+}
+
+// rowTime returns the time a row is windowed by.
+func (ru *Rollup) rowTime(row Row) (time.Time, error) {
+	if _, ok := row.Get(ru.opts.TimeColumn); !ok {
+		return ru.opts.Clock.Now(), nil
+	}
+	return row.Time(ru.opts.TimeColumn, ksql.TimestampFormat{})
+}
+
+// rowValue returns the value of the row's value column, if set and not
+// NULL.
+func (ru *Rollup) rowValue(row Row) (float64, bool, error) {
+	if ru.opts.ValueColumn == "" {
+		return 0, false, nil
+	}
+	value, ok := row.Get(ru.opts.ValueColumn)
+	if !ok {
+		return 0, false, fmt.Errorf("no column %s", ru.opts.ValueColumn)
+	}
+	if value == nil {
+		return 0, false, nil
+	}
+	f, err := strconv.ParseFloat(numberText(value), 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("column %s is not a number: %w", ru.opts.ValueColumn, err)
+	}
+	return f, true, nil
+}
+
+// sortAggregates sorts aggregates by window, then key.
+func sortAggregates(aggs []Aggregate) {
+	sort.Slice(aggs, func(i, j int) bool {
+		if !aggs[i].WindowStart.Equal(aggs[j].WindowStart) {
+			return aggs[i].WindowStart.Before(aggs[j].WindowStart)
+		}
+		return aggs[i].Key < aggs[j].Key
+	})
+}
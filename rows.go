@@ -0,0 +1,731 @@
+package ksqldb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+	"hews.co/ksqldb/pkg/ksqldbapi"
+)
+
+// Column is a named, typed column of a query result. Type is the KSQL
+// logical type as reported by the server, eg. BIGINT or STRUCT<...>.
+// Key is set for the columns read from the record key, and Header for
+// those read from its headers: HEADERS columns, and HEADER('key')
+// columns, of which HeaderKey is the key. The v2 /query-stream endpoint
+// does not tell header columns apart.
+type Column struct {
+	Name      string
+	Type      string
+	Key       bool
+	Header    bool
+	HeaderKey string
+}
+
+// Header is the metadata sent by the server ahead of a query's rows.
+type Header struct {
+	QueryID string
+	Columns []Column
+}
+
+// ColumnNames returns the names of the columns.
+func (hh *Header) ColumnNames() []string {
+	names := make([]string, len(hh.Columns))
+	for i, col := range hh.Columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// ColumnTypes returns the KSQL types of the columns, eg. BIGINT or
+// STRUCT<`A` STRING>.
+func (hh *Header) ColumnTypes() []string {
+	types := make([]string, len(hh.Columns))
+	for i, col := range hh.Columns {
+		types[i] = col.Type
+	}
+	return types
+}
+
+// Row is a single decoded result row, with values in column order.
+// Tombstone is set for table changelog rows that delete their key.
+type Row struct {
+	Columns   []Column
+	Values    []interface{}
+	Tombstone bool
+
+	policy ksql.CasePolicy
+}
+
+// Get returns the value of the named column. An exact match wins;
+// otherwise the name is matched under the client's case policy, so that
+// with ksql.UpperCase "accountId" finds the column ACCOUNTID.
+func (row Row) Get(name string) (interface{}, bool) {
+	for i, col := range row.Columns {
+		if col.Name == name && i < len(row.Values) {
+			return row.Values[i], true
+		}
+	}
+	for i, col := range row.Columns {
+		if row.policy.Match(name, col.Name) && i < len(row.Values) {
+			return row.Values[i], true
+		}
+	}
+	return nil, false
+}
+
+// Key returns the values of the row's key columns, in column order, or
+// nil if the schema designates none.
+func (row Row) Key() []interface{} {
+	var key []interface{}
+	for i, col := range row.Columns {
+		if col.Key && i < len(row.Values) {
+			key = append(key, row.Values[i])
+		}
+	}
+	return key
+}
+
+// Map returns the row as a map from column name to value.
+func (row Row) Map() map[string]interface{} {
+	mm := make(map[string]interface{}, len(row.Columns))
+	for i, col := range row.Columns {
+		if i < len(row.Values) {
+			mm[col.Name] = row.Values[i]
+		}
+	}
+	return mm
+}
+
+// Time returns the value of the named column as a time. Strings are
+// parsed in the format, eg. that of the source's TIMESTAMP_FORMAT (see
+// SourceDescription.TimestampFormat), and numbers are read as epoch
+// milliseconds, as BIGINT timestamp columns and ROWTIME are. Times
+// decoded already (see DecodeOptions.Temporal) are returned as they are.
+// NULL yields the zero time.
+func (row Row) Time(name string, format ksql.TimestampFormat) (time.Time, error) {
+	value, ok := row.Get(name)
+	if !ok {
+		return time.Time{}, fmt.Errorf("reading time: no column %s", name)
+	}
+	switch vv := value.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return vv, nil
+	case string:
+		if format.Layout() == "" {
+			return time.Time{}, fmt.Errorf("reading time from column %s: no format", name)
+		}
+		t, err := format.Parse(vv)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("reading time from column %s: %w", name, err)
+		}
+		return t, nil
+	case float64:
+		return time.Unix(0, int64(vv)*int64(time.Millisecond)).UTC(), nil
+	case int64:
+		return time.Unix(0, vv*int64(time.Millisecond)).UTC(), nil
+	case json.Number:
+		ms, err := vv.Int64()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("reading time from column %s: %w", name, err)
+		}
+		return time.Unix(0, ms*int64(time.Millisecond)).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("reading time from column %s: unexpected %T", name, value)
+}
+
+// rowTime returns the row's ROWTIME, in epoch milliseconds, if it has
+// one.
+func rowTime(row Row) (int64, bool) {
+	value, ok := row.Get("ROWTIME")
+	if !ok {
+		return 0, false
+	}
+	switch vv := value.(type) {
+	case float64:
+		return int64(vv), true
+	case int64:
+		return vv, true
+	}
+	return 0, false
+}
+
+// queryRecordV1 is a single element of the v1 /query response array.
+type queryRecordV1 struct {
+	Header *struct {
+		QueryID string `json:"queryId"`
+		Schema  string `json:"schema"`
+	} `json:"header"`
+	Row *struct {
+		Columns   []json.RawMessage `json:"columns"`
+		Tombstone bool              `json:"tombstone"`
+	} `json:"row"`
+	FinalMessage string `json:"finalMessage"`
+}
+
+// parseHeader parses a header record, in any format, or returns nil if
+// the line is not one.
+func parseHeader(line []byte) *Header {
+	if !bytes.Contains(line, []byte(`"queryId"`)) && !bytes.Contains(line, []byte(`"header"`)) {
+		return nil
+	}
+	var record struct {
+		Header *struct {
+			QueryID string `json:"queryId"`
+			Schema  string `json:"schema"`
+		} `json:"header"`
+		queryHeaderV2
+	}
+	if err := json.Unmarshal(trimRecordV1(line), &record); err != nil {
+		return nil
+	}
+	switch {
+	case record.Header != nil:
+		return &Header{QueryID: record.Header.QueryID, Columns: parseSchemaV1(record.Header.Schema)}
+	case record.QueryID != "" || record.ColumnNames != nil:
+		return &Header{QueryID: record.QueryID, Columns: record.columns()}
+	}
+	return nil
+}
+
+// trimRecordV1 strips the JSON array framing the v1 /query endpoint
+// wraps around its records: a leading "[" on the first, and a leading or
+// trailing "," or "]" on the others, depending on how they are split.
+func trimRecordV1(byt []byte) []byte {
+	byt = bytes.TrimSpace(byt)
+	byt = bytes.TrimPrefix(byt, []byte("["))
+	byt = bytes.TrimSpace(bytes.TrimLeft(byt, ","))
+	for len(byt) > 0 && (byt[len(byt)-1] == ',' || byt[len(byt)-1] == ']') {
+		byt = bytes.TrimSpace(byt[:len(byt)-1])
+	}
+	return byt
+}
+
+// parseSchemaV1 parses the header schema of the v1 /query endpoint, eg.
+// "`ID` STRING KEY, `AMOUNT` BIGINT, `TRACE` BYTES HEADER('trace')",
+// into columns.
+func parseSchemaV1(schema string) []Column {
+	var columns []Column
+	for _, def := range splitTopLevel(schema, ',') {
+		def = strings.TrimSpace(def)
+		if def == "" {
+			continue
+		}
+		name, typ := splitColumnDef(def)
+		col := Column{Name: name}
+		switch {
+		case strings.HasSuffix(typ, " KEY"):
+			col.Key = true
+			typ = strings.TrimSuffix(typ, " KEY")
+		case strings.HasSuffix(typ, " HEADERS"):
+			col.Header = true
+			typ = strings.TrimSuffix(typ, " HEADERS")
+		default:
+			if m := headerConstraint.FindStringSubmatchIndex(typ); m != nil {
+				col.Header = true
+				col.HeaderKey = strings.ReplaceAll(typ[m[2]:m[3]], "''", "'")
+				typ = typ[:m[0]]
+			}
+		}
+		col.Type = strings.TrimSpace(typ)
+		columns = append(columns, col)
+	}
+	return columns
+}
+
+// headerConstraint matches the HEADER('key') a v1 schema appends to the
+// type of a column holding a single record header.
+var headerConstraint = regexp.MustCompile(`\s+HEADER\s*\(\s*'((?:[^']|'')*)'\s*\)$`)
+
+// splitColumnDef splits the definition of a column or STRUCT field, eg.
+// "`ID` STRING KEY", into its unquoted name and the rest.
+func splitColumnDef(def string) (name, typ string) {
+	def = strings.TrimSpace(def)
+	if strings.HasPrefix(def, "`") {
+		end := strings.Index(def[1:], "`")
+		if end < 0 {
+			return strings.Trim(def, "`"), ""
+		}
+		name, typ = def[1:end+1], def[end+2:]
+	} else if idx := strings.IndexByte(def, ' '); idx >= 0 {
+		name, typ = def[:idx], def[idx+1:]
+	} else {
+		name = def
+	}
+	return name, strings.TrimSpace(typ)
+}
+
+// splitTopLevel splits s on sep, ignoring separators nested in angle
+// brackets, parentheses or backtick-quoted identifiers.
+func splitTopLevel(s string, sep byte) []string {
+	var (
+		parts  []string
+		depth  int
+		quoted bool
+		start  int
+	)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '`':
+			quoted = !quoted
+		case quoted:
+		case c == '<' || c == '(':
+			depth++
+		case c == '>' || c == ')':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Rows is an iterator over the rows of a query response. It consumes
+// the response's data and error channels, decoding the header and each
+// row as they arrive:
+//
+//	rows, err := client.Query(ctx, "SELECT * FROM transactions;", nil)
+//	...
+//	defer rows.Close()
+//	for rows.Next() {
+//		row := rows.Row()
+//		...
+//	}
+//	if err := rows.Err(); err != nil {
+//		...
+//	}
+type Rows struct {
+	resp    *Response
+	format  ResponseFormat
+	dataCh  <-chan []byte
+	errCh   <-chan error
+	pending [][]byte
+	done    bool
+
+	header *Header
+	row    Row
+	err    error
+
+	verify       bool
+	verification StreamVerification
+
+	filters    []func(Row) (bool, error)
+	transforms []columnTransform
+	lag        LagEstimator
+	rowNum     int64
+
+	decodeOpts   DecodeOptions
+	mapper       *rowMapper
+	warnings     []*DecodeError
+	warningCount int64
+
+	progress *streamProgress
+}
+
+// StreamVerification summarizes the rows a query transferred, for
+// pipelines that need to check a bounded query arrived intact: the row
+// and byte counts, and a rolling CRC-64 over each row's raw columns in
+// order of arrival. Complete is set only if the stream ended cleanly.
+type StreamVerification struct {
+	Rows     int64
+	Bytes    int64
+	Checksum uint64
+	Complete bool
+}
+
+// verificationTable is the CRC-64 table used by StreamVerification.
+var verificationTable = crc64.MakeTable(crc64.ECMA)
+
+// Verify enables verification for the rows, which must be called before
+// the first call to Next. It returns the rows, for chaining.
+func (rs *Rows) Verify() *Rows {
+	rs.verify = true
+	return rs
+}
+
+// Filter skips the rows for which fn returns false; an error from it
+// ends the iteration. Filters added by several calls must all pass. It
+// returns the rows, for chaining.
+func (rs *Rows) Filter(fn func(Row) (bool, error)) *Rows {
+	rs.filters = append(rs.filters, fn)
+	return rs
+}
+
+// Verification returns the verification summary so far; once Next has
+// returned false it is final.
+func (rs *Rows) Verification() StreamVerification {
+	vv := rs.verification
+	vv.Complete = rs.done && rs.err == nil && len(rs.pending) == 0
+	return vv
+}
+
+// track adds a row's raw columns to the verification summary.
+func (rs *Rows) track(columns []json.RawMessage) {
+	if !rs.verify {
+		return
+	}
+	rs.verification.Rows++
+	for i, raw := range columns {
+		if i > 0 {
+			rs.verification.Checksum = crc64.Update(rs.verification.Checksum, verificationTable, []byte{','})
+		}
+		rs.verification.Checksum = crc64.Update(rs.verification.Checksum, verificationTable, raw)
+		rs.verification.Bytes += int64(len(raw))
+	}
+	rs.verification.Checksum = crc64.Update(rs.verification.Checksum, verificationTable, []byte{'\n'})
+}
+
+// Rows returns an iterator over the response's rows. Like Read, it
+// starts reading the response, so only one reader may be used.
+func (rr *Response) Rows() *Rows {
+	dataCh, errCh := rr.Read()
+	rs := &Rows{resp: rr, dataCh: dataCh, errCh: errCh, decodeOpts: rr.decodeOpts, format: rr.Format()}
+	rs.lag.Clock = rr.clock
+	if rr.progress > 0 && rr.logger != nil {
+		rs.progress = newStreamProgress(rr.Context, rr.clock, rr.logger, rr.progress)
+	}
+	return rs
+}
+
+// Next advances to the next row, returning false when the response is
+// exhausted or failed (see Err). The header is consumed along the way.
+func (rs *Rows) Next() bool {
+	for {
+		if len(rs.pending) > 0 {
+			byt := rs.pending[0]
+			rs.pending = rs.pending[1:]
+			if rs.consume(byt) {
+				return true
+			}
+			continue
+		}
+		if rs.done || rs.err != nil {
+			rs.stopProgress()
+			return false
+		}
+		select {
+		case byt, ok := <-rs.dataCh:
+			if !ok {
+				// The error was queued before the data channel closed.
+				rs.end(<-rs.errCh)
+				continue
+			}
+			if rs.consume(byt) {
+				return true
+			}
+		case err := <-rs.errCh:
+			rs.end(err)
+		}
+	}
+}
+
+// end ends the reading on the response's error: as in ReadStreaming,
+// the response is canceled to guarantee the data channel closes, and
+// whatever was left in it held on to.
+func (rs *Rows) end(err error) {
+	rs.resp.Cancel()
+	rs.resp.drainRecords(rs.dataCh, func(byt []byte) {
+		rs.pending = append(rs.pending, byt)
+	})
+	rs.done = true
+	if err != nil && !errors.Is(err, io.EOF) {
+		rs.err = fmt.Errorf("reading rows: %w", err)
+	}
+}
+
+// consume decodes a single record, reporting whether it was a row.
+func (rs *Rows) consume(byt []byte) bool {
+	size := len(byt)
+	if rs.err != nil {
+		return false
+	}
+	rec, err := rs.parseRecord(byt)
+	if err != nil {
+		decErr := newDecodeError(bytes.TrimSpace(byt), err)
+		decErr.Row = rs.rowNum + 1
+		rs.err = fmt.Errorf("reading rows: %w", decErr)
+		return false
+	}
+	switch {
+	case rec.header != nil:
+		rs.header = rec.header
+		if rs.progress != nil {
+			rs.progress.setQueryID(rec.header.QueryID)
+			rs.progress.record(size, 0, false)
+		}
+		return false
+	case rec.isRow:
+		rs.rowNum++
+		rs.track(rec.columns)
+		var columns []Column
+		if rs.header != nil {
+			columns = rs.header.Columns
+		}
+		raws := rec.columns
+		if len(raws) > len(columns) && rs.decodeOpts.Mode != DecodeDefault {
+			decErr := newDecodeError(raws[len(columns)], fmt.Errorf("%d values for %d columns", len(raws), len(columns)))
+			decErr.Row = rs.rowNum
+			if rs.decodeOpts.Mode == DecodeStrict {
+				rs.err = fmt.Errorf("reading rows: %w", decErr)
+				return false
+			}
+			rs.warn(decErr)
+			raws = raws[:len(columns)]
+		}
+		values := make([]interface{}, len(raws))
+		for i, raw := range raws {
+			typ, name := "", fmt.Sprint(i)
+			if i < len(columns) {
+				typ, name = columns[i].Type, columns[i].Name
+			}
+			value, err := decodeColumn(raw, typ, rs.decodeOpts)
+			if err == nil && i < len(columns) && columns[i].HeaderKey != "" {
+				value = headerValue(value, rs.decodeOpts.HeaderValues)
+			}
+			if err != nil {
+				decErr := newDecodeError(raw, err)
+				decErr.Row, decErr.Column, decErr.Type = rs.rowNum, name, typ
+				if rs.decodeOpts.Mode != DecodeLenient {
+					rs.err = fmt.Errorf("reading rows: %w", decErr)
+					return false
+				}
+				rs.warn(decErr)
+				value = nil
+			}
+			values[i] = value
+		}
+		rs.row = Row{Columns: columns, Values: values, Tombstone: rec.tombstone, policy: rs.resp.casePolicy}
+		rowtime, hasRowtime := rowTime(rs.row)
+		if hasRowtime {
+			rs.lag.Observe(rowtime)
+		}
+		if rs.progress != nil {
+			rs.progress.record(size, rowtime, true)
+		}
+		if err := rs.applyTransforms(); err != nil {
+			rs.err = fmt.Errorf("reading rows: %w", err)
+			return false
+		}
+		for _, filter := range rs.filters {
+			ok, err := filter(rs.row)
+			if err != nil {
+				rs.err = fmt.Errorf("reading rows: filtering row: %w", err)
+				return false
+			}
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// queryRecord is a single record of a query response, in any format.
+type queryRecord struct {
+	header    *Header
+	isRow     bool
+	columns   []json.RawMessage
+	tombstone bool
+}
+
+// parseRecord parses a record in the response's format. Blank lines and
+// framing yield an empty record.
+func (rs *Rows) parseRecord(byt []byte) (queryRecord, error) {
+	var rec queryRecord
+	if rs.format != FormatV1 {
+		if rs.format == FormatV2JSON {
+			byt = trimRecordV2(byt, rs.header == nil)
+		} else {
+			byt = bytes.TrimSpace(byt)
+		}
+		if len(byt) == 0 {
+			return rec, nil
+		}
+		if byt[0] == '[' {
+			rec.isRow = true
+			return rec, json.Unmarshal(byt, &rec.columns)
+		}
+		var header queryHeaderV2
+		if err := json.Unmarshal(byt, &header); err != nil {
+			return rec, err
+		}
+		if header.ColumnNames != nil {
+			rec.header = &Header{QueryID: header.QueryID, Columns: header.columns()}
+		}
+		return rec, nil
+	}
+
+	byt = trimRecordV1(byt)
+	if len(byt) == 0 {
+		return rec, nil
+	}
+	var v1 queryRecordV1
+	if err := json.Unmarshal(byt, &v1); err != nil {
+		return rec, err
+	}
+	switch {
+	case v1.Header != nil:
+		rec.header = &Header{
+			QueryID: v1.Header.QueryID,
+			Columns: parseSchemaV1(v1.Header.Schema),
+		}
+	case v1.Row != nil:
+		rec.isRow = true
+		rec.columns = v1.Row.Columns
+		rec.tombstone = v1.Row.Tombstone
+	}
+	return rec, nil
+}
+
+// maxWarnings is the number of decoding warnings Rows keeps.
+const maxWarnings = 100
+
+// WithDecodeMode overrides the client's DecodeMode for these rows. It
+// must be called before the first call to Next, and returns the rows,
+// for chaining.
+func (rs *Rows) WithDecodeMode(mode DecodeMode) *Rows {
+	rs.decodeOpts.Mode = mode
+	return rs
+}
+
+// WithDecodeOptions overrides all of the client's DecodeOptions for these
+// rows, eg. to set UseNumber for a single query. It must be called
+// before the first call to Next, and returns the rows, for chaining.
+func (rs *Rows) WithDecodeOptions(opts DecodeOptions) *Rows {
+	rs.decodeOpts = opts
+	return rs
+}
+
+// warn records a decoding warning.
+func (rs *Rows) warn(decErr *DecodeError) {
+	rs.warningCount++
+	if len(rs.warnings) < maxWarnings {
+		rs.warnings = append(rs.warnings, decErr)
+	}
+}
+
+// Warnings returns the problems DecodeLenient worked around: the first
+// hundred of them, and how many there were in all.
+func (rs *Rows) Warnings() ([]*DecodeError, int64) {
+	return rs.warnings, rs.warningCount
+}
+
+// Lag returns the estimated end-to-end lag of the rows, as they are
+// read, from their ROWTIME (see LagEstimator); false if no row had one.
+// Unlike the other methods, it may be called while another goroutine
+// iterates, eg. to export it as a gauge.
+func (rs *Rows) Lag() (time.Duration, bool) {
+	return rs.lag.Lag()
+}
+
+// Row returns the current row.
+func (rs *Rows) Row() Row {
+	return rs.row
+}
+
+// Header returns the query header, or nil if it has not arrived yet.
+func (rs *Rows) Header() *Header {
+	return rs.header
+}
+
+// Completion returns the completion message the rows ended with, if
+// the query completed on its own (see Response.Completion).
+func (rs *Rows) Completion() *Completion {
+	return rs.resp.Completion()
+}
+
+// Err returns the error, if any, that ended the iteration. Reaching the
+// end of the response is not an error.
+func (rs *Rows) Err() error {
+	return rs.err
+}
+
+// Close stops reading, closing the underlying response.
+func (rs *Rows) Close() error {
+	rs.stopProgress()
+	rs.resp.Close()
+	return nil
+}
+
+// stopProgress stops progress logging, if enabled.
+func (rs *Rows) stopProgress() {
+	if rs.progress != nil {
+		rs.progress.stop()
+	}
+}
+
+// Query runs a pull or push query on the /query endpoint and returns an
+// iterator over its rows. Push queries (EMIT CHANGES) run until the
+// context is canceled or the Rows are closed.
+func (cc *Client) Query(ctx context.Context, ksql string, props map[string]string) (*Rows, error) {
+	return cc.runQuery(ctx, newResource(&ksqldbapi.EndpointRunQuery, ksql, props))
+}
+
+// runQuery runs a query resource on the /query endpoint.
+func (cc *Client) runQuery(ctx context.Context, res *Resource) (*Rows, error) {
+	rh, err := cc.do(ctx, res)
+	if err != nil {
+		return nil, fmt.Errorf("running ksql query: %w", err)
+	}
+	if rh.StatusCode < http.StatusOK || rh.StatusCode >= http.StatusMultipleChoices {
+		byt, _ := rh.ReadAll()
+		return nil, fmt.Errorf("running ksql query: %w", rh.responseError(byt, nil))
+	}
+	return rh.Rows(), nil
+}
+
+// rowStream pumps Rows into a channel, so that several queries can be
+// consumed together with select. C is closed when the rows end, after
+// which Err reports why.
+type rowStream struct {
+	rows *Rows
+	C    chan Row
+	err  error
+	stop chan struct{}
+	once sync.Once
+}
+
+// newRowStream starts pumping the rows.
+func newRowStream(rows *Rows) *rowStream {
+	rs := &rowStream{rows: rows, C: make(chan Row), stop: make(chan struct{})}
+	go func() {
+		defer close(rs.C)
+		for rows.Next() {
+			select {
+			case rs.C <- rows.Row():
+			case <-rs.stop:
+				return
+			}
+		}
+		rs.err = rows.Err()
+	}()
+	return rs
+}
+
+// Err returns the error that ended the stream; only valid once C has
+// been closed.
+func (rs *rowStream) Err() error {
+	return rs.err
+}
+
+// Close stops the pump and closes the underlying rows.
+func (rs *rowStream) Close() {
+	rs.once.Do(func() {
+		close(rs.stop)
+		rs.rows.Close()
+	})
+}
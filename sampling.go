@@ -0,0 +1,77 @@
+package ksqldb
+
+import (
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// TraceSampler decides which requests are traced, so that services
+// running many queries don't drown their tracing backend. Unsampled
+// requests get none of the ClientTrace hooks, with one exception: with
+// AlwaysTraceErrors, ResponseDelivered is still called for failures.
+type TraceSampler struct {
+	// Rate is the fraction of requests traced, from 0 to 1.
+	Rate float64
+
+	// KindRates overrides Rate per kind of statement, eg. to trace every
+	// DDL statement but only a sliver of pull queries.
+	KindRates map[ksql.StatementKind]float64
+
+	// AlwaysTraceErrors delivers failed responses (transport errors and
+	// non-2xx statuses) to ResponseDelivered whether sampled or not.
+	AlwaysTraceErrors bool
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// Sample decides whether a request for the given statement is traced.
+func (ts *TraceSampler) Sample(kind ksql.StatementKind) bool {
+	rate := ts.Rate
+	if kindRate, ok := ts.KindRates[kind]; ok {
+		rate = kindRate
+	}
+	switch {
+	case rate >= 1:
+		return true
+	case rate <= 0:
+		return false
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.rnd == nil {
+		ts.rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return ts.rnd.Float64() < rate
+}
+
+// traceErrors reports whether a response is a failure that should be
+// traced regardless of sampling.
+func (ts *TraceSampler) traceErrors(resp *http.Response, err error) bool {
+	if !ts.AlwaysTraceErrors {
+		return false
+	}
+	return err != nil || resp == nil || resp.StatusCode >= http.StatusBadRequest
+}
+
+// requestKind classifies a request for sampling by its statement.
+func requestKind(resource Requester) ksql.StatementKind {
+	switch rr := resource.(type) {
+	case *Resource:
+		if rr.kind != "" {
+			return rr.kind
+		}
+		if rr.Payload != nil {
+			return ksql.KindOf(rr.Payload.Ksql)
+		}
+	case *StreamResource:
+		if rr.Payload != nil {
+			return ksql.KindOf(rr.Payload.SQL)
+		}
+	}
+	return ksql.KindOther
+}
@@ -0,0 +1,528 @@
+package ksqldb
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// Columns returns the names of the result columns. The header arrives
+// with the first record, so this may block until it does; unlike Next,
+// it consumes no row.
+func (rs *Rows) Columns() ([]string, error) {
+	rs.awaitHeader()
+	if rs.header == nil {
+		if rs.err != nil {
+			return nil, rs.err
+		}
+		return nil, fmt.Errorf("reading columns: no header")
+	}
+	names := make([]string, len(rs.header.Columns))
+	for i, col := range rs.header.Columns {
+		names[i] = col.Name
+	}
+	return names, nil
+}
+
+// awaitHeader reads ahead until the header arrives, keeping any other
+// record for Next.
+func (rs *Rows) awaitHeader() {
+	for rs.header == nil && len(rs.pending) == 0 && !rs.done && rs.err == nil {
+		select {
+		case byt, ok := <-rs.dataCh:
+			if !ok {
+				rs.end(<-rs.errCh)
+				continue
+			}
+			rec, err := rs.parseRecord(byt)
+			switch {
+			case err == nil && rec.header != nil:
+				rs.consume(byt)
+			case err == nil && !rec.isRow:
+				// Framing, such as the opening bracket of v1 responses.
+			default:
+				rs.pending = append(rs.pending, byt)
+			}
+		case err := <-rs.errCh:
+			rs.end(err)
+		}
+	}
+	// The records left by an ended response may still hold the header.
+	for rs.header == nil && len(rs.pending) > 0 {
+		rec, err := rs.parseRecord(rs.pending[0])
+		if err != nil || rec.isRow {
+			return
+		}
+		rs.consume(rs.pending[0])
+		rs.pending = rs.pending[1:]
+	}
+}
+
+// Scan copies the values of the current row into dest, as with
+// database/sql: one destination per column, each a pointer to a Go value
+// the column's value converts to, a *interface{}, or an sql.Scanner.
+//
+//	var (
+//		id     string
+//		amount int64
+//	)
+//	for rows.Next() {
+//		if err := rows.Scan(&id, &amount); err != nil {
+//			...
+//		}
+//	}
+//
+// Numbers convert to any numeric type they fit in, and scalars to
+// strings. NULL can only be scanned into pointers (left nil), interfaces,
+// slices, maps and sql.Scanners. ARRAY, MAP and STRUCT values are
+// converted through their JSON encoding, so they scan into slices, maps
+// and structs alike.
+func (rs *Rows) Scan(dest ...interface{}) error {
+	if rs.rowNum == 0 {
+		return fmt.Errorf("scanning row: Scan called without Next")
+	}
+	values := rs.row.Values
+	if len(dest) != len(values) {
+		return fmt.Errorf("scanning row: %d destinations for %d columns", len(dest), len(values))
+	}
+	for i, value := range values {
+		if err := convertAssign(dest[i], value); err != nil {
+			name := fmt.Sprint(i)
+			if i < len(rs.row.Columns) {
+				name = rs.row.Columns[i].Name
+			}
+			return fmt.Errorf("scanning column %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ScanStruct decodes the current row into dest, a pointer to a struct,
+// whose fields are matched to columns through their `ksql` tags, or else
+// their names, under the client's case policy (by default ignoring case,
+// as the server upper-cases identifiers):
+//
+//	type Transaction struct {
+//		AccountID int64  `ksql:"ACCOUNT_ID"`
+//		Amount    int64  // matches the column AMOUNT
+//		Note      *string
+//	}
+//
+// Columns without a field are skipped, and NULLs leave fields at their
+// zero value. Values are converted as by Scan. dest may also point to a
+// map keyed by string, which receives every column.
+func (rs *Rows) ScanStruct(dest interface{}) error {
+	if rs.rowNum == 0 {
+		return fmt.Errorf("scanning row: ScanStruct called without Next")
+	}
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return fmt.Errorf("scanning row: destination %T is not a non-nil pointer", dest)
+	}
+	if rs.mapper == nil || rs.mapper.typ != dv.Type().Elem() {
+		mapper, err := newRowMapper(dv.Type().Elem(), rs.row.Columns, rs.row.policy)
+		if err != nil {
+			return fmt.Errorf("scanning row: %w", err)
+		}
+		rs.mapper = mapper
+	}
+	if err := rs.mapper.decode(rs.row, dv.Elem()); err != nil {
+		return fmt.Errorf("scanning row: %w", err)
+	}
+	return nil
+}
+
+// Decode decodes the row into dest, as Rows.ScanStruct does.
+func (row Row) Decode(dest interface{}) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return fmt.Errorf("decoding row: destination %T is not a non-nil pointer", dest)
+	}
+	mapper, err := newRowMapper(dv.Type().Elem(), row.Columns, row.policy)
+	if err != nil {
+		return fmt.Errorf("decoding row: %w", err)
+	}
+	if err := mapper.decode(row, dv.Elem()); err != nil {
+		return fmt.Errorf("decoding row: %w", err)
+	}
+	return nil
+}
+
+// convertAssign stores a decoded value in the destination pointer.
+func convertAssign(dest, src interface{}) error {
+	switch dd := dest.(type) {
+	case sql.Scanner:
+		value, err := driverValue(src)
+		if err != nil {
+			return err
+		}
+		return dd.Scan(value)
+	case *interface{}:
+		*dd = src
+		return nil
+	}
+
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return fmt.Errorf("destination %T is not a non-nil pointer", dest)
+	}
+	return assignValue(dv.Elem(), src)
+}
+
+// assignValue converts a decoded value into the settable value dv.
+func assignValue(dv reflect.Value, src interface{}) error {
+	if src == nil {
+		switch dv.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+			dv.Set(reflect.Zero(dv.Type()))
+			return nil
+		}
+		return fmt.Errorf("cannot scan NULL into %s", dv.Type())
+	}
+	if dv.Kind() == reflect.Ptr {
+		elem := reflect.New(dv.Type().Elem())
+		if err := assignValue(elem.Elem(), src); err != nil {
+			return err
+		}
+		dv.Set(elem)
+		return nil
+	}
+
+	sv := reflect.ValueOf(src)
+	if sv.Type().AssignableTo(dv.Type()) {
+		dv.Set(sv)
+		return nil
+	}
+	switch dv.Type() {
+	case reflect.TypeOf(time.Time{}):
+		return assignTime(dv, src)
+	case reflect.TypeOf(big.Rat{}), reflect.TypeOf(big.Float{}):
+		return assignDecimal(dv, src)
+	}
+
+	switch dv.Kind() {
+	case reflect.String:
+		switch vv := src.(type) {
+		case string, json.Number, bool, int32, int64, float64:
+			dv.SetString(fmt.Sprint(vv))
+			return nil
+		case []byte:
+			dv.SetString(string(vv))
+			return nil
+		case *big.Rat:
+			dv.SetString(ksql.DecimalString(vv))
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(numberText(src), 10, dv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("cannot scan %s into %s: %w", describeValue(src), dv.Type(), err)
+		}
+		dv.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(numberText(src), 10, dv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("cannot scan %s into %s: %w", describeValue(src), dv.Type(), err)
+		}
+		dv.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(numberText(src), dv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("cannot scan %s into %s: %w", describeValue(src), dv.Type(), err)
+		}
+		dv.SetFloat(f)
+		return nil
+	case reflect.Bool:
+		if str, ok := src.(string); ok {
+			b, err := strconv.ParseBool(str)
+			if err != nil {
+				return fmt.Errorf("cannot scan %s into bool: %w", describeValue(src), err)
+			}
+			dv.SetBool(b)
+			return nil
+		}
+	case reflect.Array:
+		if byt, ok := src.([]byte); ok && dv.Type().Elem().Kind() == reflect.Uint8 {
+			if len(byt) != dv.Len() {
+				return fmt.Errorf("cannot scan %d bytes into %s", len(byt), dv.Type())
+			}
+			reflect.Copy(dv, reflect.ValueOf(byt))
+			return nil
+		}
+	case reflect.Slice:
+		if dv.Type().Elem().Kind() == reflect.Uint8 {
+			switch vv := src.(type) {
+			case string:
+				dv.SetBytes([]byte(vv))
+				return nil
+			case []interface{}, map[string]interface{}:
+				byt, err := json.Marshal(vv)
+				if err != nil {
+					return err
+				}
+				dv.SetBytes(byt)
+				return nil
+			}
+		}
+	}
+
+	switch vv := src.(type) {
+	case []interface{}:
+		if dv.Kind() == reflect.Slice && !decodesJSON(dv.Type()) {
+			return assignSlice(dv, vv)
+		}
+	case map[string]interface{}:
+		switch {
+		case decodesJSON(dv.Type()):
+		case dv.Kind() == reflect.Map && dv.Type().Key().Kind() == reflect.String:
+			return assignMap(dv, vv)
+		case dv.Kind() == reflect.Struct:
+			return assignStruct(dv, vv)
+		}
+	}
+	switch src.(type) {
+	case []interface{}, map[string]interface{}, []RecordHeader, []StringHeader:
+		byt, err := json.Marshal(src)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(byt, dv.Addr().Interface()); err != nil {
+			return fmt.Errorf("cannot scan %s into %s: %w", describeValue(src), dv.Type(), err)
+		}
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into %s", src, dv.Type())
+}
+
+// decodesJSON reports whether composite values are decoded into a type
+// through encoding/json rather than member by member: types that
+// unmarshal themselves, and structs mapped with `json` tags only.
+func decodesJSON(typ reflect.Type) bool {
+	if reflect.PtrTo(typ).Implements(reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()) {
+		return true
+	}
+	if typ.Kind() != reflect.Struct {
+		return false
+	}
+	jsonTags := false
+	for i := 0; i < typ.NumField(); i++ {
+		if _, ok := typ.Field(i).Tag.Lookup("ksql"); ok {
+			return false
+		}
+		if _, ok := typ.Field(i).Tag.Lookup("json"); ok {
+			jsonTags = true
+		}
+	}
+	return jsonTags
+}
+
+// assignSlice converts the elements of an ARRAY into the slice dv. NULL
+// elements are left at their zero value.
+func assignSlice(dv reflect.Value, src []interface{}) error {
+	slice := reflect.MakeSlice(dv.Type(), len(src), len(src))
+	for i, elem := range src {
+		if elem == nil {
+			continue
+		}
+		if err := assignValue(slice.Index(i), elem); err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+	}
+	dv.Set(slice)
+	return nil
+}
+
+// assignMap converts the entries of a MAP or STRUCT into the map dv,
+// whose keys are strings. NULL values are kept as zero values.
+func assignMap(dv reflect.Value, src map[string]interface{}) error {
+	mm := reflect.MakeMapWithSize(dv.Type(), len(src))
+	for key, value := range src {
+		elem := reflect.New(dv.Type().Elem()).Elem()
+		if value != nil {
+			if err := assignValue(elem, value); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+		mm.SetMapIndex(reflect.ValueOf(key).Convert(dv.Type().Key()), elem)
+	}
+	dv.Set(mm)
+	return nil
+}
+
+// assignStruct converts the fields of a STRUCT into the struct dv, field
+// by field as rows are (see rowMapper), matching names as the server
+// does: case-insensitively unless exact. Fields without a match are
+// skipped, and NULLs leave fields at their zero value.
+func assignStruct(dv reflect.Value, src map[string]interface{}) error {
+	fields := structFields(dv.Type())
+	for name, value := range src {
+		sf, ok := matchStructField(fields, name, ksql.UpperCase)
+		if !ok || value == nil {
+			continue
+		}
+		if err := assignValue(dv.FieldByIndex(sf.Index), value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// numberText returns the text of a scalar, for parsing as a number.
+func numberText(src interface{}) string {
+	switch vv := src.(type) {
+	case string:
+		return vv
+	case float64:
+		// Whole floats parse as integers too.
+		return strconv.FormatFloat(vv, 'f', -1, 64)
+	case *big.Rat:
+		return ksql.DecimalString(vv)
+	}
+	return fmt.Sprint(src)
+}
+
+// assignTime converts a TIMESTAMP not decoded as a time.Time (see
+// DecodeOptions.Temporal), or a BIGINT timestamp such as ROWTIME, into
+// the time.Time dv: numbers are read as epoch milliseconds, and text as
+// sent by the server or in RFC 3339.
+func assignTime(dv reflect.Value, src interface{}) error {
+	var value interface{}
+	switch vv := src.(type) {
+	case json.Number, string:
+		value = vv
+	case int64:
+		value = json.Number(strconv.FormatInt(vv, 10))
+	default:
+		return fmt.Errorf("cannot scan %T into time.Time", src)
+	}
+	t, err := convertTemporal(value, "TIMESTAMP", time.UTC)
+	if err != nil {
+		return fmt.Errorf("cannot scan %s into time.Time", describeValue(src))
+	}
+	dv.Set(reflect.ValueOf(t))
+	return nil
+}
+
+// assignDecimal converts a number, or its text, into the big.Rat or
+// big.Float dv, exactly for big.Rat.
+func assignDecimal(dv reflect.Value, src interface{}) error {
+	var rat *big.Rat
+	switch vv := src.(type) {
+	case *big.Rat:
+		rat = vv
+	case json.Number, string, int32, int64, float64:
+		var ok bool
+		if rat, ok = new(big.Rat).SetString(numberText(vv)); !ok {
+			return fmt.Errorf("cannot scan %s into %s", describeValue(src), dv.Type())
+		}
+	default:
+		return fmt.Errorf("cannot scan %T into %s", src, dv.Type())
+	}
+	switch dd := dv.Addr().Interface().(type) {
+	case *big.Rat:
+		dd.Set(rat)
+	case *big.Float:
+		dd.SetRat(rat)
+	}
+	return nil
+}
+
+// rowMapper decodes rows into values of a Go type: structs field by
+// field, through their `ksql` tags (see structField), maps by column
+// name, and other types from a single column.
+type rowMapper struct {
+	typ    reflect.Type
+	fields [][]int // per column, the index of its struct field or nil
+}
+
+// newRowMapper maps the columns onto the type.
+func newRowMapper(typ reflect.Type, columns []Column, policy ksql.CasePolicy) (*rowMapper, error) {
+	rm := &rowMapper{typ: typ}
+	base := typ
+	for base.Kind() == reflect.Ptr {
+		base = base.Elem()
+	}
+	switch {
+	case base.Kind() == reflect.Struct && base != reflect.TypeOf(time.Time{}):
+		fields := structFields(base)
+		rm.fields = make([][]int, len(columns))
+		for i, col := range columns {
+			if sf, ok := matchStructField(fields, col.Name, policy); ok {
+				rm.fields[i] = sf.Index
+			}
+		}
+	case base.Kind() == reflect.Map:
+		if base.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("cannot map rows into %s: keys must be strings", typ)
+		}
+	case len(columns) != 1:
+		return nil, fmt.Errorf("cannot map %d columns into %s", len(columns), typ)
+	}
+	return rm, nil
+}
+
+// matchStructField finds the struct field a column maps to: an exact
+// match wins, otherwise the name is matched under the case policy.
+func matchStructField(fields []structField, name string, policy ksql.CasePolicy) (structField, bool) {
+	for _, sf := range fields {
+		if sf.Name == name {
+			return sf, true
+		}
+	}
+	for _, sf := range fields {
+		if policy.Match(sf.Name, name) {
+			return sf, true
+		}
+	}
+	return structField{}, false
+}
+
+// decode decodes a row into dv, a settable value of the mapper's type.
+// NULLs leave struct fields and map entries at their zero value.
+func (rm *rowMapper) decode(row Row, dv reflect.Value) error {
+	for dv.Kind() == reflect.Ptr {
+		if dv.IsNil() {
+			dv.Set(reflect.New(dv.Type().Elem()))
+		}
+		dv = dv.Elem()
+	}
+	switch {
+	case rm.fields != nil:
+		for i, index := range rm.fields {
+			if index == nil || i >= len(row.Values) || row.Values[i] == nil {
+				continue
+			}
+			if err := assignValue(dv.FieldByIndex(index), row.Values[i]); err != nil {
+				return fmt.Errorf("column %s: %w", row.Columns[i].Name, err)
+			}
+		}
+	case dv.Kind() == reflect.Map:
+		if dv.IsNil() {
+			dv.Set(reflect.MakeMapWithSize(dv.Type(), len(row.Values)))
+		}
+		for i, value := range row.Values {
+			if i >= len(row.Columns) || value == nil {
+				continue
+			}
+			elem := reflect.New(dv.Type().Elem()).Elem()
+			if err := assignValue(elem, value); err != nil {
+				return fmt.Errorf("column %s: %w", row.Columns[i].Name, err)
+			}
+			dv.SetMapIndex(reflect.ValueOf(row.Columns[i].Name).Convert(dv.Type().Key()), elem)
+		}
+	default:
+		if len(row.Values) != 1 {
+			return fmt.Errorf("%d values for a single column", len(row.Values))
+		}
+		return assignValue(dv, row.Values[0])
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// SizeEstimator estimates how many rows a full scan of a table returns.
+type SizeEstimator func(ctx context.Context, client *Client, table string) (int64, error)
+
+// totalMessagesStatistic extracts the message count from the statistics
+// of DESCRIBE EXTENDED.
+var totalMessagesStatistic = regexp.MustCompile(`total-messages:\s*([0-9.]+)`)
+
+// EstimateByStatistics is a SizeEstimator reading the total-messages
+// statistic of DESCRIBE EXTENDED. It is cheap, but counts the messages
+// the server consumed rather than distinct keys, so it overestimates
+// tables with many updates per key.
+func EstimateByStatistics(ctx context.Context, client *Client, table string) (int64, error) {
+	sd, err := client.DescribeExtended(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	match := totalMessagesStatistic.FindStringSubmatch(sd.Statistics)
+	if match == nil {
+		return 0, fmt.Errorf("no total-messages statistic for %s", table)
+	}
+	count, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing total-messages statistic for %s: %w", table, err)
+	}
+	return int64(count), nil
+}
+
+// EstimateByQuery returns a SizeEstimator running the given query (eg.
+// a pull query on a table maintaining COUNT(*) for the source) and
+// reading the first column of its first row as the estimate. The query
+// is formatted with the table name, eg. "SELECT N FROM COUNTS WHERE
+// NAME='%s';".
+func EstimateByQuery(format string) SizeEstimator {
+	return func(ctx context.Context, client *Client, table string) (int64, error) {
+		rows, err := client.Query(ctx, fmt.Sprintf(format, table), nil)
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return 0, err
+			}
+			return 0, fmt.Errorf("estimating size of %s: no rows", table)
+		}
+		values := rows.Row().Values
+		if len(values) == 0 {
+			return 0, fmt.Errorf("estimating size of %s: empty row", table)
+		}
+		switch vv := values[0].(type) {
+		case int64:
+			return vv, nil
+		case int32:
+			return int64(vv), nil
+		case float64:
+			return int64(vv), nil
+		}
+		return 0, fmt.Errorf("estimating size of %s: %v is not a count", table, values[0])
+	}
+}
+
+// ScanGuard protects the cluster from accidental full-table pull
+// queries against huge tables: before the scan, the table's size is
+// estimated, and scans over MaxRows are refused unless explicitly
+// allowed by the caller.
+type ScanGuard struct {
+	// MaxRows is the largest estimated scan allowed.
+	MaxRows int64
+
+	// Estimator defaults to EstimateByStatistics.
+	Estimator SizeEstimator
+}
+
+// ScanTooLargeError is returned for scans refused by a ScanGuard.
+type ScanTooLargeError struct {
+	Table    string
+	Estimate int64
+	MaxRows  int64
+}
+
+// Error implements error.
+func (err *ScanTooLargeError) Error() string {
+	return fmt.Sprintf(
+		"refusing full scan of %s: estimated %d rows exceeds limit of %d",
+		err.Table, err.Estimate, err.MaxRows,
+	)
+}
+
+// Check estimates the size of the table and returns a
+// *ScanTooLargeError if it is over the limit.
+func (sg *ScanGuard) Check(ctx context.Context, client *Client, table string) error {
+	estimator := sg.Estimator
+	if estimator == nil {
+		estimator = EstimateByStatistics
+	}
+	estimate, err := estimator(ctx, client, table)
+	if err != nil {
+		return fmt.Errorf("guarding scan of %s: %w", table, err)
+	}
+	if estimate > sg.MaxRows {
+		return &ScanTooLargeError{Table: table, Estimate: estimate, MaxRows: sg.MaxRows}
+	}
+	return nil
+}
+
+// GuardScan checks a full scan of the table against the client's
+// ScanGuard, if it has one. Call it ahead of hand-written SELECT * pull
+// queries to get the same protection as the built-in helpers.
+func (cc *Client) GuardScan(ctx context.Context, table string) error {
+	if cc.scanGuard == nil {
+		return nil
+	}
+	return cc.scanGuard.Check(ctx, cc, table)
+}
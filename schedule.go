@@ -0,0 +1,199 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// PollHandler receives the rows of a scheduled pull query.
+type PollHandler func(ctx context.Context, rows []Row) error
+
+// ScheduleOptions configures Client.Schedule.
+type ScheduleOptions struct {
+	// Interval is the time between the starts of two polls.
+	Interval time.Duration
+
+	// Jitter, if set, delays every poll by a random duration up to it,
+	// so that many clients polling the same view spread their load.
+	Jitter time.Duration
+
+	// Timeout bounds each poll, including its handler. It defaults to
+	// the interval.
+	Timeout time.Duration
+
+	// Props are sent as the query's streamsProperties.
+	Props map[string]string
+
+	// OnError, if set, is passed the errors of failed polls. Failed
+	// polls are logged, and the schedule carries on regardless.
+	OnError func(error)
+}
+
+// ScheduleStats counts the polls of a ScheduledQuery.
+type ScheduleStats struct {
+	Runs     int64
+	Failures int64
+	// Skipped counts the polls skipped because the previous one was
+	// still running when they were due.
+	Skipped int64
+	LastRun time.Time
+}
+
+// ScheduledQuery is a pull query run periodically, replacing the cron
+// jobs that poll materialized views. Polls never overlap: one still
+// running when the next is due makes that one skipped. It runs until
+// stopped, or until the client's context is done.
+type ScheduledQuery struct {
+	client  *Client
+	query   string
+	handler PollHandler
+	opts    ScheduleOptions
+	rnd     *rand.Rand
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	mu    sync.Mutex
+	stats ScheduleStats
+}
+
+// Schedule starts running a pull query at an interval, passing its rows
+// to the handler. The first poll runs at once.
+func (cc *Client) Schedule(query string, handler PollHandler, opts ScheduleOptions) (*ScheduledQuery, error) {
+	if kind := ksql.KindOf(query); kind != ksql.KindPullQuery {
+		return nil, fmt.Errorf("scheduling query: %s is not a pull query", kind)
+	}
+	if opts.Interval <= 0 {
+		return nil, fmt.Errorf("scheduling query: no interval")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = opts.Interval
+	}
+	sq := &ScheduledQuery{
+		client:  cc,
+		query:   query,
+		handler: handler,
+		opts:    opts,
+		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go sq.run()
+	return sq, nil
+}
+
+// run polls until stopped.
+func (sq *ScheduledQuery) run() {
+	defer close(sq.done)
+	clock := sq.client.clock
+	next := clock.Now()
+	for {
+		wait := next.Sub(clock.Now()) + sq.jitter()
+		timer := clock.NewTimer(wait)
+		select {
+		case <-sq.stop:
+			timer.Stop()
+			return
+		case <-sq.client.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+
+		sq.poll()
+
+		// Polls due while this one ran are skipped rather than run back
+		// to back.
+		next = next.Add(sq.opts.Interval)
+		now := clock.Now()
+		for !next.After(now) {
+			next = next.Add(sq.opts.Interval)
+			sq.mu.Lock()
+			sq.stats.Skipped++
+			sq.mu.Unlock()
+		}
+	}
+}
+
+// jitter returns a random delay up to the configured jitter.
+func (sq *ScheduledQuery) jitter() time.Duration {
+	if sq.opts.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(sq.rnd.Int63n(int64(sq.opts.Jitter)))
+}
+
+// poll runs the query once and hands its rows to the handler.
+func (sq *ScheduledQuery) poll() {
+	ctx, cancel := context.WithCancel(sq.client.ctx)
+	defer cancel()
+	timer := sq.client.clock.NewTimer(sq.opts.Timeout)
+	defer timer.Stop()
+	go func() {
+		select {
+		case <-timer.C():
+			cancel()
+		case <-sq.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	start := sq.client.clock.Now()
+	err := sq.pollOnce(ctx)
+
+	sq.mu.Lock()
+	sq.stats.Runs++
+	sq.stats.LastRun = start
+	if err != nil {
+		sq.stats.Failures++
+	}
+	sq.mu.Unlock()
+
+	if err != nil {
+		sq.client.logger.Log("scheduled query failed", "query", sq.query, "err", err)
+		if sq.opts.OnError != nil {
+			sq.opts.OnError(err)
+		}
+	}
+}
+
+// pollOnce reads all the query's rows, then calls the handler.
+func (sq *ScheduledQuery) pollOnce(ctx context.Context) error {
+	rows, err := sq.client.Query(ctx, sq.query, sq.opts.Props)
+	if err != nil {
+		return fmt.Errorf("polling: %w", err)
+	}
+	defer rows.Close()
+	var result []Row
+	for rows.Next() {
+		result = append(result, rows.Row())
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("polling: %w", err)
+	}
+	if err := sq.handler(ctx, result); err != nil {
+		return fmt.Errorf("polling: handler: %w", err)
+	}
+	return nil
+}
+
+// Stop stops the schedule, canceling the poll running if any, and
+// waits for it to wind down. It is safe to call more than once.
+func (sq *ScheduledQuery) Stop() {
+	sq.stopOnce.Do(func() { close(sq.stop) })
+	<-sq.done
+}
+
+// Stats returns the schedule's poll counts.
+func (sq *ScheduledQuery) Stats() ScheduleStats {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	return sq.stats
+}
@@ -0,0 +1,205 @@
+package ksqldb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SchemaRegistry is a minimal client for the Confluent Schema Registry
+// REST API, covering only what the ksqlDB client needs to pre-check
+// schemas before the server registers them.
+type SchemaRegistry struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+}
+
+// NewSchemaRegistry creates a Schema Registry client for the given URL.
+// A nil HTTP client falls back to http.DefaultClient.
+func NewSchemaRegistry(rawURL string, httpClient *http.Client) (*SchemaRegistry, error) {
+	uu, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("initializing schema registry client: %w", err)
+	}
+	if uu.Scheme == "" {
+		return nil, fmt.Errorf("initializing schema registry client: url %s missing scheme", rawURL)
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &SchemaRegistry{baseURL: uu, httpClient: httpClient}, nil
+}
+
+// CompatibilityResult is the registry's verdict on a candidate schema.
+type CompatibilityResult struct {
+	Compatible bool     `json:"is_compatible"`
+	Messages   []string `json:"messages"`
+}
+
+// srSubjectNotFound is the registry error code for an unknown subject,
+// which for a pre-check means there is nothing to be incompatible with.
+const srSubjectNotFound = 40401
+
+// CheckCompatibility tests an AVRO schema against the latest version
+// registered under subject, following the subject's configured
+// compatibility rules.
+func (sr *SchemaRegistry) CheckCompatibility(ctx context.Context, subject, schema string) (*CompatibilityResult, error) {
+	endpoint := sr.baseURL.ResolveReference(&url.URL{
+		Path:     strings.TrimSuffix(sr.baseURL.Path, "/") + "/compatibility/subjects/" + url.PathEscape(subject) + "/versions/latest",
+		RawQuery: "verbose=true",
+	})
+	byt, err := json.Marshal(map[string]string{"schema": schema})
+	if err != nil {
+		return nil, fmt.Errorf("checking schema compatibility: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint.String(), bytes.NewReader(byt))
+	if err != nil {
+		return nil, fmt.Errorf("checking schema compatibility: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+
+	resp, err := sr.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("checking schema compatibility: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("checking schema compatibility: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var srErr struct {
+			ErrorCode int    `json:"error_code"`
+			Message   string `json:"message"`
+		}
+		if json.Unmarshal(body, &srErr) == nil && srErr.ErrorCode == srSubjectNotFound {
+			return &CompatibilityResult{Compatible: true}, nil
+		}
+		return nil, fmt.Errorf("checking schema compatibility: %w", newResponseError(resp, body, nil))
+	}
+
+	var result CompatibilityResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("checking schema compatibility: %w", newResponseError(resp, body, fmt.Errorf("decoding response: %w", err)))
+	}
+	return &result, nil
+}
+
+// SchemaCompatibilityError is returned when a statement's output schema
+// would be rejected by the Schema Registry.
+type SchemaCompatibilityError struct {
+	Subject  string
+	Messages []string
+}
+
+// Error implements error.
+func (err *SchemaCompatibilityError) Error() string {
+	msg := fmt.Sprintf("schema incompatible with subject %s", err.Subject)
+	if len(err.Messages) > 0 {
+		msg += ": " + strings.Join(err.Messages, "; ")
+	}
+	return msg
+}
+
+// Names used by ksqlDB for the AVRO schemas it generates. Matching them
+// matters: the registry compares record names as well as structure.
+const (
+	avroRecordName      = "KsqlDataSourceSchema"
+	avroRecordNamespace = "io.confluent.ksql.avro_schemas"
+)
+
+// avroValueSchema renders the AVRO schema ksqlDB would register for the
+// value columns among the given fields.
+func avroValueSchema(fields []FieldInfo) (string, error) {
+	var values []FieldInfo
+	for _, field := range fields {
+		if field.IsKey() || field.IsHeader() || field.Name == "ROWTIME" || field.Name == "ROWKEY" {
+			continue
+		}
+		values = append(values, field)
+	}
+	record, err := avroRecord(avroRecordName, values)
+	if err != nil {
+		return "", err
+	}
+	record["namespace"] = avroRecordNamespace
+	byt, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("rendering avro schema: %w", err)
+	}
+	return string(byt), nil
+}
+
+// avroRecord renders a record with nullable fields, as ksqlDB does.
+func avroRecord(name string, fields []FieldInfo) (map[string]interface{}, error) {
+	avroFields := make([]interface{}, 0, len(fields))
+	for _, field := range fields {
+		typ, err := avroType(name+"_"+field.Name, field.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		avroFields = append(avroFields, map[string]interface{}{
+			"name":    field.Name,
+			"type":    []interface{}{"null", typ},
+			"default": nil,
+		})
+	}
+	return map[string]interface{}{
+		"type":   "record",
+		"name":   name,
+		"fields": avroFields,
+	}, nil
+}
+
+// avroType maps a ksqlDB logical type onto its AVRO representation.
+func avroType(name string, schema SchemaInfo) (interface{}, error) {
+	switch schema.Type {
+	case "BOOLEAN":
+		return "boolean", nil
+	case "INTEGER", "INT":
+		return "int", nil
+	case "BIGINT":
+		return "long", nil
+	case "DOUBLE":
+		return "double", nil
+	case "STRING", "VARCHAR":
+		return "string", nil
+	case "BYTES":
+		return "bytes", nil
+	case "DATE":
+		return map[string]interface{}{"type": "int", "logicalType": "date"}, nil
+	case "TIME":
+		return map[string]interface{}{"type": "int", "logicalType": "time-millis"}, nil
+	case "TIMESTAMP":
+		return map[string]interface{}{"type": "long", "logicalType": "timestamp-millis"}, nil
+	case "DECIMAL":
+		return map[string]interface{}{
+			"type":        "bytes",
+			"logicalType": "decimal",
+			"precision":   schema.Parameters["precision"],
+			"scale":       schema.Parameters["scale"],
+		}, nil
+	case "ARRAY", "MAP":
+		if schema.MemberSchema == nil {
+			return nil, fmt.Errorf("%s without member schema", schema.Type)
+		}
+		member, err := avroType(name, *schema.MemberSchema)
+		if err != nil {
+			return nil, err
+		}
+		if schema.Type == "ARRAY" {
+			return map[string]interface{}{"type": "array", "items": []interface{}{"null", member}}, nil
+		}
+		return map[string]interface{}{"type": "map", "values": []interface{}{"null", member}}, nil
+	case "STRUCT":
+		return avroRecord(name, schema.Fields)
+	}
+	return nil, fmt.Errorf("no avro mapping for type %s", schema.Type)
+}
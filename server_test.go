@@ -0,0 +1,144 @@
+package ksqldb_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"hews.co/ksqldb"
+)
+
+// fakeQuery is the response of a fakeServer to a query: a v1 /query
+// stream with the given schema and rows (JSON arrays of their columns,
+// or "tombstone:" and the array for tombstones). Push queries stay open
+// after their rows until the client goes away, unless cut, which drops
+// the connection after the rows instead. The response waits for wait to
+// be closed, if set.
+type fakeQuery struct {
+	schema string
+	rows   []string
+	push   bool
+	cut    bool
+	wait   <-chan struct{}
+}
+
+// fakeServer is a ksqlDB server answering /query requests from a
+// script, and recording the statements it was sent. Other statements,
+// such as the TERMINATE closing a push query, succeed.
+type fakeServer struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	statements []string
+	answer     func(ksql string) (fakeQuery, int)
+
+	// hold, if set, delays the answer to other statements than queries
+	// until it is closed.
+	hold <-chan struct{}
+}
+
+// newFakeServer starts a fakeServer, closed when the test ends. The
+// answer function returns each query's response and its status, which
+// is 200 if zero.
+func newFakeServer(t *testing.T, answer func(ksql string) (fakeQuery, int)) *fakeServer {
+	t.Helper()
+	fs := &fakeServer{answer: answer}
+	fs.Server = httptest.NewServer(http.HandlerFunc(fs.serve))
+	t.Cleanup(fs.Close)
+	return fs
+}
+
+// client creates a client of the server.
+func (fs *fakeServer) client(t *testing.T, opts ksqldb.ClientOptions) *ksqldb.Client {
+	t.Helper()
+	opts.URL = fs.URL
+	client, err := ksqldb.NewClient(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// sent returns the statements sent so far.
+func (fs *fakeServer) sent() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]string(nil), fs.statements...)
+}
+
+// queries returns the SELECT statements sent so far, leaving out those
+// closing them.
+func (fs *fakeServer) queries() []string {
+	var queries []string
+	for _, statement := range fs.sent() {
+		if strings.HasPrefix(statement, "SELECT") {
+			queries = append(queries, statement)
+		}
+	}
+	return queries
+}
+
+func (fs *fakeServer) serve(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		KSQL string `json:"ksql"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fs.mu.Lock()
+	fs.statements = append(fs.statements, req.KSQL)
+	fs.mu.Unlock()
+	if r.URL.Path != "/query" {
+		// Statements such as TERMINATE succeed without output.
+		if fs.hold != nil {
+			select {
+			case <-fs.hold:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, "[]")
+		return
+	}
+
+	query, status := fs.answer(req.KSQL)
+	if query.wait != nil {
+		select {
+		case <-query.wait:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if status != 0 && status != http.StatusOK {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"@type":"statement_error","error_code":%d,"message":"scripted failure"}`, status*100)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `[{"header":{"queryId":"q1","schema":%q}}`, query.schema)
+	for _, row := range query.rows {
+		if strings.HasPrefix(row, "tombstone:") {
+			fmt.Fprintf(w, ",\n"+`{"row":{"columns":%s,"tombstone":true}}`, strings.TrimPrefix(row, "tombstone:"))
+		} else {
+			fmt.Fprintf(w, ",\n"+`{"row":{"columns":%s}}`, row)
+		}
+	}
+	if query.cut {
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	if !query.push {
+		fmt.Fprint(w, "]\n")
+		return
+	}
+	fmt.Fprint(w, ",\n")
+	w.(http.Flusher).Flush()
+	<-r.Context().Done()
+}
@@ -0,0 +1,157 @@
+package ksqldb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrClientClosed is returned for push queries started once the client
+// is closed (see Client.Close).
+var ErrClientClosed = errors.New("ksqldb: client closed")
+
+// DefaultShutdownGrace is the time NotifyShutdown gives Client.Close.
+const DefaultShutdownGrace = 10 * time.Second
+
+// openQueries keeps the responses of the client's running push queries,
+// to close on Client.Close.
+type openQueries struct {
+	mu        sync.Mutex
+	responses map[*Response]struct{}
+	closed    bool
+}
+
+// isClosed reports whether the client is closed.
+func (oq *openQueries) isClosed() bool {
+	oq.mu.Lock()
+	defer oq.mu.Unlock()
+	return oq.closed
+}
+
+// add registers the response of a push query, reporting false if the
+// client was closed while it was sent.
+func (oq *openQueries) add(rr *Response) bool {
+	oq.mu.Lock()
+	defer oq.mu.Unlock()
+	if oq.closed {
+		return false
+	}
+	if oq.responses == nil {
+		oq.responses = make(map[*Response]struct{})
+	}
+	oq.responses[rr] = struct{}{}
+	return true
+}
+
+// remove forgets the response of a push query once it is done.
+func (oq *openQueries) remove(rr *Response) {
+	oq.mu.Lock()
+	defer oq.mu.Unlock()
+	delete(oq.responses, rr)
+}
+
+// close marks the client closed, returning the responses still open.
+func (oq *openQueries) close() []*Response {
+	oq.mu.Lock()
+	defer oq.mu.Unlock()
+	oq.closed = true
+	open := make([]*Response, 0, len(oq.responses))
+	for rr := range oq.responses {
+		open = append(open, rr)
+	}
+	return open
+}
+
+// Close shuts the client down gracefully: push queries started from then
+// on fail with ErrClientClosed, the running ones are canceled and closed
+// on the server (see Client.CloseQuery), and idle connections are closed.
+// Close waits for the queries to be closed until ctx is done. Other
+// requests still go through; cancel the client's context to stop them.
+func (cc *Client) Close(ctx context.Context) error {
+	open := cc.queries.close()
+	errs := make(chan error, len(open))
+	for _, rr := range open {
+		go func(rr *Response) {
+			rr.Cancel()
+			errs <- rr.closeStarted()
+		}(rr)
+	}
+	var err error
+	for range open {
+		select {
+		case cerr := <-errs:
+			if err == nil && cerr != nil {
+				err = fmt.Errorf("closing client: %w", cerr)
+			}
+		case <-ctx.Done():
+			cc.logger.Log("client close timed out", "queries", len(open))
+			return fmt.Errorf("closing client: %w", ctx.Err())
+		}
+	}
+	cc.httpClient.CloseIdleConnections()
+	return err
+}
+
+// ShutdownOptions configure NotifyShutdown.
+type ShutdownOptions struct {
+	// Signals are the signals that shut the client down. They default to
+	// SIGINT and SIGTERM.
+	Signals []os.Signal
+
+	// Grace bounds the time given to Client.Close, eg. to fit in a pod's
+	// termination grace period. It defaults to DefaultShutdownGrace.
+	Grace time.Duration
+}
+
+// NotifyShutdown ties signals to the graceful shutdown of a client, so
+// that push queries are closed on the server when a program is
+// interrupted or its pod terminated. The returned context is canceled on
+// the first signal, and the client then closed; the returned function
+// closes the client if no signal arrived, and waits for the close to end
+// either way:
+//
+//	ctx, shutdown := ksqldb.NotifyShutdown(ctx, client, ksqldb.ShutdownOptions{})
+//	defer shutdown()
+//	rows, err := client.Query(ctx, sql, nil)
+func NotifyShutdown(parent context.Context, cc *Client, opts ShutdownOptions) (context.Context, func() error) {
+	signals := opts.Signals
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	grace := opts.Grace
+	if grace <= 0 {
+		grace = DefaultShutdownGrace
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, signals...)
+	var once sync.Once
+	var err error
+	shutdown := func() error {
+		once.Do(func() {
+			signal.Stop(sigCh)
+			// The caller's context goes first, so that it stops reading
+			// rather than take the queries' closing for a failure.
+			cancel()
+			closeCtx, closeCancel := withTimeout(context.Background(), cc.clock, grace)
+			defer closeCancel()
+			err = cc.Close(closeCtx)
+		})
+		return err
+	}
+	go func() {
+		select {
+		case sig := <-sigCh:
+			cc.logger.Log("shutting down", "signal", sig.String())
+			shutdown()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, shutdown
+}
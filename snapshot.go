@@ -0,0 +1,223 @@
+package ksqldb
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// RowSink receives the rows of an export. WriteHeader is called once,
+// before any row; Flush once, after the last row. Writers for other
+// formats (eg. Parquet) plug in by implementing it.
+type RowSink interface {
+	WriteHeader(columns []Column) error
+	WriteRow(row Row) error
+	Flush() error
+}
+
+// SinkFunc adapts a plain callback into a RowSink.
+type SinkFunc func(Row) error
+
+// WriteHeader implements RowSink.
+func (fn SinkFunc) WriteHeader([]Column) error { return nil }
+
+// WriteRow implements RowSink.
+func (fn SinkFunc) WriteRow(row Row) error { return fn(row) }
+
+// Flush implements RowSink.
+func (fn SinkFunc) Flush() error { return nil }
+
+// ChannelSink sends every row on a channel, giving up once its context
+// is done. It does not close the channel, which remains the caller's.
+type ChannelSink struct {
+	ctx context.Context
+	ch  chan<- Row
+}
+
+// NewChannelSink creates a ChannelSink sending on ch until ctx is done.
+func NewChannelSink(ctx context.Context, ch chan<- Row) *ChannelSink {
+	return &ChannelSink{ctx: ctx, ch: ch}
+}
+
+// WriteHeader implements RowSink.
+func (cs *ChannelSink) WriteHeader([]Column) error { return nil }
+
+// WriteRow implements RowSink. It blocks until the row is received or
+// the context is done, returning the context's error.
+func (cs *ChannelSink) WriteRow(row Row) error {
+	select {
+	case cs.ch <- row:
+		return nil
+	case <-cs.ctx.Done():
+		return cs.ctx.Err()
+	}
+}
+
+// Flush implements RowSink.
+func (cs *ChannelSink) Flush() error { return nil }
+
+// CSVSink writes rows as CSV, with a header line of column names.
+// Nested values (STRUCT, ARRAY, MAP) are written as JSON.
+type CSVSink struct {
+	// Times renders decoded TIMESTAMP, DATE and TIME values (see
+	// DecodeOptions.Temporal).
+	Times ksql.TimeFormatter
+
+	writer *csv.Writer
+}
+
+// NewCSVSink creates a CSVSink writing to w.
+func NewCSVSink(w io.Writer) *CSVSink {
+	return &CSVSink{writer: csv.NewWriter(w)}
+}
+
+// WriteHeader implements RowSink.
+func (cs *CSVSink) WriteHeader(columns []Column) error {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name
+	}
+	return cs.writer.Write(names)
+}
+
+// WriteRow implements RowSink.
+func (cs *CSVSink) WriteRow(row Row) error {
+	record := make([]string, len(row.Values))
+	for i, value := range row.Values {
+		if text, ok := cs.Times.Format(value, columnType(row, i)); ok {
+			record[i] = text
+			continue
+		}
+		field, err := formatCSVValue(value)
+		if err != nil {
+			return fmt.Errorf("writing csv row: %w", err)
+		}
+		record[i] = field
+	}
+	return cs.writer.Write(record)
+}
+
+// Flush implements RowSink.
+func (cs *CSVSink) Flush() error {
+	cs.writer.Flush()
+	return cs.writer.Error()
+}
+
+// columnType returns the type of a row's column, if known.
+func columnType(row Row, i int) string {
+	if i < len(row.Columns) {
+		return row.Columns[i].Type
+	}
+	return ""
+}
+
+// formatCSVValue renders a decoded JSON value as a CSV field.
+func formatCSVValue(value interface{}) (string, error) {
+	switch vv := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return vv, nil
+	case bool, float64:
+		return fmt.Sprint(vv), nil
+	case *big.Rat:
+		if vv != nil {
+			return ksql.DecimalString(vv), nil
+		}
+	}
+	byt, err := json.Marshal(encodableValue(value))
+	return string(byt), err
+}
+
+// SnapshotProgress reports how far along an export is.
+type SnapshotProgress struct {
+	Rows    int64
+	Elapsed time.Duration
+	Done    bool
+}
+
+// SnapshotOptions configures Snapshot.
+type SnapshotOptions struct {
+	// Props are sent as the query's streamsProperties.
+	Props map[string]string
+
+	// AllowLargeScan skips the client's ScanGuard, if any.
+	AllowLargeScan bool
+
+	// OnProgress, if set, is called every ProgressInterval (default one
+	// second) while rows are arriving, and once more when done.
+	OnProgress       func(SnapshotProgress)
+	ProgressInterval time.Duration
+}
+
+// Snapshot exports the current state of a materialized table: it runs
+// a full-table pull query (SELECT * FROM table) and streams the rows
+// into the sink, for periodic snapshots and exports.
+func (cc *Client) Snapshot(ctx context.Context, table string, sink RowSink, opts SnapshotOptions) (SnapshotProgress, error) {
+	interval := opts.ProgressInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	start := cc.clock.Now()
+	progress := SnapshotProgress{}
+
+	if !opts.AllowLargeScan {
+		if err := cc.GuardScan(ctx, table); err != nil {
+			return progress, fmt.Errorf("snapshotting %s: %w", table, err)
+		}
+	}
+	rows, err := cc.Query(ctx, fmt.Sprintf("SELECT * FROM %s;", cc.ident(table)), opts.Props)
+	if err != nil {
+		return progress, fmt.Errorf("snapshotting %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	wroteHeader := false
+	lastReport := start
+	for rows.Next() {
+		row := rows.Row()
+		if !wroteHeader {
+			if err := sink.WriteHeader(row.Columns); err != nil {
+				return progress, fmt.Errorf("snapshotting %s: %w", table, err)
+			}
+			wroteHeader = true
+		}
+		if err := sink.WriteRow(row); err != nil {
+			return progress, fmt.Errorf("snapshotting %s: %w", table, err)
+		}
+		progress.Rows++
+		if opts.OnProgress != nil && since(cc.clock, lastReport) >= interval {
+			lastReport = cc.clock.Now()
+			progress.Elapsed = lastReport.Sub(start)
+			opts.OnProgress(progress)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return progress, fmt.Errorf("snapshotting %s: %w", table, err)
+	}
+	if !wroteHeader {
+		var columns []Column
+		if header := rows.Header(); header != nil {
+			columns = header.Columns
+		}
+		if err := sink.WriteHeader(columns); err != nil {
+			return progress, fmt.Errorf("snapshotting %s: %w", table, err)
+		}
+	}
+	if err := sink.Flush(); err != nil {
+		return progress, fmt.Errorf("snapshotting %s: %w", table, err)
+	}
+
+	progress.Elapsed = since(cc.clock, start)
+	progress.Done = true
+	if opts.OnProgress != nil {
+		opts.OnProgress(progress)
+	}
+	return progress, nil
+}
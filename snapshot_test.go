@@ -0,0 +1,57 @@
+package ksqldb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestCSVSinkDecimals(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewCSVSink(&buf)
+	columns := []Column{
+		{Name: "PRICE", Type: "DECIMAL(10, 2)"},
+		{Name: "LINE", Type: "STRUCT<`PRICE` DECIMAL(10, 2)>"},
+	}
+	row := Row{
+		Columns: columns,
+		Values: []interface{}{
+			big.NewRat(123, 100),
+			map[string]interface{}{"PRICE": big.NewRat(-5, 2)},
+		},
+	}
+	if err := sink.WriteHeader(columns); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.WriteRow(row); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := "PRICE,LINE\n1.23,\"{\"\"PRICE\"\":-2.5}\"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestChannelSinkCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan Row, 1)
+	sink := NewChannelSink(ctx, ch)
+	if err := sink.WriteRow(Row{}); err != nil {
+		t.Fatal(err)
+	}
+	// The channel is full: the next row waits until the context is done.
+	done := make(chan error)
+	go func() { done <- sink.WriteRow(Row{}) }()
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("WriteRow() = %v, want %v", err, context.Canceled)
+	}
+	if len(ch) != 1 {
+		t.Errorf("%d rows sent, want 1", len(ch))
+	}
+}
@@ -0,0 +1,133 @@
+package ksqldb
+
+import (
+	"bufio"
+	"bytes"
+	"mime"
+	"strings"
+)
+
+// SplitFor returns the function splitting the body of a response of the
+// given content type into records: the elements of the JSON arrays of
+// the v1 API and of /query-stream in application/json, and the lines of
+// ContentTypeDelimited and other types. See ClientOptions.RecordSplit.
+func SplitFor(contentType string) bufio.SplitFunc {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) {
+		return (&jsonArraySplitter{}).split
+	}
+	return SplitLines
+}
+
+// SplitLines splits records on apiDataDelimiter, dropping a trailing
+// carriage return. Blank lines, which keep streams alive, are empty
+// records.
+func SplitLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.Index(data, apiDataDelimiter); i >= 0 {
+		return i + len(apiDataDelimiter), bytes.TrimSuffix(data[:i], []byte("\r")), nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// jsonArraySplitter splits a JSON array into its elements, wherever
+// lines break. Each record keeps the framing before its element (the
+// "[" opening the array, or a ","), so that the records add up to the
+// body; framing followed by nothing yet, such as the blank lines that
+// keep streams alive or the closing "]", is a record of its own. Bodies
+// that are not JSON arrays are split into their top-level values, or
+// lines if they are not JSON.
+type jsonArraySplitter struct {
+	opened bool
+}
+
+// split implements bufio.SplitFunc.
+func (js *jsonArraySplitter) split(data []byte, atEOF bool) (int, []byte, error) {
+	opened := js.opened
+	i := 0
+framing:
+	for ; i < len(data); i++ {
+		switch data[i] {
+		case ' ', '\t', '\r', '\n', ',':
+		case '[':
+			if opened {
+				break framing
+			}
+			opened = true
+		case ']':
+			if !opened {
+				break framing
+			}
+			opened = false
+		default:
+			break framing
+		}
+	}
+	if i == len(data) {
+		if i == 0 {
+			return 0, nil, nil
+		}
+		js.opened = opened
+		return i, data, nil
+	}
+	if !opened && data[i] != '{' && data[i] != '"' {
+		return SplitLines(data, atEOF)
+	}
+	n, ok := scanJSONValue(data[i:])
+	switch {
+	case !ok && atEOF:
+		return len(data), data, nil
+	case !ok:
+		return 0, nil, nil
+	case n == 0:
+		// A stray "}", which is no JSON: the line goes as is.
+		return SplitLines(data, atEOF)
+	}
+	js.opened = opened
+	return i + n, data[:i+n], nil
+}
+
+// scanJSONValue returns the length of the JSON value byt starts with,
+// or false if it does not end within byt. Values are not validated, only
+// their strings and nesting followed.
+func scanJSONValue(byt []byte) (int, bool) {
+	depth := 0
+	inString, escaped := false, false
+	for i, c := range byt {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+				if depth == 0 {
+					return i + 1, true
+				}
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth == 0 {
+				return i, true
+			}
+			depth--
+			if depth == 0 {
+				return i + 1, true
+			}
+		case ',', ' ', '\t', '\r', '\n':
+			if depth == 0 {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
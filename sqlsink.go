@@ -0,0 +1,421 @@
+package ksqldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultSQLSinkBatchSize is the number of rows upserted per statement
+// when SQLSinkOptions.BatchSize is unset.
+const DefaultSQLSinkBatchSize = 500
+
+// DefaultSQLSinkFinalFlushTimeout bounds the last flush of Run when
+// SQLSinkOptions.FinalFlushTimeout is unset.
+const DefaultSQLSinkFinalFlushTimeout = 10 * time.Second
+
+// ConflictStrategy decides what an SQLSink does with rows whose key is
+// already in the table.
+type ConflictStrategy int
+
+const (
+	// ConflictUpdate overwrites the existing row's other columns.
+	ConflictUpdate ConflictStrategy = iota
+	// ConflictIgnore keeps the existing row.
+	ConflictIgnore
+	// ConflictError fails the batch, as a plain INSERT would.
+	ConflictError
+)
+
+// SQLSinkOptions configure an SQLSink.
+type SQLSinkOptions struct {
+	// Table is the table written to.
+	Table string
+
+	// Columns maps result columns to the table's columns. Result columns
+	// missing from it are not written. It defaults to writing every
+	// column, under its lower-cased name.
+	Columns map[string]string
+
+	// KeyColumns are the table's columns forming its primary key (or a
+	// unique index): the conflict target of the upserts.
+	KeyColumns []string
+
+	// Conflict is what to do with rows already in the table.
+	Conflict ConflictStrategy
+
+	// BatchSize is the number of rows upserted per statement. It
+	// defaults to DefaultSQLSinkBatchSize.
+	BatchSize int
+
+	// FlushInterval, if set, bounds how long rows consumed by Run wait
+	// for their batch to fill before being written anyway.
+	FlushInterval time.Duration
+
+	// FinalFlushTimeout bounds the flush of the pending rows when the
+	// context of Run is done, which cannot be made with that context. It
+	// defaults to DefaultSQLSinkFinalFlushTimeout.
+	FinalFlushTimeout time.Duration
+
+	// Placeholder renders the nth (from 1) bind parameter. It defaults
+	// to PostgreSQL's $n; use QuestionPlaceholder for SQLite.
+	Placeholder func(n int) string
+
+	// Clock drives FlushInterval and FinalFlushTimeout. It defaults to
+	// SystemClock.
+	Clock Clock
+}
+
+// QuestionPlaceholder renders bind parameters as ?, for drivers other
+// than PostgreSQL's.
+func QuestionPlaceholder(int) string { return "?" }
+
+// sqlSinkColumn is a written column: its index in the result rows and
+// its name in the table.
+type sqlSinkColumn struct {
+	index int
+	name  string
+}
+
+// SQLSink materializes result rows into a table of a database/sql
+// database with batched upserts (INSERT ... ON CONFLICT, as understood by
+// PostgreSQL and SQLite). It is a RowSink, so that it can be fed by
+// CopyRows or an export, and consumes hub subscriptions with Run.
+//
+// Rows are buffered until a batch is full or Flush is called. Values are
+// converted as for database/sql (see Rows.DriverRows): composite values
+// are written as JSON. Tombstones delete their key from the table, which
+// requires KeyColumns whatever the ConflictStrategy.
+type SQLSink struct {
+	db      *sql.DB
+	opts    SQLSinkOptions
+	columns []sqlSinkColumn
+	pending []Row
+}
+
+// NewSQLSink creates an SQLSink writing to db.
+func NewSQLSink(db *sql.DB, opts SQLSinkOptions) (*SQLSink, error) {
+	if opts.Table == "" {
+		return nil, fmt.Errorf("creating sql sink: no table")
+	}
+	if len(opts.KeyColumns) == 0 && opts.Conflict != ConflictError {
+		return nil, fmt.Errorf("creating sql sink for %s: upserts require key columns", opts.Table)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultSQLSinkBatchSize
+	}
+	if opts.Placeholder == nil {
+		opts.Placeholder = func(n int) string { return fmt.Sprintf("$%d", n) }
+	}
+	if opts.FinalFlushTimeout <= 0 {
+		opts.FinalFlushTimeout = DefaultSQLSinkFinalFlushTimeout
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	return &SQLSink{db: db, opts: opts}, nil
+}
+
+// WriteHeader implements RowSink, mapping the columns to the table's.
+// Without columns, they are mapped from the first row.
+func (ss *SQLSink) WriteHeader(columns []Column) error {
+	if len(columns) == 0 {
+		return nil
+	}
+	ss.columns = ss.columns[:0]
+	for i, col := range columns {
+		name := strings.ToLower(col.Name)
+		if ss.opts.Columns != nil {
+			var ok bool
+			if name, ok = ss.opts.Columns[col.Name]; !ok {
+				continue
+			}
+		}
+		ss.columns = append(ss.columns, sqlSinkColumn{index: i, name: name})
+	}
+	if len(ss.columns) == 0 {
+		return fmt.Errorf("writing to %s: no columns mapped", ss.opts.Table)
+	}
+	return nil
+}
+
+// WriteRow implements RowSink. It writes the pending batch once it is
+// full.
+func (ss *SQLSink) WriteRow(row Row) error {
+	return ss.writeRow(context.Background(), row)
+}
+
+// writeRow is WriteRow with a context for the writes.
+func (ss *SQLSink) writeRow(ctx context.Context, row Row) error {
+	if len(ss.columns) == 0 {
+		if err := ss.WriteHeader(row.Columns); err != nil {
+			return err
+		}
+	}
+	ss.pending = append(ss.pending, row)
+	if len(ss.pending) >= ss.opts.BatchSize {
+		return ss.flush(ctx)
+	}
+	return nil
+}
+
+// Flush implements RowSink, writing the pending rows.
+func (ss *SQLSink) Flush() error {
+	return ss.flush(context.Background())
+}
+
+// flush writes the pending rows: the keys deleted by tombstones in a
+// single DELETE, then the other rows in a single upsert, together in a
+// transaction.
+func (ss *SQLSink) flush(ctx context.Context) error {
+	if len(ss.pending) == 0 {
+		return nil
+	}
+	var rows, deletes [][]interface{}
+	upserted := make(map[string][]int)
+	deleted := make(map[string]bool)
+	for _, row := range ss.pending {
+		values := make([]interface{}, len(ss.columns))
+		for i, col := range ss.columns {
+			var value interface{}
+			if col.index < len(row.Values) {
+				value = row.Values[col.index]
+			}
+			dv, err := driverValue(value)
+			if err != nil {
+				return fmt.Errorf("writing to %s: column %s: %w", ss.opts.Table, col.name, err)
+			}
+			values[i] = dv
+		}
+		key, ok := ss.key(values)
+		if row.Tombstone {
+			if !ok {
+				return fmt.Errorf("writing to %s: deletes require key columns", ss.opts.Table)
+			}
+			// The delete supersedes the key's earlier rows in the batch,
+			// and precedes its later ones, as DELETE runs first.
+			for _, i := range upserted[key] {
+				rows[i] = nil
+			}
+			delete(upserted, key)
+			if !deleted[key] {
+				deleted[key] = true
+				deletes = append(deletes, ss.keyValues(values))
+			}
+			continue
+		}
+		// An upsert cannot affect the same row twice, so only the latest
+		// row of each key in the batch is written.
+		if seen := upserted[key]; ok && len(seen) > 0 && ss.opts.Conflict != ConflictError {
+			rows[seen[0]] = values
+			continue
+		}
+		if ok {
+			upserted[key] = append(upserted[key], len(rows))
+		}
+		rows = append(rows, values)
+	}
+
+	var upserts [][]interface{}
+	for _, values := range rows {
+		if values != nil {
+			upserts = append(upserts, values)
+		}
+	}
+	if err := ss.exec(ctx, deletes, upserts); err != nil {
+		return fmt.Errorf("writing %d rows to %s: %w", len(ss.pending), ss.opts.Table, err)
+	}
+	ss.pending = ss.pending[:0]
+	return nil
+}
+
+// exec runs the DELETE of the keys and the upsert of the rows, in a
+// transaction if both are needed.
+func (ss *SQLSink) exec(ctx context.Context, keys, rows [][]interface{}) error {
+	type execer interface {
+		ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	}
+	var db execer = ss.db
+	var tx *sql.Tx
+	if len(keys) > 0 && len(rows) > 0 {
+		var err error
+		if tx, err = ss.db.BeginTx(ctx, nil); err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		db = tx
+	}
+	if len(keys) > 0 {
+		if _, err := db.ExecContext(ctx, ss.deleteStatement(len(keys)), flatten(keys)...); err != nil {
+			return err
+		}
+	}
+	if len(rows) > 0 {
+		if _, err := db.ExecContext(ctx, ss.statement(len(rows)), flatten(rows)...); err != nil {
+			return err
+		}
+	}
+	if tx != nil {
+		return tx.Commit()
+	}
+	return nil
+}
+
+// flatten concatenates the values of rows into bind parameters.
+func flatten(rows [][]interface{}) []interface{} {
+	var args []interface{}
+	for _, values := range rows {
+		args = append(args, values...)
+	}
+	return args
+}
+
+// statement renders the upsert of n rows.
+func (ss *SQLSink) statement(n int) string {
+	names := make([]string, len(ss.columns))
+	for i, col := range ss.columns {
+		names[i] = col.name
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "INSERT INTO %s (%s) VALUES ", ss.opts.Table, strings.Join(names, ", "))
+	param := 1
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteByte('(')
+		for j := range ss.columns {
+			if j > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(ss.opts.Placeholder(param))
+			param++
+		}
+		sb.WriteByte(')')
+	}
+
+	keys := strings.Join(ss.opts.KeyColumns, ", ")
+	switch ss.opts.Conflict {
+	case ConflictIgnore:
+		fmt.Fprintf(&sb, " ON CONFLICT (%s) DO NOTHING", keys)
+	case ConflictUpdate:
+		var sets []string
+		for _, name := range names {
+			if !ss.isKey(name) {
+				sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", name, name))
+			}
+		}
+		if len(sets) == 0 {
+			fmt.Fprintf(&sb, " ON CONFLICT (%s) DO NOTHING", keys)
+		} else {
+			fmt.Fprintf(&sb, " ON CONFLICT (%s) DO UPDATE SET %s", keys, strings.Join(sets, ", "))
+		}
+	}
+	return sb.String()
+}
+
+// deleteStatement renders the DELETE of n keys, each matched on the key
+// columns in their order in KeyColumns.
+func (ss *SQLSink) deleteStatement(n int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "DELETE FROM %s WHERE ", ss.opts.Table)
+	param := 1
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			sb.WriteString(" OR ")
+		}
+		sb.WriteByte('(')
+		for j, key := range ss.opts.KeyColumns {
+			if j > 0 {
+				sb.WriteString(" AND ")
+			}
+			fmt.Fprintf(&sb, "%s = %s", key, ss.opts.Placeholder(param))
+			param++
+		}
+		sb.WriteByte(')')
+	}
+	return sb.String()
+}
+
+// keyValues returns the values of the key columns among a row's values,
+// in their order in KeyColumns.
+func (ss *SQLSink) keyValues(values []interface{}) []interface{} {
+	keys := make([]interface{}, len(ss.opts.KeyColumns))
+	for i, key := range ss.opts.KeyColumns {
+		for j, col := range ss.columns {
+			if strings.EqualFold(key, col.name) {
+				keys[i] = values[j]
+				break
+			}
+		}
+	}
+	return keys
+}
+
+// key renders the key of a row's values, if the key columns are all
+// mapped.
+func (ss *SQLSink) key(values []interface{}) (string, bool) {
+	var sb strings.Builder
+	found := 0
+	for i, col := range ss.columns {
+		if ss.isKey(col.name) {
+			fmt.Fprintf(&sb, "%q,", fmt.Sprint(values[i]))
+			found++
+		}
+	}
+	return sb.String(), found == len(ss.opts.KeyColumns) && found > 0
+}
+
+// isKey reports whether the table column is one of the key columns.
+func (ss *SQLSink) isKey(name string) bool {
+	for _, key := range ss.opts.KeyColumns {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run writes the subscription's rows until it ends or ctx is done,
+// flushing whenever a batch fills or FlushInterval passes. Pending rows
+// are flushed before returning, within FinalFlushTimeout once ctx is
+// done; the error is the subscription's, if it ended with one.
+func (ss *SQLSink) Run(ctx context.Context, sub *Subscription) error {
+	var tick <-chan time.Time
+	if ss.opts.FlushInterval > 0 {
+		ticker := ss.opts.Clock.NewTicker(ss.opts.FlushInterval)
+		defer ticker.Stop()
+		tick = ticker.C()
+	}
+	for {
+		select {
+		case row, ok := <-sub.C:
+			if !ok {
+				if err := ss.flush(ctx); err != nil {
+					return err
+				}
+				return sub.Err()
+			}
+			if err := ss.writeRow(ctx, row); err != nil {
+				return err
+			}
+		case <-tick:
+			if err := ss.flush(ctx); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			// The context is done, so the last batch is written without it,
+			// for as long as FinalFlushTimeout.
+			flushCtx, cancel := withTimeout(context.Background(), ss.opts.Clock, ss.opts.FinalFlushTimeout)
+			err := ss.flush(flushCtx)
+			cancel()
+			if err != nil {
+				return err
+			}
+			return ctx.Err()
+		}
+	}
+}
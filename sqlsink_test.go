@@ -0,0 +1,194 @@
+package ksqldb_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hews.co/ksqldb"
+	"hews.co/ksqldb/pkg/ksqldbtest"
+)
+
+func TestSQLSinkTombstones(t *testing.T) {
+	db, rec := openRecorder()
+	defer db.Close()
+	sink, err := ksqldb.NewSQLSink(db, ksqldb.SQLSinkOptions{
+		Table:       "accounts",
+		KeyColumns:  []string{"id"},
+		Placeholder: ksqldb.QuestionPlaceholder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := []ksqldb.Column{{Name: "ID", Type: "STRING", Key: true}, {Name: "BALANCE", Type: "BIGINT"}}
+	upsert := func(id string, balance int64) ksqldb.Row {
+		return ksqldb.Row{Columns: columns, Values: []interface{}{id, balance}}
+	}
+	tombstone := func(id string) ksqldb.Row {
+		return ksqldb.Row{Columns: columns, Values: []interface{}{id, nil}, Tombstone: true}
+	}
+	for _, row := range []ksqldb.Row{
+		upsert("a", 1),
+		upsert("b", 2),
+		tombstone("a"),
+		upsert("c", 3),
+		tombstone("b"),
+		upsert("b", 4),
+		upsert("c", 5),
+	} {
+		if err := sink.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"BEGIN",
+		"DELETE FROM accounts WHERE (id = ?) OR (id = ?) [a b]",
+		"INSERT INTO accounts (id, balance) VALUES (?, ?), (?, ?) ON CONFLICT (id) DO UPDATE SET balance = EXCLUDED.balance [c 5 b 4]",
+		"COMMIT",
+	}
+	if got := rec.log(); !reflect.DeepEqual(got, want) {
+		t.Errorf("statements:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// A batch of deletes alone needs no transaction.
+	if err := sink.WriteRow(tombstone("c")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, "DELETE FROM accounts WHERE (id = ?) [c]")
+	if got := rec.log(); !reflect.DeepEqual(got, want) {
+		t.Errorf("statements:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSQLSinkRunBoundsFinalFlush(t *testing.T) {
+	db, rec := openRecorder()
+	defer db.Close()
+	clock := ksqldbtest.NewManualClock(time.Unix(0, 0))
+	sink, err := ksqldb.NewSQLSink(db, ksqldb.SQLSinkOptions{
+		Table:             "accounts",
+		KeyColumns:        []string{"id"},
+		FinalFlushTimeout: time.Minute,
+		Clock:             clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := make(chan ksqldb.Row)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- sink.Run(ctx, &ksqldb.Subscription{C: rows}) }()
+
+	rec.mu.Lock()
+	rec.hang = true
+	rec.mu.Unlock()
+	rows <- ksqldb.Row{
+		Columns: []ksqldb.Column{{Name: "ID", Type: "STRING"}},
+		Values:  []interface{}{"a"},
+	}
+	cancel()
+	waitFor(t, func() bool { return clock.Waiters() == 1 })
+	select {
+	case err := <-done:
+		t.Fatalf("Run returned %v before the final flush timed out", err)
+	default:
+	}
+	clock.Advance(time.Minute)
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Run() = %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return once the final flush timed out")
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a while.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// recorder is a database/sql driver logging the statements run through
+// it, for tests. Statements block while hang is set, until their context
+// is done.
+type recorder struct {
+	mu         sync.Mutex
+	statements []string
+	hang       bool
+}
+
+// openRecorder opens a database backed by a new recorder.
+func openRecorder() (*sql.DB, *recorder) {
+	rec := &recorder{}
+	return sql.OpenDB(rec), rec
+}
+
+func (rec *recorder) record(statement string) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.statements = append(rec.statements, statement)
+}
+
+func (rec *recorder) log() []string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]string(nil), rec.statements...)
+}
+
+func (rec *recorder) Connect(context.Context) (driver.Conn, error) { return recorderConn{rec}, nil }
+func (rec *recorder) Driver() driver.Driver                        { return nil }
+
+type recorderConn struct{ rec *recorder }
+
+func (rc recorderConn) Prepare(string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("recorder: statements are not prepared")
+}
+func (rc recorderConn) Close() error { return nil }
+func (rc recorderConn) Begin() (driver.Tx, error) {
+	rc.rec.record("BEGIN")
+	return rc, nil
+}
+func (rc recorderConn) Commit() error {
+	rc.rec.record("COMMIT")
+	return nil
+}
+func (rc recorderConn) Rollback() error {
+	rc.rec.record("ROLLBACK")
+	return nil
+}
+
+func (rc recorderConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	rc.rec.mu.Lock()
+	hang := rc.rec.hang
+	rc.rec.mu.Unlock()
+	if hang {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	rc.rec.record(fmt.Sprintf("%s %v", query, values))
+	return driver.RowsAffected(len(args)), nil
+}
@@ -0,0 +1,37 @@
+package ksqldb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"hews.co/ksqldb/pkg/ksqldbapi"
+)
+
+// runStatement executes the given KSQL on the /ksql endpoint, reads the
+// whole response and splits it into its per-statement entities. Any
+// non-2xx status is returned as a *ResponseError, previewing the body.
+func (cc *Client) runStatement(ctx context.Context, ksql string, props map[string]string) ([]json.RawMessage, error) {
+	rh, err := cc.do(ctx, newResource(&ksqldbapi.EndpointRunStatement, ksql, props))
+	if err != nil {
+		return nil, err
+	}
+	defer rh.Close()
+
+	byt, err := rh.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("running ksql statement: %w", err)
+	}
+	if rh.StatusCode < http.StatusOK || rh.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("running ksql statement: %w", rh.responseError(byt, nil))
+	}
+
+	var entities []json.RawMessage
+	if err := json.Unmarshal(byt, &entities); err != nil {
+		decErr := newDecodeError(byt, err)
+		decErr.Type = "entities"
+		return nil, fmt.Errorf("running ksql statement: %w", rh.responseError(byt, decErr))
+	}
+	return entities, nil
+}
@@ -0,0 +1,121 @@
+package ksqldb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// StatementResult is the result of one statement of a /ksql request,
+// which answers with one entity per statement. The field of the entity's
+// type is set; entities of other types are only available Raw.
+type StatementResult struct {
+	// Type is the entity's @type, eg. "currentStatus" or "streams".
+	Type          string
+	StatementText string
+	Warnings      []StatementWarning
+
+	Status   *CurrentStatus       // currentStatus: DDL, persistent queries
+	Streams  []SourceInfo         // streams: SHOW STREAMS
+	Tables   []SourceInfo         // tables: SHOW TABLES
+	Queries  []RunningQuery       // queries: SHOW QUERIES
+	Source   *SourceDescription   // sourceDescription: DESCRIBE
+	Query    *QueryDescription    // queryDescription: EXPLAIN
+	Function *FunctionDescription // describe_function: DESCRIBE FUNCTION
+
+	// Raw is the entity as sent.
+	Raw json.RawMessage
+}
+
+// DecodeStatementResults splits the body of a /ksql response into the
+// results of its statements, in order:
+//
+//	byt, err := rh.ReadAll()
+//	...
+//	results, err := ksqldb.DecodeStatementResults(byt)
+func DecodeStatementResults(body []byte) ([]StatementResult, error) {
+	var entities []json.RawMessage
+	if err := json.Unmarshal(body, &entities); err != nil {
+		decErr := newDecodeError(body, err)
+		decErr.Type = "entities"
+		return nil, decErr
+	}
+	return decodeStatementResults(entities)
+}
+
+// decodeStatementResults types the entities of a /ksql response.
+func decodeStatementResults(entities []json.RawMessage) ([]StatementResult, error) {
+	results := make([]StatementResult, len(entities))
+	for i, raw := range entities {
+		if err := results[i].decode(raw); err != nil {
+			return nil, fmt.Errorf("statement %d: %w", i+1, err)
+		}
+	}
+	return results, nil
+}
+
+// decode types an entity.
+func (sr *StatementResult) decode(raw json.RawMessage) error {
+	var entity struct {
+		Type          string             `json:"@type"`
+		StatementText string             `json:"statementText"`
+		Warnings      []StatementWarning `json:"warnings"`
+		Streams       []SourceInfo       `json:"streams"`
+		Tables        []SourceInfo       `json:"tables"`
+		Queries       []RunningQuery     `json:"queries"`
+		Source        *SourceDescription `json:"sourceDescription"`
+		Query         *QueryDescription  `json:"queryDescription"`
+	}
+	err := json.Unmarshal(raw, &entity)
+	if err == nil {
+		*sr = StatementResult{
+			Type:          entity.Type,
+			StatementText: entity.StatementText,
+			Warnings:      entity.Warnings,
+			Raw:           raw,
+		}
+		for i := range sr.Warnings {
+			sr.Warnings[i].StatementText = entity.StatementText
+		}
+		switch entity.Type {
+		case "currentStatus":
+			sr.Status = new(CurrentStatus)
+			if err = json.Unmarshal(raw, sr.Status); err == nil {
+				sr.Status.Warnings = sr.Warnings
+			}
+		case "streams":
+			sr.Streams = entity.Streams
+		case "tables":
+			sr.Tables = entity.Tables
+		case "queries":
+			sr.Queries = entity.Queries
+		case "sourceDescription":
+			sr.Source = entity.Source
+		case "queryDescription":
+			sr.Query = entity.Query
+		case "describe_function":
+			sr.Function = new(FunctionDescription)
+			err = json.Unmarshal(raw, sr.Function)
+		}
+	}
+	if err != nil {
+		decErr := newDecodeError(raw, err)
+		decErr.Type = "entity"
+		return decErr
+	}
+	return nil
+}
+
+// Execute runs one or more statements on /ksql, returning the result of
+// each in order.
+func (cc *Client) Execute(ctx context.Context, ksql string, props map[string]string) ([]StatementResult, error) {
+	entities, err := cc.runStatement(ctx, ksql, props)
+	if err != nil {
+		return nil, err
+	}
+	results, err := decodeStatementResults(entities)
+	if err != nil {
+		return nil, fmt.Errorf("running ksql statement: %w", err)
+	}
+	return results, nil
+}
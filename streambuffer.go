@@ -0,0 +1,106 @@
+package ksqldb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrStreamOverflow ends the reading of a response whose consumer fell
+// behind by more than its StreamBuffer, under BufferCancel.
+var ErrStreamOverflow = errors.New("ksqldb: stream consumer fell behind its buffer")
+
+// BufferPolicy decides what happens to the records of a response that
+// arrive while its StreamBuffer is full.
+type BufferPolicy int
+
+const (
+	// BufferBlock stops reading the body until the consumer catches up,
+	// which holds the server back through the connection.
+	BufferBlock BufferPolicy = iota
+
+	// BufferDropOldest discards the oldest buffered record to make room
+	// for the new one (see Response.Dropped).
+	BufferDropOldest
+
+	// BufferCancel ends the response with ErrStreamOverflow.
+	BufferCancel
+)
+
+// StreamBuffer configures the buffer of records between the reading of
+// a response's body and its consumer (a handler, or Rows), so that a
+// slow consumer does not stall the stream at once.
+type StreamBuffer struct {
+	// Size is the number of records buffered. Without a buffer, the
+	// body is read in lockstep with the consumer, whatever the policy.
+	Size int
+
+	// Policy applies once the buffer is full.
+	Policy BufferPolicy
+}
+
+// streamBufferContext is the context key of WithStreamBuffer.
+type streamBufferContext struct{}
+
+// WithStreamBuffer overrides the client's StreamBuffer for the requests
+// made with ctx, eg. for a single push query.
+func WithStreamBuffer(ctx context.Context, sb StreamBuffer) context.Context {
+	return context.WithValue(ctx, streamBufferContext{}, sb)
+}
+
+// streamBuffer returns the StreamBuffer of a request.
+func (cc *Client) streamBuffer(ctx context.Context) StreamBuffer {
+	if sb, ok := ctx.Value(streamBufferContext{}).(StreamBuffer); ok {
+		return sb
+	}
+	return cc.buffer
+}
+
+// Dropped returns the number of records discarded under
+// BufferDropOldest.
+func (rr *Response) Dropped() int64 {
+	return atomic.LoadInt64(&rr.dropped)
+}
+
+// sendData passes a record on to the consumer, applying the buffer's
+// policy. It reports false if the response must end with
+// ErrStreamOverflow.
+func (rr *Response) sendData(byt []byte) bool {
+	if len(byt) == 0 || bytes.Equal(byt, apiDataDelimiter) {
+		return true
+	}
+	if rr.buffer.Size <= 0 || rr.buffer.Policy == BufferBlock {
+		select {
+		case rr.dataCh <- byt:
+		case <-rr.Context.Done():
+			// The consumer is gone: the reader ends on the next scan.
+		}
+		return true
+	}
+	for {
+		select {
+		case rr.dataCh <- byt:
+			return true
+		default:
+		}
+		if rr.buffer.Policy == BufferCancel {
+			return false
+		}
+		select {
+		case <-rr.dataCh:
+			if atomic.AddInt64(&rr.dropped, 1) == 1 {
+				rr.logger.Log("stream consumer fell behind, dropping records", "buffer", rr.buffer.Size)
+			}
+		default:
+		}
+	}
+}
+
+// record returns a scanned record to pass on: the scanner reuses its
+// buffer as soon as it scans on, which it does while the consumer still
+// holds the record, so records are copied. Consumers that are done with
+// records before the next scan read them with ReadStreamingZeroCopy.
+func (rr *Response) record(byt []byte) []byte {
+	return append([]byte(nil), byt...)
+}
@@ -0,0 +1,61 @@
+package ksqldb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// StreamError is an error the server reported inside a streaming
+// response, whose status (200) was sent long before: eg. a push query
+// failing on a record it cannot process. Reading the response stops
+// with it, delivered on Read's error channel.
+type StreamError struct {
+	Type      string `json:"@type"`
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// Error implements error.
+func (se *StreamError) Error() string {
+	if se.ErrorCode != 0 {
+		return fmt.Sprintf("ksqldb stream error %d: %s", se.ErrorCode, se.Message)
+	}
+	return fmt.Sprintf("ksqldb stream error: %s", se.Message)
+}
+
+// streamErrorRecord matches both the error records of the streaming
+// endpoints, and v1 rows carrying an errorMessage.
+type streamErrorRecord struct {
+	StreamError
+	ErrorMessage *StreamError `json:"errorMessage"`
+}
+
+// streamError parses a line of the response body into a StreamError,
+// if it is an error record. Only successful responses are checked: the
+// body of a failed one is its error.
+func (rr *Response) streamError(line []byte) *StreamError {
+	if rr.Response == nil || rr.StatusCode < http.StatusOK || rr.StatusCode >= http.StatusMultipleChoices {
+		return nil
+	}
+	if !bytes.Contains(line, []byte(`"@type"`)) && !bytes.Contains(line, []byte(`"errorMessage"`)) {
+		return nil
+	}
+	byt := trimRecordV1(line)
+	if len(byt) == 0 || byt[0] != '{' {
+		return nil
+	}
+	var rec streamErrorRecord
+	if err := json.Unmarshal(byt, &rec); err != nil {
+		return nil
+	}
+	if rec.ErrorMessage != nil {
+		return rec.ErrorMessage
+	}
+	if strings.HasSuffix(rec.Type, "_error") || rec.ErrorCode != 0 {
+		return &rec.StreamError
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package ksqldb
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// structField is an exported struct field mapped to a column through
+// its `ksql` tag:
+//
+//	type Transaction struct {
+//		AccountID int64  `ksql:"ACCOUNTID,key"`
+//		Amount    int64  `ksql:"AMOUNT"`
+//		Unit      string // maps to the column UNIT, per the case policy
+//		Internal  string `ksql:"-"`
+//	}
+type structField struct {
+	Index []int
+	Name  string
+	Key   bool
+}
+
+// structFieldCache holds the parsed fields of each struct type.
+var structFieldCache sync.Map
+
+// structFields returns the mapped fields of a struct type, following
+// embedded structs.
+func structFields(typ reflect.Type) []structField {
+	if cached, ok := structFieldCache.Load(typ); ok {
+		return cached.([]structField)
+	}
+	fields := collectStructFields(typ, nil)
+	structFieldCache.Store(typ, fields)
+	return fields
+}
+
+// collectStructFields walks a struct type's fields.
+func collectStructFields(typ reflect.Type, index []int) []structField {
+	var fields []structField
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, tagged := field.Tag.Lookup("ksql")
+		if tag == "-" {
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+		if field.Anonymous && !tagged && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, collectStructFields(field.Type, fieldIndex)...)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		sf := structField{Index: fieldIndex, Name: field.Name}
+		parts := strings.Split(tag, ",")
+		if parts[0] != "" {
+			sf.Name = parts[0]
+		}
+		for _, opt := range parts[1:] {
+			if opt == "key" {
+				sf.Key = true
+			}
+		}
+		fields = append(fields, sf)
+	}
+	return fields
+}
@@ -0,0 +1,271 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// KeyFunc extracts the cache key of a table row.
+type KeyFunc func(Row) (string, error)
+
+// KeyColumn is a KeyFunc using the value of the named column.
+func KeyColumn(name string) KeyFunc {
+	return func(row Row) (string, error) {
+		value, ok := row.Get(name)
+		if !ok {
+			return "", fmt.Errorf("row has no key column %s", name)
+		}
+		return fmt.Sprint(value), nil
+	}
+}
+
+// TableCacheOptions configures a TableCache.
+type TableCacheOptions struct {
+	// Strategy and Props are passed on to LoadAndFollow.
+	Strategy ConsistencyStrategy
+	Props    map[string]string
+
+	// Store, if set, persists the cache. On Run, a store holding entries
+	// warms the cache without a snapshot query, and only the changes
+	// made since its checkpoint are read from the changelog. The
+	// checkpoint is the latest ROWTIME applied, which the cache selects
+	// with the table's columns, so that cached rows have a ROWTIME
+	// column of their own.
+	Store CacheStore
+
+	// CheckpointInterval is how often the store is checkpointed. It
+	// defaults to five seconds.
+	CheckpointInterval time.Duration
+}
+
+// TableCacheStats describes the state and freshness of a TableCache.
+type TableCacheStats struct {
+	Entries int
+	Updates int64
+	Deletes int64
+
+	// Ready is set once the initial snapshot has been loaded.
+	Ready bool
+
+	// LastUpdate is when the cache last applied a row, and Staleness how
+	// long ago that was.
+	LastUpdate time.Time
+	Staleness  time.Duration
+}
+
+// TableCache is a local, KTable-like copy of a ksqlDB table: it loads
+// the table and then applies its changelog, deleting keys on tombstones,
+// so that lookups are served from memory instead of pull queries.
+type TableCache struct {
+	client  *Client
+	table   string
+	keyFunc KeyFunc
+	opts    TableCacheOptions
+
+	mu         sync.RWMutex
+	entries    map[string]Row
+	ready      bool
+	updates    int64
+	deletes    int64
+	lastUpdate time.Time
+
+	// Only touched from the goroutine running the cache. warned is set
+	// once a row without ROWTIME has been logged.
+	rowtime        int64
+	lastCheckpoint time.Time
+	warned         bool
+}
+
+// NewTableCache creates a cache of the given table. It is empty until
+// Run is called.
+func NewTableCache(client *Client, table string, keyFunc KeyFunc, opts TableCacheOptions) *TableCache {
+	return &TableCache{
+		client:  client,
+		table:   table,
+		keyFunc: keyFunc,
+		opts:    opts,
+		entries: make(map[string]Row),
+	}
+}
+
+// Run loads and then maintains the cache, until the context is canceled
+// or the changelog fails. Lookups may be made concurrently.
+func (tc *TableCache) Run(ctx context.Context) error {
+	if tc.opts.Store != nil {
+		warm, err := tc.warm()
+		if err != nil {
+			return err
+		}
+		defer tc.checkpoint(true)
+		if warm {
+			return tc.catchUp(ctx)
+		}
+	}
+	return tc.client.LoadAndFollow(ctx, tc.table, FollowHandler{
+		Snapshot: tc.apply,
+		Change:   tc.apply,
+		Ready: func() error {
+			tc.setReady()
+			return nil
+		},
+	}, FollowOptions{Strategy: tc.opts.Strategy, Props: tc.opts.Props, SelectRowTime: true})
+}
+
+// warm loads the store into the cache, reporting whether it held any
+// entries.
+func (tc *TableCache) warm() (bool, error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	checkpoint, err := tc.opts.Store.Load(func(key string, row Row) error {
+		tc.entries[key] = row
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("warming %s cache: %w", tc.table, err)
+	}
+	tc.rowtime = checkpoint
+	tc.lastCheckpoint = tc.client.clock.Now()
+	return len(tc.entries) > 0, nil
+}
+
+// catchUp follows the changelog from the store's checkpoint, replaying
+// it from the start if the store has none.
+func (tc *TableCache) catchUp(ctx context.Context) error {
+	tc.setReady()
+
+	table := tc.client.ident(tc.table)
+	query := fmt.Sprintf("SELECT *, ROWTIME FROM %s EMIT CHANGES;", table)
+	if tc.rowtime > 0 {
+		query = fmt.Sprintf("SELECT *, ROWTIME FROM %s WHERE ROWTIME > %d EMIT CHANGES;", table, tc.rowtime)
+	} else {
+		tc.client.logger.Log("cache store has no checkpoint, replaying the changelog", "table", tc.table)
+	}
+	props := map[string]string{"auto.offset.reset": "earliest"}
+	for name, value := range tc.opts.Props {
+		props[name] = value
+	}
+
+	rows, err := tc.client.Query(ctx, query, props)
+	if err != nil {
+		return fmt.Errorf("following %s: %w", tc.table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := tc.apply(rows.Row()); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("following %s: %w", tc.table, err)
+	}
+	return ctx.Err()
+}
+
+// setReady marks the cache as loaded.
+func (tc *TableCache) setReady() {
+	tc.mu.Lock()
+	tc.ready = true
+	tc.mu.Unlock()
+}
+
+// apply upserts or, for tombstones, deletes a row.
+func (tc *TableCache) apply(row Row) error {
+	key, err := tc.keyFunc(row)
+	if err != nil {
+		return fmt.Errorf("caching %s: %w", tc.table, err)
+	}
+
+	tc.mu.Lock()
+	if row.Tombstone {
+		delete(tc.entries, key)
+		tc.deletes++
+	} else {
+		tc.entries[key] = row
+		tc.updates++
+	}
+	tc.lastUpdate = tc.client.clock.Now()
+	tc.mu.Unlock()
+
+	if tc.opts.Store == nil {
+		return nil
+	}
+	if row.Tombstone {
+		err = tc.opts.Store.Delete(key)
+	} else {
+		err = tc.opts.Store.Put(key, row)
+	}
+	if err != nil {
+		return fmt.Errorf("caching %s: %w", tc.table, err)
+	}
+	if rowtime, ok := rowTime(row); !ok && !tc.warned {
+		tc.warned = true
+		tc.client.logger.Log("cached row has no ROWTIME, the checkpoint cannot advance", "table", tc.table)
+	} else if rowtime > tc.rowtime {
+		tc.rowtime = rowtime
+	}
+	return tc.checkpoint(false)
+}
+
+// checkpoint records the latest ROWTIME applied, at most once per
+// interval unless forced.
+func (tc *TableCache) checkpoint(force bool) error {
+	interval := tc.opts.CheckpointInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	if !force && since(tc.client.clock, tc.lastCheckpoint) < interval {
+		return nil
+	}
+	tc.lastCheckpoint = tc.client.clock.Now()
+	if err := tc.opts.Store.Checkpoint(tc.rowtime); err != nil {
+		return fmt.Errorf("checkpointing %s cache: %w", tc.table, err)
+	}
+	return nil
+}
+
+// Get returns the cached row for a key.
+func (tc *TableCache) Get(key string) (Row, bool) {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	row, ok := tc.entries[key]
+	return row, ok
+}
+
+// Range calls fn for every cached row, in no particular order, until fn
+// returns false. The cache is locked for updates meanwhile, so fn should
+// be quick.
+func (tc *TableCache) Range(fn func(key string, row Row) bool) {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	for key, row := range tc.entries {
+		if !fn(key, row) {
+			return
+		}
+	}
+}
+
+// Len returns the number of cached rows.
+func (tc *TableCache) Len() int {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	return len(tc.entries)
+}
+
+// Stats returns the cache's current statistics.
+func (tc *TableCache) Stats() TableCacheStats {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	stats := TableCacheStats{
+		Entries:    len(tc.entries),
+		Updates:    tc.updates,
+		Deletes:    tc.deletes,
+		Ready:      tc.ready,
+		LastUpdate: tc.lastUpdate,
+	}
+	if !tc.lastUpdate.IsZero() {
+		stats.Staleness = since(tc.client.clock, tc.lastUpdate)
+	}
+	return stats
+}
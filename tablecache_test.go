@@ -0,0 +1,85 @@
+package ksqldb_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"hews.co/ksqldb"
+)
+
+const accountsSchema = "`ID` STRING KEY, `BALANCE` BIGINT, `ROWTIME` BIGINT"
+
+func TestTableCacheRestartsFromCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ksqldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "accounts.jsonl")
+
+	// A cold start loads the table, then follows its changelog.
+	cold := newFakeServer(t, func(ksql string) (fakeQuery, int) {
+		switch ksql {
+		case "SELECT *, ROWTIME FROM accounts;":
+			return fakeQuery{schema: accountsSchema, rows: []string{`["a",1,100]`, `["b",2,200]`}}, 0
+		case "SELECT *, ROWTIME FROM accounts EMIT CHANGES;":
+			return fakeQuery{schema: accountsSchema, push: true, rows: []string{
+				`["c",3,300]`,
+				`tombstone:["a",null,400]`,
+			}}, 0
+		}
+		return fakeQuery{}, 400
+	})
+	runCache(t, cold.client(t, ksqldb.ClientOptions{}), path, func(cache *ksqldb.TableCache) bool {
+		return cache.Stats().Deletes == 1
+	}, "b", "c")
+
+	// A warm restart only reads the changes made since the checkpoint.
+	warm := newFakeServer(t, func(ksql string) (fakeQuery, int) {
+		if ksql == "SELECT *, ROWTIME FROM accounts WHERE ROWTIME > 400 EMIT CHANGES;" {
+			return fakeQuery{schema: accountsSchema, push: true, rows: []string{`["d",4,500]`}}, 0
+		}
+		return fakeQuery{}, 400
+	})
+	runCache(t, warm.client(t, ksqldb.ClientOptions{}), path, func(cache *ksqldb.TableCache) bool {
+		return cache.Len() == 3
+	}, "b", "c", "d")
+	if got, want := warm.queries(), []string{"SELECT *, ROWTIME FROM accounts WHERE ROWTIME > 400 EMIT CHANGES;"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("warm restart sent %q, want %q", got, want)
+	}
+}
+
+// runCache runs a cache of the accounts table stored at path until done
+// holds, and checks its keys.
+func runCache(t *testing.T, client *ksqldb.Client, path string, done func(*ksqldb.TableCache) bool, keys ...string) {
+	t.Helper()
+	store := ksqldb.NewFileStore(path)
+	defer store.Close()
+	cache := ksqldb.NewTableCache(client, "accounts", ksqldb.KeyColumn("ID"), ksqldb.TableCacheOptions{Store: store})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- cache.Run(ctx) }()
+	waitFor(t, func() bool { return done(cache) })
+	cancel()
+	if err := <-result; err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run() = %v", err)
+	}
+
+	var got []string
+	cache.Range(func(key string, row ksqldb.Row) bool {
+		got = append(got, key)
+		return true
+	})
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, keys) {
+		t.Errorf("cached keys %s, want %s", strings.Join(got, ","), strings.Join(keys, ","))
+	}
+}
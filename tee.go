@@ -0,0 +1,52 @@
+package ksqldb
+
+import (
+	"io"
+	"net/http"
+)
+
+// teeResponse copies the body of a response, as it is read, to the
+// writer the client's ResponseTee returns for it, if any.
+func (cc *Client) teeResponse(resp *http.Response) {
+	if cc.responseTee == nil {
+		return
+	}
+	w := cc.responseTee(resp)
+	if w == nil {
+		return
+	}
+	resp.Body = &teeBody{body: resp.Body, w: w, logger: cc.logger}
+}
+
+// teeBody copies a body to w as it is read. Failing writes stop the
+// copy, without failing the reads.
+type teeBody struct {
+	body   io.ReadCloser
+	w      io.Writer
+	logger Logger
+	failed bool
+}
+
+// Read implements io.Reader.
+func (tb *teeBody) Read(p []byte) (int, error) {
+	n, err := tb.body.Read(p)
+	if n > 0 && !tb.failed {
+		if _, werr := tb.w.Write(p[:n]); werr != nil {
+			tb.failed = true
+			tb.logger.Log("response tee failed", "error", werr)
+		}
+	}
+	return n, err
+}
+
+// Close implements io.Closer, closing the writer too if it is an
+// io.Closer.
+func (tb *teeBody) Close() error {
+	err := tb.body.Close()
+	if closer, ok := tb.w.(io.Closer); ok {
+		if cerr := closer.Close(); cerr != nil && !tb.failed {
+			tb.logger.Log("response tee failed", "error", cerr)
+		}
+	}
+	return err
+}
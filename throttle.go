@@ -0,0 +1,114 @@
+package ksqldb
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMaxRetryAfter bounds the waits Retry-After headers ask for, see
+// ClientOptions.MaxRetryAfter.
+const DefaultMaxRetryAfter = time.Minute
+
+// ThrottleStats describes the throttling of the client's requests: the
+// 429 (Too Many Requests) and 503 (Service Unavailable) responses of the
+// server or a gateway in front of it.
+type ThrottleStats struct {
+	// Responses is the number of throttling responses, and Hinted the
+	// number of those with a Retry-After header.
+	Responses int64
+	Hinted    int64
+
+	// Waits is the number of retries that waited longer for a Retry-After
+	// than they would have otherwise, and Waited their total wait.
+	Waits  int64
+	Waited time.Duration
+
+	// Last is when the last throttling response arrived.
+	Last time.Time
+}
+
+// throttleCounters accumulate the ThrottleStats of a client.
+type throttleCounters struct {
+	responses int64
+	hinted    int64
+	waits     int64
+	waited    int64
+	last      int64
+}
+
+// stats returns the counters' current values.
+func (tc *throttleCounters) stats() ThrottleStats {
+	ts := ThrottleStats{
+		Responses: atomic.LoadInt64(&tc.responses),
+		Hinted:    atomic.LoadInt64(&tc.hinted),
+		Waits:     atomic.LoadInt64(&tc.waits),
+		Waited:    time.Duration(atomic.LoadInt64(&tc.waited)),
+	}
+	if last := atomic.LoadInt64(&tc.last); last != 0 {
+		ts.Last = time.Unix(0, last)
+	}
+	return ts
+}
+
+// isThrottling reports whether a response status asks to back off.
+func isThrottling(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
+
+// throttled counts a throttling response, and reports it to the trace
+// and the log. It returns the wait the response's Retry-After asks for,
+// by the client's clock.
+func (cc *Client) throttled(resp *http.Response, trace *ClientTrace) time.Duration {
+	now := cc.clock.Now()
+	hint := retryAfter(resp, now)
+	atomic.AddInt64(&cc.throttle.responses, 1)
+	atomic.StoreInt64(&cc.throttle.last, now.UnixNano())
+	if hint > 0 {
+		atomic.AddInt64(&cc.throttle.hinted, 1)
+	}
+	if trace != nil && trace.Throttled != nil {
+		trace.Throttled(resp, hint)
+	}
+	cc.logger.Log("request throttled", "status", resp.StatusCode, "retry_after", hint)
+	return hint
+}
+
+// retryWait returns the wait before a retry: backoff, or the Retry-After
+// hint if longer, within the client's MaxRetryAfter.
+func (cc *Client) retryWait(backoff, hint time.Duration) time.Duration {
+	if cc.maxRetryAfter < 0 || hint <= backoff {
+		return backoff
+	}
+	if hint > cc.maxRetryAfter {
+		hint = cc.maxRetryAfter
+	}
+	if hint <= backoff {
+		return backoff
+	}
+	atomic.AddInt64(&cc.throttle.waits, 1)
+	atomic.AddInt64(&cc.throttle.waited, int64(hint))
+	return hint
+}
+
+// RetryAfter reports whether err is the server, or a gateway in front of
+// it, throttling the client: a 429 or 503 response, or an *Error matching
+// ErrTooManyRequests or ErrNotReady. It also returns the wait its
+// Retry-After header asked for, if any.
+func RetryAfter(err error) (time.Duration, bool) {
+	var re *ResponseError
+	if errors.As(err, &re) && isThrottling(re.StatusCode) {
+		return re.RetryAfter, true
+	}
+	return 0, errors.Is(err, ErrTooManyRequests) || errors.Is(err, ErrNotReady)
+}
+
+// isRetryable is the default of ReconnectOptions.Retryable: transient
+// errors, and throttling.
+func isRetryable(err error) bool {
+	if _, ok := RetryAfter(err); ok {
+		return true
+	}
+	return IsTransient(err)
+}
@@ -0,0 +1,184 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Topology is a snapshot of the server's streams, tables and persistent
+// queries.
+type Topology struct {
+	Streams []SourceInfo
+	Tables  []SourceInfo
+	Queries []RunningQuery
+}
+
+// Topology lists the server's streams, tables and persistent queries,
+// in a single request.
+func (cc *Client) Topology(ctx context.Context) (*Topology, error) {
+	entities, err := cc.runStatement(ctx, "SHOW STREAMS; SHOW TABLES; SHOW QUERIES;", nil)
+	if err != nil {
+		return nil, fmt.Errorf("listing topology: %w", err)
+	}
+	var topology Topology
+	if err := decodeEntity(entities, "streams", "streams", &topology.Streams); err != nil {
+		return nil, fmt.Errorf("listing topology: %w", err)
+	}
+	if err := decodeEntity(entities, "tables", "tables", &topology.Tables); err != nil {
+		return nil, fmt.Errorf("listing topology: %w", err)
+	}
+	if err := decodeEntity(entities, "queries", "queries", &topology.Queries); err != nil {
+		return nil, fmt.Errorf("listing topology: %w", err)
+	}
+	return &topology, nil
+}
+
+// TopologyChange is the kind of a TopologyEvent.
+type TopologyChange string
+
+// Topology changes.
+const (
+	TopologyCreated      TopologyChange = "created"
+	TopologyDropped      TopologyChange = "dropped"
+	TopologyStateChanged TopologyChange = "state_changed"
+)
+
+// TopologyEvent is a change between two topology snapshots: a stream,
+// table or query created or dropped, or a query changing state.
+type TopologyEvent struct {
+	Change TopologyChange
+
+	// Kind is STREAM, TABLE or QUERY, and Name the source's name or the
+	// query's ID.
+	Kind string
+	Name string
+
+	// Source is set for streams and tables, and Query for queries, as
+	// found in the newer snapshot (the older, if dropped).
+	Source *SourceInfo
+	Query  *RunningQuery
+
+	// PreviousState is the query's state before a state change.
+	PreviousState string
+}
+
+// DiffTopology returns the changes from one topology snapshot to the
+// next, sorted by kind and name.
+func DiffTopology(prev, next *Topology) []TopologyEvent {
+	var events []TopologyEvent
+	events = append(events, diffSources("STREAM", prev.Streams, next.Streams)...)
+	events = append(events, diffSources("TABLE", prev.Tables, next.Tables)...)
+
+	before := make(map[QueryID]RunningQuery, len(prev.Queries))
+	for _, query := range prev.Queries {
+		before[query.ID] = query
+	}
+	after := make(map[QueryID]RunningQuery, len(next.Queries))
+	for _, query := range next.Queries {
+		query := query
+		after[query.ID] = query
+		old, ok := before[query.ID]
+		switch {
+		case !ok:
+			events = append(events, TopologyEvent{Change: TopologyCreated, Kind: "QUERY", Name: string(query.ID), Query: &query})
+		case !strings.EqualFold(old.State, query.State):
+			events = append(events, TopologyEvent{Change: TopologyStateChanged, Kind: "QUERY", Name: string(query.ID), Query: &query, PreviousState: old.State})
+		}
+	}
+	for _, query := range prev.Queries {
+		query := query
+		if _, ok := after[query.ID]; !ok {
+			events = append(events, TopologyEvent{Change: TopologyDropped, Kind: "QUERY", Name: string(query.ID), Query: &query})
+		}
+	}
+
+	kinds := map[string]int{"STREAM": 0, "TABLE": 1, "QUERY": 2}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Kind != events[j].Kind {
+			return kinds[events[i].Kind] < kinds[events[j].Kind]
+		}
+		return events[i].Name < events[j].Name
+	})
+	return events
+}
+
+// diffSources returns the streams or tables created and dropped.
+func diffSources(kind string, prev, next []SourceInfo) []TopologyEvent {
+	var events []TopologyEvent
+	before := make(map[string]bool, len(prev))
+	for _, source := range prev {
+		before[source.Name] = true
+	}
+	after := make(map[string]bool, len(next))
+	for _, source := range next {
+		source := source
+		after[source.Name] = true
+		if !before[source.Name] {
+			events = append(events, TopologyEvent{Change: TopologyCreated, Kind: kind, Name: source.Name, Source: &source})
+		}
+	}
+	for _, source := range prev {
+		source := source
+		if !after[source.Name] {
+			events = append(events, TopologyEvent{Change: TopologyDropped, Kind: kind, Name: source.Name, Source: &source})
+		}
+	}
+	return events
+}
+
+// TopologyWatchOptions configures WatchTopology.
+type TopologyWatchOptions struct {
+	// Interval is the time between snapshots. It defaults to ten
+	// seconds.
+	Interval time.Duration
+
+	// OnError, if set, is passed the errors of failed snapshots. Failed
+	// snapshots are logged, and the watch carries on regardless.
+	OnError func(error)
+}
+
+// WatchTopology snapshots the topology at an interval and passes the
+// changes between snapshots to the handler, for tooling that reacts to
+// streams, tables and queries coming and going. The first snapshot is
+// the baseline, yielding no events. It runs until ctx is done or the
+// handler returns an error, which it returns.
+func (cc *Client) WatchTopology(ctx context.Context, handler func(TopologyEvent) error, opts TopologyWatchOptions) error {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := cc.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	var prev *Topology
+	for {
+		next, err := cc.Topology(ctx)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			cc.logger.Log("topology watch failed", "err", err)
+			if opts.OnError != nil {
+				opts.OnError(err)
+			}
+		case prev == nil:
+			prev = next
+		default:
+			for _, event := range DiffTopology(prev, next) {
+				if err := handler(event); err != nil {
+					return err
+				}
+			}
+			prev = next
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C():
+		}
+	}
+}
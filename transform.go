@@ -0,0 +1,90 @@
+package ksqldb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// ColumnTransform converts a column's value: as rows are read, eg. to
+// decrypt it or to parse JSON embedded in a STRING, or as they are
+// written (see StreamWriter.Transform), eg. to encrypt or tokenize it.
+// NULLs are passed to it too.
+type ColumnTransform func(value interface{}) (interface{}, error)
+
+// columnTransform is a transform registered for a column.
+type columnTransform struct {
+	column string
+	fn     ColumnTransform
+}
+
+// Transform registers a transform for the named column, matched under
+// the client's case policy, applied to every row as it is decoded and
+// before any Filter. Several transforms of a column apply in order. It
+// must be called before the first call to Next, and returns the rows,
+// for chaining.
+func (rs *Rows) Transform(column string, fn ColumnTransform) *Rows {
+	rs.transforms = append(rs.transforms, columnTransform{column: column, fn: fn})
+	return rs
+}
+
+// applyTransforms runs the registered transforms on the current row.
+func (rs *Rows) applyTransforms() error {
+	for _, tr := range rs.transforms {
+		for i, col := range rs.row.Columns {
+			if i >= len(rs.row.Values) || !(col.Name == tr.column || rs.row.policy.Match(tr.column, col.Name)) {
+				continue
+			}
+			value, err := tr.fn(rs.row.Values[i])
+			if err != nil {
+				return &DecodeError{Row: rs.rowNum, Column: col.Name, Type: col.Type, Err: fmt.Errorf("transforming: %w", err)}
+			}
+			rs.row.Values[i] = value
+			break
+		}
+	}
+	return nil
+}
+
+// JSONTransform parses a STRING column holding JSON into a new value of
+// the type v points to, returned as a pointer; eg. with
+// JSONTransform(&Address{}) the column's values become *Address. NULLs
+// stay nil.
+func JSONTransform(v interface{}) ColumnTransform {
+	typ := reflect.TypeOf(v)
+	if typ == nil || typ.Kind() != reflect.Ptr {
+		panic("ksqldb: JSONTransform needs a pointer")
+	}
+	return func(value interface{}) (interface{}, error) {
+		if value == nil {
+			return nil, nil
+		}
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%T is not a JSON string", value)
+		}
+		target := reflect.New(typ.Elem()).Interface()
+		if err := json.Unmarshal([]byte(text), target); err != nil {
+			return nil, err
+		}
+		return target, nil
+	}
+}
+
+// TokenizeTransform replaces values with their HMAC-SHA256 under the
+// key, hex-encoded, for columns holding PII that downstream consumers
+// only need to join or group on. Values are hashed as formatted by
+// fmt.Sprint; NULLs stay NULL.
+func TokenizeTransform(key []byte) ColumnTransform {
+	return func(value interface{}) (interface{}, error) {
+		if value == nil {
+			return nil, nil
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(fmt.Sprint(value)))
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	}
+}
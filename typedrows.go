@@ -0,0 +1,99 @@
+//go:build go1.18
+
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// TypedRows iterates over the rows of a query decoded into values of T,
+// see QueryRows.
+type TypedRows[T any] struct {
+	rows   *Rows
+	mapper *rowMapper
+	value  T
+	err    error
+}
+
+// QueryRows runs a query like Client.Query, decoding each row into a T
+// as it arrives, based on the columns of the response header:
+//
+//	type Pageview struct {
+//		UserID string `ksql:"USERID"`
+//		Views  int64  `ksql:"VIEWS"`
+//	}
+//
+//	rows, err := ksqldb.QueryRows[Pageview](ctx, client, "SELECT * FROM views;", nil)
+//	...
+//	defer rows.Close()
+//	for rows.Next() {
+//		pv := rows.Value()
+//		...
+//	}
+//
+// Structs are decoded field by field, matching columns to fields through
+// their `ksql` tags or names under the client's case policy; columns
+// without a field are skipped, and NULLs leave fields at their zero
+// value. Maps keyed by string take every column, and other types a
+// single column, converted as by Rows.Scan.
+func QueryRows[T any](ctx context.Context, client *Client, ksql string, props map[string]string) (*TypedRows[T], error) {
+	rows, err := client.Query(ctx, ksql, props)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedRows[T]{rows: rows}, nil
+}
+
+// Next advances to the next row and decodes it, returning false when
+// the rows are exhausted or failed (see Err).
+func (tr *TypedRows[T]) Next() bool {
+	if tr.err != nil || !tr.rows.Next() {
+		return false
+	}
+	row := tr.rows.Row()
+	if tr.mapper == nil {
+		var err error
+		if tr.mapper, err = newRowMapper(reflect.TypeOf(&tr.value).Elem(), row.Columns, row.policy); err != nil {
+			tr.fail(err)
+			return false
+		}
+	}
+	var value T
+	if err := tr.mapper.decode(row, reflect.ValueOf(&value).Elem()); err != nil {
+		tr.fail(fmt.Errorf("row %d: %w", tr.rows.rowNum, err))
+		return false
+	}
+	tr.value = value
+	return true
+}
+
+// fail ends the iteration with a decoding error.
+func (tr *TypedRows[T]) fail(err error) {
+	tr.err = fmt.Errorf("decoding rows: %w", err)
+	tr.rows.Close()
+}
+
+// Value returns the current row's value.
+func (tr *TypedRows[T]) Value() T {
+	return tr.value
+}
+
+// Rows returns the underlying rows, eg. for their header or warnings.
+func (tr *TypedRows[T]) Rows() *Rows {
+	return tr.rows
+}
+
+// Err returns the error, if any, that ended the iteration.
+func (tr *TypedRows[T]) Err() error {
+	if tr.err != nil {
+		return tr.err
+	}
+	return tr.rows.Err()
+}
+
+// Close stops reading, canceling the underlying response.
+func (tr *TypedRows[T]) Close() error {
+	return tr.rows.Close()
+}
@@ -0,0 +1,46 @@
+package ksqldb
+
+import (
+	"encoding/json"
+
+	"hews.co/ksqldb/pkg/ksqldbapi"
+)
+
+// StatementWarning is a warning the server attached to the result of a
+// statement, eg. a deprecation notice.
+type StatementWarning struct {
+	Message string `json:"message"`
+
+	// StatementText is the statement warned about, if the server told.
+	StatementText string `json:"-"`
+}
+
+// Warnings returns the warnings of the statements of a /ksql response,
+// once read with ReadAll. They are logged to the client's Logger too.
+func (rr *Response) Warnings() []StatementWarning {
+	return rr.warnings
+}
+
+// readWarnings collects the warnings of a /ksql response's entities, and
+// logs them.
+func (rr *Response) readWarnings(body []byte) {
+	if rr.Response == nil || rr.Request == nil || rr.Request.URL.Path != ksqldbapi.EndpointRunStatement.Path || failed(rr.Response) {
+		return
+	}
+	var entities []struct {
+		StatementText string             `json:"statementText"`
+		Warnings      []StatementWarning `json:"warnings"`
+	}
+	if err := json.Unmarshal(body, &entities); err != nil {
+		return
+	}
+	for _, entity := range entities {
+		for _, warning := range entity.Warnings {
+			warning.StatementText = entity.StatementText
+			rr.warnings = append(rr.warnings, warning)
+			if rr.logger != nil {
+				rr.logger.Log("statement warning", "statement", warning.StatementText, "message", warning.Message)
+			}
+		}
+	}
+}
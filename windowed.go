@@ -0,0 +1,38 @@
+package ksqldb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"hews.co/ksqldb/pkg/ksql"
+)
+
+// QueryWindowed runs a pull query against a windowed table, selecting
+// the windows in [from, to) with predicates suited to the table's window
+// type (see ksql.WindowRange). The window type is looked up with
+// DESCRIBE; non-windowed tables are an error. The where argument holds
+// any other predicates, usually on the key, and may be empty.
+func (cc *Client) QueryWindowed(ctx context.Context, table, where string, from, to time.Time, props map[string]string) (*Rows, error) {
+	sd, err := cc.Describe(ctx, table)
+	if err != nil {
+		return nil, fmt.Errorf("querying windowed table: %w", err)
+	}
+	if sd.WindowType == "" {
+		return nil, fmt.Errorf("querying windowed table: %s is not windowed", table)
+	}
+	window := ksql.WindowRange{
+		Type: ksql.WindowType(strings.ToUpper(sd.WindowType)),
+		From: from,
+		To:   to,
+	}
+	predicate, err := window.Predicate()
+	if err != nil {
+		return nil, fmt.Errorf("querying windowed table: %w", err)
+	}
+	if where = strings.TrimSpace(where); where != "" {
+		predicate = fmt.Sprintf("(%s) AND %s", where, predicate)
+	}
+	return cc.Query(ctx, fmt.Sprintf("SELECT * FROM %s WHERE %s;", cc.ident(table), predicate), props)
+}